@@ -1,12 +1,29 @@
 package main
 
 import (
+	"context"
+	orderController "fintech/controllers/orders"
+	userController "fintech/controllers/users"
+	"fintech/middlewares"
+	"fintech/pkg/gst"
+	"fintech/pkg/messaging"
+	"fintech/pkg/oidc"
+	"fintech/pkg/otp"
+	"fintech/pkg/payments"
+	"fintech/pkg/ratelimit"
+	"fintech/pkg/storage"
+	"fintech/pkg/totp"
 	"fintech/pkg/vdo"
+	"fintech/routes/audit"
 	"fintech/routes/auth"
 	"fintech/routes/chat"
 	"fintech/routes/courses"
+	"fintech/routes/finance"
 	"fintech/routes/folders"
+	"fintech/routes/orders"
+	"fintech/routes/users"
 	"fintech/store/mysql"
+	"fintech/utils"
 	"fmt"
 	"log"
 	"os"
@@ -25,6 +42,23 @@ func main() {
 		log.Fatalf("Error loading .env file")
 	}
 
+	// Refuse to start without a key to sign tokens with
+	if err := utils.LoadKeysFromEnv(); err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	// or to hash OTPs with
+	otpConfig, err := otp.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure OTPs: %v", err)
+	}
+
+	// or to seal authenticator secrets with
+	totpConfig, err := totp.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure TOTP: %v", err)
+	}
+
 	// Connect to the database
 	db, err := sqlx.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
 		os.Getenv("DB_USER"),
@@ -51,16 +85,61 @@ func main() {
 
 	// Disable proxy trusting by passing an empty slice
 	r.SetTrustedProxies(nil)
+	r.Use(middlewares.RequestID())
 
 	mysqlStore := mysql.NewMySQLStore(db)
 
+	// Promote the configured phone number when the platform has no admin yet
+	err = userController.BootstrapAdmin(context.Background(), mysqlStore, os.Getenv("ADMIN_BOOTSTRAP_PHONE"))
+	if err != nil {
+		log.Fatalf("Failed to bootstrap admin: %v", err)
+	}
+
 	vdo := vdo.NewVideoCipherClient()
 
+	otpSender, err := messaging.NewOTPSenderFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure OTP sender: %v", err)
+	}
+
+	oidcProviders, err := oidc.ProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure OIDC providers: %v", err)
+	}
+
+	blobs, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure storage: %v", err)
+	}
+
+	limiter, err := ratelimit.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure rate limiting: %v", err)
+	}
+
+	gateway, err := payments.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure payment gateway: %v", err)
+	}
+
+	tax, err := gst.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure GST: %v", err)
+	}
+
+	// Apply payment webhooks in the background
+	webhooks := orderController.NewWebhookWorker(mysqlStore, gateway, tax)
+	go webhooks.Run(context.Background())
+
 	// Set up routes
-	auth.AuthRoutes(r, mysqlStore)
+	auth.AuthRoutes(r, mysqlStore, otpSender, otpConfig, totpConfig, oidcProviders, limiter)
 	courses.CourseRoutes(r, mysqlStore, vdo)
-	folders.FolderRoutes(r, mysqlStore, vdo)
-	chat.ChatRoutes(r, mysqlStore)
+	folders.FolderRoutes(r, mysqlStore, vdo, limiter)
+	chat.ChatRoutes(r, mysqlStore, limiter)
+	users.UserRoutes(r, mysqlStore, otpSender, otpConfig, blobs, limiter)
+	audit.AuditRoutes(r, mysqlStore)
+	orders.OrderRoutes(r, mysqlStore, gateway, webhooks, tax, blobs, vdo)
+	finance.FinanceRoutes(r, mysqlStore)
 
 	// routes.VideoRoutes(r, db)
 	// routes.UserActionRoutes(r, db)
@@ -0,0 +1,77 @@
+// Command payouts runs the periodic instructor payout calculation, creating
+// a batch for an admin to approve. Run it on the payout schedule, e.g. weekly
+// from cron.
+package main
+
+import (
+	"context"
+	"errors"
+	financeController "fintech/controllers/finance"
+	"fintech/pkg/payouts"
+	"fintech/store/models"
+	"fintech/store/mysql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the payouts without creating a batch")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	db, err := sqlx.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASS"),
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_PORT"),
+		os.Getenv("DB_NAME"),
+	))
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	store := mysql.NewMySQLStore(db)
+	config := payouts.ConfigFromEnv()
+
+	if *dryRun {
+		planned, skipped, err := financeController.PlanPayouts(ctx, store, config, time.Now().Add(-config.Hold))
+		if err != nil {
+			log.Fatalf("Failed to plan payouts: %v", err)
+		}
+		for _, p := range planned {
+			log.Printf("Would pay user %d %d %s by %s", p.UserID, p.AmountMinor, p.Currency, p.Method)
+		}
+		logSkipped(skipped)
+		return
+	}
+
+	batch, skipped, err := financeController.RunPayouts(ctx, store, config, nil, models.AuditEvent{})
+	logSkipped(skipped)
+	if errors.Is(err, financeController.ErrNothingToPay) {
+		log.Printf("No earnings are due to be paid out")
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to run payouts: %v", err)
+	}
+
+	log.Printf("Created payout batch %s with %d payouts, waiting for approval", batch.ID, len(batch.Payouts))
+}
+
+func logSkipped(skipped []payouts.Skipped) {
+	for _, s := range skipped {
+		log.Printf("Skipping user %d: %d %s, %s", s.UserID, s.AmountMinor, s.Currency, s.Reason)
+	}
+}
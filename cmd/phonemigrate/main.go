@@ -0,0 +1,96 @@
+// Command phonemigrate normalizes every stored phone number to E.164 and
+// merges users whose numbers turn out to be the same. Run it once after
+// applying the phone number migration, with -dry-run first to review.
+package main
+
+import (
+	"context"
+	"errors"
+	"fintech/pkg/phone"
+	"fintech/store/models"
+	"fintech/store/mysql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the changes without applying them")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	db, err := sqlx.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASS"),
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_PORT"),
+		os.Getenv("DB_NAME"),
+	))
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	store := mysql.NewMySQLStore(db)
+	parser := phone.ParserFromEnv()
+
+	users, err := store.ListPhoneNumbers(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list users: %v", err)
+	}
+
+	// Group users by normalized number; users are listed oldest first, so
+	// the first user of each group is the one that is kept
+	groups := map[string][]int{}
+	current := map[int]string{}
+	for _, u := range users {
+		e164, err := parser.Normalize(u.Phone())
+		if err != nil {
+			log.Printf("Skipping user %d: %q: %v", u.ID, u.Phone(), err)
+			continue
+		}
+		groups[e164] = append(groups[e164], u.ID)
+		current[u.ID] = u.Phone()
+	}
+
+	numbers := make([]string, 0, len(groups))
+	for n := range groups {
+		numbers = append(numbers, n)
+	}
+	sort.Strings(numbers)
+
+	var updated, merged int
+	for _, n := range numbers {
+		ids := groups[n]
+		keepID, mergeIDs := ids[0], ids[1:]
+		if len(mergeIDs) == 0 && current[keepID] == n {
+			continue
+		}
+
+		log.Printf("User %d: %q -> %q, merging users %v", keepID, current[keepID], n, mergeIDs)
+		if !*dryRun {
+			err := store.MergeUsers(ctx, keepID, mergeIDs, n)
+			if errors.Is(err, models.ErrUserHasPayments) {
+				log.Printf("Skipping user %d: users %v have payments and have to be merged by hand", keepID, mergeIDs)
+				continue
+			}
+			if err != nil {
+				log.Fatalf("Failed to update user %d: %v", keepID, err)
+			}
+		}
+		updated++
+		merged += len(mergeIDs)
+	}
+
+	log.Printf("Updated %d users, merged %d duplicates", updated, merged)
+}
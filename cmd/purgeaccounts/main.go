@@ -0,0 +1,117 @@
+// Command purgeaccounts erases accounts whose deletion grace period has
+// ended and removes expired data exports. Run it periodically, e.g. daily
+// from cron.
+package main
+
+import (
+	"context"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/pkg/storage"
+	"fintech/store/models"
+	"fintech/store/mysql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print what would be deleted without deleting it")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	db, err := sqlx.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASS"),
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_PORT"),
+		os.Getenv("DB_NAME"),
+	))
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	blobs, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure storage: %v", err)
+	}
+
+	ctx := context.Background()
+	store := mysql.NewMySQLStore(db)
+	now := time.Now()
+
+	exports, err := store.ListExpiredDataExports(ctx, now)
+	if err != nil {
+		log.Fatalf("Failed to list expired exports: %v", err)
+	}
+	for _, e := range exports {
+		log.Printf("Deleting export %s of user %d", e.ID, e.UserID)
+		if *dryRun {
+			continue
+		}
+		if err := deleteBlob(ctx, blobs, e.StorageKey); err != nil {
+			log.Fatalf("Failed to delete export %s: %v", e.ID, err)
+		}
+		if err := store.DeleteDataExport(ctx, e.ID); err != nil {
+			log.Fatalf("Failed to delete export %s: %v", e.ID, err)
+		}
+	}
+
+	users, err := store.ListUsersDueForDeletion(ctx, now)
+	if err != nil {
+		log.Fatalf("Failed to list users: %v", err)
+	}
+	deleted := 0
+	for _, u := range users {
+		log.Printf("Deleting user %d, scheduled for %s", u.ID, u.DeletionScheduledAt.Format(time.RFC3339))
+		if *dryRun {
+			continue
+		}
+
+		userID := u.ID
+		keys, err := store.PurgeUser(ctx, u.ID, now, models.AuditEvent{
+			UserID:     &userID,
+			Action:     audit.ActionAccountDeleted,
+			TargetType: "user",
+			TargetID:   strconv.Itoa(u.ID),
+			Details:    audit.Details(map[string]interface{}{"deletion_scheduled_at": u.DeletionScheduledAt}),
+		})
+		if errors.Is(err, models.ErrDeletionNotDue) {
+			log.Printf("Skipping user %d, whose deletion was cancelled", u.ID)
+			continue
+		}
+		if err != nil {
+			log.Fatalf("Failed to delete user %d: %v", u.ID, err)
+		}
+		deleted++
+
+		// Files go once the purge is committed, so a failed purge leaves
+		// the account whole. A file that can't be deleted now has nothing
+		// pointing at it, so it's logged for removing by hand.
+		for _, key := range keys {
+			if err := deleteBlob(ctx, blobs, key); err != nil {
+				log.Printf("Failed to delete file %s of user %d: %v", key, u.ID, err)
+			}
+		}
+	}
+
+	log.Printf("Deleted %d users and %d expired exports", deleted, len(exports))
+}
+
+func deleteBlob(ctx context.Context, blobs storage.Storage, key string) error {
+	if key == "" {
+		return nil
+	}
+	return blobs.Delete(ctx, key)
+}
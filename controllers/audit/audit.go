@@ -0,0 +1,207 @@
+package audit
+
+import (
+	"encoding/csv"
+	"fintech/pkg/audit"
+	"fintech/store"
+	"fintech/store/models"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportPageSize is how many events the CSV export reads at a time
+const exportPageSize = 500
+
+type Controller struct {
+	Store store.Store
+}
+
+// List returns audit events matching the query filters, newest first
+func (controller Controller) List(c *gin.Context) {
+	filter, ok := filterFrom(c)
+	if !ok {
+		return
+	}
+
+	events, err := controller.Store.ListAuditEvents(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// Export streams every audit event matching the query filters as CSV
+func (controller Controller) Export(c *gin.Context) {
+	filter, ok := filterFrom(c)
+	if !ok {
+		return
+	}
+	filter.Limit = exportPageSize
+	filter.Offset = 0
+
+	// Read the first page before committing to a 200
+	events, err := controller.Store.ListAuditEvents(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit events"})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.csv"`, time.Now().Format("2006-01-02")))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "actor_id", "user_id", "action", "target_type", "target_id",
+		"method", "path", "status", "ip", "request_id", "changes", "details", "hash"})
+
+	for len(events) > 0 {
+		for _, e := range events {
+			w.Write([]string{
+				strconv.FormatInt(e.ID, 10),
+				e.CreatedAt.UTC().Format(time.RFC3339Nano),
+				optionalID(e.ActorID),
+				optionalID(e.UserID),
+				cell(e.Action),
+				cell(e.TargetType),
+				cell(e.TargetID),
+				e.Method,
+				cell(e.Path),
+				strconv.Itoa(e.Status),
+				e.IP,
+				cell(e.RequestID),
+				cell(e.Changes),
+				cell(e.Details),
+				e.Hash,
+			})
+		}
+		w.Flush()
+		if w.Error() != nil || len(events) < exportPageSize {
+			return
+		}
+
+		filter.BeforeID = events[len(events)-1].ID
+		events, err = controller.Store.ListAuditEvents(c, filter)
+		if err != nil {
+			// Headers are gone; all that's left is to cut the file short
+			c.Error(err)
+			return
+		}
+	}
+}
+
+// Verify walks the whole hash chain and reports the first event that was
+// altered, removed or inserted out of order
+func (controller Controller) Verify(c *gin.Context) {
+	var prevHash string
+	var lastID int64
+	checked := 0
+
+	for {
+		events, err := controller.Store.ListAuditChain(c, lastID, exportPageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read audit events"})
+			return
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		var badID int64
+		prevHash, badID = audit.Verify(prevHash, events)
+		if badID != 0 {
+			c.JSON(http.StatusOK, VerifyResponse{Valid: false, Checked: checked, FirstInvalidID: badID})
+			return
+		}
+		checked += len(events)
+		lastID = events[len(events)-1].ID
+	}
+
+	// Removing the newest events leaves a valid chain, but not one that ends
+	// where the recorded head does
+	head, err := controller.Store.GetAuditChainHead(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read audit chain"})
+		return
+	}
+	if head != prevHash {
+		c.JSON(http.StatusOK, VerifyResponse{Valid: false, Checked: checked, Truncated: true})
+		return
+	}
+
+	c.JSON(http.StatusOK, VerifyResponse{Valid: true, Checked: checked, Head: head})
+}
+
+// filterFrom reads the audit filters from the query string
+func filterFrom(c *gin.Context) (models.AuditFilter, bool) {
+	filter := models.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		RequestID:  c.Query("request_id"),
+	}
+
+	for param, dest := range map[string]*int{"actor_id": &filter.ActorID, "user_id": &filter.UserID} {
+		if v := c.Query(param); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return filter, false
+			}
+			*dest = id
+		}
+	}
+
+	for param, dest := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC 3339 timestamp"})
+				return filter, false
+			}
+			*dest = &t
+		}
+	}
+
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	return filter, true
+}
+
+func optionalID(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.Itoa(*id)
+}
+
+// cell keeps spreadsheet programs from running user supplied values as formulas
+func cell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+type VerifyResponse struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// FirstInvalidID is the first event whose hash or link doesn't match
+	FirstInvalidID int64 `json:"first_invalid_id,omitempty"`
+	// Truncated means the newest events were removed
+	Truncated bool   `json:"truncated,omitempty"`
+	Head      string `json:"head,omitempty"`
+}
@@ -3,23 +3,37 @@ package auth
 import (
 	"database/sql"
 	"errors"
+	"fintech/pkg/messaging"
+	"fintech/pkg/oidc"
+	"fintech/pkg/otp"
+	"fintech/pkg/phone"
+	"fintech/pkg/totp"
 	"fintech/store"
 	"fintech/store/models"
-	"fintech/utils"
-	"fmt"
 	"log"
-	"math/rand"
+	"math"
 	"net/http"
-	"slices"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Controller struct {
-	Store store.Store
+	Store  store.Store
+	Sender messaging.OTPSender
+	OTP    otp.Config
+	Phone  phone.Parser
+	TOTP   totp.Config
+	OIDC   map[string]*oidc.Provider
 }
 
+const (
+	attemptScopePhone = "phone"
+	attemptScopeIP    = "ip"
+	attemptScopeMFA   = "mfa"
+)
+
 func (controller *Controller) Register(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -27,25 +41,22 @@ func (controller *Controller) Register(c *gin.Context) {
 		return
 	}
 
-	adminPhoneNumbers := []string{"9840091130"}
-
-	role := "user"
-
-	if slices.Contains(adminPhoneNumbers, req.PhoneNumber) {
-		role = "admin"
+	phoneNumber, ok := controller.normalizePhone(c, req.PhoneNumber)
+	if !ok {
+		return
 	}
 
-	user := models.User{
-		PhoneNumber: req.PhoneNumber,
-		Role:        role,
+	code, err := otp.Generate(controller.OTP.Length)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate OTP"})
+		return
 	}
-
-	otp := generateOTP()                            // Generate a random OTP
-	otpExpiry := time.Now().Add(1440 * time.Minute) // Set OTP expiry time
+	otpHash := controller.OTP.Hash(phoneNumber, code)
+	otpExpiry := time.Now().Add(controller.OTP.TTL)
 
 	// Check if user already exists
 	var exists int
-	_, err := controller.Store.GetUserByPhoneNumber(c, user.PhoneNumber)
+	_, err = controller.Store.GetUserByPhoneNumber(c, phoneNumber)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Printf("error is %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user existence"})
@@ -58,23 +69,100 @@ func (controller *Controller) Register(c *gin.Context) {
 	// Insert or update the OTP in the database
 	if exists == 0 {
 		// Example insertion query in Register function
-		err := controller.Store.CreateUser(c, user.PhoneNumber, otp, otpExpiry, user.Role)
+		err := controller.Store.CreateUser(c, phoneNumber, otpHash, otpExpiry)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
 			return
 		}
 	} else {
-		err := controller.Store.UpdateOTP(c, user.PhoneNumber, otp, otpExpiry)
+		err := controller.Store.UpdateOTP(c, phoneNumber, otpHash, otpExpiry)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update OTP"})
 			return
 		}
 	}
 
-	// Send OTP via WhatsApp
-	sendWhatsAppMessage(user.PhoneNumber, otp)
-	c.JSON(http.StatusOK, gin.H{"message": "OTP sent successfully"})
+	// Send OTP through the configured providers, falling back between channels
+	result, err := controller.Sender.SendOTP(c, messaging.OTPMessage{
+		Recipient: messaging.Recipient{PhoneNumber: phoneNumber},
+		Code:      code,
+		ExpiresAt: otpExpiry,
+	})
+	controller.recordDeliveries(c, phoneNumber, result)
+	if err != nil {
+		log.Printf("failed to send OTP: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send OTP"})
+		return
+	}
+
+	delivery, _ := result.Delivered()
+	c.JSON(http.StatusOK, gin.H{"message": "OTP sent successfully", "channel": delivery.Channel})
+}
+
+// DeliveryStatus receives asynchronous delivery reports from OTP providers
+func (controller *Controller) DeliveryStatus(c *gin.Context) {
+	provider := c.Param("provider")
+
+	source, ok := controller.Sender.(messaging.StatusSource)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+		return
+	}
+	parser, ok := source.StatusParser(provider)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+		return
+	}
+
+	// Providers such as WhatsApp verify the callback URL with a GET handshake
+	if c.Request.Method == http.MethodGet {
+		verifier, ok := parser.(messaging.SubscriptionVerifier)
+		if !ok {
+			c.Status(http.StatusMethodNotAllowed)
+			return
+		}
+		challenge, ok := verifier.VerifySubscription(c.Request.URL.Query())
+		if !ok {
+			c.Status(http.StatusForbidden)
+			return
+		}
+		c.String(http.StatusOK, challenge)
+		return
+	}
+
+	updates, err := parser.ParseStatusCallback(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid callback"})
+		return
+	}
+
+	for _, u := range updates {
+		err := controller.Store.UpdateOTPDeliveryStatus(c, provider, u.ProviderMessageID, string(u.Status), u.Error)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update delivery status"})
+			return
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// recordDeliveries stores every delivery attempt so its status can be tracked
+func (controller *Controller) recordDeliveries(c *gin.Context, phoneNumber string, result messaging.Result) {
+	for _, a := range result.Attempts {
+		err := controller.Store.CreateOTPDelivery(c, models.OTPDelivery{
+			PhoneNumber:       phoneNumber,
+			Channel:           string(a.Channel),
+			Provider:          a.Provider,
+			ProviderMessageID: a.ProviderMessageID,
+			Status:            string(a.Status),
+			Error:             a.Error,
+		})
+		if err != nil {
+			log.Printf("failed to record OTP delivery: %v", err)
+		}
+	}
 }
 
 func (controller *Controller) Verify(c *gin.Context) {
@@ -86,10 +174,25 @@ func (controller *Controller) Verify(c *gin.Context) {
 		return
 	}
 
-	u, err := controller.Store.GetUserByPhoneNumber(c, req.PhoneNumber)
+	phoneNumber, ok := controller.normalizePhone(c, req.PhoneNumber)
+	if !ok {
+		return
+	}
+
+	// Refuse to even look at the code while the phone number or IP is locked out
+	subjects := map[string]string{
+		attemptScopePhone: phoneNumber,
+		attemptScopeIP:    c.ClientIP(),
+	}
+	if controller.lockedOut(c, subjects) {
+		return
+	}
+
+	u, err := controller.Store.GetUserByPhoneNumber(c, phoneNumber)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+			controller.recordFailures(c, subjects)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired OTP"})
 			return
 		}
 
@@ -97,41 +200,121 @@ func (controller *Controller) Verify(c *gin.Context) {
 		return
 	}
 
-	// Get stored OTP and its expiry time from the database
-
 	// Check if the OTP matches and if it is not expired
-	if u.OTP != req.OTP || time.Now().After(u.OTPExpiry) {
+	if !controller.OTP.Matches(phoneNumber, req.OTP, u.OTPHash) || time.Now().After(u.OTPExpiry) {
+		controller.recordFailures(c, subjects)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired OTP"})
+		return
+	}
+
+	// Invalidate the code so it can't be used a second time
+	consumed, err := controller.Store.ConsumeOTP(c, u.ID, u.OTPHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify OTP"})
+		return
+	}
+	if !consumed {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired OTP"})
 		return
 	}
 
-	// Generate JWT token for the user with the role (default to "user" if role is not found)
-	token, err := utils.GenerateJWT(u.ID, u.PhoneNumber, u.Role)
+	// Failures from the IP are kept so one valid login can't reset a guessing run
+	err = controller.Store.ResetOTPAttempts(c, attemptScopePhone, phoneNumber)
+	if err != nil {
+		log.Printf("failed to reset OTP attempts: %v", err)
+	}
+
+	// Accounts with an authenticator, or whose role requires one, have to
+	// pass a second factor before getting tokens
+	challenge, err := controller.mfaChallenge(c, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check second factor"})
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	// Start a new session and hand out its first access and refresh tokens
+	resp, err := controller.startSession(c, u)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	// Return the JWT token in the response
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, resp)
 }
 
+// RegisterRequest accepts the phone number in international format or in the
+// national format of PHONE_DEFAULT_REGION
 type RegisterRequest struct {
-	PhoneNumber string `json:"phone_number" validate:"min=10,max=10"`
+	PhoneNumber string `json:"phone_number"`
 }
 
 type VerifyRequest struct {
-	PhoneNumber string `json:"phone_number" validate:"min=10,max=10"`
-	OTP         string `json:"otp" validate:"min=4,max=4"`
+	PhoneNumber string `json:"phone_number"`
+	OTP         string `json:"otp"`
 }
 
-// Generate random OTP
-func generateOTP() string {
-	otp := rand.Intn(10000)         // Generate a random OTP
-	return fmt.Sprintf("%04d", otp) // Format as a 4-digit string
+// normalizePhone parses the phone number to E.164, responding with a
+// country specific error when it isn't valid
+func (controller *Controller) normalizePhone(c *gin.Context, input string) (string, bool) {
+	n, err := controller.Phone.Parse(input)
+	if err != nil {
+		resp := gin.H{"error": err.Error()}
+		var invalid *phone.ValidationError
+		if errors.As(err, &invalid) {
+			resp["country"] = invalid.Country.Code
+		}
+		c.JSON(http.StatusBadRequest, resp)
+		return "", false
+	}
+
+	return n.E164, true
 }
 
-// Send OTP via WhatsApp (dummy implementation, replace with actual sending logic)
-func sendWhatsAppMessage(phone string, otp string) {
-	fmt.Printf("Sending OTP %s to phone number %s via WhatsApp\n", otp, phone)
+// lockedOut responds with 429 when any of the subjects is locked out
+func (controller *Controller) lockedOut(c *gin.Context, subjects map[string]string) bool {
+	for scope, subject := range subjects {
+		retryAfter, err := controller.lockedFor(c, scope, subject)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check verification attempts"})
+			return true
+		}
+		if retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+			return true
+		}
+	}
+	return false
+}
+
+// lockedFor returns how much longer the subject is locked out of verification
+func (controller *Controller) lockedFor(c *gin.Context, scope, subject string) (time.Duration, error) {
+	attempt, err := controller.Store.GetOTPAttempt(c, scope, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if attempt.LockedUntil == nil {
+		return 0, nil
+	}
+	return time.Until(*attempt.LockedUntil), nil
+}
+
+// recordFailures counts a failed verification against every subject and locks
+// them out with exponential backoff once they pass the allowed attempts
+func (controller *Controller) recordFailures(c *gin.Context, subjects map[string]string) {
+	for scope, subject := range subjects {
+		err := controller.Store.RecordOTPFailure(c, scope, subject, controller.OTP.AttemptWindow,
+			controller.OTP.MaxAttempts, controller.OTP.BaseLockout, controller.OTP.MaxLockout)
+		if err != nil {
+			log.Printf("failed to record OTP attempt: %v", err)
+		}
+	}
 }
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"fintech/pkg/audit"
+	"fintech/pkg/rbac"
+	"fintech/store/models"
+	"fintech/utils"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxImpersonationTTL caps how long a single impersonation session can last
+const maxImpersonationTTL = time.Hour
+
+// Impersonate issues a short-lived, read-only token that lets a support
+// admin see the platform exactly as another user does
+func (controller *Controller) Impersonate(c *gin.Context) {
+	actorID := c.MustGet("user_id").(int)
+
+	// Impersonation has to be attributable to a person
+	if _, ok := c.Get("api_key_id"); ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys can't impersonate users"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" || len(reason) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason of at most 500 characters is required"})
+		return
+	}
+
+	ttl := impersonationTTL()
+	if req.Minutes > 0 {
+		ttl = time.Duration(req.Minutes) * time.Minute
+	}
+	if ttl > maxImpersonationTTL {
+		ttl = maxImpersonationTTL
+	}
+
+	if userID == actorID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't impersonate yourself"})
+		return
+	}
+
+	u, err := controller.Store.GetUser(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if u.Kind == models.UserKindService {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service accounts can't be impersonated"})
+		return
+	}
+
+	// Acting as another admin would hand out their privileges
+	grants, err := controller.Store.GetUserGrants(c, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+		return
+	}
+	if rbac.Allows(grants, rbac.UserManage, rbac.Target{}) || rbac.Allows(grants, rbac.UserImpersonate, rbac.Target{}) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admins can't be impersonated"})
+		return
+	}
+
+	session := models.AuthSession{
+		ID:             uuid.NewString(),
+		UserID:         u.ID,
+		ImpersonatorID: &actorID,
+		ExpiresAt:      time.Now().Add(ttl),
+	}
+	err = controller.Store.CreateImpersonationSession(c, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+
+	token, err := utils.GenerateImpersonationJWT(u.ID, actorID, u.Phone(), session.ID, session.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionImpersonationStart, "user", strconv.Itoa(u.ID))
+	event.UserID = &u.ID
+	event.Status = http.StatusOK
+	event.Details = audit.Details(map[string]interface{}{
+		"session_id": session.ID,
+		"reason":     reason,
+		"expires_at": session.ExpiresAt,
+	})
+	audit.Record(c, controller.Store, event)
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"session_id": session.ID,
+		"expires_in": int(ttl.Seconds()),
+	})
+}
+
+// EndImpersonation ends an impersonation session before it expires
+func (controller *Controller) EndImpersonation(c *gin.Context) {
+	session, err := controller.Store.GetAuthSession(c, c.Param("session_id"))
+	if err != nil || session.ImpersonatorID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation session not found"})
+		return
+	}
+
+	err = controller.Store.RevokeAuthSession(c, session.ID, "impersonation_ended")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end impersonation"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionImpersonationEnd, "user", strconv.Itoa(session.UserID))
+	event.UserID = &session.UserID
+	event.Status = http.StatusNoContent
+	event.Details = audit.Details(map[string]interface{}{
+		"session_id":      session.ID,
+		"impersonator_id": *session.ImpersonatorID,
+	})
+	audit.Record(c, controller.Store, event)
+
+	c.Status(http.StatusNoContent)
+}
+
+// impersonationTTL is how long impersonation lasts by default, from IMPERSONATION_TTL
+func impersonationTTL() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("IMPERSONATION_TTL")); err == nil && v > 0 {
+		return v
+	}
+	return 15 * time.Minute
+}
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason"`
+	// Minutes overrides the default duration, up to an hour
+	Minutes int `json:"minutes"`
+}
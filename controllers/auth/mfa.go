@@ -0,0 +1,480 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/pkg/totp"
+	"fintech/store/models"
+	"fintech/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mfaChallengeTTL is how long a user has to enter their second factor
+const mfaChallengeTTL = 5 * time.Minute
+
+// mfaChallenge returns a step-up challenge when the user has to pass a second
+// factor before getting tokens, or nil when the first factor is enough
+func (controller *Controller) mfaChallenge(c *gin.Context, u models.User) (*MFAChallengeResponse, error) {
+	enrolled := false
+	mfa, err := controller.Store.GetUserMFA(c, u.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err == nil {
+		enrolled = mfa.Enrolled()
+	}
+
+	required, err := controller.Store.MFARequired(c, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !enrolled && !required {
+		return nil, nil
+	}
+
+	token, tokenHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = controller.Store.CreateMFAChallenge(c, models.MFAChallenge{
+		TokenHash: tokenHash,
+		UserID:    u.ID,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAChallengeResponse{
+		MFARequired:        true,
+		Challenge:          token,
+		ExpiresIn:          int(mfaChallengeTTL.Seconds()),
+		EnrollmentRequired: !enrolled,
+	}, nil
+}
+
+// EnrollMFAChallenge starts authenticator enrollment for users whose role
+// requires a second factor but who haven't set one up yet
+func (controller *Controller) EnrollMFAChallenge(c *gin.Context) {
+	var req MFAChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	challenge, ok := controller.activeChallenge(c, req.Challenge)
+	if !ok {
+		return
+	}
+
+	u, err := controller.Store.GetUser(c, challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	controller.startEnrollment(c, u)
+}
+
+// VerifyMFA completes a login with a TOTP or recovery code. For users
+// enrolling through the challenge, the first valid code confirms enrollment
+// and the response carries their recovery codes.
+func (controller *Controller) VerifyMFA(c *gin.Context) {
+	var req MFAChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	challenge, ok := controller.activeChallenge(c, req.Challenge)
+	if !ok {
+		return
+	}
+
+	subjects := map[string]string{
+		attemptScopeMFA: strconv.Itoa(challenge.UserID),
+		attemptScopeIP:  c.ClientIP(),
+	}
+	if controller.lockedOut(c, subjects) {
+		return
+	}
+
+	mfa, err := controller.Store.GetUserMFA(c, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Authenticator enrollment has not been started"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get authenticator"})
+		return
+	}
+
+	var recoveryCodes []string
+	if mfa.Enrolled() {
+		ok, err = controller.checkSecondFactor(c, mfa, req.Code, req.RecoveryCode)
+	} else {
+		recoveryCodes, ok, err = controller.confirmEnrollment(c, mfa, req.Code)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		controller.recordFailures(c, subjects)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	consumed, err := controller.Store.ConsumeMFAChallenge(c, challenge.TokenHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !consumed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	err = controller.Store.ResetOTPAttempts(c, attemptScopeMFA, subjects[attemptScopeMFA])
+	if err != nil {
+		log.Printf("failed to reset MFA attempts: %v", err)
+	}
+
+	u, err := controller.Store.GetUser(c, challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	resp, err := controller.startSession(c, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MFATokenResponse{TokenResponse: resp, RecoveryCodes: recoveryCodes})
+}
+
+// MFAStatus reports the caller's second factor setup
+func (controller *Controller) MFAStatus(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+
+	mfa, err := controller.Store.GetUserMFA(c, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get authenticator"})
+		return
+	}
+
+	required, err := controller.Store.MFARequired(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get authenticator"})
+		return
+	}
+
+	remaining, err := controller.Store.CountRecoveryCodes(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get authenticator"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enrolled":                 mfa.Enrolled(),
+		"required":                 required,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// EnrollMFA starts authenticator enrollment for the caller
+func (controller *Controller) EnrollMFA(c *gin.Context) {
+	u, err := controller.Store.GetUser(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	controller.startEnrollment(c, u)
+}
+
+// ConfirmMFA finishes enrollment with a code from the authenticator app
+func (controller *Controller) ConfirmMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	userID := c.MustGet("user_id").(int)
+	subjects := map[string]string{attemptScopeMFA: strconv.Itoa(userID)}
+	if controller.lockedOut(c, subjects) {
+		return
+	}
+
+	mfa, err := controller.Store.GetUserMFA(c, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Authenticator enrollment has not been started"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get authenticator"})
+		return
+	}
+	if mfa.Enrolled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Authenticator is already enrolled"})
+		return
+	}
+
+	recoveryCodes, ok, err := controller.confirmEnrollment(c, mfa, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm authenticator"})
+		return
+	}
+	if !ok {
+		controller.recordFailures(c, subjects)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": recoveryCodes})
+}
+
+// DisableMFA removes the caller's authenticator after checking a current code
+func (controller *Controller) DisableMFA(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+
+	required, err := controller.Store.MFARequired(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get authenticator"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your role requires a second factor"})
+		return
+	}
+
+	if _, ok := controller.requireSecondFactor(c, userID); !ok {
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionUserMFADisable, "user", strconv.Itoa(userID))
+	event.UserID = &userID
+	err = controller.Store.DeleteUserMFA(c, userID, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove authenticator"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes
+func (controller *Controller) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+	if _, ok := controller.requireSecondFactor(c, userID); !ok {
+		return
+	}
+
+	codes, hashes, err := controller.newRecoveryCodes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	err = controller.Store.ReplaceRecoveryCodes(c, userID, hashes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// activeChallenge loads an unused, unexpired challenge, responding when there is none
+func (controller *Controller) activeChallenge(c *gin.Context, token string) (models.MFAChallenge, bool) {
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return models.MFAChallenge{}, false
+	}
+
+	challenge, err := controller.Store.GetMFAChallenge(c, utils.HashToken(token))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get challenge"})
+		return challenge, false
+	}
+	if err != nil || challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return challenge, false
+	}
+
+	return challenge, true
+}
+
+// startEnrollment stores a new secret and responds with the provisioning URI
+func (controller *Controller) startEnrollment(c *gin.Context, u models.User) {
+	mfa, err := controller.Store.GetUserMFA(c, u.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get authenticator"})
+		return
+	}
+	if mfa.Enrolled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Authenticator is already enrolled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	sealed, err := controller.TOTP.Seal(secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	err = controller.Store.StartMFAEnrollment(c, u.ID, sealed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": controller.TOTP.URI(u.Phone(), secret),
+	})
+}
+
+// confirmEnrollment checks a code against a pending secret and, if it
+// matches, confirms it and returns a fresh set of recovery codes
+func (controller *Controller) confirmEnrollment(c *gin.Context, mfa models.UserMFA, code string) ([]string, bool, error) {
+	secret, err := controller.TOTP.Open(mfa.TOTPSecret)
+	if err != nil {
+		return nil, false, err
+	}
+
+	step, ok := controller.TOTP.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, false, nil
+	}
+
+	codes, hashes, err := controller.newRecoveryCodes(mfa.UserID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = controller.Store.ConfirmMFAEnrollment(c, mfa.UserID, step, hashes)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return codes, true, nil
+}
+
+// checkSecondFactor checks a TOTP code, or a recovery code when no TOTP code
+// is given, burning whichever one was used
+func (controller *Controller) checkSecondFactor(c *gin.Context, mfa models.UserMFA, code, recoveryCode string) (bool, error) {
+	if code == "" {
+		if recoveryCode == "" {
+			return false, nil
+		}
+		return controller.Store.UseRecoveryCode(c, mfa.UserID, controller.recoveryCodeHash(mfa.UserID, recoveryCode))
+	}
+
+	secret, err := controller.TOTP.Open(mfa.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := controller.TOTP.Validate(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// A code can only be used once, even within its period
+	return controller.Store.UseTOTPStep(c, mfa.UserID, step)
+}
+
+// requireSecondFactor checks the code in the request body of an enrolled
+// caller, responding when it is missing or wrong
+func (controller *Controller) requireSecondFactor(c *gin.Context, userID int) (models.UserMFA, bool) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return models.UserMFA{}, false
+	}
+
+	subjects := map[string]string{attemptScopeMFA: strconv.Itoa(userID)}
+	if controller.lockedOut(c, subjects) {
+		return models.UserMFA{}, false
+	}
+
+	mfa, err := controller.Store.GetUserMFA(c, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get authenticator"})
+		return mfa, false
+	}
+	if !mfa.Enrolled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No authenticator is enrolled"})
+		return mfa, false
+	}
+
+	ok, err := controller.checkSecondFactor(c, mfa, req.Code, req.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return mfa, false
+	}
+	if !ok {
+		controller.recordFailures(c, subjects)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return mfa, false
+	}
+
+	return mfa, true
+}
+
+func (controller *Controller) newRecoveryCodes(userID int) ([]string, []string, error) {
+	codes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, controller.recoveryCodeHash(userID, code))
+	}
+	return codes, hashes, nil
+}
+
+func (controller *Controller) recoveryCodeHash(userID int, code string) string {
+	return controller.OTP.Hash("recovery:"+strconv.Itoa(userID), totp.NormalizeRecoveryCode(code))
+}
+
+// MFAChallengeResponse is returned by /verify instead of tokens when a second
+// factor is needed
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	Challenge          string `json:"challenge"`
+	ExpiresIn          int    `json:"expires_in"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+}
+
+type MFAChallengeRequest struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFACodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFATokenResponse struct {
+	TokenResponse
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
@@ -0,0 +1,320 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fintech/pkg/oidc"
+	"fintech/store/models"
+	"fintech/utils"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// oidcStateTTL is how long a user has to log in at the identity provider
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCProviders lists the identity providers users can log in with
+func (controller *Controller) OIDCProviders(c *gin.Context) {
+	names := []string{}
+	for name := range controller.OIDC {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// OIDCLogin starts a login with an identity provider and returns the URL to
+// send the user to
+func (controller *Controller) OIDCLogin(c *gin.Context) {
+	controller.startOIDC(c, nil)
+}
+
+// LinkIdentity starts a login with an identity provider that links the
+// identity to the caller instead of logging in
+func (controller *Controller) LinkIdentity(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+	controller.startOIDC(c, &userID)
+}
+
+// OIDCCallback finishes a login with the code and state the identity
+// provider redirected back with
+func (controller *Controller) OIDCCallback(c *gin.Context) {
+	provider, ok := controller.oidcProvider(c)
+	if !ok {
+		return
+	}
+
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" || req.State == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	state, err := controller.Store.ConsumeOIDCState(c, utils.HashToken(req.State))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get login state"})
+		return
+	}
+	if err != nil || state.Provider != provider.Name || time.Now().After(state.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login"})
+		return
+	}
+
+	claims, err := provider.Exchange(c, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("OIDC login with %s failed: %v", provider.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login with the identity provider failed"})
+		return
+	}
+
+	if state.LinkUserID != nil {
+		controller.linkIdentity(c, *state.LinkUserID, provider.Name, claims)
+		return
+	}
+
+	u, err := controller.userForIdentity(c, provider.Name, claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if u.DeletedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account has been deleted"})
+		return
+	}
+
+	// The identity provider replaces the OTP, not the second factor
+	challenge, err := controller.mfaChallenge(c, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check second factor"})
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	resp, err := controller.startSession(c, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListIdentities returns the identities linked to the caller
+func (controller *Controller) ListIdentities(c *gin.Context) {
+	identities, err := controller.Store.ListUserIdentities(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list identities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// UnlinkIdentity removes a linked identity, as long as the caller is left
+// with another way to log in
+func (controller *Controller) UnlinkIdentity(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+	provider := c.Param("provider")
+
+	u, err := controller.Store.GetUser(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	identities, err := controller.Store.ListUserIdentities(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list identities"})
+		return
+	}
+	if u.PhoneNumber == nil && len(identities) <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Can't remove your only way to log in"})
+		return
+	}
+
+	deleted, err := controller.Store.DeleteUserIdentity(c, userID, provider)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove identity"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (controller *Controller) startOIDC(c *gin.Context, linkUserID *int) {
+	provider, ok := controller.oidcProvider(c)
+	if !ok {
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c, state, nonce, challenge)
+	if err != nil {
+		log.Printf("failed to reach OIDC provider %s: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	err = controller.Store.CreateOIDCState(c, models.OIDCState{
+		StateHash:    utils.HashToken(state),
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL, "state": state})
+}
+
+func (controller *Controller) oidcProvider(c *gin.Context) (*oidc.Provider, bool) {
+	provider, ok := controller.OIDC[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+	}
+	return provider, ok
+}
+
+// userForIdentity finds the user an external identity logs in as. Identities
+// seen for the first time are linked to the account with the same verified
+// email or phone number, and otherwise get a new account.
+func (controller *Controller) userForIdentity(c *gin.Context, provider string, claims oidc.Claims) (models.User, error) {
+	identity, err := controller.Store.GetUserIdentity(c, provider, claims.Subject)
+	if err == nil {
+		if err := controller.Store.TouchUserIdentity(c, identity.ID, claims.Email); err != nil {
+			log.Printf("failed to record login for identity %d: %v", identity.ID, err)
+		}
+		return controller.Store.GetUser(c, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, err
+	}
+
+	now := time.Now()
+	identity = models.UserIdentity{
+		Provider:    provider,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+	}
+
+	// Only addresses both sides have verified are trusted for linking; the
+	// users table only holds verified emails
+	var email, phoneNumber *string
+	if claims.EmailVerified && claims.Email != "" {
+		email = &claims.Email
+	}
+	if claims.PhoneNumberVerified && claims.PhoneNumber != "" {
+		if n, err := controller.Phone.Normalize(claims.PhoneNumber); err == nil {
+			phoneNumber = &n
+		}
+	}
+
+	existing, err := controller.linkedUser(c, email, phoneNumber)
+	if err != nil {
+		return existing, err
+	}
+	if existing.ID != 0 {
+		identity.UserID = existing.ID
+		return existing, controller.Store.CreateUserIdentity(c, identity)
+	}
+
+	user := models.User{Name: claims.Name, Email: email, PhoneNumber: phoneNumber}
+	if email != nil {
+		user.EmailVerifiedAt = &now
+	}
+	userID, err := controller.Store.CreateIdentityUser(c, user, identity)
+	if err != nil {
+		return models.User{}, err
+	}
+	return controller.Store.GetUser(c, userID)
+}
+
+// linkedUser returns the user with the given email or phone number, or a
+// zero user when there is none
+func (controller *Controller) linkedUser(c *gin.Context, email, phoneNumber *string) (models.User, error) {
+	if email != nil {
+		u, err := controller.Store.GetUserByEmail(c, *email)
+		if err == nil || !errors.Is(err, sql.ErrNoRows) {
+			return u, err
+		}
+	}
+	if phoneNumber != nil {
+		u, err := controller.Store.GetUserByPhoneNumber(c, *phoneNumber)
+		if err == nil || !errors.Is(err, sql.ErrNoRows) {
+			return u, err
+		}
+	}
+	return models.User{}, nil
+}
+
+// linkIdentity attaches an identity to a logged in user
+func (controller *Controller) linkIdentity(c *gin.Context, userID int, provider string, claims oidc.Claims) {
+	u, err := controller.Store.GetUser(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if u.DeletedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account has been deleted"})
+		return
+	}
+
+	now := time.Now()
+	identity := models.UserIdentity{
+		UserID:      userID,
+		Provider:    provider,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+	}
+
+	err = controller.Store.CreateUserIdentity(c, identity)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Identity is already linked to an account"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link identity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, identity)
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fintech/pkg/oidc"
+	"fintech/pkg/oidc/oidctest"
+	"fintech/pkg/phone"
+	"fintech/store"
+	"fintech/store/models"
+	"fintech/utils"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStore keeps what the OIDC flow touches in memory. Anything else it's
+// asked for panics on the nil Store.
+type oidcStore struct {
+	store.Store
+
+	mu         sync.Mutex
+	states     map[string]models.OIDCState
+	users      map[int]models.User
+	identities []models.UserIdentity
+}
+
+func newOIDCStore() *oidcStore {
+	return &oidcStore{states: map[string]models.OIDCState{}, users: map[int]models.User{}}
+}
+
+func (s *oidcStore) CreateOIDCState(_ context.Context, state models.OIDCState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state.StateHash] = state
+	return nil
+}
+
+func (s *oidcStore) ConsumeOIDCState(_ context.Context, stateHash string) (models.OIDCState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[stateHash]
+	if !ok {
+		return state, sql.ErrNoRows
+	}
+	delete(s.states, stateHash)
+	return state, nil
+}
+
+// editState changes the only login in progress
+func (s *oidcStore) editState(edit func(*models.OIDCState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, state := range s.states {
+		edit(&state)
+		s.states[hash] = state
+	}
+}
+
+func (s *oidcStore) GetUser(_ context.Context, id int) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return u, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (s *oidcStore) GetUserByEmail(_ context.Context, email string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email != nil && *u.Email == email {
+			return u, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+func (s *oidcStore) GetUserByPhoneNumber(_ context.Context, phoneNumber string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.PhoneNumber != nil && *u.PhoneNumber == phoneNumber {
+			return u, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+func (s *oidcStore) GetUserIdentity(_ context.Context, provider, subject string) (models.UserIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, i := range s.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return models.UserIdentity{}, sql.ErrNoRows
+}
+
+func (s *oidcStore) TouchUserIdentity(context.Context, int, string) error {
+	return nil
+}
+
+func (s *oidcStore) CreateUserIdentity(_ context.Context, identity models.UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	identity.ID = len(s.identities) + 1
+	s.identities = append(s.identities, identity)
+	return nil
+}
+
+func (s *oidcStore) CreateIdentityUser(_ context.Context, user models.User, identity models.UserIdentity) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user.ID = len(s.users) + 1
+	s.users[user.ID] = user
+	identity.ID = len(s.identities) + 1
+	identity.UserID = user.ID
+	s.identities = append(s.identities, identity)
+	return user.ID, nil
+}
+
+func (s *oidcStore) GetUserMFA(context.Context, int) (models.UserMFA, error) {
+	return models.UserMFA{}, sql.ErrNoRows
+}
+
+func (s *oidcStore) MFARequired(context.Context, int) (bool, error) {
+	return false, nil
+}
+
+func (s *oidcStore) CreateAuthSession(context.Context, models.AuthSession, models.RefreshToken, int) error {
+	return nil
+}
+
+// identityUser returns who the issuer's subject is linked to
+func (s *oidcStore) identityUser(t *testing.T, subject string) int {
+	t.Helper()
+	i, err := s.GetUserIdentity(context.Background(), "test", subject)
+	if err != nil {
+		t.Fatalf("identity %s wasn't linked: %v", subject, err)
+	}
+	return i.UserID
+}
+
+type oidcHarness struct {
+	issuer *oidctest.Issuer
+	store  *oidcStore
+	router *gin.Engine
+}
+
+func newOIDCHarness(t *testing.T) *oidcHarness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_KEYS", "")
+	t.Setenv("JWT_SIGNING_KEY_ID", "")
+	t.Setenv("JWT_EPHEMERAL_KEY", "true")
+	if err := utils.LoadKeysFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+
+	issuer, err := oidctest.NewIssuer("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(issuer.Close)
+
+	h := &oidcHarness{issuer: issuer, store: newOIDCStore(), router: gin.New()}
+	controller := &Controller{
+		Store: h.store,
+		Phone: phone.Parser{DefaultRegion: "IN"},
+		OIDC: map[string]*oidc.Provider{"test": oidc.NewProvider(oidc.Config{
+			Name:        "test",
+			Issuer:      issuer.URL(),
+			ClientID:    "client",
+			RedirectURL: "https://app.example/callback",
+		})},
+	}
+	h.router.GET("/auth/oidc/:provider/login", controller.OIDCLogin)
+	h.router.POST("/auth/oidc/:provider/callback", controller.OIDCCallback)
+	return h
+}
+
+// login starts a login and has the issuer approve it, returning the code and
+// state the browser would come back with
+func (h *oidcHarness) login(t *testing.T) (string, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/test/login", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login returned %d: %s", w.Code, w.Body)
+	}
+
+	var resp struct {
+		AuthorizationURL string `json:"authorization_url"`
+		State            string `json:"state"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	code, state, err := h.issuer.Authorize(resp.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != resp.State {
+		t.Fatalf("issuer returned state %q, want %q", state, resp.State)
+	}
+	return code, state
+}
+
+func (h *oidcHarness) callback(code, state string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(OIDCCallbackRequest{Code: code, State: state})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/oidc/test/callback", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	h.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	h := newOIDCHarness(t)
+	h.issuer.SetUser(oidctest.User{Subject: "alice", Name: "Alice", Email: "alice@example.com", EmailVerified: true})
+
+	w := h.callback(h.login(t))
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback returned %d: %s", w.Code, w.Body)
+	}
+	var resp TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatalf("callback didn't start a session: %s", w.Body)
+	}
+
+	u, _ := h.store.GetUser(context.Background(), h.store.identityUser(t, "alice"))
+	if u.Email == nil || *u.Email != "alice@example.com" || u.EmailVerifiedAt == nil {
+		t.Errorf("new user has email %v verified at %v", u.Email, u.EmailVerifiedAt)
+	}
+
+	// The next login finds the identity instead of making another user
+	if w := h.callback(h.login(t)); w.Code != http.StatusOK {
+		t.Fatalf("second login returned %d: %s", w.Code, w.Body)
+	}
+	if len(h.store.users) != 1 {
+		t.Errorf("got %d users, want 1", len(h.store.users))
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		// before runs between the issuer approving the login and the callback
+		before func(h *oidcHarness)
+	}{
+		{"PKCE verifier mismatch", func(h *oidcHarness) {
+			h.store.editState(func(s *models.OIDCState) { s.CodeVerifier = "not-the-verifier" })
+		}},
+		{"nonce mismatch", func(h *oidcHarness) {
+			h.store.editState(func(s *models.OIDCState) { s.Nonce = "not-the-nonce" })
+		}},
+		{"expired state", func(h *oidcHarness) {
+			h.store.editState(func(s *models.OIDCState) { s.ExpiresAt = time.Now().Add(-time.Second) })
+		}},
+		{"state for another provider", func(h *oidcHarness) {
+			h.store.editState(func(s *models.OIDCState) { s.Provider = "other" })
+		}},
+		{"wrong audience", func(h *oidcHarness) {
+			h.issuer.SetClaimOverrides(map[string]interface{}{"aud": "someone-else"})
+		}},
+		{"wrong issuer", func(h *oidcHarness) {
+			h.issuer.SetClaimOverrides(map[string]interface{}{"iss": "https://evil.example"})
+		}},
+		{"expired token", func(h *oidcHarness) {
+			h.issuer.SetClaimOverrides(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newOIDCHarness(t)
+			h.issuer.SetUser(oidctest.User{Subject: "alice"})
+
+			code, state := h.login(t)
+			tt.before(h)
+			if w := h.callback(code, state); w.Code != http.StatusUnauthorized {
+				t.Fatalf("callback returned %d, want 401: %s", w.Code, w.Body)
+			}
+			if len(h.store.users) != 0 {
+				t.Errorf("a rejected login created %d users", len(h.store.users))
+			}
+		})
+	}
+}
+
+func TestOIDCStateCanOnlyBeUsedOnce(t *testing.T) {
+	h := newOIDCHarness(t)
+	h.issuer.SetUser(oidctest.User{Subject: "alice"})
+
+	code, state := h.login(t)
+	if w := h.callback(code, state); w.Code != http.StatusOK {
+		t.Fatalf("callback returned %d: %s", w.Code, w.Body)
+	}
+	if w := h.callback(code, state); w.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed callback returned %d, want 401", w.Code)
+	}
+	if w := h.callback(code, "made-up"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown state returned %d, want 401", w.Code)
+	}
+}
+
+func TestOIDCLinksByVerifiedAddress(t *testing.T) {
+	email := "bob@example.com"
+	number := "+919876543210"
+
+	tests := []struct {
+		name     string
+		user     oidctest.User
+		wantLink bool
+	}{
+		{"verified email", oidctest.User{Subject: "s", Email: email, EmailVerified: true}, true},
+		{"unverified email", oidctest.User{Subject: "s", Email: email}, false},
+		{"verified phone", oidctest.User{Subject: "s", PhoneNumber: "9876543210", PhoneNumberVerified: true}, true},
+		{"unverified phone", oidctest.User{Subject: "s", PhoneNumber: number}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newOIDCHarness(t)
+			h.store.users[1] = models.User{ID: 1, Email: &email, PhoneNumber: &number}
+			h.issuer.SetUser(tt.user)
+
+			if w := h.callback(h.login(t)); w.Code != http.StatusOK {
+				t.Fatalf("callback returned %d: %s", w.Code, w.Body)
+			}
+			linked := h.store.identityUser(t, "s") == 1
+			if linked != tt.wantLink {
+				t.Errorf("linked to the existing user: %v, want %v", linked, tt.wantLink)
+			}
+		})
+	}
+}
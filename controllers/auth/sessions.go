@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/store/models"
+	"fintech/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Presenting a refresh token that was already exchanged revokes the
+// whole session, since it means the token was copied.
+func (controller *Controller) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	token, err := controller.Store.GetRefreshToken(c, utils.HashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get refresh token"})
+		return
+	}
+
+	session, err := controller.Store.GetAuthSession(c, token.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session"})
+		return
+	}
+	if !session.Active() || time.Now().After(token.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	if token.UsedAt != nil {
+		controller.revokeForReuse(c, session)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	u, err := controller.Store.GetUser(c, session.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if u.DeletedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	refreshToken, refreshHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	rotated, err := controller.Store.RotateRefreshToken(c, token.ID, models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: refreshHash,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL()),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate refresh token"})
+		return
+	}
+	// Another request exchanged the same token first
+	if !rotated {
+		controller.revokeForReuse(c, session)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	accessToken, err := utils.GenerateJWT(u.ID, u.Phone(), session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	})
+}
+
+// Logout revokes the session the request was made with
+func (controller *Controller) Logout(c *gin.Context) {
+	err := controller.Store.RevokeAuthSession(c, c.MustGet("session_id").(string), "logout")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutAll revokes every session of the current user
+func (controller *Controller) LogoutAll(c *gin.Context) {
+	err := controller.Store.RevokeUserAuthSessions(c, c.MustGet("user_id").(int), "logout_all")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListSessions returns the devices the current user is logged in on
+func (controller *Controller) ListSessions(c *gin.Context) {
+	current := c.MustGet("session_id").(string)
+
+	sessions, err := controller.Store.ListUserAuthSessions(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+
+	resp := []SessionResponse{}
+	for _, s := range sessions {
+		lastSeen := s.CreatedAt
+		if s.LastSeenAt != nil {
+			lastSeen = *s.LastSeenAt
+		}
+		resp = append(resp, SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: lastSeen,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == current,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeSession logs one of the current user's devices out
+func (controller *Controller) RevokeSession(c *gin.Context) {
+	revoked, err := controller.Store.RevokeUserAuthSession(c, c.MustGet("user_id").(int), c.Param("session_id"), "revoked_by_user")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeUserSessions lets an admin cut off every session of another user
+func (controller *Controller) RevokeUserSessions(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	err = controller.Store.RevokeUserAuthSessions(c, userID, "revoked_by_admin")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionUserSessionsRevoke, "user", strconv.Itoa(userID))
+	event.UserID = &userID
+	event.Status = http.StatusNoContent
+	audit.Record(c, controller.Store, event)
+
+	c.Status(http.StatusNoContent)
+}
+
+// startSession creates a session for the user and issues its first tokens
+func (controller *Controller) startSession(c *gin.Context, u models.User) (TokenResponse, error) {
+	refreshToken, refreshHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(utils.RefreshTokenTTL())
+	session := models.AuthSession{
+		ID:         uuid.NewString(),
+		UserID:     u.ID,
+		UserAgent:  truncate(c.Request.UserAgent(), 500),
+		IP:         c.ClientIP(),
+		LastSeenAt: &now,
+		ExpiresAt:  expiresAt,
+	}
+
+	maxDevices := utils.MaxDevices()
+	if u.MaxDevices != nil {
+		maxDevices = *u.MaxDevices
+	}
+
+	err = controller.Store.CreateAuthSession(c, session, models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: refreshHash,
+		ExpiresAt: expiresAt,
+	}, maxDevices)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	accessToken, err := utils.GenerateJWT(u.ID, u.Phone(), session.ID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	return TokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+func (controller *Controller) revokeForReuse(c *gin.Context, session models.AuthSession) {
+	log.Printf("refresh token reuse detected for session %s of user %d", session.ID, session.UserID)
+	err := controller.Store.RevokeAuthSession(c, session.ID, "refresh_token_reuse")
+	if err != nil {
+		log.Printf("failed to revoke session %s: %v", session.ID, err)
+	}
+}
+
+// JWKS publishes the public keys tokens can be verified with
+func (controller *Controller) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS())
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// SessionResponse describes a device the user is logged in on
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current marks the session the request was made with
+	Current bool `json:"current"`
+}
@@ -1,9 +1,11 @@
 package chat
 
 import (
+	"fintech/pkg/ratelimit"
 	"fintech/store"
 	"fintech/store/models"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"sync"
@@ -14,7 +16,10 @@ import (
 )
 
 type ChatController struct {
-	Store store.Store
+	Store   store.Store
+	Limiter ratelimit.Limiter
+	// MessagePolicy limits how fast a user may send messages over sockets
+	MessagePolicy ratelimit.Policy
 }
 
 var upgrader = websocket.Upgrader{
@@ -39,13 +44,14 @@ var mutex sync.Mutex
 
 func (controller ChatController) Chat(c *gin.Context) {
 	senderID := c.MustGet("user_id").(int)
-	courseID := c.Query("course_id")
 
-	course, err := controller.Store.GetCourse(c, courseID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+	// The course is loaded from the course_id query parameter by RequirePermission
+	value, ok := c.Get("course")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "course_id is required"})
 		return
 	}
+	course := value.(models.Course)
 
 	receiverID := course.AuthorID
 
@@ -107,33 +113,54 @@ func (controller ChatController) GetChatSessions(c *gin.Context) {
 
 	sessions, err := controller.Store.GetChatSessions(c, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chat sessions"})
+		return
+	}
+
+	var ids []int
+	for _, s := range sessions {
+		ids = append(ids, s.SenderID, s.ReceiverID)
+	}
+	summaries, err := controller.Store.GetUserSummaries(c, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chat sessions"})
 		return
 	}
 
-	c.JSON(http.StatusOK, sessions)
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, SessionResponse{
+			ChatSession: s,
+			Sender:      summaries[s.SenderID],
+			Receiver:    summaries[s.ReceiverID],
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
+// GetChatSessionsMessages lists the messages of the session loaded by the
+// route
 func (controller ChatController) GetChatSessionsMessages(c *gin.Context) {
-	sessionID := c.Param("session_id")
-	sID, _ := strconv.Atoi(sessionID)
+	session := c.MustGet("chat_session").(models.ChatSession)
 
-	messages, err := controller.Store.GetChatSessionsMessages(c, sID)
+	messages, err := controller.Store.GetChatSessionsMessages(c, session.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get messages"})
 		return
 	}
 
 	c.JSON(http.StatusOK, messages)
 }
 
+// MarkChatSessionsAsRead marks the messages of the session loaded by the
+// route read
 func (controller ChatController) MarkChatSessionsAsRead(c *gin.Context) {
-	sessionID := c.Param("session_id")
-	sID, _ := strconv.Atoi(sessionID)
+	session := c.MustGet("chat_session").(models.ChatSession)
 
-	err := controller.Store.MarkChatSessionsAsRead(c, sID)
+	err := controller.Store.MarkChatSessionsAsRead(c, session.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark messages read"})
 		return
 	}
 
@@ -156,6 +183,10 @@ func (controller ChatController) handleMessages(c *gin.Context, conn *Connection
 			break
 		}
 
+		if !controller.allowMessage(c, conn) {
+			break
+		}
+
 		// Check and create sessions if needed
 		m := models.Message{
 			SenderID:   conn.SenderID,
@@ -187,3 +218,33 @@ func (controller ChatController) handleMessages(c *gin.Context, conn *Connection
 		}
 	}
 }
+
+// allowMessage takes a token from the sender's message bucket, closing the
+// socket with a policy violation once it's empty
+func (controller ChatController) allowMessage(c *gin.Context, conn *Connection) bool {
+	if controller.Limiter == nil || controller.MessagePolicy.Disabled() {
+		return true
+	}
+
+	key := fmt.Sprintf("%s:user:%d", controller.MessagePolicy.Name, conn.SenderID)
+	result, err := controller.Limiter.Allow(c, key, controller.MessagePolicy)
+	if err != nil {
+		log.Printf("rate limiter failed for %s: %v", controller.MessagePolicy.Name, err)
+		return true
+	}
+	if result.Allowed {
+		return true
+	}
+
+	conn.Conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Too many messages"),
+		time.Now().Add(time.Second))
+	return false
+}
+
+// SessionResponse is a chat session with both participants' profiles
+type SessionResponse struct {
+	models.ChatSession
+	Sender   models.UserSummary `json:"sender"`
+	Receiver models.UserSummary `json:"receiver"`
+}
@@ -1,10 +1,13 @@
 package courses
 
 import (
+	"fintech/pkg/audit"
+	"fintech/pkg/payments"
 	"fintech/pkg/vdo"
 	"fintech/store"
 	"fintech/store/models"
 	"net/http"
+	"regexp"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -23,6 +26,12 @@ func (controller Controller) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	if req.Currency == "" {
+		req.Currency = defaultCurrency
+	}
+	if !validPrice(c, req) || !validCategory(c, req) {
+		return
+	}
 
 	newUUID := uuid.New()
 	vdoFolder, err := controller.VDO.CreateFolderRoot(newUUID.String(), "root")
@@ -36,12 +45,17 @@ func (controller Controller) Create(c *gin.Context) {
 		Name:        req.Name,
 		Description: req.Description,
 		FolderID:    vdoFolder.ID,
+		PriceMinor:  req.PriceMinor,
+		Currency:    req.Currency,
+		Category:    req.Category,
 		AuthorID:    c.MustGet("user_id").(int),
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	err = controller.Store.CreateCourse(c, course)
+	event := audit.FromRequest(c, audit.ActionCourseCreate, "course", course.ID.String())
+	event.Changes = audit.Diff(nil, course)
+	err = controller.Store.CreateCourse(c, course, event)
 	if err != nil {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Course ID already exists"})
@@ -57,17 +71,31 @@ func (controller Controller) Create(c *gin.Context) {
 
 func (controller Controller) Update(c *gin.Context) {
 	course := c.MustGet("course").(models.Course)
+	before := course
 	var req mutateRequest
 	req.Description = course.Description
 	req.Name = course.Name
+	req.PriceMinor = course.PriceMinor
+	req.Currency = course.Currency
+	req.Category = course.Category
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	if !validPrice(c, req) || !validCategory(c, req) {
+		return
+	}
 
 	course.Description = req.Description
 	course.Name = req.Name
-	err := controller.Store.UpdateCourse(c, course)
+	course.PriceMinor = req.PriceMinor
+	course.Currency = req.Currency
+	course.Category = req.Category
+	course.UpdatedAt = time.Now()
+
+	event := audit.FromRequest(c, audit.ActionCourseUpdate, "course", course.ID.String())
+	event.Changes = audit.Diff(before, course)
+	err := controller.Store.UpdateCourse(c, course, event)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
@@ -82,7 +110,22 @@ func (controller Controller) List(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
-	c.JSON(http.StatusOK, courses)
+
+	var ids []int
+	for _, course := range courses {
+		ids = append(ids, course.AuthorID)
+	}
+	authors, err := controller.Store.GetUserSummaries(c, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	resp := make([]CourseResponse, 0, len(courses))
+	for _, course := range courses {
+		resp = append(resp, CourseResponse{Course: course, Author: authors[course.AuthorID]})
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func (controller Controller) Get(c *gin.Context) {
@@ -94,12 +137,22 @@ func (controller Controller) Get(c *gin.Context) {
 		return
 	}
 
+	authors, err := controller.Store.GetUserSummaries(c, []int{course.AuthorID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
 	resp := CourseDetailedResponse{
 		ID:          course.ID,
 		Name:        course.Name,
 		Description: course.Description,
 		Folder:      *vdoFolder,
+		PriceMinor:  course.PriceMinor,
+		Currency:    course.Currency,
+		Category:    course.Category,
 		AuthorID:    course.AuthorID,
+		Author:      authors[course.AuthorID],
 		CreatedAt:   course.CreatedAt,
 		UpdatedAt:   course.UpdatedAt,
 	}
@@ -109,8 +162,15 @@ func (controller Controller) Get(c *gin.Context) {
 
 func (controller Controller) Delete(c *gin.Context) {
 	course := c.MustGet("course").(models.Course)
-	err := controller.Store.DeleteCourse(c, course.ID.String())
+
+	event := audit.FromRequest(c, audit.ActionCourseDelete, "course", course.ID.String())
+	event.Changes = audit.Diff(course, nil)
+	err := controller.Store.DeleteCourse(c, course.ID.String(), event)
 	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1451 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Courses that have been ordered can't be deleted"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
@@ -118,9 +178,39 @@ func (controller Controller) Delete(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// defaultCurrency is used for courses created without one
+const defaultCurrency = "INR"
+
 type mutateRequest struct {
 	Name        string `json:"name" validate:"min=5,max=50"`
 	Description string `json:"description" validate:"min=5,max=500"`
+	PriceMinor  int64  `json:"price_minor"`
+	Currency    string `json:"currency"`
+	Category    string `json:"category"`
+}
+
+func validPrice(c *gin.Context, req mutateRequest) bool {
+	if req.PriceMinor < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price_minor can't be negative"})
+		return false
+	}
+	if !payments.SupportedCurrency(req.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency"})
+		return false
+	}
+	return true
+}
+
+// categoryPattern matches the slugs courses are categorized by, such as
+// "data-science"
+var categoryPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+func validCategory(c *gin.Context, req mutateRequest) bool {
+	if req.Category != "" && (len(req.Category) > 50 || !categoryPattern.MatchString(req.Category)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "category must be a lower case slug of up to 50 characters"})
+		return false
+	}
+	return true
 }
 
 type CourseDetailedResponse struct {
@@ -128,7 +218,17 @@ type CourseDetailedResponse struct {
 	Name        string             `db:"name"`        // VARCHAR(50), non-nullable
 	Description string             `db:"description"` // VARCHAR(300), nullable, use sql.NullString
 	AuthorID    int                `db:"author_id"`   // INT, non-nullable
+	Author      models.UserSummary `db:"-"`
 	Folder      vdo.FolderResponse `db:"folder"`
+	PriceMinor  int64              `db:"price_minor"`
+	Currency    string             `db:"currency"`
+	Category    string             `db:"category"`
 	CreatedAt   time.Time          `db:"created_at"` // DATETIME(6), default CURRENT_TIMESTAMP(6)
 	UpdatedAt   time.Time          `db:"updated_at"`
 }
+
+// CourseResponse is a course with its author's profile
+type CourseResponse struct {
+	models.Course
+	Author models.UserSummary `db:"-"`
+}
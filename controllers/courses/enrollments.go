@@ -0,0 +1,248 @@
+package courses
+
+import (
+	"database/sql"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/store/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkEnrollments caps how many learners one admin request may change
+const maxBulkEnrollments = 500
+
+// Enroll enrolls the caller in a free course. Paid courses are enrolled in
+// by checking out.
+func (controller Controller) Enroll(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+	userID := c.MustGet("user_id").(int)
+
+	if course.PriceMinor > 0 {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "This course has to be purchased"})
+		return
+	}
+
+	existing, err := controller.Store.GetEnrollment(c, userID, course.ID.String())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get enrollment"})
+		return
+	}
+	if err == nil && existing.Active() {
+		c.JSON(http.StatusOK, existing)
+		return
+	}
+
+	err = controller.Store.Enroll(c, models.Enrollment{
+		UserID:   userID,
+		CourseID: course.ID.String(),
+		Status:   models.EnrollmentActive,
+		Source:   models.EnrollmentSourceSelf,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll"})
+		return
+	}
+
+	enrollment, err := controller.Store.GetEnrollment(c, userID, course.ID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, enrollment)
+}
+
+// Unenroll ends the caller's enrollment in the course
+func (controller Controller) Unenroll(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	cancelled, err := controller.Store.CancelEnrollment(c, c.MustGet("user_id").(int), course.ID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unenroll"})
+		return
+	}
+	if !cancelled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not enrolled in this course"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// MyCourses lists the courses the caller is currently enrolled in
+func (controller Controller) MyCourses(c *gin.Context) {
+	enrollments, err := controller.Store.ListUserEnrollments(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list enrollments"})
+		return
+	}
+
+	byCourse := map[string]models.Enrollment{}
+	var ids []string
+	for _, e := range enrollments {
+		if e.Active() {
+			byCourse[e.CourseID] = e
+			ids = append(ids, e.CourseID)
+		}
+	}
+
+	courses, err := controller.Store.ListCoursesByID(c, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list courses"})
+		return
+	}
+
+	var authorIDs []int
+	for _, course := range courses {
+		authorIDs = append(authorIDs, course.AuthorID)
+	}
+	authors, err := controller.Store.GetUserSummaries(c, authorIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get authors"})
+		return
+	}
+
+	resp := make([]EnrolledCourseResponse, 0, len(courses))
+	for _, course := range courses {
+		resp = append(resp, EnrolledCourseResponse{
+			Course:     CourseResponse{Course: course, Author: authors[course.AuthorID]},
+			Enrollment: byCourse[course.ID.String()],
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListEnrollments lists every enrollment in the course, cancelled ones included
+func (controller Controller) ListEnrollments(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	enrollments, err := controller.Store.ListCourseEnrollments(c, course.ID.String(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list enrollments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollments)
+}
+
+// BulkEnroll enrolls several learners at once, reactivating cancelled or
+// expired enrollments and replacing the expiry of active ones
+func (controller Controller) BulkEnroll(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	var req bulkEnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	userIDs, ok := bulkUserIDs(c, req.UserIDs)
+	if !ok {
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	users, err := controller.Store.GetUserSummaries(c, userIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
+		return
+	}
+	missing := []int{}
+	for _, id := range userIDs {
+		if _, ok := users[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Users not found", "user_ids": missing})
+		return
+	}
+
+	enrolledBy := c.MustGet("user_id").(int)
+	enrollments := make([]models.Enrollment, 0, len(userIDs))
+	for _, id := range userIDs {
+		enrollments = append(enrollments, models.Enrollment{
+			UserID:     id,
+			CourseID:   course.ID.String(),
+			Status:     models.EnrollmentActive,
+			Source:     models.EnrollmentSourceAdmin,
+			ExpiresAt:  req.ExpiresAt,
+			EnrolledBy: &enrolledBy,
+		})
+	}
+
+	event := audit.FromRequest(c, audit.ActionEnrollmentGrant, "course", course.ID.String())
+	event.Details = audit.Details(map[string]interface{}{"user_ids": userIDs, "expires_at": req.ExpiresAt})
+	err = controller.Store.EnrollUsers(c, enrollments, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"enrolled": len(enrollments)})
+}
+
+// BulkUnenroll cancels the enrollments of several learners at once
+func (controller Controller) BulkUnenroll(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	var req bulkEnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	userIDs, ok := bulkUserIDs(c, req.UserIDs)
+	if !ok {
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionEnrollmentCancel, "course", course.ID.String())
+	event.Details = audit.Details(map[string]interface{}{"user_ids": userIDs})
+	cancelled, err := controller.Store.CancelEnrollments(c, course.ID.String(), userIDs, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unenroll users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cancelled": cancelled})
+}
+
+// bulkUserIDs removes duplicates and checks the number of learners
+func bulkUserIDs(c *gin.Context, ids []int) ([]int, bool) {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	if len(ids) == 0 || len(ids) > maxBulkEnrollments || ids[0] <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids must list between 1 and " + strconv.Itoa(maxBulkEnrollments) + " users"})
+		return nil, false
+	}
+	return ids, true
+}
+
+type bulkEnrollRequest struct {
+	UserIDs   []int      `json:"user_ids"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// EnrolledCourseResponse is a course the caller is enrolled in
+type EnrolledCourseResponse struct {
+	Course     CourseResponse    `json:"course"`
+	Enrollment models.Enrollment `json:"enrollment"`
+}
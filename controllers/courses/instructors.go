@@ -0,0 +1,157 @@
+package courses
+
+import (
+	"database/sql"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/store/models"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// rolesForLevel lists the roles that carry ":own" permissions for each level,
+// one of which an invitee must hold for the invitation to give them any rights
+var rolesForLevel = map[string][]string{
+	models.InstructorCoInstructor: {models.RoleInstructor},
+	models.InstructorTA:           {models.RoleInstructor, models.RoleTeachingAssistant},
+}
+
+func (controller Controller) ListInstructors(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	instructors, err := controller.Store.ListCourseInstructors(c, course.ID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list instructors"})
+		return
+	}
+
+	c.JSON(http.StatusOK, instructors)
+}
+
+// InviteInstructor invites a user as co-instructor or teaching assistant. The
+// invitation only grants rights once the user accepts it.
+func (controller Controller) InviteInstructor(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	var req inviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	allowedRoles, ok := rolesForLevel[req.Level]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Level must be co_instructor or teaching_assistant"})
+		return
+	}
+
+	roles, err := controller.Store.GetUserRoles(c, req.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user roles"})
+		return
+	}
+	if len(roles) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+		return
+	}
+	if !slices.ContainsFunc(roles, func(r models.UserRole) bool { return slices.Contains(allowedRoles, r.Role) }) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User doesn't have a role that allows this level"})
+		return
+	}
+
+	invitedBy := c.MustGet("user_id").(int)
+	instructor := models.CourseInstructor{
+		CourseID:  course.ID.String(),
+		UserID:    req.UserID,
+		Level:     req.Level,
+		Status:    models.InstructorInvited,
+		InvitedBy: &invitedBy,
+	}
+
+	event := audit.FromRequest(c, audit.ActionInstructorInvite, "course", course.ID.String())
+	event.UserID = &instructor.UserID
+	event.Changes = audit.Diff(nil, instructor)
+	err = controller.Store.AddCourseInstructor(c, instructor, event)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User is already an instructor of this course"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invite instructor"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, instructor)
+}
+
+// AcceptInvitation lets an invited user become an active instructor
+func (controller Controller) AcceptInvitation(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+	userID := c.MustGet("user_id").(int)
+
+	event := audit.FromRequest(c, audit.ActionInstructorAccept, "course", course.ID.String())
+	event.UserID = &userID
+	event.Changes = audit.Diff(map[string]string{"status": models.InstructorInvited}, map[string]string{"status": models.InstructorActive})
+	accepted, err := controller.Store.ActivateCourseInstructor(c, course.ID.String(), userID, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+	if !accepted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending invitation"})
+		return
+	}
+
+	instructor, err := controller.Store.GetCourseInstructor(c, course.ID.String(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get instructor"})
+		return
+	}
+
+	c.JSON(http.StatusOK, instructor)
+}
+
+// RemoveInstructor removes a co-instructor or teaching assistant, or
+// withdraws their invitation. The owner can't be removed.
+func (controller Controller) RemoveInstructor(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	instructor, err := controller.Store.GetCourseInstructor(c, course.ID.String(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Instructor not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get instructor"})
+		return
+	}
+	if instructor.Level == models.InstructorOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The course owner can't be removed"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionInstructorRemove, "course", course.ID.String())
+	event.UserID = &userID
+	event.Changes = audit.Diff(instructor, nil)
+	err = controller.Store.RemoveCourseInstructor(c, course.ID.String(), userID, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove instructor"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type inviteRequest struct {
+	UserID int    `json:"user_id"`
+	Level  string `json:"level"`
+}
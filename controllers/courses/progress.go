@@ -0,0 +1,66 @@
+package courses
+
+import (
+	"fintech/store/models"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// videoIDPattern matches VdoCipher video IDs
+var videoIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// SaveProgress records how far the caller got through a video. Players report
+// their position periodically; only the furthest position is kept.
+func (controller Controller) SaveProgress(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	videoID := c.Param("video_id")
+	if !videoIDPattern.MatchString(videoID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid video ID"})
+		return
+	}
+
+	var req progressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if req.PositionSeconds < 0 || req.DurationSeconds <= 0 || req.PositionSeconds > req.DurationSeconds {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "position_seconds must be between 0 and duration_seconds"})
+		return
+	}
+
+	err := controller.Store.SaveVideoProgress(c, models.VideoProgress{
+		UserID:          c.MustGet("user_id").(int),
+		CourseID:        course.ID.String(),
+		VideoID:         videoID,
+		FurthestSeconds: req.PositionSeconds,
+		DurationSeconds: req.DurationSeconds,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save progress"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListProgress lists the caller's progress through the course's videos
+func (controller Controller) ListProgress(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	progress, err := controller.Store.ListCourseProgress(c, c.MustGet("user_id").(int), course.ID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+type progressRequest struct {
+	PositionSeconds int `json:"position_seconds"`
+	DurationSeconds int `json:"duration_seconds"`
+}
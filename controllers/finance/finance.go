@@ -0,0 +1,219 @@
+package finance
+
+import (
+	"database/sql"
+	"errors"
+	"fintech/pkg/ledger"
+	"fintech/pkg/payouts"
+	"fintech/store"
+	"fintech/store/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	Store        store.Store
+	PlatformFee  ledger.Rate
+	PayoutConfig payouts.Config
+}
+
+// Balances returns every account's balance as of ?as_of, now by default.
+// Without ?prefix it's a trial balance, which has to come out even.
+func (controller Controller) Balances(c *gin.Context) {
+	asOf := time.Now()
+	if v := c.Query("as_of"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "as_of must be an RFC 3339 timestamp"})
+			return
+		}
+		asOf = t
+	}
+
+	filter := models.LedgerFilter{AccountPrefix: c.Query("prefix"), To: &asOf}
+	balances, err := controller.Store.SumLedger(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sum ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newSummary(filter, balances))
+}
+
+// Activity returns how much each account moved between ?from and ?to
+func (controller Controller) Activity(c *gin.Context) {
+	filter, ok := filterFrom(c)
+	if !ok {
+		return
+	}
+	if filter.From == nil || filter.To == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to are required"})
+		return
+	}
+
+	balances, err := controller.Store.SumLedger(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sum ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newSummary(filter, balances))
+}
+
+// Statement lists one account's lines between ?from and ?to along with its
+// opening balance
+func (controller Controller) Statement(c *gin.Context) {
+	filter, ok := filterFrom(c)
+	if !ok {
+		return
+	}
+	filter.Account = c.Param("account")
+	filter.AccountPrefix = ""
+
+	opening := []models.AccountBalance{}
+	if filter.From != nil {
+		before := filter.From.Add(-time.Microsecond)
+		var err error
+		opening, err = controller.Store.SumLedger(c, models.LedgerFilter{Account: filter.Account, To: &before})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sum ledger"})
+			return
+		}
+	}
+
+	lines, err := controller.Store.ListStatementLines(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list ledger lines"})
+		return
+	}
+
+	c.JSON(http.StatusOK, StatementResponse{
+		Account: filter.Account,
+		Type:    ledger.TypeOf(filter.Account),
+		Opening: opening,
+		Lines:   lines,
+	})
+}
+
+// GetEntry returns a journal entry with its lines
+func (controller Controller) GetEntry(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry ID"})
+		return
+	}
+
+	entry, err := controller.Store.GetJournalEntry(c, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entry not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get entry"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// FindEntry returns the entry posted for a record, such as
+// ?kind=payment&reference=<order ID>
+func (controller Controller) FindEntry(c *gin.Context) {
+	entry, err := controller.Store.GetJournalEntryByReference(c, c.Query("kind"), c.Query("reference"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entry not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get entry"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+func filterFrom(c *gin.Context) (models.LedgerFilter, bool) {
+	filter := models.LedgerFilter{AccountPrefix: c.Query("prefix")}
+
+	for param, dest := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC 3339 timestamp"})
+				return filter, false
+			}
+			*dest = &t
+		}
+	}
+
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	return filter, true
+}
+
+// newSummary presents balances with the sign that's positive in each
+// account's usual direction, and checks debits and credits agree in every
+// currency
+func newSummary(filter models.LedgerFilter, balances []models.AccountBalance) SummaryResponse {
+	resp := SummaryResponse{
+		From:     filter.From,
+		To:       filter.To,
+		Accounts: make([]AccountResponse, 0, len(balances)),
+		Balanced: true,
+	}
+
+	sums := map[string]int64{}
+	for _, b := range balances {
+		resp.Accounts = append(resp.Accounts, AccountResponse{
+			Account:     b.Account,
+			Type:        ledger.TypeOf(b.Account),
+			Currency:    b.Currency,
+			AmountMinor: ledger.Natural(b.Account, b.AmountMinor),
+		})
+		sums[b.Currency] += b.AmountMinor
+	}
+	// Only the whole ledger has to balance
+	if filter.AccountPrefix == "" {
+		for _, sum := range sums {
+			if sum != 0 {
+				resp.Balanced = false
+			}
+		}
+	}
+
+	return resp
+}
+
+type AccountResponse struct {
+	Account  string `json:"account"`
+	Type     string `json:"type"`
+	Currency string `json:"currency"`
+	// AmountMinor is positive for debits to assets and expenses, and for
+	// credits to every other type of account
+	AmountMinor int64 `json:"amount_minor"`
+}
+
+type SummaryResponse struct {
+	From     *time.Time        `json:"from,omitempty"`
+	To       *time.Time        `json:"to"`
+	Accounts []AccountResponse `json:"accounts"`
+	// Balanced is false if debits and credits differ in any currency
+	Balanced bool `json:"balanced"`
+}
+
+type StatementResponse struct {
+	Account string                  `json:"account"`
+	Type    string                  `json:"type"`
+	Opening []models.AccountBalance `json:"opening"`
+	Lines   []models.StatementLine  `json:"lines"`
+}
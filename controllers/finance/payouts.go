@@ -0,0 +1,528 @@
+package finance
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/pkg/ledger"
+	"fintech/pkg/payouts"
+	"fintech/store"
+	"fintech/store/models"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ErrNothingToPay is returned by RunPayouts when no instructor has earnings
+// to pay out
+var ErrNothingToPay = errors.New("nothing to pay out")
+
+var (
+	ifscPattern          = regexp.MustCompile(`^[A-Z]{4}0[A-Z0-9]{6}$`)
+	routingPattern       = regexp.MustCompile(`^[0-9]{9}$`)
+	accountNumberPattern = regexp.MustCompile(`^[0-9]{4,34}$`)
+)
+
+// PlanPayouts works out what a payout run would pay every instructor for the
+// earnings they've held for longer than config.Hold, and which balances it
+// would skip, without paying anything
+func PlanPayouts(ctx context.Context, db store.Store, config payouts.Config, cutoff time.Time) ([]models.Payout, []payouts.Skipped, error) {
+	balances, err := db.SumMaturedLedger(ctx, ledger.InstructorPrefix, cutoff)
+	if err != nil {
+		return nil, nil, err
+	}
+	var userIDs []int
+	for _, b := range balances {
+		if userID, ok := ledger.InstructorOf(b.Account); ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	accounts, err := db.ListPayoutAccounts(ctx, userIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	planned, skipped := payouts.Plan(balances, accounts, config.Minimum)
+	return planned, skipped, nil
+}
+
+// RunPayouts creates a batch waiting for approval with the payouts
+// PlanPayouts works out. createdBy is nil for scheduled runs. Balances that
+// can't be paid are returned as skipped and carry over to the next run.
+func RunPayouts(ctx context.Context, db store.Store, config payouts.Config, createdBy *int, event models.AuditEvent) (models.PayoutBatch, []payouts.Skipped, error) {
+	now := time.Now()
+	cutoff := now.Add(-config.Hold)
+
+	planned, skipped, err := PlanPayouts(ctx, db, config, cutoff)
+	if err != nil {
+		return models.PayoutBatch{}, nil, err
+	}
+	if len(planned) == 0 {
+		return models.PayoutBatch{}, skipped, ErrNothingToPay
+	}
+
+	batch := models.PayoutBatch{
+		ID:        uuid.NewString(),
+		Status:    models.PayoutPendingApproval,
+		CutoffAt:  cutoff,
+		CreatedBy: createdBy,
+	}
+	for i := range planned {
+		planned[i].ID = uuid.NewString()
+		planned[i].BatchID = batch.ID
+	}
+	entry, err := ledger.Payouts(batch, planned, now)
+	if err != nil {
+		return models.PayoutBatch{}, skipped, err
+	}
+
+	event.Action = audit.ActionPayoutBatchCreate
+	event.TargetType = "payout_batch"
+	event.TargetID = batch.ID
+	event.Details = audit.Details(map[string]interface{}{
+		"cutoff_at": cutoff,
+		"payouts":   len(planned),
+		"skipped":   len(skipped),
+	})
+	if err := db.CreatePayoutBatch(ctx, batch, planned, entry, event); err != nil {
+		return models.PayoutBatch{}, skipped, err
+	}
+
+	batch, err = db.GetPayoutBatch(ctx, batch.ID)
+	return batch, skipped, err
+}
+
+// GetRevenueShares returns the course's current agreement along with every
+// earlier and scheduled one
+func (controller Controller) GetRevenueShares(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	shares, err := controller.Store.ListRevenueShares(c, course.ID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list revenue shares"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RevenueSharesResponse{
+		DefaultPercent: float64(ledger.Percent(100)-controller.PlatformFee) / 100,
+		Shares:         shares,
+	})
+}
+
+// SetRevenueShares replaces the course's agreement from starts_at, now by
+// default. Sales made before then keep the split they were recorded with.
+func (controller Controller) SetRevenueShares(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+
+	var req revenueSharesRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Shares) == 0 || len(req.Shares) > 20 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	startsAt := time.Now()
+	if req.StartsAt != nil {
+		if req.StartsAt.Before(startsAt) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "starts_at can't be in the past"})
+			return
+		}
+		startsAt = *req.StartsAt
+	}
+
+	createdBy := c.MustGet("user_id").(int)
+	seen := map[int]bool{}
+	var total ledger.Rate
+	shares := make([]models.RevenueShare, 0, len(req.Shares))
+	for _, s := range req.Shares {
+		rate := ledger.Percent(s.Percent)
+		if rate <= 0 || seen[s.UserID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each instructor needs one share above zero"})
+			return
+		}
+		if _, err := controller.Store.GetUser(c, s.UserID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("User %d not found", s.UserID)})
+			return
+		}
+		seen[s.UserID] = true
+		total += rate
+		shares = append(shares, models.RevenueShare{UserID: s.UserID, ShareBps: int(rate), CreatedBy: createdBy})
+	}
+	if total > ledger.Percent(100) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shares can't add up to more than 100 percent"})
+		return
+	}
+
+	before, err := controller.Store.GetRevenueShares(c, course.ID.String(), startsAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get revenue shares"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionRevenueShareSet, "course", course.ID.String())
+	event.Changes = audit.Diff(map[string]interface{}{"shares": shareSummary(before)}, map[string]interface{}{"shares": shareSummary(shares)})
+	event.Details = audit.Details(map[string]interface{}{"starts_at": startsAt})
+	if err := controller.Store.SetRevenueShares(c, course.ID.String(), shares, startsAt, event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set revenue shares"})
+		return
+	}
+
+	controller.GetRevenueShares(c)
+}
+
+// RunPayouts creates a payout batch from the instructors' matured earnings
+func (controller Controller) RunPayouts(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+
+	batch, skipped, err := RunPayouts(c, controller.Store, controller.PayoutConfig, &userID, audit.FromRequest(c, "", "", ""))
+	if errors.Is(err, ErrNothingToPay) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No earnings are due to be paid out", "skipped": skipped})
+		return
+	}
+	if errors.Is(err, models.ErrPayoutExceedsBalance) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Balances changed while the payouts were calculated, try again"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run payouts"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, PayoutRunResponse{Batch: batch, Skipped: skipped})
+}
+
+// ListPayoutBatches lists payout batches, optionally only those with ?status
+func (controller Controller) ListPayoutBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	batches, err := controller.Store.ListPayoutBatches(c, c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payout batches"})
+		return
+	}
+
+	c.JSON(http.StatusOK, batches)
+}
+
+// GetPayoutBatch returns a batch with its payouts
+func (controller Controller) GetPayoutBatch(c *gin.Context) {
+	c.JSON(http.StatusOK, c.MustGet("batch").(models.PayoutBatch))
+}
+
+// ApprovePayoutBatch approves a batch for export. Batches an admin ran have
+// to be approved by another one.
+func (controller Controller) ApprovePayoutBatch(c *gin.Context) {
+	batch := c.MustGet("batch").(models.PayoutBatch)
+	userID := c.MustGet("user_id").(int)
+
+	if batch.CreatedBy != nil && *batch.CreatedBy == userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Batches have to be approved by someone other than who ran them"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionPayoutBatchApprove, "payout_batch", batch.ID)
+	event.Changes = audit.Diff(map[string]string{"status": batch.Status}, map[string]string{"status": models.PayoutApproved})
+	approved, err := controller.Store.ApprovePayoutBatch(c, batch.ID, userID, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve payout batch"})
+		return
+	}
+	if !approved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only batches waiting for approval can be approved"})
+		return
+	}
+
+	controller.respondBatch(c, batch.ID)
+}
+
+// ExportPayoutBatch downloads the bank transfer file paying the batch's
+// payouts made with ?method
+func (controller Controller) ExportPayoutBatch(c *gin.Context) {
+	batch := c.MustGet("batch").(models.PayoutBatch)
+
+	if batch.Status != models.PayoutApproved && batch.Status != models.PayoutSettled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only approved batches can be exported"})
+		return
+	}
+	method := c.Query("method")
+	if _, ok := payouts.Currency(method); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "method must be neft or ach"})
+		return
+	}
+
+	var file bytes.Buffer
+	if _, err := payouts.WriteBankFile(&file, method, batch.Payouts, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write bank file"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="payouts-%s-%s.csv"`, batch.ID, method))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", file.Bytes())
+}
+
+// SettlePayoutBatch records that an approved batch's transfers went out
+func (controller Controller) SettlePayoutBatch(c *gin.Context) {
+	batch := c.MustGet("batch").(models.PayoutBatch)
+
+	var req settleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.BankReference) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	reference := strings.TrimSpace(req.BankReference)
+	if reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bank_reference is required"})
+		return
+	}
+
+	entry, err := ledger.PayoutSettlement(batch, batch.Payouts, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle payout batch"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionPayoutBatchSettle, "payout_batch", batch.ID)
+	event.Changes = audit.Diff(
+		map[string]string{"status": batch.Status, "bank_reference": batch.BankReference},
+		map[string]string{"status": models.PayoutSettled, "bank_reference": reference})
+	settled, err := controller.Store.SettlePayoutBatch(c, batch.ID, c.MustGet("user_id").(int), reference, entry, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle payout batch"})
+		return
+	}
+	if !settled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only approved batches can be settled"})
+		return
+	}
+
+	controller.respondBatch(c, batch.ID)
+}
+
+// CancelPayoutBatch cancels a batch that hasn't been settled. Its payouts go
+// back to the instructors' balances for the next run.
+func (controller Controller) CancelPayoutBatch(c *gin.Context) {
+	batch := c.MustGet("batch").(models.PayoutBatch)
+
+	entry, err := ledger.PayoutCancellation(batch, batch.Payouts, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel payout batch"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionPayoutBatchCancel, "payout_batch", batch.ID)
+	event.Changes = audit.Diff(map[string]string{"status": batch.Status}, map[string]string{"status": models.PayoutCancelled})
+	cancelled, err := controller.Store.CancelPayoutBatch(c, batch.ID, entry, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel payout batch"})
+		return
+	}
+	if !cancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Settled batches can't be cancelled"})
+		return
+	}
+
+	controller.respondBatch(c, batch.ID)
+}
+
+// MyEarnings returns what the caller is owed in total and how much of it is
+// old enough to go out with the next payout run
+func (controller Controller) MyEarnings(c *gin.Context) {
+	account := ledger.InstructorAccount(c.MustGet("user_id").(int))
+
+	balances, err := controller.Store.SumLedger(c, models.LedgerFilter{Account: account})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get earnings"})
+		return
+	}
+	matured, err := controller.Store.SumMaturedLedger(c, account, time.Now().Add(-controller.PayoutConfig.Hold))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get earnings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, EarningsResponse{
+		Balance:   accountAmounts(account, balances),
+		Available: accountAmounts(account, matured),
+	})
+}
+
+// MyPayouts lists the payouts made or on their way to the caller
+func (controller Controller) MyPayouts(c *gin.Context) {
+	p, err := controller.Store.ListUserPayouts(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payouts"})
+		return
+	}
+	for i := range p {
+		p[i].AccountNumber = models.PayoutAccount{AccountNumber: p[i].AccountNumber}.Masked().AccountNumber
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// GetPayoutAccount returns the caller's payout account with its number masked
+func (controller Controller) GetPayoutAccount(c *gin.Context) {
+	account, err := controller.Store.GetPayoutAccount(c, c.MustGet("user_id").(int))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No payout account set"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payout account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account.Masked())
+}
+
+// SavePayoutAccount sets the bank account the caller is paid out to. Batches
+// already calculated keep paying the account they were calculated for.
+func (controller Controller) SavePayoutAccount(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+
+	if _, ok := c.Get("api_key_id"); ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys can't change payout accounts"})
+		return
+	}
+
+	var req payoutAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	account := models.PayoutAccount{
+		UserID:        userID,
+		Method:        req.Method,
+		AccountHolder: strings.TrimSpace(req.AccountHolder),
+		AccountNumber: strings.ReplaceAll(req.AccountNumber, " ", ""),
+		BankCode:      strings.ToUpper(strings.TrimSpace(req.BankCode)),
+		BankName:      strings.TrimSpace(req.BankName),
+	}
+
+	switch {
+	case account.Method == models.PayoutNEFT && !ifscPattern.MatchString(account.BankCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bank_code must be an IFSC"})
+		return
+	case account.Method == models.PayoutACH && !routingPattern.MatchString(account.BankCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bank_code must be a 9 digit routing number"})
+		return
+	case account.Method != models.PayoutNEFT && account.Method != models.PayoutACH:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "method must be neft or ach"})
+		return
+	case account.AccountHolder == "" || len(account.AccountHolder) > 100 || len(account.BankName) > 100:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account holder or bank name"})
+		return
+	case !accountNumberPattern.MatchString(account.AccountNumber):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account number"})
+		return
+	}
+
+	var before interface{}
+	existing, err := controller.Store.GetPayoutAccount(c, userID)
+	if err == nil {
+		before = existing.Masked()
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payout account"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionPayoutAccountUpdate, "user", strconv.Itoa(userID))
+	event.Changes = audit.Diff(before, account.Masked())
+	if err := controller.Store.SavePayoutAccount(c, account, event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payout account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account.Masked())
+}
+
+// respondBatch responds with the batch as it is now
+func (controller Controller) respondBatch(c *gin.Context, id string) {
+	batch, err := controller.Store.GetPayoutBatch(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payout batch"})
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
+
+// accountAmounts picks one account's balances out of a prefix sum, in the
+// account's usual direction
+func accountAmounts(account string, balances []models.AccountBalance) []AccountResponse {
+	amounts := []AccountResponse{}
+	for _, b := range balances {
+		if b.Account != account {
+			continue
+		}
+		amounts = append(amounts, AccountResponse{
+			Account:     b.Account,
+			Type:        ledger.TypeOf(b.Account),
+			Currency:    b.Currency,
+			AmountMinor: ledger.Natural(b.Account, b.AmountMinor),
+		})
+	}
+	return amounts
+}
+
+// shareSummary maps instructors to their share in basis points for the audit
+// log
+func shareSummary(shares []models.RevenueShare) map[string]int {
+	summary := map[string]int{}
+	for _, s := range shares {
+		summary[strconv.Itoa(s.UserID)] = s.ShareBps
+	}
+	return summary
+}
+
+type revenueSharesRequest struct {
+	Shares []struct {
+		UserID  int     `json:"user_id"`
+		Percent float64 `json:"percent"`
+	} `json:"shares"`
+	StartsAt *time.Time `json:"starts_at"`
+}
+
+type settleRequest struct {
+	BankReference string `json:"bank_reference"`
+}
+
+type payoutAccountRequest struct {
+	Method        string `json:"method"`
+	AccountHolder string `json:"account_holder"`
+	AccountNumber string `json:"account_number"`
+	BankCode      string `json:"bank_code"`
+	BankName      string `json:"bank_name"`
+}
+
+type RevenueSharesResponse struct {
+	// DefaultPercent is the author's share of courses without an agreement
+	DefaultPercent float64               `json:"default_percent"`
+	Shares         []models.RevenueShare `json:"shares"`
+}
+
+type PayoutRunResponse struct {
+	Batch   models.PayoutBatch `json:"batch"`
+	Skipped []payouts.Skipped  `json:"skipped"`
+}
+
+type EarningsResponse struct {
+	// Balance is everything the instructor is owed
+	Balance []AccountResponse `json:"balance"`
+	// Available is the part of it the next payout run pays out
+	Available []AccountResponse `json:"available"`
+}
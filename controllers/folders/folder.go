@@ -1,6 +1,7 @@
 package folders
 
 import (
+	"fintech/pkg/audit"
 	"fintech/pkg/vdo"
 	"fintech/store"
 	"fintech/store/models"
@@ -44,7 +45,9 @@ func (controller Controller) Create(c *gin.Context) {
 		UpdatedAt:   time.Now(),
 	}
 
-	err = controller.Store.CreateFolder(c, folder)
+	event := audit.FromRequest(c, audit.ActionFolderCreate, "folder", folder.ID.String())
+	event.Changes = audit.Diff(nil, folder)
+	err = controller.Store.CreateFolder(c, folder, event)
 	if err != nil {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Folder ID already exists"})
@@ -60,6 +63,7 @@ func (controller Controller) Create(c *gin.Context) {
 
 func (controller Controller) Update(c *gin.Context) {
 	folder := c.MustGet("folder").(models.Folder)
+	before := folder
 	var req mutateRequest
 	req.Description = folder.Description
 	req.Name = folder.Name
@@ -70,7 +74,11 @@ func (controller Controller) Update(c *gin.Context) {
 
 	folder.Description = req.Description
 	folder.Name = req.Name
-	err := controller.Store.UpdateFolder(c, folder)
+	folder.UpdatedAt = time.Now()
+
+	event := audit.FromRequest(c, audit.ActionFolderUpdate, "folder", folder.ID.String())
+	event.Changes = audit.Diff(before, folder)
+	err := controller.Store.UpdateFolder(c, folder, event)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
@@ -113,7 +121,10 @@ func (controller Controller) Get(c *gin.Context) {
 
 func (controller Controller) Delete(c *gin.Context) {
 	folder := c.MustGet("folder").(models.Folder)
-	err := controller.Store.DeleteFolder(c, folder.ID.String())
+
+	event := audit.FromRequest(c, audit.ActionFolderDelete, "folder", folder.ID.String())
+	event.Changes = audit.Diff(folder, nil)
+	err := controller.Store.DeleteFolder(c, folder.ID.String(), event)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
@@ -164,6 +175,17 @@ func (controller Controller) Upload(c *gin.Context) {
 		return
 	}
 
+	// Nothing is stored on our side for uploads, so the event is the only record
+	event := audit.FromRequest(c, audit.ActionFolderUpload, "folder", folder.ID.String())
+	event.Status = http.StatusOK
+	event.Details = audit.Details(map[string]interface{}{
+		"video_id": credentials.FileName,
+		"title":    videoTitle,
+		"filename": file.Filename,
+		"size":     file.Size,
+	})
+	audit.Record(c, controller.Store, event)
+
 	c.JSON(http.StatusOK, gin.H{"videoID": credentials.FileName})
 }
 
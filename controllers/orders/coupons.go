@@ -0,0 +1,439 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/pkg/coupons"
+	"fintech/pkg/ledger"
+	"fintech/pkg/payments"
+	"fintech/store/models"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	codePattern     = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{2,39}$`)
+	categoryPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// Quote prices a cart of courses with the coupons the buyer entered. Each
+// course is bought with its own order, so each line is priced as its
+// checkout would be, with coupons used on earlier lines counting towards
+// their limits on later ones.
+func (controller Controller) Quote(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+
+	var req quoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.CourseIDs) == 0 || len(req.CourseIDs) > 20 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	codes, ok := normalizeCodes(req.Coupons)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d coupons can be used", coupons.MaxPerOrder)})
+		return
+	}
+	found, err := controller.Store.GetCouponsByCode(c, codes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get coupons"})
+		return
+	}
+
+	resp := QuoteResponse{Lines: []QuoteLine{}, Totals: []QuoteTotal{}}
+	totals := map[string]int{}
+	usage := map[int64]*models.CouponUsage{}
+	for _, courseID := range req.CourseIDs {
+		line := QuoteLine{CourseID: courseID, Rejected: []RejectedCoupon{}}
+
+		course, err := controller.Store.GetCourse(c, courseID)
+		if errors.Is(err, sql.ErrNoRows) {
+			line.Error = "Course not found"
+			resp.Lines = append(resp.Lines, line)
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get course"})
+			return
+		}
+		if reason, err := controller.cantBuy(c, userID, course); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get enrollment"})
+			return
+		} else if reason != "" {
+			line.Error = reason
+			resp.Lines = append(resp.Lines, line)
+			continue
+		}
+
+		line.Price, line.Rejected, err = controller.priceCourse(c, userID, course, codes, found, usage)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price course"})
+			return
+		}
+		resp.Lines = append(resp.Lines, line)
+
+		i, ok := totals[course.Currency]
+		if !ok {
+			i = len(resp.Totals)
+			totals[course.Currency] = i
+			resp.Totals = append(resp.Totals, QuoteTotal{Currency: course.Currency})
+		}
+		total := &resp.Totals[i]
+		total.ListMinor += line.ListMinor
+		total.DiscountMinor += line.DiscountMinor
+		total.TotalMinor += line.TotalMinor
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// cantBuy returns why the buyer can't check out the course, or nothing if
+// they can
+func (controller Controller) cantBuy(ctx context.Context, userID int, course models.Course) (string, error) {
+	if course.PriceMinor == 0 {
+		return "Free courses don't need to be purchased", nil
+	}
+
+	enrollment, err := controller.Store.GetEnrollment(ctx, userID, course.ID.String())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	if err == nil && enrollment.Active() {
+		return "Already enrolled in this course", nil
+	}
+	return "", nil
+}
+
+// priceCourse prices the course for the buyer with the coupons entered as
+// codes, found being the coupons that exist. Coupons that can't be used are
+// rejected and left out. usage caches what holds each coupon and counts the
+// redemptions this price would add.
+func (controller Controller) priceCourse(ctx context.Context, userID int, course models.Course, codes []string, found []models.Coupon, usage map[int64]*models.CouponUsage) (coupons.Price, []RejectedCoupon, error) {
+	byCode := map[string]models.Coupon{}
+	for _, coupon := range found {
+		byCode[coupon.Code] = coupon
+	}
+
+	now := time.Now()
+	rejected := []RejectedCoupon{}
+	var usable []models.Coupon
+	for _, code := range codes {
+		coupon, ok := byCode[code]
+		if !ok {
+			rejected = append(rejected, RejectedCoupon{Code: code, Reason: "coupon not found"})
+			continue
+		}
+		if _, ok := usage[coupon.ID]; !ok {
+			u, err := controller.Store.GetCouponUsage(ctx, coupon.ID, userID)
+			if err != nil {
+				return coupons.Price{}, nil, err
+			}
+			usage[coupon.ID] = &u
+		}
+		if err := coupons.Check(coupon, course, *usage[coupon.ID], now); err != nil {
+			rejected = append(rejected, RejectedCoupon{Code: code, Reason: err.Error()})
+			continue
+		}
+		usable = append(usable, coupon)
+	}
+
+	price, err := coupons.Apply(course, usable)
+	if errors.Is(err, coupons.ErrNotStackable) || errors.Is(err, coupons.ErrTooMany) {
+		for _, coupon := range usable {
+			rejected = append(rejected, RejectedCoupon{Code: coupon.Code, Reason: err.Error()})
+		}
+		price, err = coupons.Apply(course, nil)
+	}
+	if err != nil {
+		return price, rejected, err
+	}
+
+	for _, d := range price.Discounts {
+		usage[d.CouponID].Total++
+		usage[d.CouponID].ByUser++
+	}
+	return price, rejected, nil
+}
+
+// CreateCoupon creates a coupon. Percent coupons take percent off the
+// course's price, fixed ones amount_minor in currency.
+func (controller Controller) CreateCoupon(c *gin.Context) {
+	var req createCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Description) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	coupon := models.Coupon{
+		Code:           strings.ToUpper(strings.TrimSpace(req.Code)),
+		Description:    strings.TrimSpace(req.Description),
+		Kind:           req.Kind,
+		AmountMinor:    req.AmountMinor,
+		Currency:       req.Currency,
+		MinOrderMinor:  req.MinOrderMinor,
+		CourseID:       req.CourseID,
+		Category:       req.Category,
+		MaxRedemptions: req.MaxRedemptions,
+		PerUserLimit:   req.PerUserLimit,
+		Stackable:      req.Stackable,
+		StartsAt:       time.Now(),
+		EndsAt:         req.EndsAt,
+		CreatedBy:      c.MustGet("user_id").(int),
+	}
+	if req.StartsAt != nil {
+		coupon.StartsAt = *req.StartsAt
+	}
+	if coupon.Kind == models.CouponPercent {
+		coupon.PercentBps = int(ledger.Percent(req.Percent))
+	}
+
+	if msg := validateCoupon(coupon); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if coupon.CourseID != nil {
+		course, err := controller.Store.GetCourse(c, *coupon.CourseID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Course not found"})
+			return
+		}
+		if coupon.Currency != "" && coupon.Currency != course.Currency {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "currency must match the course's"})
+			return
+		}
+	}
+
+	event := audit.FromRequest(c, audit.ActionCouponCreate, "coupon", "")
+	event.Changes = audit.Diff(nil, coupon)
+	id, err := controller.Store.CreateCoupon(c, coupon, event)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create coupon"})
+		return
+	}
+
+	coupon, err = controller.Store.GetCoupon(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get coupon"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CouponResponse{Coupon: coupon})
+}
+
+// ListCoupons lists coupons, newest first
+func (controller Controller) ListCoupons(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	found, err := controller.Store.ListCoupons(c, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list coupons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, found)
+}
+
+// GetCoupon returns a coupon with how many redemptions currently hold it
+func (controller Controller) GetCoupon(c *gin.Context) {
+	coupon := c.MustGet("coupon").(models.Coupon)
+
+	usage, err := controller.Store.GetCouponUsage(c, coupon.ID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count redemptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, CouponResponse{Coupon: coupon, Redemptions: usage.Total})
+}
+
+// UpdateCoupon changes a coupon's description, limits, stacking and end, or
+// disables it. What it takes off and what it applies to are fixed once it's
+// been handed out.
+func (controller Controller) UpdateCoupon(c *gin.Context) {
+	coupon := c.MustGet("coupon").(models.Coupon)
+	before := coupon
+
+	req := updateCouponRequest{
+		Description:    coupon.Description,
+		MaxRedemptions: coupon.MaxRedemptions,
+		PerUserLimit:   coupon.PerUserLimit,
+		Stackable:      coupon.Stackable,
+		EndsAt:         coupon.EndsAt,
+		Disabled:       coupon.DisabledAt != nil,
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Description) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	coupon.Description = strings.TrimSpace(req.Description)
+	coupon.MaxRedemptions = req.MaxRedemptions
+	coupon.PerUserLimit = req.PerUserLimit
+	coupon.Stackable = req.Stackable
+	coupon.EndsAt = req.EndsAt
+	if !req.Disabled {
+		coupon.DisabledAt = nil
+	} else if coupon.DisabledAt == nil {
+		now := time.Now()
+		coupon.DisabledAt = &now
+	}
+	if msg := validateCoupon(coupon); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionCouponUpdate, "coupon", strconv.FormatInt(coupon.ID, 10))
+	event.Changes = audit.Diff(before, coupon)
+	if err := controller.Store.UpdateCoupon(c, coupon, event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update coupon"})
+		return
+	}
+
+	controller.GetCoupon(c)
+}
+
+// ListCouponRedemptions lists the orders a coupon was used on, newest first
+func (controller Controller) ListCouponRedemptions(c *gin.Context) {
+	coupon := c.MustGet("coupon").(models.Coupon)
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	redemptions, err := controller.Store.ListCouponRedemptions(c, coupon.ID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list redemptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, redemptions)
+}
+
+// validateCoupon returns what's wrong with the coupon, or nothing
+func validateCoupon(c models.Coupon) string {
+	switch {
+	case !codePattern.MatchString(c.Code):
+		return "code must be 3 to 40 letters, digits, dashes or underscores"
+	case c.Kind == models.CouponPercent && (c.PercentBps <= 0 || c.PercentBps > int(ledger.Percent(100)) || c.AmountMinor != 0):
+		return "percent coupons need a percent above 0 and up to 100"
+	case c.Kind == models.CouponFixed && (c.AmountMinor <= 0 || c.Currency == ""):
+		return "fixed coupons need a positive amount_minor and a currency"
+	case c.Kind != models.CouponPercent && c.Kind != models.CouponFixed:
+		return "kind must be percent or fixed"
+	case c.Currency != "" && !payments.SupportedCurrency(c.Currency):
+		return "Unsupported currency"
+	case c.MinOrderMinor < 0 || (c.MinOrderMinor > 0 && c.Currency == ""):
+		return "min_order_minor needs a currency and can't be negative"
+	case c.Category != "" && (len(c.Category) > 50 || !categoryPattern.MatchString(c.Category)):
+		return "category must be a lower case slug of up to 50 characters"
+	case (c.MaxRedemptions != nil && *c.MaxRedemptions <= 0) || (c.PerUserLimit != nil && *c.PerUserLimit <= 0):
+		return "Redemption limits must be above zero"
+	case c.EndsAt != nil && !c.EndsAt.After(c.StartsAt):
+		return "ends_at must be after starts_at"
+	}
+	return ""
+}
+
+// normalizeCodes upper cases the codes and drops repeats, reporting false if
+// there are more than an order may use
+func normalizeCodes(codes []string) ([]string, bool) {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		normalized = append(normalized, code)
+	}
+	return normalized, len(normalized) <= coupons.MaxPerOrder
+}
+
+type quoteRequest struct {
+	CourseIDs []string `json:"course_ids"`
+	Coupons   []string `json:"coupons"`
+}
+
+type createCouponRequest struct {
+	Code           string     `json:"code"`
+	Description    string     `json:"description"`
+	Kind           string     `json:"kind"`
+	Percent        float64    `json:"percent"`
+	AmountMinor    int64      `json:"amount_minor"`
+	Currency       string     `json:"currency"`
+	MinOrderMinor  int64      `json:"min_order_minor"`
+	CourseID       *string    `json:"course_id"`
+	Category       string     `json:"category"`
+	MaxRedemptions *int       `json:"max_redemptions"`
+	PerUserLimit   *int       `json:"per_user_limit"`
+	Stackable      bool       `json:"stackable"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+}
+
+type updateCouponRequest struct {
+	Description    string     `json:"description"`
+	MaxRedemptions *int       `json:"max_redemptions"`
+	PerUserLimit   *int       `json:"per_user_limit"`
+	Stackable      bool       `json:"stackable"`
+	EndsAt         *time.Time `json:"ends_at"`
+	Disabled       bool       `json:"disabled"`
+}
+
+// RejectedCoupon is a coupon the buyer entered that can't be used, and why
+type RejectedCoupon struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+type QuoteLine struct {
+	CourseID string `json:"course_id"`
+	coupons.Price
+	Rejected []RejectedCoupon `json:"rejected"`
+	// Error is why the course can't be bought, in which case it isn't priced
+	Error string `json:"error,omitempty"`
+}
+
+type QuoteTotal struct {
+	Currency      string `json:"currency"`
+	ListMinor     int64  `json:"list_minor"`
+	DiscountMinor int64  `json:"discount_minor"`
+	TotalMinor    int64  `json:"total_minor"`
+}
+
+type QuoteResponse struct {
+	Lines []QuoteLine `json:"lines"`
+	// Totals add up the lines that can be bought, per currency
+	Totals []QuoteTotal `json:"totals"`
+}
+
+type CouponResponse struct {
+	models.Coupon
+	// Redemptions is how many redemptions count towards the coupon's limit
+	Redemptions int `json:"redemptions"`
+}
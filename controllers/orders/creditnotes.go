@@ -0,0 +1,102 @@
+package orders
+
+import (
+	"bytes"
+	"context"
+	"fintech/pkg/invoices"
+	"fintech/store/models"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// renderCreditNote writes the credit note document to storage and records
+// where it is
+func (controller Controller) renderCreditNote(ctx context.Context, note models.CreditNote) (models.CreditNote, error) {
+	order, err := controller.Store.GetOrder(ctx, note.OrderID)
+	if err != nil {
+		return note, err
+	}
+	course, err := controller.Store.GetCourse(ctx, order.CourseID)
+	if err != nil {
+		return note, err
+	}
+
+	// Notes of orders paid before invoicing name the buyer as they are now
+	var invoice *models.Invoice
+	buyer := ""
+	if note.InvoiceID != nil {
+		i, err := controller.Store.GetInvoiceByOrder(ctx, note.OrderID)
+		if err != nil {
+			return note, err
+		}
+		invoice = &i
+	} else {
+		buyers, err := controller.Store.GetUserSummaries(ctx, []int{note.UserID})
+		if err != nil {
+			return note, err
+		}
+		buyer = buyers[note.UserID].Name
+	}
+
+	var buf bytes.Buffer
+	if err := invoices.CreditNote(&buf, controller.GST, note, invoice, buyer, course.Name); err != nil {
+		return note, err
+	}
+
+	key := fmt.Sprintf("credit-notes/%d.pdf", note.ID)
+	if err := controller.Storage.Put(ctx, key, &buf, invoices.ContentType); err != nil {
+		return note, err
+	}
+	if err := controller.Store.SetCreditNoteKey(ctx, note.ID, key); err != nil {
+		return note, err
+	}
+
+	note.StorageKey = key
+	return note, nil
+}
+
+// renderInvoice writes the invoice PDF to storage and records where it is.
+// Invoices are rendered when first downloaded, since orders are also paid
+// through webhooks.
+func (controller Controller) renderInvoice(ctx context.Context, invoice models.Invoice) (models.Invoice, error) {
+	order, err := controller.Store.GetOrder(ctx, invoice.OrderID)
+	if err != nil {
+		return invoice, err
+	}
+	course, err := controller.Store.GetCourse(ctx, order.CourseID)
+	if err != nil {
+		return invoice, err
+	}
+
+	var buf bytes.Buffer
+	if err := invoices.Invoice(&buf, controller.GST, invoice, course.Name); err != nil {
+		return invoice, err
+	}
+
+	key := fmt.Sprintf("invoices/%d.pdf", invoice.ID)
+	if err := controller.Storage.Put(ctx, key, &buf, invoices.ContentType); err != nil {
+		return invoice, err
+	}
+	if err := controller.Store.SetInvoiceKey(ctx, invoice.ID, key); err != nil {
+		return invoice, err
+	}
+
+	invoice.StorageKey = key
+	return invoice, nil
+}
+
+// documentType is the content type of a stored document. Credit notes issued
+// before invoicing were plain text.
+func documentType(key string) string {
+	if path.Ext(key) == ".txt" {
+		return "text/plain; charset=utf-8"
+	}
+	return invoices.ContentType
+}
+
+// documentName turns a document number into a file name, e.g.
+// INV-26-27-000001
+func documentName(number string) string {
+	return strings.ReplaceAll(number, "/", "-")
+}
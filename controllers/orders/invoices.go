@@ -0,0 +1,46 @@
+package orders
+
+import (
+	"database/sql"
+	"errors"
+	"fintech/store/models"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Invoice downloads the order's invoice as PDF
+func (controller Controller) Invoice(c *gin.Context) {
+	order := c.MustGet("order").(models.Order)
+
+	invoice, err := controller.Store.GetInvoiceByOrder(c, order.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order has no invoice"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get invoice"})
+		return
+	}
+	if invoice.StorageKey == "" {
+		if invoice, err = controller.renderInvoice(c, invoice); err != nil {
+			log.Printf("failed to render invoice %s: %v", invoice.Number, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render invoice"})
+			return
+		}
+	}
+
+	r, err := controller.Storage.Get(c, invoice.StorageKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read invoice"})
+		return
+	}
+	defer r.Close()
+
+	c.Header("Cache-Control", "no-store")
+	c.DataFromReader(http.StatusOK, -1, documentType(invoice.StorageKey), r, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s.pdf"`, documentName(invoice.Number)),
+	})
+}
@@ -0,0 +1,329 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/pkg/coupons"
+	"fintech/pkg/gst"
+	"fintech/pkg/ledger"
+	"fintech/pkg/payments"
+	"fintech/pkg/refunds"
+	"fintech/pkg/storage"
+	"fintech/pkg/vdo"
+	"fintech/store"
+	"fintech/store/models"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type Controller struct {
+	Store store.Store
+	// Gateway is nil when no payment gateway is configured
+	Gateway payments.PaymentGateway
+	// Worker applies received webhooks
+	Worker *WebhookWorker
+	// PlatformFee is the platform's cut of each sale
+	PlatformFee ledger.Rate
+	// GST is charged on sales and printed on invoices
+	GST gst.Config
+	// RefundPolicy decides which refunds go through without approval
+	RefundPolicy refunds.Policy
+	// Storage holds invoices and credit notes
+	Storage storage.Storage
+	// VDO counts course videos for the refund policy
+	VDO *vdo.VideoCipherClient
+}
+
+// Checkout places an order for the course on the payment gateway, with the
+// coupons the buyer entered taken off. The client pays it through the
+// gateway's checkout and then confirms the payment.
+func (controller Controller) Checkout(c *gin.Context) {
+	course := c.MustGet("course").(models.Course)
+	userID := c.MustGet("user_id").(int)
+
+	if _, ok := c.Get("api_key_id"); ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys can't buy courses"})
+		return
+	}
+	if controller.Gateway == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not available"})
+		return
+	}
+	if course.PriceMinor == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Free courses don't need to be purchased"})
+		return
+	}
+
+	// The body is optional for checkouts without coupons
+	var req checkoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	codes, ok := normalizeCodes(req.Coupons)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d coupons can be used", coupons.MaxPerOrder)})
+		return
+	}
+
+	reason, err := controller.cantBuy(c, userID, course)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get enrollment"})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": reason})
+		return
+	}
+
+	found, err := controller.Store.GetCouponsByCode(c, codes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get coupons"})
+		return
+	}
+	price, rejected, err := controller.priceCourse(c, userID, course, codes, found, map[int64]*models.CouponUsage{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price course"})
+		return
+	}
+	if len(rejected) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Some coupons can't be used", "rejected": rejected})
+		return
+	}
+
+	order := models.Order{
+		ID:            uuid.NewString(),
+		UserID:        userID,
+		CourseID:      course.ID.String(),
+		AmountMinor:   price.TotalMinor,
+		DiscountMinor: price.DiscountMinor,
+		Currency:      course.Currency,
+		Status:        models.OrderPending,
+		Gateway:       controller.Gateway.Name(),
+	}
+	redemptions := make([]models.CouponRedemption, 0, len(price.Discounts))
+	for _, d := range price.Discounts {
+		redemptions = append(redemptions, models.CouponRedemption{
+			CouponID:      d.CouponID,
+			OrderID:       order.ID,
+			UserID:        userID,
+			DiscountMinor: d.AmountMinor,
+			Currency:      order.Currency,
+		})
+	}
+
+	checkout, err := controller.Gateway.CreateOrder(c, payments.Order{
+		Receipt:  order.ID,
+		Amount:   order.AmountMinor,
+		Currency: order.Currency,
+	})
+	if err != nil {
+		log.Printf("failed to create %s order: %v", order.Gateway, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to start checkout"})
+		return
+	}
+	order.GatewayOrderID = checkout.OrderID
+
+	err = controller.Store.CreateOrder(c, order, redemptions)
+	if errors.Is(err, models.ErrCouponLimitReached) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A coupon ran out of redemptions, check out again"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
+	}
+
+	order, err = controller.Store.GetOrder(c, order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CheckoutResponse{Order: order, Checkout: checkout})
+}
+
+// Confirm verifies the payment the client made for the order with the
+// gateway, then enrolls the buyer. Confirming a settled order again just
+// returns it.
+func (controller Controller) Confirm(c *gin.Context) {
+	order := c.MustGet("order").(models.Order)
+
+	var req confirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	// Only the payment ID the gateway vouches for is stored, since refunds
+	// are made against it
+	paymentID := order.GatewayPaymentID
+	if order.CanTransition(models.OrderPaid) {
+		if controller.Gateway == nil || controller.Gateway.Name() != order.Gateway {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not available"})
+			return
+		}
+
+		var err error
+		paymentID, err = controller.Gateway.VerifyPayment(c, payments.Payment{
+			OrderID:   order.GatewayOrderID,
+			PaymentID: req.PaymentID,
+			Signature: req.Signature,
+		})
+		if errors.Is(err, payments.ErrNotPaid) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment could not be verified"})
+			return
+		}
+		if err != nil {
+			log.Printf("failed to verify payment of order %s: %v", order.ID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify payment"})
+			return
+		}
+	}
+
+	order, err := Settle(c, controller.Store, controller.Gateway, order, paymentID, controller.PlatformFee, controller.GST)
+	if errors.Is(err, models.ErrCouponLimitReached) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A coupon ran out before the payment completed, so it has been refunded"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (controller Controller) Get(c *gin.Context) {
+	c.JSON(http.StatusOK, c.MustGet("order").(models.Order))
+}
+
+// ListMine lists the caller's orders, newest first
+func (controller Controller) ListMine(c *gin.Context) {
+	orders, err := controller.Store.ListUserOrders(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// Settle records a verified payment in the ledger, invoices it and enrolls
+// the buyer. It only moves the order forward, so calling it again for a
+// settled order, or for a payment reported twice, changes nothing.
+//
+// Payments made after the order's coupons stopped being held for it, which
+// the coupons no longer have room for, are refunded through the gateway
+// instead, and models.ErrCouponLimitReached is returned.
+func Settle(ctx context.Context, db store.Store, gateway payments.PaymentGateway, order models.Order, paymentID string, fee ledger.Rate, tax gst.Config) (models.Order, error) {
+	if order.CanTransition(models.OrderPaid) {
+		at := time.Now()
+		buyer, err := billingProfile(ctx, db, order.UserID)
+		if err != nil {
+			return order, err
+		}
+		invoice := gst.NewInvoice(tax, order, buyer, at)
+
+		entry, err := paymentEntry(ctx, db, order, fee, gst.Legs(invoice.GSTAmounts, order.Currency), at)
+		if err != nil {
+			return order, err
+		}
+		_, err = db.MarkOrderPaid(ctx, order.ID, paymentID, entry, invoice)
+		if errors.Is(err, models.ErrCouponLimitReached) {
+			return order, void(ctx, db, gateway, order, paymentID)
+		}
+		if err != nil {
+			return order, err
+		}
+	}
+	if _, err := db.FulfillOrder(ctx, order); err != nil {
+		return order, err
+	}
+
+	return db.GetOrder(ctx, order.ID)
+}
+
+// void refunds a payment the order can't accept in full. The order's ID is
+// the receipt, so a retried void won't refund twice.
+func void(ctx context.Context, db store.Store, gateway payments.PaymentGateway, order models.Order, paymentID string) error {
+	if gateway == nil || gateway.Name() != order.Gateway {
+		return fmt.Errorf("gateway %s isn't configured to refund order %s", order.Gateway, order.ID)
+	}
+	_, err := gateway.Refund(ctx, payments.RefundRequest{
+		PaymentID: paymentID,
+		Amount:    order.AmountMinor,
+		Currency:  order.Currency,
+		Receipt:   order.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refund order %s after its coupon ran out: %w", order.ID, err)
+	}
+	if _, err := db.VoidOrder(ctx, order.ID, paymentID); err != nil {
+		return err
+	}
+
+	log.Printf("refunded order %s, paid after its coupon ran out", order.ID)
+	return models.ErrCouponLimitReached
+}
+
+// billingProfile returns what the buyer wants on their invoices, their
+// account name for buyers who haven't said
+func billingProfile(ctx context.Context, db store.Store, userID int) (models.BillingProfile, error) {
+	profile, err := db.GetBillingProfile(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return profile, err
+	}
+	if profile.LegalName == "" {
+		user, err := db.GetUser(ctx, userID)
+		if err != nil {
+			return profile, err
+		}
+		profile.LegalName = user.Name
+	}
+	return profile, nil
+}
+
+// paymentEntry splits the order's payment, less the taxes collected with it,
+// by the course's revenue share agreement in effect at the time. Courses
+// without one pay the author all but the platform's fee.
+func paymentEntry(ctx context.Context, db store.Store, order models.Order, fee ledger.Rate, taxes []ledger.Leg, at time.Time) (models.JournalEntry, error) {
+	agreement, err := db.GetRevenueShares(ctx, order.CourseID, at)
+	if err != nil {
+		return models.JournalEntry{}, err
+	}
+
+	var shares []ledger.Share
+	for _, s := range agreement {
+		shares = append(shares, ledger.Share{UserID: s.UserID, Rate: ledger.Rate(s.ShareBps)})
+	}
+	if len(shares) == 0 {
+		course, err := db.GetCourse(ctx, order.CourseID)
+		if err != nil {
+			return models.JournalEntry{}, err
+		}
+		shares = []ledger.Share{{UserID: course.AuthorID, Rate: ledger.Percent(100) - fee}}
+	}
+	return ledger.Payment(order, shares, taxes, at)
+}
+
+type checkoutRequest struct {
+	Coupons []string `json:"coupons"`
+}
+
+type confirmRequest struct {
+	PaymentID string `json:"payment_id"`
+	Signature string `json:"signature"`
+}
+
+type CheckoutResponse struct {
+	Order    models.Order      `json:"order"`
+	Checkout payments.Checkout `json:"checkout"`
+}
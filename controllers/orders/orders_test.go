@@ -0,0 +1,202 @@
+package orders
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fintech/pkg/gst"
+	"fintech/pkg/ledger"
+	"fintech/pkg/payments"
+	"fintech/store"
+	"fintech/store/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// orderStore keeps one order in memory, with what settling it touches.
+// Anything else it's asked for panics on the nil Store.
+type orderStore struct {
+	store.Store
+
+	order  models.Order
+	course models.Course
+	// couponsGone makes MarkOrderPaid fail as if a coupon ran out
+	couponsGone bool
+	entry       models.JournalEntry
+}
+
+func (s *orderStore) GetOrder(context.Context, string) (models.Order, error) {
+	return s.order, nil
+}
+
+func (s *orderStore) GetCourse(context.Context, string) (models.Course, error) {
+	return s.course, nil
+}
+
+func (s *orderStore) GetUser(_ context.Context, id int) (models.User, error) {
+	return models.User{ID: id, Name: "Buyer"}, nil
+}
+
+func (s *orderStore) GetBillingProfile(context.Context, int) (models.BillingProfile, error) {
+	return models.BillingProfile{}, sql.ErrNoRows
+}
+
+func (s *orderStore) GetRevenueShares(context.Context, string, time.Time) ([]models.RevenueShare, error) {
+	return nil, nil
+}
+
+func (s *orderStore) MarkOrderPaid(_ context.Context, _, paymentID string, entry models.JournalEntry, _ models.Invoice) (bool, error) {
+	if s.couponsGone {
+		return false, models.ErrCouponLimitReached
+	}
+	s.entry = entry
+	s.order.Status = models.OrderPaid
+	s.order.GatewayPaymentID = paymentID
+	return true, nil
+}
+
+func (s *orderStore) VoidOrder(_ context.Context, _, paymentID string) (bool, error) {
+	s.order.Status = models.OrderFailed
+	s.order.GatewayPaymentID = paymentID
+	return true, nil
+}
+
+func (s *orderStore) FulfillOrder(context.Context, models.Order) (bool, error) {
+	if s.order.Status == models.OrderPaid {
+		s.order.Status = models.OrderFulfilled
+	}
+	return true, nil
+}
+
+type orderHarness struct {
+	gateway *payments.Fake
+	store   *orderStore
+	router  *gin.Engine
+}
+
+// newOrderHarness places an order on the fake gateway, ready to be confirmed
+func newOrderHarness(t *testing.T) *orderHarness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	gateway := payments.NewFake("secret")
+	checkout, err := gateway.CreateOrder(context.Background(), payments.Order{Receipt: "order", Amount: 50000, Currency: "INR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &orderHarness{
+		gateway: gateway,
+		store: &orderStore{
+			order: models.Order{
+				ID:             "order",
+				UserID:         1,
+				CourseID:       "course",
+				AmountMinor:    50000,
+				Currency:       "INR",
+				Status:         models.OrderPending,
+				Gateway:        gateway.Name(),
+				GatewayOrderID: checkout.OrderID,
+			},
+			course: models.Course{ID: uuid.New(), AuthorID: 2, PriceMinor: 50000, Currency: "INR"},
+		},
+		router: gin.New(),
+	}
+	controller := Controller{Store: h.store, Gateway: gateway, PlatformFee: ledger.Percent(20), GST: gst.Config{}}
+	h.router.POST("/orders/:order_id/confirm", func(c *gin.Context) {
+		c.Set("order", h.store.order)
+	}, controller.Confirm)
+	return h
+}
+
+func (h *orderHarness) confirm(paymentID, signature string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(confirmRequest{PaymentID: paymentID, Signature: signature})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/orders/order/confirm", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	h.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestConfirmSettlesSignedPayment(t *testing.T) {
+	h := newOrderHarness(t)
+
+	w := h.confirm("pay_1", h.gateway.Sign(h.store.order.GatewayOrderID, "pay_1"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirm returned %d: %s", w.Code, w.Body)
+	}
+	if h.store.order.Status != models.OrderFulfilled || h.store.order.GatewayPaymentID != "pay_1" {
+		t.Errorf("order is %s with payment %q", h.store.order.Status, h.store.order.GatewayPaymentID)
+	}
+
+	var total int64
+	for _, l := range h.store.entry.Lines {
+		total += l.AmountMinor
+	}
+	if len(h.store.entry.Lines) == 0 || total != 0 {
+		t.Errorf("payment entry has %d lines summing to %d", len(h.store.entry.Lines), total)
+	}
+
+	// Confirming again finds the order settled
+	if w := h.confirm("pay_1", "anything"); w.Code != http.StatusOK {
+		t.Errorf("second confirm returned %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestConfirmRejectsUnsignedPayment(t *testing.T) {
+	tests := []struct {
+		name string
+		sign func(h *orderHarness) string
+	}{
+		{"no signature", func(h *orderHarness) string { return "" }},
+		{"signed with another secret", func(h *orderHarness) string {
+			return payments.NewFake("other").Sign(h.store.order.GatewayOrderID, "pay_1")
+		}},
+		{"signature for another payment", func(h *orderHarness) string {
+			return h.gateway.Sign(h.store.order.GatewayOrderID, "pay_2")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newOrderHarness(t)
+
+			if w := h.confirm("pay_1", tt.sign(h)); w.Code != http.StatusPaymentRequired {
+				t.Fatalf("confirm returned %d, want 402: %s", w.Code, w.Body)
+			}
+			if h.store.order.Status != models.OrderPending {
+				t.Errorf("order moved to %s", h.store.order.Status)
+			}
+		})
+	}
+}
+
+func TestConfirmRefundsPaymentOnceWhenCouponRanOut(t *testing.T) {
+	h := newOrderHarness(t)
+	h.store.couponsGone = true
+
+	w := h.confirm("pay_1", h.gateway.Sign(h.store.order.GatewayOrderID, "pay_1"))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("confirm returned %d, want 409: %s", w.Code, w.Body)
+	}
+	if h.store.order.Status != models.OrderFailed {
+		t.Errorf("order is %s, want failed", h.store.order.Status)
+	}
+
+	// The order is the receipt, so voiding again finds the same refund
+	refund := payments.RefundRequest{PaymentID: "pay_1", Amount: 50000, Currency: "INR", Receipt: "order"}
+	first, err := h.gateway.Refund(context.Background(), refund)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := h.gateway.Refund(context.Background(), refund)
+	if err != nil || again != first {
+		t.Errorf("retried refund returned %q, %v, want %q", again, err, first)
+	}
+}
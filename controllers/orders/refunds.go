@@ -0,0 +1,473 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/pkg/gst"
+	"fintech/pkg/ledger"
+	"fintech/pkg/payments"
+	"fintech/pkg/refunds"
+	"fintech/store/models"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// refundStuckAfter is how long a refund has to be processing before an admin
+// can retry it, so a retry doesn't race a request still waiting on the gateway
+const refundStuckAfter = 15 * time.Minute
+
+// RequestRefund asks for a refund of the caller's order, of whatever is left
+// of the payment unless amount_minor says otherwise. Full refunds within the
+// refund policy go to the gateway straight away; the rest, partial refunds
+// included, wait for an admin.
+func (controller Controller) RequestRefund(c *gin.Context) {
+	order := c.MustGet("order").(models.Order)
+	userID := c.MustGet("user_id").(int)
+
+	if _, ok := c.Get("api_key_id"); ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys can't request refunds"})
+		return
+	}
+
+	refund, ok := newRefund(c, order, userID)
+	if !ok {
+		return
+	}
+
+	broken := controller.RefundPolicy.Check(controller.usage(c, order), time.Now())
+	if refund.AmountMinor < order.AmountMinor-order.RefundedMinor {
+		broken = append(broken, "partial refund")
+	}
+	refund.WithinPolicy = len(broken) == 0
+	refund.PolicyNotes = strings.Join(broken, "; ")
+	if !refund.WithinPolicy {
+		refund.Status = models.RefundPendingApproval
+	}
+
+	event := audit.FromRequest(c, audit.ActionRefundRequest, "refund", refund.ID)
+	event.Changes = audit.Diff(nil, refund)
+	controller.createRefund(c, order, refund, event)
+}
+
+// CreateRefund refunds an order on an admin's behalf, without the refund
+// policy applying
+func (controller Controller) CreateRefund(c *gin.Context) {
+	order := c.MustGet("order").(models.Order)
+
+	refund, ok := newRefund(c, order, c.MustGet("user_id").(int))
+	if !ok {
+		return
+	}
+	refund.PolicyNotes = "issued by an admin"
+
+	event := audit.FromRequest(c, audit.ActionRefundCreate, "refund", refund.ID)
+	event.Changes = audit.Diff(nil, refund)
+	controller.createRefund(c, order, refund, event)
+}
+
+// newRefund builds a refund of the order from the request body, responding
+// itself when the body is invalid
+func newRefund(c *gin.Context, order models.Order, requestedBy int) (models.Refund, bool) {
+	var req refundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return models.Refund{}, false
+	}
+	if order.Status != models.OrderPaid && order.Status != models.OrderFulfilled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only paid orders can be refunded"})
+		return models.Refund{}, false
+	}
+
+	amount := order.AmountMinor - order.RefundedMinor
+	if req.AmountMinor != nil {
+		amount = *req.AmountMinor
+	}
+	if amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount_minor must be positive"})
+		return models.Refund{}, false
+	}
+	if len(req.Reason) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be at most 500 characters"})
+		return models.Refund{}, false
+	}
+
+	return models.Refund{
+		ID:          uuid.NewString(),
+		OrderID:     order.ID,
+		UserID:      order.UserID,
+		AmountMinor: amount,
+		Currency:    order.Currency,
+		Reason:      req.Reason,
+		Status:      models.RefundProcessing,
+		RequestedBy: requestedBy,
+	}, true
+}
+
+// createRefund stores the refund and, unless it needs approval, pays it out
+func (controller Controller) createRefund(c *gin.Context, order models.Order, refund models.Refund, event models.AuditEvent) {
+	if refund.Status == models.RefundProcessing && !controller.canRefund(order) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not available"})
+		return
+	}
+
+	err := controller.Store.CreateRefund(c, refund, event)
+	if errors.Is(err, models.ErrRefundExceedsPayment) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Refund exceeds what's left of the payment"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create refund"})
+		return
+	}
+
+	if refund.Status == models.RefundProcessing {
+		refund, err = controller.process(context.WithoutCancel(c), order, refund)
+	} else {
+		refund, err = controller.Store.GetRefund(c, refund.ID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete refund"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, refund)
+}
+
+// ListRefunds lists the refunds of the caller's order
+func (controller Controller) ListRefunds(c *gin.Context) {
+	order := c.MustGet("order").(models.Order)
+
+	r, err := controller.Store.ListOrderRefunds(c, order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// ListAllRefunds lists refunds oldest first; ?status=pending_approval is the
+// approval queue
+func (controller Controller) ListAllRefunds(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	r, err := controller.Store.ListRefunds(c, c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// ApproveRefund pays out a refund waiting for approval, or retries one the
+// gateway refused
+func (controller Controller) ApproveRefund(c *gin.Context) {
+	refund := c.MustGet("refund").(models.Refund)
+
+	var req reviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Note) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	order, err := controller.Store.GetOrder(c, refund.OrderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order"})
+		return
+	}
+	if !controller.canRefund(order) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not available"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionRefundApprove, "refund", refund.ID)
+	event.Changes = audit.Diff(map[string]string{"status": refund.Status}, map[string]string{"status": models.RefundProcessing})
+	event.Details = audit.Details(map[string]interface{}{"note": req.Note})
+	approved, err := controller.Store.ApproveRefund(c, refund.ID, c.MustGet("user_id").(int), req.Note, event)
+	if errors.Is(err, models.ErrRefundExceedsPayment) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Refund exceeds what's left of the payment"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve refund"})
+		return
+	}
+	if !approved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only refunds waiting for approval or failed can be approved"})
+		return
+	}
+
+	refund, err = controller.Store.GetRefund(c, refund.ID)
+	if err == nil {
+		refund, err = controller.process(context.WithoutCancel(c), order, refund)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete refund"})
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// RejectRefund turns down a refund waiting for approval. The note is shown
+// to the buyer.
+func (controller Controller) RejectRefund(c *gin.Context) {
+	refund := c.MustGet("refund").(models.Refund)
+
+	var req reviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Note) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if strings.TrimSpace(req.Note) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "note is required"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionRefundReject, "refund", refund.ID)
+	event.Changes = audit.Diff(map[string]string{"status": refund.Status}, map[string]string{"status": models.RefundRejected})
+	event.Details = audit.Details(map[string]interface{}{"note": req.Note})
+	rejected, err := controller.Store.RejectRefund(c, refund.ID, c.MustGet("user_id").(int), req.Note, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject refund"})
+		return
+	}
+	if !rejected {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only refunds waiting for approval can be rejected"})
+		return
+	}
+
+	refund, err = controller.Store.GetRefund(c, refund.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get refund"})
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// RetryRefund sends a refund left processing, by a crash or a gateway that
+// timed out, to the gateway again. Gateways look refunds up by the refund's
+// ID before making them, so one that was paid out is only recorded.
+func (controller Controller) RetryRefund(c *gin.Context) {
+	refund := c.MustGet("refund").(models.Refund)
+
+	order, err := controller.Store.GetOrder(c, refund.OrderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order"})
+		return
+	}
+	if !controller.canRefund(order) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not available"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionRefundRetry, "refund", refund.ID)
+	reclaimed, err := controller.Store.ReclaimRefund(c, refund.ID, time.Now().Add(-refundStuckAfter), event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry refund"})
+		return
+	}
+	if !reclaimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only refunds processing for over " + refundStuckAfter.String() + " can be retried"})
+		return
+	}
+
+	refund, err = controller.Store.GetRefund(c, refund.ID)
+	if err == nil {
+		refund, err = controller.process(context.WithoutCancel(c), order, refund)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete refund"})
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// canRefund reports whether the gateway the order was paid through is the
+// one configured
+func (controller Controller) canRefund(order models.Order) bool {
+	return controller.Gateway != nil && controller.Gateway.Name() == order.Gateway
+}
+
+// process sends a refund that is processing to the gateway and records the
+// outcome. The refund's ID is passed as the receipt, so a retried refund
+// isn't paid twice.
+func (controller Controller) process(ctx context.Context, order models.Order, refund models.Refund) (models.Refund, error) {
+	// The journal entry is worked out first so nothing is paid out that
+	// can't be recorded
+	entry, err := controller.refundEntry(ctx, order.ID, refund)
+	if err != nil {
+		log.Printf("failed to prepare journal entry for refund %s: %v", refund.ID, err)
+		return controller.fail(ctx, refund, fmt.Errorf("journal entry: %w", err))
+	}
+
+	gatewayID, err := controller.Gateway.Refund(ctx, payments.RefundRequest{
+		PaymentID: order.GatewayPaymentID,
+		Amount:    refund.AmountMinor,
+		Currency:  refund.Currency,
+		Receipt:   refund.ID,
+	})
+	if err != nil {
+		log.Printf("failed to refund %s on %s: %v", refund.ID, order.Gateway, err)
+		return controller.fail(ctx, refund, err)
+	}
+
+	entry.EffectiveAt = time.Now()
+	taxes := gst.Reversed(entry, refund.AmountMinor)
+	note, err := controller.Store.CompleteRefund(ctx, refund, gatewayID, controller.RefundPolicy.AccessUntil(entry.EffectiveAt), entry, taxes)
+	if err != nil {
+		log.Printf("refund %s was paid out as %s but couldn't be recorded: %v", refund.ID, gatewayID, err)
+		return refund, err
+	}
+
+	// Credit notes that fail to render here are rendered when downloaded
+	if _, err := controller.renderCreditNote(ctx, note); err != nil {
+		log.Printf("failed to render credit note %s: %v", note.Number, err)
+	}
+
+	return controller.Store.GetRefund(ctx, refund.ID)
+}
+
+// fail records why the refund couldn't be paid out, so an admin can retry it
+func (controller Controller) fail(ctx context.Context, refund models.Refund, cause error) (models.Refund, error) {
+	reason := cause.Error()
+	if len(reason) > 1000 {
+		reason = reason[:1000]
+	}
+	if err := controller.Store.FailRefund(ctx, refund.ID, reason); err != nil {
+		return refund, err
+	}
+	return controller.Store.GetRefund(ctx, refund.ID)
+}
+
+// refundEntry reverses the refunded part of the order's payment entry.
+// Orders paid before the ledger existed have their payment entry worked out
+// as it would have been posted.
+func (controller Controller) refundEntry(ctx context.Context, orderID string, refund models.Refund) (models.JournalEntry, error) {
+	order, err := controller.Store.GetOrder(ctx, orderID)
+	if err != nil {
+		return models.JournalEntry{}, err
+	}
+
+	payment, err := controller.Store.GetJournalEntryByReference(ctx, models.JournalPayment, order.ID)
+	if errors.Is(err, sql.ErrNoRows) && order.PaidAt != nil {
+		payment, err = paymentEntry(ctx, controller.Store, order, controller.PlatformFee, nil, *order.PaidAt)
+	}
+	if err != nil {
+		return models.JournalEntry{}, err
+	}
+
+	return ledger.Refund(payment, order, refund, time.Now())
+}
+
+// usage looks up what the buyer did with the course. The share of videos
+// watched is unknown when the course's videos can't be counted.
+func (controller Controller) usage(ctx context.Context, order models.Order) refunds.Usage {
+	var usage refunds.Usage
+	if order.PaidAt != nil {
+		usage.PaidAt = *order.PaidAt
+	}
+
+	total, err := controller.countVideos(ctx, order.CourseID)
+	if err != nil {
+		log.Printf("failed to count videos of course %s: %v", order.CourseID, err)
+		return usage
+	}
+	watched, err := controller.Store.CountWatchedVideos(ctx, order.UserID, order.CourseID)
+	if err != nil {
+		log.Printf("failed to count watched videos of user %d: %v", order.UserID, err)
+		return usage
+	}
+
+	usage.WatchedKnown = true
+	if total > 0 {
+		usage.WatchedPercent = float64(min(watched, total)) * 100 / float64(total)
+	}
+	return usage
+}
+
+// countVideos counts the videos in the course's folder and its subfolders
+func (controller Controller) countVideos(ctx context.Context, courseID string) (int, error) {
+	if controller.VDO == nil {
+		return 0, fmt.Errorf("no video client configured")
+	}
+
+	course, err := controller.Store.GetCourse(ctx, courseID)
+	if err != nil {
+		return 0, err
+	}
+	folder, err := controller.VDO.GetSubFolders(course.FolderID)
+	if err != nil {
+		return 0, err
+	}
+
+	total := folder.Current.VideosCount
+	for _, f := range folder.FolderList {
+		total += f.VideosCount
+	}
+	return total, nil
+}
+
+// CreditNote serves the credit note of a completed refund
+func (controller Controller) CreditNote(c *gin.Context) {
+	refund := c.MustGet("refund").(models.Refund)
+
+	note, err := controller.Store.GetCreditNoteByRefund(c, refund.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund has no credit note"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get credit note"})
+		return
+	}
+	if note.StorageKey == "" {
+		if note, err = controller.renderCreditNote(c, note); err != nil {
+			log.Printf("failed to render credit note %s: %v", note.Number, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render credit note"})
+			return
+		}
+	}
+
+	r, err := controller.Storage.Get(c, note.StorageKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read credit note"})
+		return
+	}
+	defer r.Close()
+
+	c.Header("Cache-Control", "no-store")
+	c.DataFromReader(http.StatusOK, -1, documentType(note.StorageKey), r, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s%s"`, documentName(note.Number), path.Ext(note.StorageKey)),
+	})
+}
+
+type refundRequest struct {
+	// AmountMinor defaults to what's left of the payment
+	AmountMinor *int64 `json:"amount_minor"`
+	Reason      string `json:"reason"`
+}
+
+type reviewRequest struct {
+	Note string `json:"note"`
+}
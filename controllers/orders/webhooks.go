@@ -0,0 +1,306 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/pkg/gst"
+	"fintech/pkg/ledger"
+	"fintech/pkg/payments"
+	"fintech/store"
+	"fintech/store/models"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxWebhookBody is the largest webhook accepted
+	maxWebhookBody = 1 << 20
+	// webhookLease is how long a worker has to apply the events it claimed
+	webhookLease = 5 * time.Minute
+	// maxWebhookAttempts is how often an event is tried before it's marked
+	// failed and left for an admin to replay
+	maxWebhookAttempts = 8
+	// webhookBatch is how many events a worker claims at a time
+	webhookBatch = 20
+)
+
+// Webhook stores a signed gateway event for the worker to apply. Events the
+// gateway delivers again are acknowledged without being stored twice.
+func (controller Controller) Webhook(c *gin.Context) {
+	receiver, ok := controller.Gateway.(payments.WebhookReceiver)
+	if !ok || c.Param("gateway") != controller.Gateway.Name() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown gateway"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read body"})
+		return
+	}
+	if len(body) > maxWebhookBody {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Webhook too large"})
+		return
+	}
+
+	id, eventType, err := receiver.VerifyWebhook(c.Request.Header, body)
+	if errors.Is(err, payments.ErrInvalidSignature) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook"})
+		return
+	}
+
+	created, err := controller.Store.CreateWebhookEvent(c, models.WebhookEvent{
+		Gateway:   controller.Gateway.Name(),
+		EventID:   id,
+		EventType: eventType,
+		Payload:   string(body),
+	})
+	if err != nil {
+		// The gateway delivers it again later
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store webhook"})
+		return
+	}
+	if created && controller.Worker != nil {
+		controller.Worker.Notify()
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhooks lists received webhooks, optionally only those with a status
+func (controller Controller) ListWebhooks(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	events, err := controller.Store.ListWebhookEvents(c, c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// GetWebhook returns a webhook with its payload
+func (controller Controller) GetWebhook(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	event, err := controller.Store.GetWebhookEvent(c, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// ReplayWebhook queues a failed webhook to be applied again
+func (controller Controller) ReplayWebhook(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionWebhookReplay, "webhook_event", c.Param("id"))
+	event.Changes = audit.Diff(map[string]string{"status": models.WebhookFailed}, map[string]string{"status": models.WebhookPending})
+	replayed, err := controller.Store.ReplayWebhookEvent(c, id, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay webhook"})
+		return
+	}
+	if !replayed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No failed webhook with this ID"})
+		return
+	}
+	if controller.Worker != nil {
+		controller.Worker.Notify()
+	}
+
+	controller.GetWebhook(c)
+}
+
+// WebhookWorker applies stored webhook events to orders in the background,
+// retrying failures with exponential backoff
+type WebhookWorker struct {
+	Store   store.Store
+	Gateway payments.PaymentGateway
+	// Interval is how often due events are polled for
+	Interval time.Duration
+	// PlatformFee is the platform's cut of each sale
+	PlatformFee ledger.Rate
+	// GST is charged on sales
+	GST gst.Config
+
+	wake chan struct{}
+}
+
+// NewWebhookWorker polls every WEBHOOK_POLL_INTERVAL, 10s by default, and
+// splits payments by PLATFORM_FEE_PERCENT
+func NewWebhookWorker(db store.Store, gateway payments.PaymentGateway, tax gst.Config) *WebhookWorker {
+	interval, err := time.ParseDuration(os.Getenv("WEBHOOK_POLL_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &WebhookWorker{
+		Store:       db,
+		Gateway:     gateway,
+		Interval:    interval,
+		PlatformFee: ledger.PlatformFeeFromEnv(),
+		GST:         tax,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the worker to apply new events now instead of on its next poll
+func (w *WebhookWorker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run applies due events until ctx is cancelled
+func (w *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+func (w *WebhookWorker) drain(ctx context.Context) {
+	for {
+		events, err := w.Store.ClaimWebhookEvents(ctx, webhookLease, webhookBatch)
+		if err != nil {
+			log.Printf("failed to claim webhook events: %v", err)
+			return
+		}
+		for _, e := range events {
+			w.process(ctx, e)
+		}
+		if len(events) < webhookBatch {
+			return
+		}
+	}
+}
+
+func (w *WebhookWorker) process(ctx context.Context, e models.WebhookEvent) {
+	status, err := w.apply(ctx, e)
+	if err == nil {
+		if err := w.Store.CompleteWebhookEvent(ctx, e.ID, status); err != nil {
+			log.Printf("failed to complete webhook event %d: %v", e.ID, err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	var permanent permanentError
+	if e.Attempts+1 < maxWebhookAttempts && !errors.As(err, &permanent) {
+		t := time.Now().Add(webhookBackoff(e.Attempts + 1))
+		retryAt = &t
+	}
+	log.Printf("failed to apply webhook event %d: %v", e.ID, err)
+
+	reason := err.Error()
+	if len(reason) > 1000 {
+		reason = reason[:1000]
+	}
+	if err := w.Store.FailWebhookEvent(ctx, e.ID, reason, retryAt); err != nil {
+		log.Printf("failed to record webhook event %d failure: %v", e.ID, err)
+	}
+}
+
+// apply moves the order the event is about forward, returning the status
+// to leave the event in
+func (w *WebhookWorker) apply(ctx context.Context, e models.WebhookEvent) (string, error) {
+	receiver, ok := w.Gateway.(payments.WebhookReceiver)
+	if !ok || w.Gateway.Name() != e.Gateway {
+		return "", fmt.Errorf("gateway %s isn't configured", e.Gateway)
+	}
+
+	parsed, err := receiver.ParseWebhook([]byte(e.Payload))
+	if err != nil {
+		return "", permanentError{err}
+	}
+	if parsed.Kind == "" {
+		return models.WebhookIgnored, nil
+	}
+
+	order, err := w.Store.GetOrderByGatewayID(ctx, e.Gateway, parsed.OrderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("no order for %s order %s", e.Gateway, parsed.OrderID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch parsed.Kind {
+	case payments.WebhookPaymentCaptured:
+		if parsed.Amount != order.AmountMinor || !strings.EqualFold(parsed.Currency, order.Currency) {
+			return "", permanentError{fmt.Errorf("captured %d %s for order %s of %d %s",
+				parsed.Amount, parsed.Currency, order.ID, order.AmountMinor, order.Currency)}
+		}
+		_, err = Settle(ctx, w.Store, w.Gateway, order, parsed.PaymentID, w.PlatformFee, w.GST)
+		if errors.Is(err, models.ErrCouponLimitReached) {
+			// The payment was refunded instead
+			err = nil
+		}
+	case payments.WebhookPaymentFailed:
+		// Orders that were paid meanwhile stay paid
+		_, err = w.Store.FailOrder(ctx, order.ID)
+	}
+	if err != nil {
+		return "", err
+	}
+	return models.WebhookProcessed, nil
+}
+
+// webhookBackoff doubles the wait after every failure, from 30s up to an hour
+func webhookBackoff(attempts int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+	return min(d, time.Hour)
+}
+
+// permanentError is a failure retrying won't fix
+type permanentError struct {
+	error
+}
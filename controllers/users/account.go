@@ -0,0 +1,365 @@
+package users
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/store/models"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// staleExport is how long an export may stay pending before another can be
+// requested, in case the server restarted while building it
+const staleExport = time.Hour
+
+// RequestExport starts building an archive of the caller's personal data.
+// The archive is built in the background; poll GetExport until it is ready.
+func (controller Controller) RequestExport(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+
+	exports, err := controller.Store.ListDataExports(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list exports"})
+		return
+	}
+	for _, e := range exports {
+		if e.Status == models.ExportPending && time.Since(e.CreatedAt) < staleExport {
+			c.JSON(http.StatusAccepted, e)
+			return
+		}
+	}
+
+	export := models.DataExport{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Status:    models.ExportPending,
+		CreatedAt: time.Now(),
+	}
+	err = controller.Store.CreateDataExport(c, export)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionDataExportRequested, "data_export", export.ID)
+	event.UserID = &userID
+	event.Status = http.StatusAccepted
+	audit.Record(c, controller.Store, event)
+
+	// The request context ends with the response, so build with a fresh one
+	go controller.runExport(context.Background(), export)
+
+	c.JSON(http.StatusAccepted, export)
+}
+
+// ListExports returns the caller's data exports, newest first
+func (controller Controller) ListExports(c *gin.Context) {
+	exports, err := controller.Store.ListDataExports(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list exports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, exports)
+}
+
+// GetExport returns the status of one of the caller's data exports
+func (controller Controller) GetExport(c *gin.Context) {
+	export, ok := controller.export(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
+
+// DownloadExport serves the archive of a finished data export
+func (controller Controller) DownloadExport(c *gin.Context) {
+	export, ok := controller.export(c)
+	if !ok {
+		return
+	}
+	if !export.Downloadable() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready or has expired"})
+		return
+	}
+
+	r, err := controller.Storage.Get(c, export.StorageKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read export"})
+		return
+	}
+	defer r.Close()
+
+	c.Header("Cache-Control", "no-store")
+	c.DataFromReader(http.StatusOK, -1, "application/zip", r, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="export-%s.zip"`, export.CreatedAt.Format("2006-01-02")),
+	})
+}
+
+// DeleteMe schedules the caller's account for deletion once the grace period
+// in ACCOUNT_DELETION_GRACE ends, and logs out all their devices. Logging in
+// again and calling CancelDeletion before then keeps the account.
+func (controller Controller) DeleteMe(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+
+	if _, ok := c.Get("api_key_id"); ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys can't delete accounts"})
+		return
+	}
+
+	at := time.Now().Add(deletionGracePeriod())
+	err := controller.Store.ScheduleUserDeletion(c, userID, &at)
+	if errors.Is(err, models.ErrLastAdmin) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete the last admin"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule deletion"})
+		return
+	}
+
+	err = controller.Store.RevokeUserAuthSessions(c, userID, "account_deletion")
+	if err != nil {
+		log.Printf("failed to revoke sessions of user %d: %v", userID, err)
+	}
+
+	controller.recordDeletion(c, userID, audit.ActionAccountDeletionRequested, http.StatusAccepted, &at)
+
+	c.JSON(http.StatusAccepted, gin.H{"deletion_scheduled_at": at})
+}
+
+// CancelDeletion keeps an account whose deletion is still in its grace period
+func (controller Controller) CancelDeletion(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+
+	u, err := controller.Store.GetUser(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if u.DeletionScheduledAt == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account is not scheduled for deletion"})
+		return
+	}
+
+	err = controller.Store.ScheduleUserDeletion(c, userID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel deletion"})
+		return
+	}
+
+	controller.recordDeletion(c, userID, audit.ActionAccountDeletionCancelled, http.StatusNoContent, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+func (controller Controller) recordDeletion(c *gin.Context, userID int, action string, status int, at *time.Time) {
+	details := map[string]interface{}{}
+	if at != nil {
+		details["deletion_scheduled_at"] = at
+	}
+	event := audit.FromRequest(c, action, "user", strconv.Itoa(userID))
+	event.UserID = &userID
+	event.Status = status
+	event.Details = audit.Details(details)
+	audit.Record(c, controller.Store, event)
+}
+
+// export loads the data export named in the route, responding 404 when the
+// caller has no such export
+func (controller Controller) export(c *gin.Context) (models.DataExport, bool) {
+	export, err := controller.Store.GetDataExport(c, c.MustGet("user_id").(int), c.Param("export_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+			return export, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get export"})
+		return export, false
+	}
+
+	return export, true
+}
+
+// runExport builds the archive for export and records the outcome
+func (controller Controller) runExport(ctx context.Context, export models.DataExport) {
+	data, err := controller.buildExport(ctx, export.UserID)
+	if err == nil {
+		key := "exports/" + strconv.Itoa(export.UserID) + "/" + export.ID + ".zip"
+		err = controller.Storage.Put(ctx, key, bytes.NewReader(data), "application/zip")
+		if err == nil {
+			err = controller.Store.CompleteDataExport(ctx, export.ID, key, time.Now().Add(exportTTL()))
+			if err == nil {
+				return
+			}
+		}
+	}
+
+	log.Printf("failed to export data of user %d: %v", export.UserID, err)
+	if err := controller.Store.FailDataExport(ctx, export.ID, "Failed to build export"); err != nil {
+		log.Printf("failed to record failed export %s: %v", export.ID, err)
+	}
+}
+
+// buildExport zips everything stored about the user as one JSON file per kind
+// of record
+func (controller Controller) buildExport(ctx context.Context, userID int) ([]byte, error) {
+	u, err := controller.Store.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := controller.Store.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := controller.Store.ListUserIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := controller.Store.ListUserAuthSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	chats, err := controller.Store.GetChatSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := controller.Store.ListUserMessages(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	enrollments, err := controller.Store.ListUserEnrollments(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := controller.Store.ListUserOrders(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	refunds, err := controller.Store.ListUserRefunds(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := controller.Store.ListUserProgress(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	payouts, err := controller.Store.ListUserPayouts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	invoices, err := controller.Store.ListUserInvoices(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	billing, err := controller.Store.GetBillingProfile(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", newProfileResponse(u, roles)},
+		{"identities.json", identities},
+		{"devices.json", exportedSessions(sessions)},
+		{"chat_sessions.json", chats},
+		{"messages.json", messages},
+		{"enrollments.json", enrollments},
+		{"orders.json", orders},
+		{"refunds.json", refunds},
+		{"progress.json", progress},
+		{"payouts.json", payouts},
+		{"billing.json", billing},
+		{"invoices.json", invoices},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return nil, err
+		}
+	}
+
+	if u.AvatarKey != "" {
+		if err := controller.addAvatar(ctx, zw, u.AvatarKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (controller Controller) addAvatar(ctx context.Context, zw *zip.Writer, key string) error {
+	r, err := controller.Storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := zw.Create("avatar" + path.Ext(key))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// exportedSession leaves out session internals such as revocation state
+type exportedSession struct {
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+func exportedSessions(sessions []models.AuthSession) []exportedSession {
+	out := []exportedSession{}
+	for _, s := range sessions {
+		out = append(out, exportedSession{UserAgent: s.UserAgent, IP: s.IP, CreatedAt: s.CreatedAt, LastSeenAt: s.LastSeenAt})
+	}
+	return out
+}
+
+// deletionGracePeriod is how long a deleted account can still be restored,
+// from ACCOUNT_DELETION_GRACE
+func deletionGracePeriod() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE")); err == nil && v > 0 {
+		return v
+	}
+	return 30 * 24 * time.Hour
+}
+
+// exportTTL is how long a finished export can be downloaded, from EXPORT_TTL
+func exportTTL() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("EXPORT_TTL")); err == nil && v > 0 {
+		return v
+	}
+	return 7 * 24 * time.Hour
+}
@@ -0,0 +1,89 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"fintech/pkg/gst"
+	"fintech/store/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBilling returns what the caller wants printed on their invoices, empty
+// until they set it
+func (controller Controller) GetBilling(c *gin.Context) {
+	userID := c.MustGet("user_id").(int)
+
+	profile, err := controller.Store.GetBillingProfile(c, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		profile = models.BillingProfile{UserID: userID}
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get billing details"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// SaveBilling sets the caller's billing details. Buyers registered for GST
+// give their GSTIN, whose state their address has to be in; buyers outside
+// India give gst.Abroad as their state. Invoices already issued keep the
+// details they were issued with.
+func (controller Controller) SaveBilling(c *gin.Context) {
+	var req billingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	profile := models.BillingProfile{
+		UserID:    c.MustGet("user_id").(int),
+		LegalName: strings.TrimSpace(req.LegalName),
+		GSTIN:     strings.ToUpper(strings.TrimSpace(req.GSTIN)),
+		Address:   strings.TrimSpace(req.Address),
+		StateCode: strings.TrimSpace(req.StateCode),
+	}
+	if profile.StateCode == "" {
+		profile.StateCode = gst.StateOf(profile.GSTIN)
+	}
+
+	switch {
+	case len(profile.LegalName) > 100:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "legal_name must be at most 100 characters"})
+		return
+	case len(profile.Address) > 300:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address must be at most 300 characters"})
+		return
+	case profile.GSTIN != "" && !gst.ValidGSTIN(profile.GSTIN):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid GSTIN"})
+		return
+	case profile.GSTIN != "" && (profile.LegalName == "" || profile.Address == ""):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "legal_name and address are required with a GSTIN"})
+		return
+	}
+	if _, ok := gst.States[profile.StateCode]; profile.StateCode != "" && profile.StateCode != gst.Abroad && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state_code"})
+		return
+	}
+	if profile.GSTIN != "" && profile.StateCode != gst.StateOf(profile.GSTIN) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state_code must be the state of the GSTIN"})
+		return
+	}
+
+	if err := controller.Store.SaveBillingProfile(c, profile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save billing details"})
+		return
+	}
+
+	controller.GetBilling(c)
+}
+
+type billingRequest struct {
+	LegalName string `json:"legal_name"`
+	GSTIN     string `json:"gstin"`
+	Address   string `json:"address"`
+	// StateCode defaults to the state of the GSTIN, and is gst.Abroad for
+	// addresses outside India
+	StateCode string `json:"state_code"`
+}
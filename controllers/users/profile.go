@@ -0,0 +1,353 @@
+package users
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fintech/pkg/messaging"
+	"fintech/pkg/otp"
+	"fintech/pkg/storage"
+	"fintech/store/models"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+)
+
+const maxAvatarSize = 2 << 20
+
+// attemptScopeEmail counts wrong email verification codes per user
+const attemptScopeEmail = "email"
+
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+var avatarExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Me returns the caller's own profile
+func (controller Controller) Me(c *gin.Context) {
+	u, err := controller.Store.GetUser(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	roles, err := controller.Store.GetUserRoles(c, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newProfileResponse(u, roles))
+}
+
+// UpdateMe changes the caller's name, locale or email. A new email address is
+// only used once it has been verified with the code sent to it.
+func (controller Controller) UpdateMe(c *gin.Context) {
+	u, err := controller.Store.GetUser(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	req := updateProfileRequest{Name: &u.Name, Locale: &u.Locale}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	name := strings.TrimSpace(*req.Name)
+	if len(name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be at most 100 characters"})
+		return
+	}
+	if !localePattern.MatchString(*req.Locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid locale"})
+		return
+	}
+
+	err = controller.Store.UpdateProfile(c, u.ID, name, *req.Locale)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	if req.Email != nil && (u.Email == nil || !strings.EqualFold(*u.Email, *req.Email)) {
+		if !controller.startEmailVerification(c, u.ID, *req.Email) {
+			return
+		}
+	}
+
+	controller.Me(c)
+}
+
+// startEmailVerification stores the address as pending and sends it a code
+func (controller Controller) startEmailVerification(c *gin.Context, userID int, email string) bool {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > 254 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+		return false
+	}
+
+	code, err := otp.Generate(controller.OTP.Length)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate code"})
+		return false
+	}
+	expiry := time.Now().Add(controller.OTP.TTL)
+
+	err = controller.Store.SetPendingEmail(c, userID, email, controller.OTP.Hash(email, code), expiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update email"})
+		return false
+	}
+
+	_, err = controller.Sender.SendOTP(c, messaging.OTPMessage{
+		Recipient: messaging.Recipient{Email: email},
+		Code:      code,
+		ExpiresAt: expiry,
+	})
+	if err != nil {
+		log.Printf("failed to send email verification code: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send verification code"})
+		return false
+	}
+
+	return true
+}
+
+// VerifyEmail confirms the pending email address with the code sent to it.
+// Wrong codes lock the user out like wrong OTPs do, and after MaxAttempts of
+// them the code is thrown away so guessing has to start over with a new one.
+func (controller Controller) VerifyEmail(c *gin.Context) {
+	u, err := controller.Store.GetUser(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	var req verifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	subject := strconv.Itoa(u.ID)
+	attempt, err := controller.Store.GetOTPAttempt(c, attemptScopeEmail, subject)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check verification attempts"})
+		return
+	}
+	if attempt.LockedUntil != nil && time.Now().Before(*attempt.LockedUntil) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(*attempt.LockedUntil).Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+		return
+	}
+
+	verified, err := controller.Store.VerifyEmail(c, u.ID, controller.OTP.Hash(u.PendingEmail, req.Code))
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	if !verified {
+		controller.recordEmailFailure(c, u.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	if err := controller.Store.ResetOTPAttempts(c, attemptScopeEmail, subject); err != nil {
+		log.Printf("failed to reset email verification attempts: %v", err)
+	}
+
+	controller.Me(c)
+}
+
+// recordEmailFailure counts a wrong email verification code against the user,
+// dropping the pending code once it has been guessed at too often
+func (controller Controller) recordEmailFailure(c *gin.Context, userID int) {
+	subject := strconv.Itoa(userID)
+	err := controller.Store.RecordOTPFailure(c, attemptScopeEmail, subject, controller.OTP.AttemptWindow,
+		controller.OTP.MaxAttempts, controller.OTP.BaseLockout, controller.OTP.MaxLockout)
+	if err != nil {
+		log.Printf("failed to record email verification attempt: %v", err)
+		return
+	}
+
+	attempt, err := controller.Store.GetOTPAttempt(c, attemptScopeEmail, subject)
+	if err != nil {
+		log.Printf("failed to get email verification attempts: %v", err)
+		return
+	}
+	if attempt.Failures >= controller.OTP.MaxAttempts {
+		if err := controller.Store.ClearPendingEmail(c, userID); err != nil {
+			log.Printf("failed to clear pending email of user %d: %v", userID, err)
+		}
+	}
+}
+
+// UploadAvatar stores a new avatar image for the caller
+func (controller Controller) UploadAvatar(c *gin.Context) {
+	u, err := controller.Store.GetUser(c, c.MustGet("user_id").(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar is required"})
+		return
+	}
+	if file.Size > maxAvatarSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar must be at most 2 MB"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read avatar"})
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxAvatarSize+1))
+	if err != nil || len(data) > maxAvatarSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read avatar"})
+		return
+	}
+
+	// Trust the content, not the file name or the client's content type
+	contentType := http.DetectContentType(data)
+	ext, ok := avatarExtensions[contentType]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar must be a PNG, JPEG, GIF or WebP image"})
+		return
+	}
+
+	key := "avatars/" + strconv.Itoa(u.ID) + "/" + uuid.NewString() + ext
+	err = controller.Storage.Put(c, key, bytes.NewReader(data), contentType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store avatar"})
+		return
+	}
+
+	err = controller.Store.SetAvatar(c, u.ID, key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update avatar"})
+		return
+	}
+
+	if u.AvatarKey != "" {
+		if err := controller.Storage.Delete(c, u.AvatarKey); err != nil {
+			log.Printf("failed to delete old avatar %s: %v", u.AvatarKey, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"avatar_url": models.AvatarURL(u.ID, key)})
+}
+
+// Avatar serves a user's avatar image
+func (controller Controller) Avatar(c *gin.Context) {
+	u, err := controller.Store.GetUser(c, c.GetInt("profile_id"))
+	if err != nil || u.AvatarKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+		return
+	}
+
+	r, err := controller.Storage.Get(c, u.AvatarKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read avatar"})
+		return
+	}
+	defer r.Close()
+
+	contentType := "application/octet-stream"
+	for t, ext := range avatarExtensions {
+		if strings.HasSuffix(u.AvatarKey, ext) {
+			contentType = t
+		}
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.DataFromReader(http.StatusOK, -1, contentType, r, nil)
+}
+
+// Profile returns the public profile of any user
+func (controller Controller) Profile(c *gin.Context) {
+	id := c.GetInt("profile_id")
+	summaries, err := controller.Store.GetUserSummaries(c, []int{id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	summary, ok := summaries[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+type profileResponse struct {
+	ID            int               `json:"id"`
+	PhoneNumber   *string           `json:"phone_number"`
+	Name          string            `json:"name"`
+	Email         *string           `json:"email"`
+	EmailVerified bool              `json:"email_verified"`
+	PendingEmail  string            `json:"pending_email,omitempty"`
+	AvatarURL     string            `json:"avatar_url"`
+	Locale        string            `json:"locale"`
+	Roles         []models.UserRole `json:"roles"`
+	// DeletionScheduledAt is set while the account is waiting to be deleted
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+func newProfileResponse(u models.User, roles []models.UserRole) profileResponse {
+	return profileResponse{
+		ID:                  u.ID,
+		PhoneNumber:         u.PhoneNumber,
+		Name:                u.Name,
+		Email:               u.Email,
+		EmailVerified:       u.EmailVerifiedAt != nil,
+		PendingEmail:        u.PendingEmail,
+		AvatarURL:           models.AvatarURL(u.ID, u.AvatarKey),
+		Locale:              u.Locale,
+		Roles:               roles,
+		CreatedAt:           u.CreatedAt,
+		DeletionScheduledAt: u.DeletionScheduledAt,
+	}
+}
+
+type updateProfileRequest struct {
+	Name   *string `json:"name"`
+	Email  *string `json:"email"`
+	Locale *string `json:"locale"`
+}
+
+type verifyEmailRequest struct {
+	Code string `json:"code"`
+}
@@ -0,0 +1,188 @@
+package users
+
+import (
+	"fintech/pkg/apikey"
+	"fintech/pkg/audit"
+	"fintech/store/models"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultAPIKeyTTL applies to keys created without an expiry
+const defaultAPIKeyTTL = 90 * 24 * time.Hour
+
+// ListServiceAccounts returns every service account with its roles
+func (controller Controller) ListServiceAccounts(c *gin.Context) {
+	users, err := controller.Store.ListUsers(c, models.UserFilter{Kind: models.UserKindService, Limit: 1000})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list service accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// CreateServiceAccount creates a user that backend jobs and integrations act
+// as, so what they do is attributed to them rather than to an admin
+func (controller Controller) CreateServiceAccount(c *gin.Context) {
+	var req serviceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be between 1 and 100 characters"})
+		return
+	}
+
+	for _, role := range req.Roles {
+		ok, err := controller.roleExists(c, role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			return
+		}
+	}
+
+	event := audit.FromRequest(c, audit.ActionServiceAccountCreate, "user", "")
+	event.Changes = audit.Diff(nil, gin.H{"name": name, "roles": req.Roles})
+	userID, err := controller.Store.CreateServiceAccount(c, name, req.Roles, c.MustGet("user_id").(int), event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+
+	user, err := controller.Store.GetUser(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get service account"})
+		return
+	}
+
+	controller.respondWithRoles(c, http.StatusCreated, user)
+}
+
+// ListAPIKeys returns the keys of a service account, without their secrets
+func (controller Controller) ListAPIKeys(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	keys, err := controller.Store.ListAPIKeys(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey issues a key for a service account. The key is only ever
+// returned in this response.
+func (controller Controller) CreateAPIKey(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req apiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" || len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	ok, err := controller.permissionsExist(c, req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list permissions"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission"})
+		return
+	}
+
+	expiresAt := time.Now().Add(apiKeyTTL())
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+			return
+		}
+		expiresAt = *req.ExpiresAt
+	}
+
+	key, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	createdBy := c.MustGet("user_id").(int)
+	k := models.APIKey{
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    req.Scopes,
+		ExpiresAt: &expiresAt,
+		CreatedBy: &createdBy,
+		CreatedAt: time.Now(),
+	}
+	event := audit.FromRequest(c, audit.ActionAPIKeyCreate, "api_key", "")
+	event.UserID = &user.ID
+	event.Changes = audit.Diff(nil, k)
+	k.ID, err = controller.Store.CreateAPIKey(c, k, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"key": key, "api_key": k})
+}
+
+// RevokeAPIKey stops a key from being accepted
+func (controller Controller) RevokeAPIKey(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	keyID, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionAPIKeyRevoke, "api_key", strconv.Itoa(keyID))
+	event.UserID = &user.ID
+	revoked, err := controller.Store.RevokeAPIKey(c, user.ID, keyID, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// apiKeyTTL is the expiry of keys created without one, from API_KEY_DEFAULT_TTL
+func apiKeyTTL() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("API_KEY_DEFAULT_TTL")); err == nil && v > 0 {
+		return v
+	}
+	return defaultAPIKeyTTL
+}
+
+type serviceAccountRequest struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+type apiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
@@ -0,0 +1,444 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/pkg/audit"
+	"fintech/pkg/messaging"
+	"fintech/pkg/otp"
+	"fintech/pkg/phone"
+	"fintech/pkg/rbac"
+	"fintech/pkg/storage"
+	"fintech/store"
+	"fintech/store/models"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+type Controller struct {
+	Store   store.Store
+	Sender  messaging.OTPSender
+	Storage storage.Storage
+	OTP     otp.Config
+	Phone   phone.Parser
+}
+
+// List returns users with their roles, optionally filtered by role or phone number
+func (controller Controller) List(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	phoneNumber := c.Query("phone_number")
+	if phoneNumber != "" {
+		n, err := controller.Phone.Normalize(phoneNumber)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		phoneNumber = n
+	}
+
+	users, err := controller.Store.ListUsers(c, models.UserFilter{
+		Role:        c.Query("role"),
+		PhoneNumber: phoneNumber,
+		Limit:       limit,
+		Offset:      offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// ListRoles returns every role that can be granted
+func (controller Controller) ListRoles(c *gin.Context) {
+	roles, err := controller.Store.ListRoles(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// CreateRole adds a new role, optionally with its permissions
+func (controller Controller) CreateRole(c *gin.Context) {
+	var req createRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	ok, err := controller.permissionsExist(c, req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list permissions"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission"})
+		return
+	}
+
+	if req.Permissions == nil {
+		req.Permissions = []string{}
+	}
+	role := models.Role{Name: req.Name, Description: req.Description, MFARequired: req.MFARequired, Permissions: req.Permissions}
+
+	event := audit.FromRequest(c, audit.ActionRoleCreate, "role", role.Name)
+	event.Changes = audit.Diff(nil, role)
+	err = controller.Store.CreateRole(c, role, event)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// SetRolePermissions replaces the permissions attached to a role. Taking
+// user:manage away from the last role anyone holds it through is refused, as
+// nobody could give it back.
+func (controller Controller) SetRolePermissions(c *gin.Context) {
+	role := c.Param("role")
+
+	var req rolePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	before, exists, err := controller.findRole(c, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	ok, err := controller.permissionsExist(c, req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list permissions"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission"})
+		return
+	}
+
+	if req.Permissions == nil {
+		req.Permissions = []string{}
+	}
+	event := audit.FromRequest(c, audit.ActionRolePermissions, "role", role)
+	event.Changes = audit.Diff(gin.H{"permissions": before.Permissions}, gin.H{"permissions": req.Permissions})
+	err = controller.Store.SetRolePermissions(c, role, req.Permissions, string(rbac.UserManage), event)
+	if errors.Is(err, models.ErrNoUserManager) {
+		c.JSON(http.StatusConflict, gin.H{"error": "No one would be able to manage users"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": role, "permissions": req.Permissions})
+}
+
+// SetRoleMFA sets whether holders of the role must log in with a second factor
+func (controller Controller) SetRoleMFA(c *gin.Context) {
+	role := c.Param("role")
+
+	var req roleMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Required == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	before, exists, err := controller.findRole(c, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionRoleMFA, "role", role)
+	event.Changes = audit.Diff(gin.H{"mfa_required": before.MFARequired}, gin.H{"mfa_required": *req.Required})
+	err = controller.Store.SetRoleMFARequired(c, role, *req.Required, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set MFA policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": role, "mfa_required": *req.Required})
+}
+
+// ResetMFA removes a user's authenticator and recovery codes, for users who
+// lost both. Users whose role requires MFA enroll again on their next login.
+func (controller Controller) ResetMFA(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	event := audit.FromRequest(c, audit.ActionUserMFAReset, "user", strconv.Itoa(user.ID))
+	event.UserID = &user.ID
+	err := controller.Store.DeleteUserMFA(c, user.ID, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset MFA"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// SetMaxDevices sets how many devices a user may be logged in on at once.
+// A null limit falls back to MAX_DEVICES and zero removes the limit. The
+// limit is applied on the user's next login, which logs out their oldest
+// sessions beyond it.
+func (controller Controller) SetMaxDevices(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req maxDevicesRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.MaxDevices != nil && *req.MaxDevices < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	event := audit.FromRequest(c, audit.ActionUserMaxDevices, "user", strconv.Itoa(user.ID))
+	event.UserID = &user.ID
+	event.Changes = audit.Diff(gin.H{"max_devices": user.MaxDevices}, gin.H{"max_devices": req.MaxDevices})
+	err := controller.Store.SetUserMaxDevices(c, user.ID, req.MaxDevices, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set device limit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": user.ID, "max_devices": req.MaxDevices})
+}
+
+// ListPermissions returns every permission that can be attached to roles
+func (controller Controller) ListPermissions(c *gin.Context) {
+	permissions, err := controller.Store.ListPermissions(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// GrantRole gives a user an additional role, platform-wide or for one course
+func (controller Controller) GrantRole(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Role == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	ok, err := controller.roleExists(c, req.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+
+	if req.CourseID != "" {
+		if _, err := controller.Store.GetCourse(c, req.CourseID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Course not found"})
+			return
+		}
+	}
+
+	grantedBy := c.MustGet("user_id").(int)
+	grant := models.UserRole{
+		UserID:    user.ID,
+		Role:      req.Role,
+		CourseID:  req.CourseID,
+		GrantedBy: &grantedBy,
+	}
+
+	event := audit.FromRequest(c, audit.ActionUserRoleGrant, "user", strconv.Itoa(user.ID))
+	event.UserID = &user.ID
+	event.Changes = audit.Diff(nil, grant)
+	err = controller.Store.GrantRole(c, grant, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant role"})
+		return
+	}
+
+	controller.respondWithRoles(c, http.StatusOK, user)
+}
+
+// RevokeRole removes a role from a user. The last admin can't be demoted, so
+// the platform is never left without anyone able to manage it.
+func (controller Controller) RevokeRole(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	role := c.Param("role")
+	courseID := c.Query("course_id")
+
+	event := audit.FromRequest(c, audit.ActionUserRoleRevoke, "user", strconv.Itoa(user.ID))
+	event.UserID = &user.ID
+	event.Changes = audit.Diff(models.UserRole{UserID: user.ID, Role: role, CourseID: courseID}, nil)
+	err := controller.Store.RevokeRole(c, user.ID, role, courseID, event)
+	if errors.Is(err, models.ErrLastAdmin) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot revoke the last admin"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke role"})
+		return
+	}
+
+	controller.respondWithRoles(c, http.StatusOK, user)
+}
+
+func (controller Controller) respondWithRoles(c *gin.Context, status int, user models.User) {
+	roles, err := controller.Store.GetUserRoles(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get roles"})
+		return
+	}
+
+	c.JSON(status, models.UserWithRoles{
+		ID:          user.ID,
+		Kind:        user.Kind,
+		Name:        user.Name,
+		PhoneNumber: user.PhoneNumber,
+		Roles:       roles,
+		CreatedAt:   user.CreatedAt,
+	})
+}
+
+func (controller Controller) roleExists(c *gin.Context, name string) (bool, error) {
+	_, ok, err := controller.findRole(c, name)
+	return ok, err
+}
+
+// findRole returns the named role with its permissions
+func (controller Controller) findRole(c *gin.Context, name string) (models.Role, bool, error) {
+	roles, err := controller.Store.ListRoles(c)
+	if err != nil {
+		return models.Role{}, false, err
+	}
+
+	i := slices.IndexFunc(roles, func(r models.Role) bool { return r.Name == name })
+	if i < 0 {
+		return models.Role{}, false, nil
+	}
+	return roles[i], true, nil
+}
+
+func (controller Controller) permissionsExist(c *gin.Context, names []string) (bool, error) {
+	permissions, err := controller.Store.ListPermissions(c)
+	if err != nil {
+		return false, err
+	}
+
+	for _, name := range names {
+		if !slices.ContainsFunc(permissions, func(p models.Permission) bool { return p.Name == name }) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// BootstrapAdmin makes the given phone number an admin when no admin exists
+// yet, creating the user if needed. It does nothing once there is an admin,
+// so the configured phone number can't be used to regain access later.
+func BootstrapAdmin(ctx context.Context, db store.Store, phoneNumber string) error {
+	if phoneNumber == "" {
+		return nil
+	}
+
+	phoneNumber, err := phone.ParserFromEnv().Normalize(phoneNumber)
+	if err != nil {
+		return fmt.Errorf("invalid ADMIN_BOOTSTRAP_PHONE: %v", err)
+	}
+
+	admins, err := db.CountUsersWithRole(ctx, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	u, err := db.GetUserByPhoneNumber(ctx, phoneNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = db.CreateUser(ctx, phoneNumber, "", time.Now())
+		if err != nil {
+			return err
+		}
+		u, err = db.GetUserByPhoneNumber(ctx, phoneNumber)
+	}
+	if err != nil {
+		return err
+	}
+
+	// There is no request or actor to attribute this to
+	grant := models.UserRole{UserID: u.ID, Role: models.RoleAdmin}
+	err = db.GrantRole(ctx, grant, models.AuditEvent{
+		UserID:     &u.ID,
+		Action:     audit.ActionUserRoleGrant,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(u.ID),
+		Changes:    audit.Diff(nil, grant),
+		Details:    audit.Details(map[string]interface{}{"reason": "ADMIN_BOOTSTRAP_PHONE"}),
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Bootstrapped user %d as the first admin", u.ID)
+	return nil
+}
+
+type roleRequest struct {
+	Role     string `json:"role"`
+	CourseID string `json:"course_id"`
+}
+
+type createRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	MFARequired bool     `json:"mfa_required"`
+}
+
+type maxDevicesRequest struct {
+	MaxDevices *int `json:"max_devices"`
+}
+
+type roleMFARequest struct {
+	Required *bool `json:"required"`
+}
+
+type rolePermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
@@ -1,54 +1,208 @@
 package middlewares
 
 import (
+	"database/sql"
+	"errors"
+	"fintech/pkg/rbac"
+	"fintech/store"
+	"fintech/store/models"
 	"fintech/utils"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
-// AuthMiddleware checks for a valid JWT token
-func AuthMiddleware(c *gin.Context) {
-	token := c.GetHeader("Authorization")
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-		c.Abort()
-		return
-	}
+// ErrSessionRevoked is returned for tokens whose session was logged out or revoked
+var ErrSessionRevoked = errors.New("session revoked")
 
-	claims, err := utils.VerifyJWT(token) // We only care about phone number here
+// VerifySession parses the token and checks that its session is still active,
+// so logging out or revoking a session cuts off its access tokens immediately
+func VerifySession(c *gin.Context, db store.Store, token string) (utils.Claims, error) {
+	claims, err := utils.VerifyJWT(token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-		c.Abort()
-		return
+		return claims, err
+	}
+
+	if claims.SessionID == "" {
+		return claims, ErrSessionRevoked
+	}
+	session, err := db.GetAuthSession(c, claims.SessionID)
+	if err != nil || !session.Active() || session.UserID != claims.UserID {
+		return claims, ErrSessionRevoked
 	}
 
-	c.Set("user_id", claims.UserID)           // Store phone number in context
-	c.Set("phone_number", claims.PhoneNumber) // Store phone number in context
-	c.Next()
+	// Impersonation tokens are only valid for the session opened for them
+	impersonatorID := 0
+	if session.ImpersonatorID != nil {
+		impersonatorID = *session.ImpersonatorID
+	}
+	if impersonatorID != claims.ActorID {
+		return claims, ErrSessionRevoked
+	}
+
+	// Impersonating a user shouldn't look like activity on their devices
+	if session.ImpersonatorID == nil {
+		if err := db.TouchAuthSession(c, session.ID, c.ClientIP()); err != nil {
+			log.Printf("failed to record use of session %s: %v", session.ID, err)
+		}
+	}
+
+	return claims, nil
+}
+
+// RequirePermission authenticates the request and checks that the caller
+// holds at least one of the given permissions. With no permissions it only
+// authenticates.
+//
+// Requests authenticate with either a JWT or a service account's API key.
+// API keys only get the permissions of the service account that are also
+// among the key's scopes.
+//
+// Routes with a :course_id parameter, or a course_id query parameter, are
+// checked against that course, so course-scoped roles and ":own" grants
+// apply. The course is stored in the context under "course" and the caller's
+// instructor level on it under "instructor_level".
+//
+// Permissions are looked up on every request, so granting or revoking a role
+// takes effect without waiting for tokens to expire.
+func RequirePermission(db store.Store, permissions ...rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, scopes, ok := authenticate(c, db)
+		if !ok {
+			return
+		}
+
+		// Tokens and API keys would otherwise outlive a purged account
+		user, err := db.GetUser(c, claims.UserID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+			c.Abort()
+			return
+		}
+		if err != nil || user.DeletedAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account has been deleted"})
+			c.Abort()
+			return
+		}
+
+		var target rbac.Target
+		if courseID := courseIDFrom(c); courseID != "" {
+			course, err := db.GetCourse(c, courseID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+				c.Abort()
+				return
+			}
+			target.Course = &course
+			c.Set("course", course)
+
+			instructor, err := db.GetCourseInstructor(c, courseID, claims.UserID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+				c.Abort()
+				return
+			}
+			if err == nil && instructor.Status == models.InstructorActive {
+				target.Level = instructor.Level
+			}
+			c.Set("instructor_level", target.Level)
+		}
+
+		grants, err := db.GetUserGrants(c, claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+			c.Abort()
+			return
+		}
+		if scopes != nil {
+			grants = rbac.Scope(grants, scopes)
+		}
+
+		if len(permissions) > 0 && !allowsAny(grants, permissions, target) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid access"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", claims.UserID)           // Store user ID in context
+		c.Set("phone_number", claims.PhoneNumber) // Store phone number in context
+		c.Set("session_id", claims.SessionID)     // Store session ID in context
+		c.Set("grants", grants)                   // Store permissions for handlers that check more
+
+		if claims.ActorID != 0 {
+			impersonate(c, db, claims)
+			return
+		}
+		c.Next()
+	}
 }
 
-// AdminMiddleware checks if the user is an admin
-func AdminMiddleware(c *gin.Context) {
+// authenticate verifies the JWT or API key the request was made with. For
+// API keys it returns the key's scopes, which are nil for JWTs.
+func authenticate(c *gin.Context, db store.Store) (utils.Claims, []string, bool) {
+	if key, ok := apiKeyFrom(c); ok {
+		k, err := VerifyAPIKey(c, db, key)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return utils.Claims{}, nil, false
+		}
+
+		c.Set("api_key_id", k.ID)
+		return utils.Claims{UserID: k.UserID}, k.Scopes, true
+	}
+
+	// Browsers can't set headers on WebSocket handshakes, so sockets pass
+	// the token as a query parameter instead
 	token := c.GetHeader("Authorization")
+	if token == "" && websocket.IsWebSocketUpgrade(c.Request) {
+		token = c.Query("authorization")
+	}
 	if token == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
 		c.Abort()
-		return
+		return utils.Claims{}, nil, false
 	}
 
-	claims, err := utils.VerifyJWT(token) // We only care about phone number here
+	claims, err := VerifySession(c, db, token)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 		c.Abort()
-		return
+		return claims, nil, false
 	}
-	if claims.Role != "admin" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid access"})
-		c.Abort()
-		return
+
+	return claims, nil, true
+}
+
+// Can reports whether the authenticated caller may perform action on the
+// course RequirePermission loaded, or platform-wide when there is none
+func Can(c *gin.Context, action rbac.Permission) bool {
+	var target rbac.Target
+	if course, ok := c.Get("course"); ok {
+		found := course.(models.Course)
+		target.Course = &found
+		target.Level = c.GetString("instructor_level")
+	}
+
+	grants, _ := c.Get("grants")
+	g, _ := grants.([]models.PermissionGrant)
+	return rbac.Allows(g, action, target)
+}
+
+func allowsAny(grants []models.PermissionGrant, permissions []rbac.Permission, target rbac.Target) bool {
+	for _, p := range permissions {
+		if rbac.Allows(grants, p, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func courseIDFrom(c *gin.Context) string {
+	if id := c.Param("course_id"); id != "" {
+		return id
 	}
-	c.Set("user_id", claims.UserID)           // Store phone number in context
-	c.Set("phone_number", claims.PhoneNumber) // Store phone number in context
-	c.Next()
+	return c.Query("course_id")
 }
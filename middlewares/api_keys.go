@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fintech/pkg/apikey"
+	"fintech/store"
+	"fintech/store/models"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrInvalidAPIKey is returned for unknown, revoked or expired API keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// apiKeyFrom returns the API key the request was made with, if any. Keys are
+// sent either as a Bearer token or in the X-API-Key header.
+func apiKeyFrom(c *gin.Context) (string, bool) {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key, true
+	}
+
+	key := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return key, strings.HasPrefix(key, apikey.Tag)
+}
+
+// VerifyAPIKey looks up an API key and checks it can still be used
+func VerifyAPIKey(c *gin.Context, db store.Store, key string) (models.APIKey, error) {
+	prefix, ok := apikey.Parse(key)
+	if !ok {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+
+	k, err := db.GetAPIKeyByPrefix(c, prefix)
+	if err != nil {
+		return k, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(apikey.Hash(key)), []byte(k.KeyHash)) != 1 || !k.Active() {
+		return k, ErrInvalidAPIKey
+	}
+
+	if err := db.TouchAPIKey(c, k.ID, c.ClientIP()); err != nil {
+		log.Printf("failed to record use of API key %d: %v", k.ID, err)
+	}
+
+	return k, nil
+}
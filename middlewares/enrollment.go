@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"database/sql"
+	"errors"
+	"fintech/pkg/rbac"
+	"fintech/store"
+	"fintech/store/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireEnrollment only lets through learners with an active enrollment in
+// the course RequirePermission loaded, and the people teaching or managing
+// it. Requests without a course are left for the handler to reject.
+func RequireEnrollment(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get("course")
+		if !ok {
+			return
+		}
+		course := value.(models.Course)
+
+		// Instructors of any level, and anyone who may edit the course
+		if c.GetString("instructor_level") != "" || Can(c, rbac.CourseEdit) {
+			return
+		}
+
+		enrollment, err := db.GetEnrollment(c, c.GetInt("user_id"), course.ID.String())
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check enrollment"})
+			c.Abort()
+			return
+		}
+		if err != nil || !enrollment.Active() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not enrolled in this course"})
+			c.Abort()
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"fintech/pkg/audit"
+	"fintech/store"
+	"fintech/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// impersonationDenied are reads impersonators can't make: marking chat
+// messages read changes what the user sees, and an export hands over
+// everything the user has
+var impersonationDenied = map[string]bool{
+	"/chat/sessions/:session_id/messages/read": true,
+	"/me/export/:export_id/download":           true,
+}
+
+// impersonate runs a request made with an impersonation token. Impersonation
+// is for seeing what the user sees, so only reads are allowed, and every
+// request is recorded in the audit log.
+func impersonate(c *gin.Context, db store.Store, claims utils.Claims) {
+	c.Set("actor_id", claims.ActorID)
+
+	readOnly := c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions
+	// Chat sockets are opened with a GET but send messages as the user
+	if !readOnly || websocket.IsWebSocketUpgrade(c.Request) || impersonationDenied[c.FullPath()] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation sessions are read-only"})
+		c.Abort()
+	} else {
+		c.Next()
+	}
+
+	event := audit.FromRequest(c, audit.ActionImpersonationRequest, "", "")
+	event.Status = c.Writer.Status()
+	event.Details = audit.Details(map[string]interface{}{"session_id": claims.SessionID})
+	audit.Record(c, db, event)
+}
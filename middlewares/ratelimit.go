@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fintech/pkg/phone"
+	"fintech/pkg/ratelimit"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPeekBody is the largest request body RateByPhone reads the number from
+const maxPeekBody = 64 << 10
+
+// RateKey picks the bucket a request counts against. Requests it returns
+// false for aren't limited by the policy.
+type RateKey func(c *gin.Context) (string, bool)
+
+// RateByIP keys requests by client address
+func RateByIP(c *gin.Context) (string, bool) {
+	return "ip:" + c.ClientIP(), true
+}
+
+// RateByUser keys requests by the authenticated user, so it has to come after
+// RequirePermission. Unauthenticated requests fall back to their address.
+func RateByUser(c *gin.Context) (string, bool) {
+	if userID := c.GetInt("user_id"); userID != 0 {
+		return "user:" + strconv.Itoa(userID), true
+	}
+	return RateByIP(c)
+}
+
+// RateByPhone keys requests by the phone_number in their JSON body, in E.164
+// so differently written forms of a number share a bucket. The body is put
+// back for the handler to read.
+func RateByPhone(parser phone.Parser) RateKey {
+	return func(c *gin.Context) (string, bool) {
+		original := c.Request.Body
+		peeked, err := io.ReadAll(io.LimitReader(original, maxPeekBody+1))
+		c.Request.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(peeked), original), original}
+		if err != nil || len(peeked) > maxPeekBody {
+			return "", false
+		}
+
+		var req struct {
+			PhoneNumber string `json:"phone_number"`
+		}
+		if json.Unmarshal(peeked, &req) != nil {
+			return "", false
+		}
+		// Numbers that don't parse are rejected by the handler anyway
+		number, err := parser.Normalize(req.PhoneNumber)
+		if err != nil {
+			return "", false
+		}
+		return "phone:" + number, true
+	}
+}
+
+// RateLimit takes a token from the request's bucket under policy, answering
+// 429 with a Retry-After header once it's empty. The RateLimit-* headers
+// describe whichever of the route's policies has the fewest requests left.
+//
+// When the limiter fails the request is let through, so an outage of a
+// shared backend doesn't take the API down with it.
+func RateLimit(limiter ratelimit.Limiter, policy ratelimit.Policy, key RateKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy.Disabled() {
+			return
+		}
+		k, ok := key(c)
+		if !ok {
+			return
+		}
+
+		result, err := limiter.Allow(c, policy.Name+":"+k, policy)
+		if err != nil {
+			log.Printf("rate limiter failed for %s: %v", policy.Name, err)
+			return
+		}
+
+		h := c.Writer.Header()
+		if prev, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err != nil || result.Remaining < prev || !result.Allowed {
+			h.Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("RateLimit-Reset", seconds(result.Reset))
+			h.Set("RateLimit-Policy", policy.String())
+		}
+
+		if !result.Allowed {
+			h.Set("Retry-After", seconds(result.RetryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			c.Abort()
+		}
+	}
+}
+
+// seconds rounds up, so clients never retry a moment too early
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
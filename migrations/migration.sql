@@ -51,4 +51,762 @@ CREATE TABLE messages (
     content TEXT NOT NULL,
     is_read BOOLEAN DEFAULT FALSE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
\ No newline at end of file
+);
+CREATE TABLE `otp_deliveries` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `phone_number` varchar(15) NOT NULL,
+  `channel` varchar(20) NOT NULL,
+  `provider` varchar(50) NOT NULL,
+  `provider_message_id` varchar(200) DEFAULT NULL,
+  `status` varchar(20) NOT NULL,
+  `error` varchar(500) DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  KEY `provider_message` (`provider`, `provider_message_id`),
+  KEY `phone_number` (`phone_number`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- OTPs are stored as an HMAC of the code instead of the code itself
+UPDATE `users` SET `otp_code` = '';
+ALTER TABLE `users`
+  CHANGE COLUMN `otp_code` `otp_hash` char(64) NOT NULL DEFAULT '';
+
+CREATE TABLE `otp_attempts` (
+  `scope` enum('phone','ip') NOT NULL,
+  `subject` varchar(64) NOT NULL,
+  `failures` int NOT NULL DEFAULT 0,
+  `locked_until` datetime(6) DEFAULT NULL,
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`scope`, `subject`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `auth_sessions` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` int NOT NULL,
+  `expires_at` datetime(6) NOT NULL,
+  `revoked_at` datetime(6) DEFAULT NULL,
+  `revoked_reason` varchar(50) NOT NULL DEFAULT '',
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `auth_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `refresh_tokens` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `session_id` CHAR(36) NOT NULL,
+  `token_hash` char(64) NOT NULL,
+  `expires_at` datetime(6) NOT NULL,
+  `used_at` datetime(6) DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `token_hash` (`token_hash`),
+  KEY `session_id` (`session_id`),
+  CONSTRAINT `refresh_tokens_session` FOREIGN KEY (`session_id`) REFERENCES `auth_sessions` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Roles live in their own tables instead of an enum on users, so they can be
+-- granted and revoked at runtime
+CREATE TABLE `roles` (
+  `name` varchar(32) NOT NULL,
+  `description` varchar(200) NOT NULL DEFAULT '',
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `roles` (`name`, `description`) VALUES
+  ('user', 'Regular learner'),
+  ('admin', 'Full access to courses, users and chats');
+
+CREATE TABLE `user_roles` (
+  `user_id` int NOT NULL,
+  `role` varchar(32) NOT NULL,
+  `granted_by` int DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`user_id`, `role`),
+  KEY `role` (`role`),
+  CONSTRAINT `user_roles_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `user_roles_role` FOREIGN KEY (`role`) REFERENCES `roles` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `user_roles` (`user_id`, `role`) SELECT `id`, 'user' FROM `users`;
+INSERT INTO `user_roles` (`user_id`, `role`) SELECT `id`, 'admin' FROM `users` WHERE `role` = 'admin';
+
+ALTER TABLE `users` DROP COLUMN `role`;
+
+-- Fine-grained permissions attached to roles. Roles can be granted for a
+-- single course through user_roles.course_id, empty meaning platform-wide.
+CREATE TABLE `permissions` (
+  `name` varchar(64) NOT NULL,
+  `description` varchar(200) NOT NULL DEFAULT '',
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `role_permissions` (
+  `role` varchar(32) NOT NULL,
+  `permission` varchar(64) NOT NULL,
+  PRIMARY KEY (`role`, `permission`),
+  CONSTRAINT `role_permissions_role` FOREIGN KEY (`role`) REFERENCES `roles` (`name`) ON DELETE CASCADE,
+  CONSTRAINT `role_permissions_permission` FOREIGN KEY (`permission`) REFERENCES `permissions` (`name`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+  ('course:view', 'View course details and folders'),
+  ('course:create', 'Create new courses'),
+  ('course:edit:own', 'Edit courses you own'),
+  ('course:edit:any', 'Edit any course'),
+  ('course:delete:own', 'Delete courses you own'),
+  ('course:delete:any', 'Delete any course'),
+  ('folder:edit', 'Create, edit and delete folders'),
+  ('folder:edit:own', 'Create, edit and delete folders in courses you own'),
+  ('folder:edit:any', 'Create, edit and delete folders in any course'),
+  ('folder:upload', 'Upload videos to folders'),
+  ('folder:upload:own', 'Upload videos to courses you own'),
+  ('folder:upload:any', 'Upload videos to any course'),
+  ('chat:participate', 'Chat with course instructors'),
+  ('chat:support', 'Answer learner chats'),
+  ('user:manage', 'Manage users, roles and sessions');
+
+INSERT INTO `roles` (`name`, `description`) VALUES
+  ('student', 'Learner taking courses'),
+  ('teaching_assistant', 'Helps instructors with uploads and learner chats'),
+  ('instructor', 'Creates and manages their own courses');
+
+ALTER TABLE `user_roles`
+  ADD COLUMN `course_id` varchar(36) NOT NULL DEFAULT '' AFTER `role`,
+  DROP PRIMARY KEY,
+  ADD PRIMARY KEY (`user_id`, `role`, `course_id`);
+
+UPDATE `user_roles` SET `role` = 'student' WHERE `role` = 'user';
+DELETE FROM `roles` WHERE `name` = 'user';
+
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+  ('student', 'course:view'),
+  ('student', 'chat:participate'),
+  ('teaching_assistant', 'course:view'),
+  ('teaching_assistant', 'folder:upload'),
+  ('teaching_assistant', 'chat:support'),
+  ('instructor', 'course:view'),
+  ('instructor', 'course:create'),
+  ('instructor', 'course:edit:own'),
+  ('instructor', 'course:delete:own'),
+  ('instructor', 'folder:edit:own'),
+  ('instructor', 'folder:upload:own'),
+  ('instructor', 'chat:support'),
+  ('admin', 'course:view'),
+  ('admin', 'course:create'),
+  ('admin', 'course:edit:any'),
+  ('admin', 'course:delete:any'),
+  ('admin', 'folder:edit:any'),
+  ('admin', 'folder:upload:any'),
+  ('admin', 'chat:participate'),
+  ('admin', 'chat:support'),
+  ('admin', 'user:manage');
+
+-- Instructors of a course. ":own" permissions apply to courses the user is an
+-- active instructor of, limited by their level.
+CREATE TABLE `course_instructors` (
+  `course_id` CHAR(36) NOT NULL,
+  `user_id` int NOT NULL,
+  `level` enum('owner','co_instructor','teaching_assistant') NOT NULL,
+  `status` enum('invited','active') NOT NULL DEFAULT 'invited',
+  `invited_by` int DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`course_id`, `user_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `course_instructors_course` FOREIGN KEY (`course_id`) REFERENCES `courses` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `course_instructors_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `course_instructors` (`course_id`, `user_id`, `level`, `status`)
+  SELECT `id`, `author_id`, 'owner', 'active' FROM `courses`;
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+  ('course:instructors:own', 'Invite and remove instructors on courses you own'),
+  ('course:instructors:any', 'Invite and remove instructors on any course');
+
+-- Teaching assistants only get upload rights on courses they assist on
+DELETE FROM `role_permissions` WHERE `role` = 'teaching_assistant' AND `permission` = 'folder:upload';
+
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+  ('teaching_assistant', 'folder:upload:own'),
+  ('instructor', 'course:instructors:own'),
+  ('admin', 'course:instructors:any');
+
+-- User profiles
+ALTER TABLE `users`
+  ADD COLUMN `name` varchar(100) NOT NULL DEFAULT '' AFTER `otp_expiry`,
+  ADD COLUMN `email` varchar(254) DEFAULT NULL AFTER `name`,
+  ADD COLUMN `email_verified_at` datetime(6) DEFAULT NULL AFTER `email`,
+  ADD COLUMN `pending_email` varchar(254) NOT NULL DEFAULT '' AFTER `email_verified_at`,
+  ADD COLUMN `email_code_hash` char(64) NOT NULL DEFAULT '' AFTER `pending_email`,
+  ADD COLUMN `email_code_expiry` datetime(6) DEFAULT NULL AFTER `email_code_hash`,
+  ADD COLUMN `avatar_key` varchar(200) NOT NULL DEFAULT '' AFTER `email_code_expiry`,
+  ADD COLUMN `locale` varchar(35) NOT NULL DEFAULT 'en' AFTER `avatar_key`,
+  ADD UNIQUE KEY `email` (`email`);
+
+-- Phone numbers are stored in E.164, up to 15 digits after the "+". Run
+-- `go run ./cmd/phonemigrate` afterwards to normalize and dedupe existing users.
+ALTER TABLE `users` MODIFY `phone_number` varchar(16) NOT NULL;
+ALTER TABLE `otp_deliveries` MODIFY `phone_number` varchar(16) NOT NULL;
+
+-- TOTP second factor
+CREATE TABLE `user_mfa` (
+  `user_id` int NOT NULL,
+  `totp_secret` varchar(255) NOT NULL,
+  `confirmed_at` datetime(6) DEFAULT NULL,
+  `last_used_step` bigint NOT NULL DEFAULT 0,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`user_id`),
+  CONSTRAINT `user_mfa_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `mfa_recovery_codes` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `code_hash` char(64) NOT NULL,
+  `used_at` datetime(6) DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `user_code` (`user_id`, `code_hash`),
+  CONSTRAINT `mfa_recovery_codes_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `mfa_challenges` (
+  `token_hash` char(64) NOT NULL,
+  `user_id` int NOT NULL,
+  `expires_at` datetime(6) NOT NULL,
+  `used_at` datetime(6) DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`token_hash`),
+  CONSTRAINT `mfa_challenges_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `roles` ADD COLUMN `mfa_required` tinyint(1) NOT NULL DEFAULT 0 AFTER `description`;
+UPDATE `roles` SET `mfa_required` = 1 WHERE `name` = 'admin';
+
+ALTER TABLE `otp_attempts` MODIFY `scope` enum('phone','ip','mfa') NOT NULL;
+
+-- Service accounts and their API keys. Service accounts have no phone number
+-- and can't log in with an OTP.
+ALTER TABLE `users`
+  ADD COLUMN `kind` enum('human','service') NOT NULL DEFAULT 'human' AFTER `id`,
+  MODIFY `phone_number` varchar(16) DEFAULT NULL;
+
+CREATE TABLE `api_keys` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `prefix` varchar(16) NOT NULL,
+  `key_hash` char(64) NOT NULL,
+  `expires_at` datetime(6) DEFAULT NULL,
+  `last_used_at` datetime(6) DEFAULT NULL,
+  `last_used_ip` varchar(45) NOT NULL DEFAULT '',
+  `revoked_at` datetime(6) DEFAULT NULL,
+  `created_by` int DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `prefix` (`prefix`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `api_keys_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `api_key_scopes` (
+  `api_key_id` int NOT NULL,
+  `permission` varchar(64) NOT NULL,
+  PRIMARY KEY (`api_key_id`, `permission`),
+  CONSTRAINT `api_key_scopes_key` FOREIGN KEY (`api_key_id`) REFERENCES `api_keys` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `api_key_scopes_permission` FOREIGN KEY (`permission`) REFERENCES `permissions` (`name`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- OpenID Connect logins
+CREATE TABLE `user_identities` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `provider` varchar(50) NOT NULL,
+  `subject` varchar(255) NOT NULL,
+  `email` varchar(254) NOT NULL DEFAULT '',
+  `last_login_at` datetime(6) DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `provider_subject` (`provider`, `subject`),
+  UNIQUE KEY `user_provider` (`user_id`, `provider`),
+  CONSTRAINT `user_identities_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `oidc_states` (
+  `state_hash` char(64) NOT NULL,
+  `provider` varchar(50) NOT NULL,
+  `code_verifier` varchar(128) NOT NULL,
+  `nonce` varchar(128) NOT NULL,
+  `link_user_id` int DEFAULT NULL,
+  `expires_at` datetime(6) NOT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`state_hash`),
+  CONSTRAINT `oidc_states_user` FOREIGN KEY (`link_user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Audit log, and sessions an admin opened to act as another user
+CREATE TABLE `audit_events` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `actor_id` int DEFAULT NULL,
+  `user_id` int DEFAULT NULL,
+  `action` varchar(100) NOT NULL,
+  `target_type` varchar(50) NOT NULL DEFAULT '',
+  `target_id` varchar(64) NOT NULL DEFAULT '',
+  `method` varchar(10) NOT NULL DEFAULT '',
+  `path` varchar(500) NOT NULL DEFAULT '',
+  `status` int NOT NULL DEFAULT 0,
+  `ip` varchar(45) NOT NULL DEFAULT '',
+  `details` text NOT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  KEY `actor_id` (`actor_id`, `created_at`),
+  KEY `user_id` (`user_id`, `created_at`),
+  KEY `action` (`action`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `auth_sessions`
+  ADD COLUMN `impersonator_id` int DEFAULT NULL AFTER `user_id`,
+  ADD CONSTRAINT `auth_sessions_impersonator` FOREIGN KEY (`impersonator_id`) REFERENCES `users` (`id`) ON DELETE CASCADE;
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+  ('user:impersonate', 'View the platform as another user');
+
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+  ('admin', 'user:impersonate');
+
+-- Devices a session was opened on, and an optional per-user device limit
+ALTER TABLE `auth_sessions`
+  ADD COLUMN `user_agent` varchar(500) NOT NULL DEFAULT '' AFTER `impersonator_id`,
+  ADD COLUMN `ip` varchar(45) NOT NULL DEFAULT '' AFTER `user_agent`,
+  ADD COLUMN `last_seen_at` datetime(6) DEFAULT NULL AFTER `ip`;
+
+ALTER TABLE `users`
+  ADD COLUMN `max_devices` int DEFAULT NULL AFTER `locale`;
+
+-- Personal data exports, and account deletion after a grace period. Deleted
+-- users keep their row, stripped of personal data, so records referencing
+-- them stay intact.
+ALTER TABLE `users`
+  ADD COLUMN `deletion_scheduled_at` datetime(6) DEFAULT NULL AFTER `max_devices`,
+  ADD COLUMN `deleted_at` datetime(6) DEFAULT NULL AFTER `deletion_scheduled_at`,
+  ADD KEY `deletion_scheduled_at` (`deletion_scheduled_at`);
+
+CREATE TABLE `data_exports` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` int NOT NULL,
+  `status` enum('pending','ready','failed') NOT NULL DEFAULT 'pending',
+  `storage_key` varchar(200) NOT NULL DEFAULT '',
+  `error` varchar(500) NOT NULL DEFAULT '',
+  `expires_at` datetime(6) DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `completed_at` datetime(6) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `user_id` (`user_id`, `created_at`),
+  KEY `expires_at` (`expires_at`),
+  CONSTRAINT `data_exports_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Audit events form a hash chain and can't be changed once written. The
+-- head of the chain lives in its own row so writers can lock it. Events
+-- written before this have no hash and are left out of verification.
+ALTER TABLE `audit_events`
+  ADD COLUMN `request_id` varchar(64) NOT NULL DEFAULT '' AFTER `ip`,
+  ADD COLUMN `changes` mediumtext NOT NULL AFTER `request_id`,
+  ADD COLUMN `prev_hash` char(64) NOT NULL DEFAULT '' AFTER `details`,
+  ADD COLUMN `hash` char(64) NOT NULL DEFAULT '' AFTER `prev_hash`,
+  ADD KEY `target` (`target_type`, `target_id`, `created_at`),
+  ADD KEY `request_id` (`request_id`);
+
+CREATE TABLE `audit_chain` (
+  `id` tinyint NOT NULL,
+  `hash` char(64) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `audit_chain` (`id`, `hash`) VALUES (1, '');
+
+CREATE TRIGGER `audit_events_no_update` BEFORE UPDATE ON `audit_events`
+  FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
+
+CREATE TRIGGER `audit_events_no_delete` BEFORE DELETE ON `audit_events`
+  FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+  ('audit:view', 'Query and export the audit log');
+
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+  ('admin', 'audit:view');
+
+-- Learners enrolled in a course. Course content and chats are only open to
+-- enrolled learners and the course's instructors.
+CREATE TABLE `enrollments` (
+  `user_id` int NOT NULL,
+  `course_id` CHAR(36) NOT NULL,
+  `status` enum('active','cancelled') NOT NULL DEFAULT 'active',
+  `source` enum('self','admin','purchase') NOT NULL,
+  `expires_at` datetime(6) DEFAULT NULL,
+  `enrolled_by` int DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`user_id`, `course_id`),
+  KEY `course_id` (`course_id`, `status`),
+  CONSTRAINT `enrollments_course` FOREIGN KEY (`course_id`) REFERENCES `courses` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `enrollments_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+  ('enrollment:manage', 'Enroll and unenroll learners on any course');
+
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+  ('admin', 'enrollment:manage');
+
+-- Course prices, in the currency's minor unit, and orders paid through a
+-- payment gateway. Orders are financial records, so they keep the course
+-- they were placed for from being deleted.
+ALTER TABLE `courses`
+  ADD COLUMN `price_minor` bigint NOT NULL DEFAULT 0 AFTER `folder_id`,
+  ADD COLUMN `currency` char(3) NOT NULL DEFAULT 'INR' AFTER `price_minor`;
+
+CREATE TABLE `orders` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` int NOT NULL,
+  `course_id` CHAR(36) NOT NULL,
+  `amount_minor` bigint NOT NULL,
+  `currency` char(3) NOT NULL,
+  `status` enum('pending','paid','fulfilled','refunded','failed') NOT NULL DEFAULT 'pending',
+  `gateway` varchar(32) NOT NULL,
+  `gateway_order_id` varchar(100) NOT NULL,
+  `gateway_payment_id` varchar(100) NOT NULL DEFAULT '',
+  `paid_at` datetime(6) DEFAULT NULL,
+  `fulfilled_at` datetime(6) DEFAULT NULL,
+  `refunded_at` datetime(6) DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `gateway_order` (`gateway`, `gateway_order_id`),
+  KEY `user_id` (`user_id`, `created_at`),
+  KEY `course_id` (`course_id`, `status`),
+  CONSTRAINT `orders_course` FOREIGN KEY (`course_id`) REFERENCES `courses` (`id`),
+  CONSTRAINT `orders_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Raw payment gateway webhooks, stored before they're applied so each event
+-- is processed once however often the gateway delivers it
+CREATE TABLE `webhook_events` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `gateway` varchar(32) NOT NULL,
+  `event_id` varchar(100) NOT NULL,
+  `event_type` varchar(100) NOT NULL DEFAULT '',
+  `payload` mediumtext NOT NULL,
+  `status` enum('pending','processed','ignored','failed') NOT NULL DEFAULT 'pending',
+  `attempts` int NOT NULL DEFAULT 0,
+  `last_error` varchar(1000) NOT NULL DEFAULT '',
+  `next_attempt_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `received_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `processed_at` datetime(6) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `gateway_event` (`gateway`, `event_id`),
+  KEY `due` (`status`, `next_attempt_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+  ('payment:manage', 'Inspect and replay payment webhooks');
+
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+  ('admin', 'payment:manage');
+
+-- How far learners got through each video of a course
+CREATE TABLE `video_progress` (
+  `user_id` int NOT NULL,
+  `course_id` CHAR(36) NOT NULL,
+  `video_id` varchar(64) NOT NULL,
+  `furthest_seconds` int NOT NULL DEFAULT 0,
+  `duration_seconds` int NOT NULL DEFAULT 0,
+  `watched_at` datetime(6) DEFAULT NULL,
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`user_id`, `course_id`, `video_id`),
+  CONSTRAINT `video_progress_course` FOREIGN KEY (`course_id`) REFERENCES `courses` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `video_progress_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Full and partial refunds of orders. Refunds outside the refund policy wait
+-- for an admin to approve them. Every completed refund gets a credit note.
+ALTER TABLE `orders`
+  ADD COLUMN `refunded_minor` bigint NOT NULL DEFAULT 0 AFTER `amount_minor`;
+
+CREATE TABLE `refunds` (
+  `id` CHAR(36) NOT NULL,
+  `order_id` CHAR(36) NOT NULL,
+  `user_id` int NOT NULL,
+  `amount_minor` bigint NOT NULL,
+  `currency` char(3) NOT NULL,
+  `reason` varchar(500) NOT NULL DEFAULT '',
+  `status` enum('pending_approval','processing','refunded','rejected','failed') NOT NULL,
+  `within_policy` tinyint(1) NOT NULL DEFAULT 0,
+  `policy_notes` varchar(500) NOT NULL DEFAULT '',
+  `gateway_refund_id` varchar(100) NOT NULL DEFAULT '',
+  `error` varchar(1000) NOT NULL DEFAULT '',
+  `requested_by` int NOT NULL,
+  `reviewed_by` int DEFAULT NULL,
+  `review_note` varchar(500) NOT NULL DEFAULT '',
+  `reviewed_at` datetime(6) DEFAULT NULL,
+  `completed_at` datetime(6) DEFAULT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  KEY `order_id` (`order_id`, `created_at`),
+  KEY `status` (`status`, `created_at`),
+  CONSTRAINT `refunds_order` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `credit_notes` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `number` varchar(32) NOT NULL DEFAULT '',
+  `refund_id` CHAR(36) NOT NULL,
+  `order_id` CHAR(36) NOT NULL,
+  `user_id` int NOT NULL,
+  `amount_minor` bigint NOT NULL,
+  `currency` char(3) NOT NULL,
+  `storage_key` varchar(200) NOT NULL DEFAULT '',
+  `issued_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `refund_id` (`refund_id`),
+  KEY `order_id` (`order_id`),
+  CONSTRAINT `credit_notes_refund` FOREIGN KEY (`refund_id`) REFERENCES `refunds` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Double-entry ledger of every movement of money. Each entry's lines sum to
+-- zero per currency; debits are positive and credits negative. Account codes
+-- start with their type, e.g. 'assets:gateway:razorpay'.
+CREATE TABLE `journal_entries` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `kind` varchar(32) NOT NULL,
+  `reference` varchar(64) NOT NULL,
+  `memo` varchar(255) NOT NULL DEFAULT '',
+  `effective_at` datetime(6) NOT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `kind_reference` (`kind`, `reference`),
+  KEY `effective_at` (`effective_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `journal_lines` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `entry_id` bigint NOT NULL,
+  `account` varchar(100) NOT NULL,
+  `amount_minor` bigint NOT NULL,
+  `currency` char(3) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `entry_id` (`entry_id`),
+  KEY `account` (`account`, `currency`, `entry_id`),
+  CONSTRAINT `journal_lines_entry` FOREIGN KEY (`entry_id`) REFERENCES `journal_entries` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+  ('finance:view', 'View the ledger and finance reports');
+
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+  ('admin', 'finance:view');
+
+-- Instructors' shares of a course's sales. The shares of a course starting at
+-- the same time form one agreement, and the platform keeps what they leave.
+-- Courses without an agreement pay their author the default share.
+CREATE TABLE `revenue_shares` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `course_id` CHAR(36) NOT NULL,
+  `user_id` int NOT NULL,
+  `share_bps` int NOT NULL,
+  `starts_at` datetime(6) NOT NULL,
+  `ends_at` datetime(6) DEFAULT NULL,
+  `created_by` int NOT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  KEY `course_id` (`course_id`, `starts_at`),
+  CONSTRAINT `revenue_shares_course` FOREIGN KEY (`course_id`) REFERENCES `courses` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `revenue_shares_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Bank accounts instructors are paid out to. bank_code is the IFSC for NEFT
+-- and the routing number for ACH.
+CREATE TABLE `payout_accounts` (
+  `user_id` int NOT NULL,
+  `method` enum('neft','ach') NOT NULL,
+  `account_holder` varchar(100) NOT NULL,
+  `account_number` varchar(34) NOT NULL,
+  `bank_code` varchar(20) NOT NULL,
+  `bank_name` varchar(100) NOT NULL DEFAULT '',
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`user_id`),
+  CONSTRAINT `payout_accounts_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Payout runs. Creating a batch moves the amounts out of the instructors'
+-- ledger accounts, so later runs don't pay them again; cancelling moves them
+-- back. Payouts keep a copy of the bank account they were calculated for.
+CREATE TABLE `payout_batches` (
+  `id` CHAR(36) NOT NULL,
+  `status` enum('pending_approval','approved','settled','cancelled') NOT NULL DEFAULT 'pending_approval',
+  `cutoff_at` datetime(6) NOT NULL,
+  `created_by` int DEFAULT NULL,
+  `approved_by` int DEFAULT NULL,
+  `approved_at` datetime(6) DEFAULT NULL,
+  `settled_by` int DEFAULT NULL,
+  `settled_at` datetime(6) DEFAULT NULL,
+  `bank_reference` varchar(100) NOT NULL DEFAULT '',
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  KEY `status` (`status`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `payouts` (
+  `id` CHAR(36) NOT NULL,
+  `batch_id` CHAR(36) NOT NULL,
+  `user_id` int NOT NULL,
+  `amount_minor` bigint NOT NULL,
+  `currency` char(3) NOT NULL,
+  `method` enum('neft','ach') NOT NULL,
+  `account_holder` varchar(100) NOT NULL,
+  `account_number` varchar(34) NOT NULL,
+  `bank_code` varchar(20) NOT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  KEY `batch_id` (`batch_id`),
+  KEY `user_id` (`user_id`, `created_at`),
+  CONSTRAINT `payouts_batch` FOREIGN KEY (`batch_id`) REFERENCES `payout_batches` (`id`),
+  CONSTRAINT `payouts_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+  ('payout:manage', 'Set revenue shares and approve, export and settle instructor payouts');
+
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+  ('admin', 'payout:manage');
+
+-- Coupons. Courses get a category coupons can be scoped to, and orders record
+-- the discount taken off the course's price. Redemptions are written with the
+-- order; the coupon row is locked while its limits are checked.
+ALTER TABLE `courses`
+  ADD COLUMN `category` varchar(50) NOT NULL DEFAULT '' AFTER `currency`,
+  ADD KEY `category` (`category`);
+
+ALTER TABLE `orders`
+  ADD COLUMN `discount_minor` bigint NOT NULL DEFAULT 0 AFTER `amount_minor`;
+
+CREATE TABLE `coupons` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `code` varchar(40) NOT NULL,
+  `description` varchar(200) NOT NULL DEFAULT '',
+  `kind` enum('percent','fixed') NOT NULL,
+  `percent_bps` int NOT NULL DEFAULT 0,
+  `amount_minor` bigint NOT NULL DEFAULT 0,
+  `currency` char(3) NOT NULL DEFAULT '',
+  `min_order_minor` bigint NOT NULL DEFAULT 0,
+  `course_id` CHAR(36) DEFAULT NULL,
+  `category` varchar(50) NOT NULL DEFAULT '',
+  `max_redemptions` int DEFAULT NULL,
+  `per_user_limit` int DEFAULT NULL,
+  `stackable` tinyint(1) NOT NULL DEFAULT 0,
+  `starts_at` datetime(6) NOT NULL,
+  `ends_at` datetime(6) DEFAULT NULL,
+  `disabled_at` datetime(6) DEFAULT NULL,
+  `created_by` int NOT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `code` (`code`),
+  CONSTRAINT `coupons_course` FOREIGN KEY (`course_id`) REFERENCES `courses` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `coupon_redemptions` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `coupon_id` bigint NOT NULL,
+  `order_id` CHAR(36) NOT NULL,
+  `user_id` int NOT NULL,
+  `discount_minor` bigint NOT NULL,
+  `currency` char(3) NOT NULL,
+  `created_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `coupon_order` (`coupon_id`, `order_id`),
+  KEY `coupon_user` (`coupon_id`, `user_id`),
+  KEY `order_id` (`order_id`),
+  CONSTRAINT `coupon_redemptions_coupon` FOREIGN KEY (`coupon_id`) REFERENCES `coupons` (`id`),
+  CONSTRAINT `coupon_redemptions_order` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`),
+  CONSTRAINT `coupon_redemptions_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+  ('coupon:manage', 'Create, change and disable coupons');
+
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+  ('admin', 'coupon:manage');
+
+-- GST invoices. Invoices and credit notes are numbered without gaps within
+-- each financial year from document_sequences, whose row is locked until the
+-- document is stored. Credit notes issued before invoicing keep their numbers
+-- and had no GST.
+CREATE TABLE `document_sequences` (
+  `series` varchar(8) NOT NULL,
+  `financial_year` char(5) NOT NULL,
+  `last_number` int NOT NULL,
+  PRIMARY KEY (`series`, `financial_year`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `billing_profiles` (
+  `user_id` int NOT NULL,
+  `legal_name` varchar(100) NOT NULL DEFAULT '',
+  `gstin` char(15) NOT NULL DEFAULT '',
+  `address` varchar(300) NOT NULL DEFAULT '',
+  `state_code` char(2) NOT NULL DEFAULT '',
+  `updated_at` datetime(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`user_id`),
+  CONSTRAINT `billing_profiles_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `invoices` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `number` varchar(16) NOT NULL,
+  `financial_year` char(5) NOT NULL,
+  `order_id` CHAR(36) NOT NULL,
+  `user_id` int NOT NULL,
+  `total_minor` bigint NOT NULL,
+  `currency` char(3) NOT NULL,
+  `taxable_minor` bigint NOT NULL,
+  `cgst_minor` bigint NOT NULL DEFAULT 0,
+  `sgst_minor` bigint NOT NULL DEFAULT 0,
+  `igst_minor` bigint NOT NULL DEFAULT 0,
+  `rate_bps` int NOT NULL DEFAULT 0,
+  `sac` varchar(8) NOT NULL DEFAULT '',
+  `place_of_supply` char(2) NOT NULL DEFAULT '',
+  `supplier_gstin` char(15) NOT NULL DEFAULT '',
+  `buyer_name` varchar(100) NOT NULL DEFAULT '',
+  `buyer_gstin` char(15) NOT NULL DEFAULT '',
+  `buyer_address` varchar(300) NOT NULL DEFAULT '',
+  `buyer_state_code` char(2) NOT NULL DEFAULT '',
+  `storage_key` varchar(200) NOT NULL DEFAULT '',
+  `issued_at` datetime(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `number` (`number`),
+  UNIQUE KEY `order_id` (`order_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `invoices_order` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `credit_notes`
+  ADD COLUMN `invoice_id` bigint DEFAULT NULL AFTER `number`,
+  ADD COLUMN `taxable_minor` bigint NOT NULL DEFAULT 0 AFTER `currency`,
+  ADD COLUMN `cgst_minor` bigint NOT NULL DEFAULT 0 AFTER `taxable_minor`,
+  ADD COLUMN `sgst_minor` bigint NOT NULL DEFAULT 0 AFTER `cgst_minor`,
+  ADD COLUMN `igst_minor` bigint NOT NULL DEFAULT 0 AFTER `sgst_minor`,
+  ADD CONSTRAINT `credit_notes_invoice` FOREIGN KEY (`invoice_id`) REFERENCES `invoices` (`id`);
+
+UPDATE `credit_notes` SET `taxable_minor` = `amount_minor`;
+
+-- Wrong email verification codes count against the user, like OTPs
+ALTER TABLE `otp_attempts` MODIFY `scope` enum('phone','ip','mfa','email') NOT NULL;
@@ -0,0 +1,184 @@
+// Package audit records security relevant events and administrative changes
+// to the audit log
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fintech/store/models"
+	"log"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionImpersonationStart   = "impersonation.start"
+	ActionImpersonationEnd     = "impersonation.end"
+	ActionImpersonationRequest = "impersonation.request"
+
+	ActionDataExportRequested      = "account.export_requested"
+	ActionAccountDeletionRequested = "account.deletion_requested"
+	ActionAccountDeletionCancelled = "account.deletion_cancelled"
+	ActionAccountDeleted           = "account.deleted"
+
+	ActionCourseCreate = "course.create"
+	ActionCourseUpdate = "course.update"
+	ActionCourseDelete = "course.delete"
+
+	ActionFolderCreate = "folder.create"
+	ActionFolderUpdate = "folder.update"
+	ActionFolderDelete = "folder.delete"
+	ActionFolderUpload = "folder.upload"
+
+	ActionInstructorInvite = "course.instructor.invite"
+	ActionInstructorAccept = "course.instructor.accept"
+	ActionInstructorRemove = "course.instructor.remove"
+
+	ActionEnrollmentGrant  = "course.enrollment.grant"
+	ActionEnrollmentCancel = "course.enrollment.cancel"
+
+	ActionRoleCreate      = "role.create"
+	ActionRolePermissions = "role.permissions"
+	ActionRoleMFA         = "role.mfa"
+
+	ActionUserRoleGrant      = "user.role.grant"
+	ActionUserRoleRevoke     = "user.role.revoke"
+	ActionUserMFAReset       = "user.mfa.reset"
+	ActionUserMFADisable     = "user.mfa.disable"
+	ActionUserMaxDevices     = "user.max_devices"
+	ActionUserSessionsRevoke = "user.sessions.revoke"
+
+	ActionServiceAccountCreate = "service_account.create"
+	ActionAPIKeyCreate         = "api_key.create"
+	ActionAPIKeyRevoke         = "api_key.revoke"
+
+	ActionWebhookReplay = "payment.webhook.replay"
+	ActionRefundRequest = "payment.refund.request"
+	ActionRefundCreate  = "payment.refund.create"
+	ActionRefundApprove = "payment.refund.approve"
+	ActionRefundReject  = "payment.refund.reject"
+	ActionRefundRetry   = "payment.refund.retry"
+
+	ActionCouponCreate = "coupon.create"
+	ActionCouponUpdate = "coupon.update"
+
+	ActionRevenueShareSet     = "payout.revenue_share.set"
+	ActionPayoutAccountUpdate = "payout.account.update"
+	ActionPayoutBatchCreate   = "payout.batch.create"
+	ActionPayoutBatchApprove  = "payout.batch.approve"
+	ActionPayoutBatchSettle   = "payout.batch.settle"
+	ActionPayoutBatchCancel   = "payout.batch.cancel"
+)
+
+// Recorder stores audit events
+type Recorder interface {
+	CreateAuditEvent(ctx context.Context, event models.AuditEvent) error
+}
+
+// Record stores an event, logging instead of failing the request if it can't.
+// Changes to the database should instead pass their event to the store
+// method making the change, which writes both in one transaction.
+func Record(ctx context.Context, r Recorder, event models.AuditEvent) {
+	if err := r.CreateAuditEvent(ctx, event); err != nil {
+		log.Printf("failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// FromRequest starts an event for an action taken through the current
+// request, attributed to the authenticated caller
+func FromRequest(c *gin.Context, action, targetType, targetID string) models.AuditEvent {
+	event := models.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		IP:         c.ClientIP(),
+		RequestID:  c.GetString("request_id"),
+	}
+
+	if userID := c.GetInt("user_id"); userID != 0 {
+		event.ActorID = &userID
+	}
+	// While impersonating, the admin is the actor
+	if actorID := c.GetInt("actor_id"); actorID != 0 {
+		userID := c.GetInt("user_id")
+		event.ActorID = &actorID
+		event.UserID = &userID
+	}
+
+	return event
+}
+
+// Details encodes extra context for AuditEvent.Details
+func Details(v map[string]interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// Change is the before and after value of one changed field
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Diff encodes the fields that differ between two versions of a resource, as
+// they appear in the API, for AuditEvent.Changes. Pass nil as before for
+// creations and as after for deletions.
+func Diff(before, after interface{}) string {
+	b, a := fields(before), fields(after)
+
+	changes := map[string]Change{}
+	for k, v := range b {
+		if !reflect.DeepEqual(v, a[k]) {
+			changes[k] = Change{Before: v, After: a[k]}
+		}
+	}
+	for k, v := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{After: v}
+		}
+	}
+
+	out, err := json.Marshal(changes)
+	if err != nil {
+		return "{}"
+	}
+	return string(out)
+}
+
+// fields flattens v to its top level JSON fields
+func fields(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == nil {
+		return m
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	json.Unmarshal(b, &m)
+	return m
+}
+
+// Verify checks that events, given in chain order, link up from prevHash and
+// that none was altered. It returns the hash to continue from and the ID of
+// the first event that fails, or zero if all pass. Events written before
+// the chain was introduced have no hash and are skipped.
+func Verify(prevHash string, events []models.AuditEvent) (string, int64) {
+	for _, e := range events {
+		if e.Hash == "" && prevHash == "" {
+			continue
+		}
+		if e.PrevHash != prevHash || e.ChainHash() != e.Hash {
+			return prevHash, e.ID
+		}
+		prevHash = e.Hash
+	}
+	return prevHash, 0
+}
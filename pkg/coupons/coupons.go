@@ -0,0 +1,110 @@
+// Package coupons decides which discount codes apply to a course and prices
+// the course with them
+package coupons
+
+import (
+	"errors"
+	"fintech/pkg/ledger"
+	"fintech/store/models"
+	"time"
+)
+
+// MinimumCharge is the least a course can cost after discounts, in the
+// currency's minor unit. Gateways won't take payments under one unit of a
+// currency, so discounts stop there.
+const MinimumCharge = 100
+
+// MaxPerOrder is how many coupons one order may use
+const MaxPerOrder = 3
+
+// Reasons a coupon can't be used
+var (
+	ErrNotActive        = errors.New("coupon is not active")
+	ErrNotApplicable    = errors.New("coupon doesn't apply to this course")
+	ErrCurrency         = errors.New("coupon is for another currency")
+	ErrBelowMinimum     = errors.New("course costs less than the coupon's minimum order value")
+	ErrUserLimitReached = errors.New("coupon already used")
+	ErrNotStackable     = errors.New("coupon can't be combined with other coupons")
+	ErrTooMany          = errors.New("too many coupons")
+)
+
+// Discount is what one coupon takes off a course
+type Discount struct {
+	CouponID    int64  `json:"coupon_id"`
+	Code        string `json:"code"`
+	AmountMinor int64  `json:"amount_minor"`
+}
+
+// Price is what a course costs with coupons applied
+type Price struct {
+	ListMinor     int64      `json:"list_minor"`
+	DiscountMinor int64      `json:"discount_minor"`
+	TotalMinor    int64      `json:"total_minor"`
+	Currency      string     `json:"currency"`
+	Discounts     []Discount `json:"discounts"`
+}
+
+// Check returns why the coupon can't be used on the course by a buyer, given
+// the redemptions already holding it, or nil if it can
+func Check(c models.Coupon, course models.Course, usage models.CouponUsage, now time.Time) error {
+	switch {
+	case c.DisabledAt != nil || now.Before(c.StartsAt) || (c.EndsAt != nil && !now.Before(*c.EndsAt)):
+		return ErrNotActive
+	case c.CourseID != nil && *c.CourseID != course.ID.String():
+		return ErrNotApplicable
+	case c.Category != "" && c.Category != course.Category:
+		return ErrNotApplicable
+	case c.Currency != "" && c.Currency != course.Currency:
+		return ErrCurrency
+	case course.PriceMinor < c.MinOrderMinor:
+		return ErrBelowMinimum
+	case c.MaxRedemptions != nil && usage.Total >= *c.MaxRedemptions:
+		return models.ErrCouponLimitReached
+	case c.PerUserLimit != nil && usage.ByUser >= *c.PerUserLimit:
+		return ErrUserLimitReached
+	}
+	return nil
+}
+
+// Apply prices the course with coupons that passed Check. Coupons that
+// aren't stackable can only be used on their own. Percentages are taken off
+// the course's price before fixed amounts, and each coupon only takes what's
+// left above MinimumCharge.
+func Apply(course models.Course, coupons []models.Coupon) (Price, error) {
+	price := Price{
+		ListMinor:  course.PriceMinor,
+		TotalMinor: course.PriceMinor,
+		Currency:   course.Currency,
+		Discounts:  []Discount{},
+	}
+	if len(coupons) > MaxPerOrder {
+		return price, ErrTooMany
+	}
+	if len(coupons) > 1 {
+		for _, c := range coupons {
+			if !c.Stackable {
+				return price, ErrNotStackable
+			}
+		}
+	}
+
+	list := ledger.New(course.PriceMinor, course.Currency)
+	for _, kind := range []string{models.CouponPercent, models.CouponFixed} {
+		for _, c := range coupons {
+			if c.Kind != kind {
+				continue
+			}
+			amount := c.AmountMinor
+			if kind == models.CouponPercent {
+				amount = ledger.Rate(c.PercentBps).Of(list).Amount
+			}
+			amount = min(amount, max(price.TotalMinor-MinimumCharge, 0))
+
+			price.Discounts = append(price.Discounts, Discount{CouponID: c.ID, Code: c.Code, AmountMinor: amount})
+			price.DiscountMinor += amount
+			price.TotalMinor -= amount
+		}
+	}
+
+	return price, nil
+}
@@ -0,0 +1,122 @@
+package coupons
+
+import (
+	"errors"
+	"fintech/store/models"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var now = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func course(price int64) models.Course {
+	return models.Course{ID: uuid.MustParse("3f0c6a0e-8d5e-4f43-9a57-6a3d2b0c1e11"), PriceMinor: price, Currency: "INR", Category: "finance"}
+}
+
+func percent(id int64, bps int) models.Coupon {
+	return models.Coupon{ID: id, Code: "P", Kind: models.CouponPercent, PercentBps: bps, Stackable: true}
+}
+
+func fixed(id int64, amount int64) models.Coupon {
+	return models.Coupon{ID: id, Code: "F", Kind: models.CouponFixed, AmountMinor: amount, Currency: "INR", Stackable: true}
+}
+
+func TestApply(t *testing.T) {
+	single := fixed(1, 500)
+	single.Stackable = false
+
+	tests := []struct {
+		name    string
+		price   int64
+		coupons []models.Coupon
+		want    []int64 // discount of each coupon, in the order taken
+		total   int64
+		wantErr error
+	}{
+		{"no coupons", 10000, nil, []int64{}, 10000, nil},
+		{"percentage", 10000, []models.Coupon{percent(1, 1000)}, []int64{1000}, 9000, nil},
+		{"fixed", 10000, []models.Coupon{fixed(1, 2500)}, []int64{2500}, 7500, nil},
+		{"percentage taken before fixed", 10000, []models.Coupon{fixed(1, 500), percent(2, 1000)}, []int64{1000, 500}, 8500, nil},
+		{"percentages of the list price", 10000, []models.Coupon{percent(1, 2000), percent(2, 2000)}, []int64{2000, 2000}, 6000, nil},
+		{"percentage rounded down", 999, []models.Coupon{percent(1, 1000)}, []int64{99}, 900, nil},
+		{"fixed capped at the minimum charge", 10000, []models.Coupon{fixed(1, 20000)}, []int64{9900}, MinimumCharge, nil},
+		{"stack capped at the minimum charge", 10000, []models.Coupon{percent(1, 5000), percent(2, 5000), fixed(3, 100)},
+			[]int64{5000, 4900, 0}, MinimumCharge, nil},
+		{"course already at the minimum", 50, []models.Coupon{fixed(1, 10)}, []int64{0}, 50, nil},
+		{"unstackable on its own", 10000, []models.Coupon{single}, []int64{500}, 9500, nil},
+		{"unstackable with another", 10000, []models.Coupon{single, percent(2, 1000)}, nil, 10000, ErrNotStackable},
+		{"too many", 10000, []models.Coupon{percent(1, 100), percent(2, 100), percent(3, 100), percent(4, 100)}, nil, 10000, ErrTooMany},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, err := Apply(course(tt.price), tt.coupons)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Apply() error = %v, want %v", err, tt.wantErr)
+			}
+			if price.TotalMinor != tt.total || price.ListMinor != tt.price || price.TotalMinor+price.DiscountMinor != tt.price {
+				t.Errorf("Apply() = list %d, discount %d, total %d, want total %d", price.ListMinor, price.DiscountMinor, price.TotalMinor, tt.total)
+			}
+			if err != nil {
+				return
+			}
+
+			got := []int64{}
+			for _, d := range price.Discounts {
+				got = append(got, d.AmountMinor)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply() discounts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	limit := func(n int) *int { return &n }
+	at := func(d time.Duration) *time.Time { t := now.Add(d); return &t }
+	otherCourse := uuid.NewString()
+	thisCourse := course(0).ID.String()
+
+	tests := []struct {
+		name   string
+		coupon func(c *models.Coupon)
+		price  int64
+		usage  models.CouponUsage
+		want   error
+	}{
+		{"usable", func(c *models.Coupon) {}, 10000, models.CouponUsage{}, nil},
+		{"not started", func(c *models.Coupon) { c.StartsAt = now.Add(time.Second) }, 10000, models.CouponUsage{}, ErrNotActive},
+		{"starts now", func(c *models.Coupon) { c.StartsAt = now }, 10000, models.CouponUsage{}, nil},
+		{"ended", func(c *models.Coupon) { c.EndsAt = at(-time.Second) }, 10000, models.CouponUsage{}, ErrNotActive},
+		{"ends now", func(c *models.Coupon) { c.EndsAt = at(0) }, 10000, models.CouponUsage{}, ErrNotActive},
+		{"ends later", func(c *models.Coupon) { c.EndsAt = at(time.Second) }, 10000, models.CouponUsage{}, nil},
+		{"disabled", func(c *models.Coupon) { c.DisabledAt = at(-time.Hour) }, 10000, models.CouponUsage{}, ErrNotActive},
+		{"for this course", func(c *models.Coupon) { c.CourseID = &thisCourse }, 10000, models.CouponUsage{}, nil},
+		{"for another course", func(c *models.Coupon) { c.CourseID = &otherCourse }, 10000, models.CouponUsage{}, ErrNotApplicable},
+		{"for another category", func(c *models.Coupon) { c.Category = "design" }, 10000, models.CouponUsage{}, ErrNotApplicable},
+		{"in another currency", func(c *models.Coupon) { c.Currency = "USD" }, 10000, models.CouponUsage{}, ErrCurrency},
+		{"at the minimum order value", func(c *models.Coupon) { c.MinOrderMinor = 10000 }, 10000, models.CouponUsage{}, nil},
+		{"below the minimum order value", func(c *models.Coupon) { c.MinOrderMinor = 10001 }, 10000, models.CouponUsage{}, ErrBelowMinimum},
+		{"last redemption left", func(c *models.Coupon) { c.MaxRedemptions = limit(5) }, 10000, models.CouponUsage{Total: 4}, nil},
+		{"redemptions used up", func(c *models.Coupon) { c.MaxRedemptions = limit(5) }, 10000, models.CouponUsage{Total: 5}, models.ErrCouponLimitReached},
+		{"buyer's last use left", func(c *models.Coupon) { c.PerUserLimit = limit(2) }, 10000, models.CouponUsage{Total: 9, ByUser: 1}, nil},
+		{"buyer used it up", func(c *models.Coupon) { c.PerUserLimit = limit(1) }, 10000, models.CouponUsage{Total: 1, ByUser: 1}, ErrUserLimitReached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fixed(1, 500)
+			c.Category = "finance"
+			c.StartsAt = now.Add(-time.Hour)
+			tt.coupon(&c)
+
+			if err := Check(c, course(tt.price), tt.usage, now); !errors.Is(err, tt.want) {
+				t.Errorf("Check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
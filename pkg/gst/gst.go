@@ -0,0 +1,210 @@
+// Package gst works out the Goods and Services Tax included in course sales
+// and checks the identifiers tax invoices carry
+package gst
+
+import (
+	"fintech/pkg/ledger"
+	"fintech/store/models"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Taxes, also the last segment of their ledger accounts
+const (
+	CGST = "cgst"
+	SGST = "sgst"
+	IGST = "igst"
+)
+
+// Abroad is the place of supply of services to buyers outside India, and
+// the state code their billing profiles carry
+const Abroad = "96"
+
+// States maps GST state codes to the states and union territories they
+// stand for
+var States = map[string]string{
+	"01": "Jammu and Kashmir", "02": "Himachal Pradesh", "03": "Punjab", "04": "Chandigarh",
+	"05": "Uttarakhand", "06": "Haryana", "07": "Delhi", "08": "Rajasthan", "09": "Uttar Pradesh",
+	"10": "Bihar", "11": "Sikkim", "12": "Arunachal Pradesh", "13": "Nagaland", "14": "Manipur",
+	"15": "Mizoram", "16": "Tripura", "17": "Meghalaya", "18": "Assam", "19": "West Bengal",
+	"20": "Jharkhand", "21": "Odisha", "22": "Chhattisgarh", "23": "Madhya Pradesh", "24": "Gujarat",
+	"26": "Dadra and Nagar Haveli and Daman and Diu", "27": "Maharashtra", "29": "Karnataka",
+	"30": "Goa", "31": "Lakshadweep", "32": "Kerala", "33": "Tamil Nadu", "34": "Puducherry",
+	"35": "Andaman and Nicobar Islands", "36": "Telangana", "37": "Andhra Pradesh", "38": "Ladakh",
+	"97": "Other Territory",
+}
+
+var (
+	gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+	sacPattern   = regexp.MustCompile(`^99[0-9]{4}$`)
+)
+
+// gstinAlphabet gives each GSTIN character its value for the check digit
+const gstinAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Config describes the platform as a GST supplier
+type Config struct {
+	SupplierName    string
+	SupplierAddress string
+	// SupplierGSTIN is empty when the platform isn't registered, in which
+	// case it charges no GST
+	SupplierGSTIN string
+	// SAC classifies the courses sold, 999293 being commercial training and
+	// coaching
+	SAC string
+	// Rate is included in course prices
+	Rate ledger.Rate
+}
+
+// ConfigFromEnv reads GST_SUPPLIER_NAME, GST_SUPPLIER_ADDRESS,
+// GST_SUPPLIER_GSTIN, GST_SAC (999293) and GST_RATE_PERCENT (18)
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		SupplierName:    os.Getenv("GST_SUPPLIER_NAME"),
+		SupplierAddress: os.Getenv("GST_SUPPLIER_ADDRESS"),
+		SupplierGSTIN:   strings.ToUpper(os.Getenv("GST_SUPPLIER_GSTIN")),
+		SAC:             "999293",
+		Rate:            ledger.Percent(18),
+	}
+	if v := os.Getenv("GST_SAC"); v != "" {
+		config.SAC = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("GST_RATE_PERCENT"), 64); err == nil && v >= 0 && v <= 100 {
+		config.Rate = ledger.Percent(v)
+	}
+
+	if config.SupplierGSTIN != "" && !ValidGSTIN(config.SupplierGSTIN) {
+		return config, fmt.Errorf("GST_SUPPLIER_GSTIN %q is not a valid GSTIN", config.SupplierGSTIN)
+	}
+	if !sacPattern.MatchString(config.SAC) {
+		return config, fmt.Errorf("GST_SAC %q is not a services accounting code", config.SAC)
+	}
+	return config, nil
+}
+
+// Registered reports whether the platform charges GST
+func (c Config) Registered() bool {
+	return c.SupplierGSTIN != ""
+}
+
+// ValidGSTIN checks a GSTIN's format, state and check digit
+func ValidGSTIN(gstin string) bool {
+	if !gstinPattern.MatchString(gstin) {
+		return false
+	}
+	if _, ok := States[gstin[:2]]; !ok {
+		return false
+	}
+
+	sum := 0
+	for i, c := range gstin[:14] {
+		product := strings.IndexRune(gstinAlphabet, c) * (i%2 + 1)
+		sum += product/len(gstinAlphabet) + product%len(gstinAlphabet)
+	}
+	check := (len(gstinAlphabet) - sum%len(gstinAlphabet)) % len(gstinAlphabet)
+	return gstin[14] == gstinAlphabet[check]
+}
+
+// StateOf returns the state a GSTIN is registered in
+func StateOf(gstin string) string {
+	if len(gstin) < 2 {
+		return ""
+	}
+	return gstin[:2]
+}
+
+// NewInvoice works out the invoice for an order paid at the given time, to
+// be numbered when it's stored. buyer is the buyer's billing profile, with
+// their account name as LegalName if they didn't give one.
+//
+// Supplies are taxed where the buyer is: in the state of their GSTIN, else
+// of their billing address, else, when neither is known, the platform's.
+// Buyers whose billing address is outside India are exports, which GST
+// doesn't apply to, whatever currency they paid in.
+func NewInvoice(config Config, order models.Order, buyer models.BillingProfile, at time.Time) models.Invoice {
+	invoice := models.Invoice{
+		FinancialYear:  models.FinancialYear(at),
+		OrderID:        order.ID,
+		UserID:         order.UserID,
+		TotalMinor:     order.AmountMinor,
+		Currency:       order.Currency,
+		SAC:            config.SAC,
+		SupplierGSTIN:  config.SupplierGSTIN,
+		BuyerName:      buyer.LegalName,
+		BuyerGSTIN:     buyer.GSTIN,
+		BuyerAddress:   buyer.Address,
+		BuyerStateCode: buyer.StateCode,
+		IssuedAt:       at,
+		GSTAmounts:     models.GSTAmounts{TaxableMinor: order.AmountMinor},
+	}
+
+	switch {
+	case buyer.GSTIN != "":
+		invoice.PlaceOfSupply = StateOf(buyer.GSTIN)
+	case buyer.StateCode != "":
+		invoice.PlaceOfSupply = buyer.StateCode
+	default:
+		invoice.PlaceOfSupply = StateOf(config.SupplierGSTIN)
+	}
+
+	if config.Registered() && invoice.PlaceOfSupply != Abroad {
+		invoice.RateBps = int(config.Rate)
+		invoice.GSTAmounts = Split(order.AmountMinor, config.Rate, invoice.PlaceOfSupply == StateOf(config.SupplierGSTIN))
+	}
+	return invoice
+}
+
+// Split takes the tax included at rate out of amount. Tax within the
+// supplier's state is shared between CGST and SGST, any odd minor unit going
+// to SGST.
+func Split(amount int64, rate ledger.Rate, intraState bool) models.GSTAmounts {
+	// Rounded to the nearest minor unit
+	whole := int64(ledger.Percent(100))
+	taxable := (2*amount*whole + whole + int64(rate)) / (2 * (whole + int64(rate)))
+	tax := amount - taxable
+
+	amounts := models.GSTAmounts{TaxableMinor: taxable}
+	if intraState {
+		amounts.CGSTMinor = tax / 2
+		amounts.SGSTMinor = tax - amounts.CGSTMinor
+	} else {
+		amounts.IGSTMinor = tax
+	}
+	return amounts
+}
+
+// Legs credits the taxes to the accounts they're owed from
+func Legs(amounts models.GSTAmounts, currency string) []ledger.Leg {
+	var legs []ledger.Leg
+	for _, t := range []struct {
+		tax    string
+		amount int64
+	}{{CGST, amounts.CGSTMinor}, {SGST, amounts.SGSTMinor}, {IGST, amounts.IGSTMinor}} {
+		if t.amount != 0 {
+			legs = append(legs, ledger.Credit(ledger.TaxAccount(t.tax), ledger.New(t.amount, currency)))
+		}
+	}
+	return legs
+}
+
+// Reversed returns the taxes a refund's journal entry takes back out of the
+// tax accounts, with the rest of amount as the taxable value
+func Reversed(entry models.JournalEntry, amount int64) models.GSTAmounts {
+	amounts := models.GSTAmounts{}
+	for _, l := range entry.Lines {
+		switch l.Account {
+		case ledger.TaxAccount(CGST):
+			amounts.CGSTMinor += l.AmountMinor
+		case ledger.TaxAccount(SGST):
+			amounts.SGSTMinor += l.AmountMinor
+		case ledger.TaxAccount(IGST):
+			amounts.IGSTMinor += l.AmountMinor
+		}
+	}
+	amounts.TaxableMinor = amount - amounts.Tax()
+	return amounts
+}
@@ -0,0 +1,143 @@
+package gst
+
+import (
+	"fintech/pkg/ledger"
+	"fintech/store/models"
+	"testing"
+	"time"
+)
+
+func TestValidGSTIN(t *testing.T) {
+	tests := []struct {
+		gstin string
+		want  bool
+	}{
+		{"27AAPFU0939F1ZV", true},
+		{"29AAGCB7383J1Z4", true},
+		{"33AAACH7409R1Z8", true},
+		{"24AAACC1206D1ZM", true},
+		{"27AAPFU0939F1ZW", false}, // wrong check digit
+		{"29AAGCB7383J1Z5", false},
+		{"27aapfu0939f1zv", false}, // lowercase
+		{"25AAPFU0939F1ZV", false}, // no state 25
+		{"27AAPFU0939F1YV", false}, // 14th character isn't Z
+		{"27AAPFU0939F0ZV", false}, // entity number can't be 0
+		{"27AAPFU0939F1Z", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.gstin, func(t *testing.T) {
+			if got := ValidGSTIN(tt.gstin); got != tt.want {
+				t.Errorf("ValidGSTIN(%q) = %v, want %v", tt.gstin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name       string
+		amount     int64
+		rate       ledger.Rate
+		intraState bool
+		want       models.GSTAmounts
+	}{
+		{"within the state", 11800, ledger.Percent(18), true, models.GSTAmounts{TaxableMinor: 10000, CGSTMinor: 900, SGSTMinor: 900}},
+		{"between states", 11800, ledger.Percent(18), false, models.GSTAmounts{TaxableMinor: 10000, IGSTMinor: 1800}},
+		{"taxable value rounded to nearest", 100, ledger.Percent(18), false, models.GSTAmounts{TaxableMinor: 85, IGSTMinor: 15}},
+		{"odd unit to SGST", 100, ledger.Percent(18), true, models.GSTAmounts{TaxableMinor: 85, CGSTMinor: 7, SGSTMinor: 8}},
+		{"price of 499", 49900, ledger.Percent(18), true, models.GSTAmounts{TaxableMinor: 42288, CGSTMinor: 3806, SGSTMinor: 3806}},
+		{"too small to tax", 1, ledger.Percent(18), false, models.GSTAmounts{TaxableMinor: 1}},
+		{"zero rate", 11800, 0, true, models.GSTAmounts{TaxableMinor: 11800}},
+		{"nothing", 0, ledger.Percent(18), true, models.GSTAmounts{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.amount, tt.rate, tt.intraState)
+			if got != tt.want {
+				t.Errorf("Split(%d, %s, %v) = %+v, want %+v", tt.amount, tt.rate, tt.intraState, got, tt.want)
+			}
+			if got.TaxableMinor+got.Tax() != tt.amount {
+				t.Errorf("Split(%d) parts add up to %d", tt.amount, got.TaxableMinor+got.Tax())
+			}
+		})
+	}
+}
+
+func TestNewInvoice(t *testing.T) {
+	registered := Config{SupplierGSTIN: "27AAPFU0939F1ZV", SAC: "999293", Rate: ledger.Percent(18)}
+	at := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		config        Config
+		currency      string
+		buyer         models.BillingProfile
+		placeOfSupply string
+		want          models.GSTAmounts
+	}{
+		{
+			name: "business in the supplier's state", config: registered, currency: "INR",
+			buyer:         models.BillingProfile{GSTIN: "27AAPFU0939F1ZV", StateCode: "27"},
+			placeOfSupply: "27",
+			want:          models.GSTAmounts{TaxableMinor: 10000, CGSTMinor: 900, SGSTMinor: 900},
+		},
+		{
+			name: "business in another state", config: registered, currency: "INR",
+			buyer:         models.BillingProfile{GSTIN: "29AAGCB7383J1Z4", StateCode: "29"},
+			placeOfSupply: "29",
+			want:          models.GSTAmounts{TaxableMinor: 10000, IGSTMinor: 1800},
+		},
+		{
+			name: "consumer with an address in another state", config: registered, currency: "INR",
+			buyer:         models.BillingProfile{StateCode: "33"},
+			placeOfSupply: "33",
+			want:          models.GSTAmounts{TaxableMinor: 10000, IGSTMinor: 1800},
+		},
+		{
+			name: "consumer without an address", config: registered, currency: "INR",
+			placeOfSupply: "27",
+			want:          models.GSTAmounts{TaxableMinor: 10000, CGSTMinor: 900, SGSTMinor: 900},
+		},
+		{
+			name: "buyer in India paying in dollars", config: registered, currency: "USD",
+			buyer:         models.BillingProfile{StateCode: "29"},
+			placeOfSupply: "29",
+			want:          models.GSTAmounts{TaxableMinor: 10000, IGSTMinor: 1800},
+		},
+		{
+			name: "buyer abroad paying in rupees", config: registered, currency: "INR",
+			buyer:         models.BillingProfile{StateCode: Abroad},
+			placeOfSupply: Abroad,
+			want:          models.GSTAmounts{TaxableMinor: 11800},
+		},
+		{
+			name: "unregistered supplier", config: Config{SAC: "999293", Rate: ledger.Percent(18)}, currency: "INR",
+			buyer:         models.BillingProfile{StateCode: "29"},
+			placeOfSupply: "29",
+			want:          models.GSTAmounts{TaxableMinor: 11800},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{ID: "order", UserID: 1, AmountMinor: 11800, Currency: tt.currency}
+			invoice := NewInvoice(tt.config, order, tt.buyer, at)
+
+			if invoice.PlaceOfSupply != tt.placeOfSupply {
+				t.Errorf("place of supply = %q, want %q", invoice.PlaceOfSupply, tt.placeOfSupply)
+			}
+			if invoice.GSTAmounts != tt.want {
+				t.Errorf("amounts = %+v, want %+v", invoice.GSTAmounts, tt.want)
+			}
+			if taxed := tt.want.Tax() != 0; taxed != (invoice.RateBps != 0) {
+				t.Errorf("rate = %d on an invoice taxed %v", invoice.RateBps, taxed)
+			}
+			if invoice.TotalMinor != order.AmountMinor || invoice.Currency != order.Currency {
+				t.Errorf("total = %d %s, want %d %s", invoice.TotalMinor, invoice.Currency, order.AmountMinor, order.Currency)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package invoices lays out tax invoices and credit notes as PDF
+package invoices
+
+import (
+	"fintech/pkg/gst"
+	"fintech/pkg/pdf"
+	"fintech/store/models"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ContentType is the type of the documents written
+const ContentType = "application/pdf"
+
+// Page layout in points
+const (
+	margin   = 50.0
+	right    = pdf.PageWidth - margin
+	fontSize = 10.0
+	leading  = 14.0
+)
+
+// Invoice writes the invoice for item, the course sold. The supplier's name
+// and address are the platform's current ones, its GSTIN the one the
+// invoice was issued under.
+func Invoice(w io.Writer, supplier gst.Config, invoice models.Invoice, item string) error {
+	title := "INVOICE"
+	if invoice.SupplierGSTIN != "" {
+		title = "TAX INVOICE"
+	}
+
+	doc := pdf.New(title + " " + invoice.Number)
+	l := &layout{page: doc.AddPage(), y: margin}
+	l.header(title, supplier, invoice.SupplierGSTIN, [][2]string{
+		{"Invoice no.", invoice.Number},
+		{"Date", invoice.IssuedAt.In(models.IST).Format("02 Jan 2006")},
+		{"Place of supply", placeOfSupply(invoice.PlaceOfSupply)},
+		{"Order", invoice.OrderID},
+	})
+	l.party("Billed to", invoice.BuyerName, invoice.BuyerAddress, invoice.BuyerGSTIN, invoice.BuyerStateCode)
+	l.lines(item, invoice.SAC, invoice.RateBps, invoice.TotalMinor, invoice.Currency, invoice.GSTAmounts)
+	l.footer(invoice.Currency, invoice.SupplierGSTIN != "" && invoice.BuyerGSTIN != "")
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// CreditNote writes the credit note for a refund of item. invoice is the one
+// the note amends, nil for orders paid before invoicing, which are billed to
+// buyer.
+func CreditNote(w io.Writer, supplier gst.Config, note models.CreditNote, invoice *models.Invoice, buyer, item string) error {
+	details := [][2]string{
+		{"Credit note no.", note.Number},
+		{"Date", note.IssuedAt.In(models.IST).Format("02 Jan 2006")},
+	}
+	gstin, sac, rate := "", "", 0
+	if invoice != nil {
+		details = append(details,
+			[2]string{"Original invoice", invoice.Number},
+			[2]string{"Invoice date", invoice.IssuedAt.In(models.IST).Format("02 Jan 2006")},
+			[2]string{"Place of supply", placeOfSupply(invoice.PlaceOfSupply)})
+		gstin, sac, rate = invoice.SupplierGSTIN, invoice.SAC, invoice.RateBps
+	}
+	details = append(details, [2]string{"Order", note.OrderID}, [2]string{"Refund", note.RefundID})
+
+	doc := pdf.New("CREDIT NOTE " + note.Number)
+	l := &layout{page: doc.AddPage(), y: margin}
+	l.header("CREDIT NOTE", supplier, gstin, details)
+	if invoice != nil {
+		l.party("Issued to", invoice.BuyerName, invoice.BuyerAddress, invoice.BuyerGSTIN, invoice.BuyerStateCode)
+	} else {
+		l.party("Issued to", buyer, "", "", "")
+	}
+	l.lines("Refund of "+item, sac, rate, note.AmountMinor, note.Currency, note.GSTAmounts)
+	l.footer(note.Currency, false)
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// layout prints down a page, y being where the next line goes
+type layout struct {
+	page *pdf.Page
+	y    float64
+}
+
+func (l *layout) text(x float64, font pdf.Font, s string) {
+	l.page.Text(x, l.y, font, fontSize, s)
+}
+
+func (l *layout) rule() {
+	l.page.Line(margin, l.y-fontSize, right, l.y-fontSize)
+	l.y += leading
+}
+
+// header prints the title, the supplier on the left and the document's
+// details on the right
+func (l *layout) header(title string, supplier gst.Config, gstin string, details [][2]string) {
+	l.page.Text(margin, l.y, pdf.Bold, 18, title)
+	l.y += 2 * leading
+
+	top := l.y
+	name := supplier.SupplierName
+	if name == "" {
+		name = "fintech"
+	}
+	l.text(margin, pdf.Bold, name)
+	l.y += leading
+	for _, line := range pdf.Wrap(pdf.Regular, fontSize, 250, supplier.SupplierAddress) {
+		if line != "" {
+			l.text(margin, pdf.Regular, line)
+			l.y += leading
+		}
+	}
+	if gstin != "" {
+		l.text(margin, pdf.Regular, "GSTIN: "+gstin)
+		l.y += leading
+	}
+	left := l.y
+
+	l.y = top
+	for _, d := range details {
+		l.page.Text(330, l.y, pdf.Bold, fontSize, d[0])
+		l.page.TextRight(right, l.y, pdf.Regular, fontSize, d[1])
+		l.y += leading
+	}
+
+	l.y = max(l.y, left) + leading
+}
+
+// party prints who the document is addressed to
+func (l *layout) party(label, name, address, gstin, state string) {
+	l.text(margin, pdf.Bold, label)
+	l.y += leading
+	l.text(margin, pdf.Regular, name)
+	l.y += leading
+	for _, line := range pdf.Wrap(pdf.Regular, fontSize, 300, address) {
+		if line != "" {
+			l.text(margin, pdf.Regular, line)
+			l.y += leading
+		}
+	}
+	if gstin != "" {
+		l.text(margin, pdf.Regular, "GSTIN: "+gstin)
+		l.y += leading
+	}
+	if state != "" {
+		l.text(margin, pdf.Regular, "State: "+placeOfSupply(state))
+		l.y += leading
+	}
+	l.y += leading
+}
+
+// lines prints the item with its taxable value, then the taxes and total
+func (l *layout) lines(item, sac string, rateBps int, total int64, currency string, amounts models.GSTAmounts) {
+	const (
+		sacX     = 330.0
+		amountX  = right
+		itemWide = sacX - margin - 10
+	)
+
+	l.text(margin, pdf.Bold, "Description")
+	l.page.Text(sacX, l.y, pdf.Bold, fontSize, "SAC")
+	l.page.TextRight(amountX, l.y, pdf.Bold, fontSize, "Taxable value")
+	l.y += leading
+	l.rule()
+
+	for i, line := range pdf.Wrap(pdf.Regular, fontSize, itemWide, item) {
+		l.text(margin, pdf.Regular, line)
+		if i == 0 {
+			l.page.Text(sacX, l.y, pdf.Regular, fontSize, sac)
+			l.page.TextRight(amountX, l.y, pdf.Regular, fontSize, money(amounts.TaxableMinor, currency))
+		}
+		l.y += leading
+	}
+	l.rule()
+
+	row := func(font pdf.Font, label string, amount int64) {
+		l.page.Text(sacX, l.y, font, fontSize, label)
+		l.page.TextRight(amountX, l.y, font, fontSize, money(amount, currency))
+		l.y += leading
+	}
+	row(pdf.Regular, "Taxable value", amounts.TaxableMinor)
+	if amounts.CGSTMinor != 0 || amounts.SGSTMinor != 0 {
+		row(pdf.Regular, "CGST @ "+percent(rateBps/2), amounts.CGSTMinor)
+		row(pdf.Regular, "SGST @ "+percent(rateBps-rateBps/2), amounts.SGSTMinor)
+	}
+	if amounts.IGSTMinor != 0 {
+		row(pdf.Regular, "IGST @ "+percent(rateBps), amounts.IGSTMinor)
+	}
+	l.rule()
+	row(pdf.Bold, "Total", total)
+	l.y += leading
+}
+
+// footer notes the currency and whether tax is payable on reverse charge
+func (l *layout) footer(currency string, business bool) {
+	notes := []string{"Amounts are in " + currency + ".", "Tax payable on reverse charge: No."}
+	if business {
+		notes = append(notes, "The buyer may claim input tax credit for the GST charged.")
+	}
+	notes = append(notes, "This is a computer generated document and needs no signature.")
+	for _, n := range notes {
+		l.text(margin, pdf.Regular, n)
+		l.y += leading
+	}
+}
+
+// placeOfSupply names a GST state code, e.g. "27 - Maharashtra"
+func placeOfSupply(code string) string {
+	if code == gst.Abroad {
+		return code + " - Outside India"
+	}
+	if state, ok := gst.States[code]; ok {
+		return code + " - " + state
+	}
+	return code
+}
+
+// money prints an amount in a currency with two decimal places, which every
+// supported currency has
+func money(amount int64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s %s%d.%02d", currency, sign, amount/100, amount%100)
+}
+
+// percent prints a rate in basis points, e.g. "9%"
+func percent(bps int) string {
+	return strconv.FormatFloat(float64(bps)/100, 'f', -1, 64) + "%"
+}
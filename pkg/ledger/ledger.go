@@ -0,0 +1,211 @@
+// Package ledger records every movement of money as balanced double-entry
+// journal entries
+package ledger
+
+import (
+	"errors"
+	"fintech/store/models"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Account types. The type is the first segment of an account code, so
+// "liabilities:instructors:42" is a liability.
+const (
+	Assets      = "assets"
+	Liabilities = "liabilities"
+	Equity      = "equity"
+	Revenue     = "revenue"
+	Expenses    = "expenses"
+)
+
+// Accounts that aren't tied to a gateway or person
+const (
+	// PlatformFees is the platform's cut of sales
+	PlatformFees = "revenue:platform_fees"
+	// Discounts is what coupons took off list prices. It's set against the
+	// platform's fees, though instructors bear their share of it too.
+	Discounts = "expenses:discounts"
+	// PayoutsInTransit holds instructor payouts from when they're calculated
+	// until the bank transfers go out
+	PayoutsInTransit = "liabilities:payouts_in_transit"
+	// Bank is the account payouts are transferred from
+	Bank = "assets:bank"
+)
+
+// InstructorPrefix starts the account code of every instructor
+const InstructorPrefix = "liabilities:instructors:"
+
+// TaxPrefix starts the account code of every tax collected on sales
+const TaxPrefix = "liabilities:tax:"
+
+// GatewayAccount holds money collected through a payment gateway until the
+// gateway settles it
+func GatewayAccount(gateway string) string {
+	return "assets:gateway:" + gateway
+}
+
+// InstructorAccount is what the platform owes an instructor
+func InstructorAccount(userID int) string {
+	return InstructorPrefix + strconv.Itoa(userID)
+}
+
+// TaxAccount is what the platform owes the government of a tax, such as
+// "cgst"
+func TaxAccount(tax string) string {
+	return TaxPrefix + tax
+}
+
+// InstructorOf returns the instructor an account belongs to
+func InstructorOf(account string) (int, bool) {
+	id, ok := strings.CutPrefix(account, InstructorPrefix)
+	if !ok {
+		return 0, false
+	}
+	userID, err := strconv.Atoi(id)
+	return userID, err == nil
+}
+
+// TypeOf returns the type of an account code
+func TypeOf(account string) string {
+	t, _, _ := strings.Cut(account, ":")
+	return t
+}
+
+// DebitNormal reports whether the account's balance grows with debits, as
+// for assets and expenses
+func DebitNormal(account string) bool {
+	t := TypeOf(account)
+	return t == Assets || t == Expenses
+}
+
+// Natural returns a balance, which lines store as debits minus credits, with
+// the sign that's positive in the account's usual direction
+func Natural(account string, amount int64) int64 {
+	if DebitNormal(account) {
+		return amount
+	}
+	return -amount
+}
+
+var (
+	ErrUnbalanced   = errors.New("journal entry doesn't balance")
+	ErrInvalidEntry = errors.New("invalid journal entry")
+)
+
+// Leg moves money into or out of one account. Debits are positive and
+// credits negative.
+type Leg struct {
+	Account string
+	Amount  Money
+}
+
+func Debit(account string, m Money) Leg {
+	return Leg{Account: account, Amount: m}
+}
+
+func Credit(account string, m Money) Leg {
+	return Leg{Account: account, Amount: m.Neg()}
+}
+
+// Entry is a journal entry being built
+type Entry struct {
+	Kind        string
+	Reference   string
+	Memo        string
+	EffectiveAt time.Time
+	Legs        []Leg
+}
+
+// Add appends legs, skipping zero amounts and merging legs on the same
+// account and currency
+func (e *Entry) Add(legs ...Leg) {
+	for _, l := range legs {
+		if l.Amount.IsZero() {
+			continue
+		}
+		merged := false
+		for i := range e.Legs {
+			if e.Legs[i].Account == l.Account && e.Legs[i].Amount.Currency == l.Amount.Currency {
+				e.Legs[i].Amount.Amount += l.Amount.Amount
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			e.Legs = append(e.Legs, l)
+		}
+	}
+}
+
+// Validate checks the entry can be posted: every leg is on a known kind of
+// account, and debits equal credits in each currency
+func (e Entry) Validate() error {
+	if e.Kind == "" || e.Reference == "" || e.EffectiveAt.IsZero() {
+		return fmt.Errorf("%w: kind, reference and effective time are required", ErrInvalidEntry)
+	}
+
+	legs := 0
+	sums := map[string]int64{}
+	for _, l := range e.Legs {
+		switch TypeOf(l.Account) {
+		case Assets, Liabilities, Equity, Revenue, Expenses:
+		default:
+			return fmt.Errorf("%w: unknown type of account %s", ErrInvalidEntry, l.Account)
+		}
+		if len(l.Amount.Currency) != 3 {
+			return fmt.Errorf("%w: leg on %s has no currency", ErrInvalidEntry, l.Account)
+		}
+		if l.Amount.IsZero() {
+			continue
+		}
+		legs++
+		sums[l.Amount.Currency] += l.Amount.Amount
+	}
+
+	if legs < 2 {
+		return fmt.Errorf("%w: at least two legs are required", ErrInvalidEntry)
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("%w: %s is off by %d", ErrUnbalanced, currency, sum)
+		}
+	}
+	return nil
+}
+
+// Record validates the entry and converts it for the store
+func (e Entry) Record() (models.JournalEntry, error) {
+	if err := e.Validate(); err != nil {
+		return models.JournalEntry{}, err
+	}
+
+	record := models.JournalEntry{
+		Kind:        e.Kind,
+		Reference:   e.Reference,
+		Memo:        e.Memo,
+		EffectiveAt: e.EffectiveAt,
+	}
+	for _, l := range e.Legs {
+		if l.Amount.IsZero() {
+			continue
+		}
+		record.Lines = append(record.Lines, models.JournalLine{
+			Account:     l.Account,
+			AmountMinor: l.Amount.Amount,
+			Currency:    l.Amount.Currency,
+		})
+	}
+	// Debits first, then by account, so entries read the same way
+	sort.SliceStable(record.Lines, func(i, j int) bool {
+		a, b := record.Lines[i], record.Lines[j]
+		if (a.AmountMinor > 0) != (b.AmountMinor > 0) {
+			return a.AmountMinor > 0
+		}
+		return a.Account < b.Account
+	})
+	return record, nil
+}
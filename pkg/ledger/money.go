@@ -0,0 +1,84 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// ErrCurrencyMismatch is returned when amounts in different currencies are
+// combined
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// Money is an amount in the minor unit of its currency, such as paise for
+// INR. Amounts are never floating point, so they add up exactly.
+type Money struct {
+	Amount   int64  `json:"amount_minor"`
+	Currency string `json:"currency"`
+}
+
+// New returns amount minor units of currency
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return m, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(o.Neg())
+}
+
+// String prints the amount with two decimal places, which every supported
+// currency has
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s %s%d.%02d", m.Currency, sign, amount/100, amount%100)
+}
+
+// Rate is a share in basis points, hundredths of a percent
+type Rate int64
+
+// Percent converts a percentage such as 12.5 to a rate
+func Percent(p float64) Rate {
+	return Rate(math.Round(p * 100))
+}
+
+// Of returns the rate's share of m, rounded towards zero so shares never add
+// up to more than the whole
+func (r Rate) Of(m Money) Money {
+	return Money{Amount: m.Amount * int64(r) / 10000, Currency: m.Currency}
+}
+
+func (r Rate) String() string {
+	return strconv.FormatFloat(float64(r)/100, 'f', -1, 64) + "%"
+}
+
+// PlatformFeeFromEnv reads PLATFORM_FEE_PERCENT, the platform's cut of sales
+// of courses without a revenue share agreement, 30 by default. The author
+// gets the rest.
+func PlatformFeeFromEnv() Rate {
+	if v, err := strconv.ParseFloat(os.Getenv("PLATFORM_FEE_PERCENT"), 64); err == nil && v >= 0 && v <= 100 {
+		return Percent(v)
+	}
+	return Percent(30)
+}
@@ -0,0 +1,146 @@
+package ledger
+
+import (
+	"fintech/store/models"
+	"fmt"
+	"time"
+)
+
+// Share is an instructor's cut of a sale
+type Share struct {
+	UserID int
+	Rate   Rate
+}
+
+// Payment records a captured payment. The gateway holds the money and the
+// taxes collected with it are owed to the government. Each instructor is
+// owed their share of the rest, and what's left is the platform's fee.
+//
+// Shares are taken from what was paid, so instructors bear a coupon discount
+// in proportion to their share. The sale is still recorded at its list
+// price: the discount is debited to Discounts and added back to the
+// platform's fee, so the platform keeps its fee less the discount.
+func Payment(order models.Order, shares []Share, taxes []Leg, at time.Time) (models.JournalEntry, error) {
+	paid := New(order.AmountMinor, order.Currency)
+	discount := New(order.DiscountMinor, order.Currency)
+	if discount.Amount < 0 {
+		return models.JournalEntry{}, fmt.Errorf("%w: discount of order %s is negative", ErrInvalidEntry, order.ID)
+	}
+
+	e := Entry{
+		Kind:        models.JournalPayment,
+		Reference:   order.ID,
+		Memo:        fmt.Sprintf("Payment for order %s", order.ID),
+		EffectiveAt: at,
+	}
+	e.Add(Debit(GatewayAccount(order.Gateway), paid))
+	e.Add(Debit(Discounts, discount))
+
+	net := paid
+	for _, tax := range taxes {
+		if tax.Amount.Currency != paid.Currency || tax.Amount.Amount > 0 {
+			return models.JournalEntry{}, fmt.Errorf("%w: taxes of order %s must be credits in %s", ErrInvalidEntry, order.ID, paid.Currency)
+		}
+		e.Add(tax)
+		net.Amount += tax.Amount.Amount
+	}
+	if net.Amount < 0 {
+		return models.JournalEntry{}, fmt.Errorf("%w: taxes of order %s exceed the sale", ErrInvalidEntry, order.ID)
+	}
+
+	var total Rate
+	platform := net
+	for _, s := range shares {
+		total += s.Rate
+		if s.Rate < 0 || total > Percent(100) {
+			return models.JournalEntry{}, fmt.Errorf("%w: shares of order %s exceed the sale", ErrInvalidEntry, order.ID)
+		}
+		share := s.Rate.Of(net)
+		e.Add(Credit(InstructorAccount(s.UserID), share))
+		platform.Amount -= share.Amount
+	}
+	platform.Amount += discount.Amount
+	e.Add(Credit(PlatformFees, platform))
+
+	return e.Record()
+}
+
+// Refund reverses the part of the order's payment entry that the refund pays
+// back. Every leg is reversed in proportion to what has been refunded in
+// total, so a series of partial refunds ends up reversing the payment exactly
+// once the whole order is refunded. Rounding in between comes out of the
+// platform's fee.
+func Refund(payment models.JournalEntry, order models.Order, refund models.Refund, at time.Time) (models.JournalEntry, error) {
+	before := order.RefundedMinor
+	after := before + refund.AmountMinor
+	if order.AmountMinor <= 0 || refund.AmountMinor <= 0 || after > order.AmountMinor {
+		return models.JournalEntry{}, fmt.Errorf("%w: refund of %d after %d refunded from %d", ErrInvalidEntry,
+			refund.AmountMinor, before, order.AmountMinor)
+	}
+
+	e := Entry{
+		Kind:        models.JournalRefund,
+		Reference:   refund.ID,
+		Memo:        fmt.Sprintf("Refund %s of order %s", refund.ID, order.ID),
+		EffectiveAt: at,
+	}
+	var sum int64
+	for _, l := range payment.Lines {
+		if l.Currency != refund.Currency {
+			return models.JournalEntry{}, fmt.Errorf("%w: payment in %s, refund in %s", ErrCurrencyMismatch, l.Currency, refund.Currency)
+		}
+		amount := l.AmountMinor*before/order.AmountMinor - l.AmountMinor*after/order.AmountMinor
+		e.Add(Leg{Account: l.Account, Amount: New(amount, l.Currency)})
+		sum += amount
+	}
+	e.Add(Leg{Account: PlatformFees, Amount: New(-sum, refund.Currency)})
+
+	return e.Record()
+}
+
+// Payouts moves the batch's payouts out of the instructors' accounts until
+// the transfers go out
+func Payouts(batch models.PayoutBatch, payouts []models.Payout, at time.Time) (models.JournalEntry, error) {
+	e := Entry{
+		Kind:        models.JournalPayout,
+		Reference:   batch.ID,
+		Memo:        fmt.Sprintf("Payout batch %s", batch.ID),
+		EffectiveAt: at,
+	}
+	for _, p := range payouts {
+		amount := New(p.AmountMinor, p.Currency)
+		e.Add(Debit(InstructorAccount(p.UserID), amount), Credit(PayoutsInTransit, amount))
+	}
+	return e.Record()
+}
+
+// PayoutSettlement records that the batch's transfers left the bank
+func PayoutSettlement(batch models.PayoutBatch, payouts []models.Payout, at time.Time) (models.JournalEntry, error) {
+	e := Entry{
+		Kind:        models.JournalPayoutSettlement,
+		Reference:   batch.ID,
+		Memo:        fmt.Sprintf("Transfers of payout batch %s", batch.ID),
+		EffectiveAt: at,
+	}
+	for _, p := range payouts {
+		amount := New(p.AmountMinor, p.Currency)
+		e.Add(Debit(PayoutsInTransit, amount), Credit(Bank, amount))
+	}
+	return e.Record()
+}
+
+// PayoutCancellation gives a cancelled batch's payouts back to the
+// instructors
+func PayoutCancellation(batch models.PayoutBatch, payouts []models.Payout, at time.Time) (models.JournalEntry, error) {
+	e := Entry{
+		Kind:        models.JournalPayoutCancellation,
+		Reference:   batch.ID,
+		Memo:        fmt.Sprintf("Cancellation of payout batch %s", batch.ID),
+		EffectiveAt: at,
+	}
+	for _, p := range payouts {
+		amount := New(p.AmountMinor, p.Currency)
+		e.Add(Debit(PayoutsInTransit, amount), Credit(InstructorAccount(p.UserID), amount))
+	}
+	return e.Record()
+}
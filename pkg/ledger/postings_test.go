@@ -0,0 +1,239 @@
+package ledger
+
+import (
+	"errors"
+	"fintech/store/models"
+	"maps"
+	"testing"
+	"time"
+)
+
+var at = time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+// balances sums the entries' lines by account
+func balances(entries ...models.JournalEntry) map[string]int64 {
+	sums := map[string]int64{}
+	for _, e := range entries {
+		for _, l := range e.Lines {
+			sums[l.Account] += l.AmountMinor
+			if sums[l.Account] == 0 {
+				delete(sums, l.Account)
+			}
+		}
+	}
+	return sums
+}
+
+func order(amount, discount int64) models.Order {
+	return models.Order{ID: "order", AmountMinor: amount, DiscountMinor: discount, Currency: "INR", Gateway: "fake"}
+}
+
+func TestPayment(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   models.Order
+		shares  []Share
+		taxes   []Leg
+		want    map[string]int64
+		wantErr error
+	}{
+		{
+			name:   "split between author and platform",
+			order:  order(10000, 0),
+			shares: []Share{{UserID: 1, Rate: Percent(70)}},
+			want: map[string]int64{
+				"assets:gateway:fake": 10000,
+				InstructorAccount(1):  -7000,
+				PlatformFees:          -3000,
+			},
+		},
+		{
+			name:   "taxes come off before the split",
+			order:  order(11800, 0),
+			shares: []Share{{UserID: 1, Rate: Percent(70)}},
+			taxes:  []Leg{Credit(TaxAccount("cgst"), New(900, "INR")), Credit(TaxAccount("sgst"), New(900, "INR"))},
+			want: map[string]int64{
+				"assets:gateway:fake": 11800,
+				TaxAccount("cgst"):    -900,
+				TaxAccount("sgst"):    -900,
+				InstructorAccount(1):  -7000,
+				PlatformFees:          -3000,
+			},
+		},
+		{
+			name:   "discount is shared and recorded at list price",
+			order:  order(8000, 2000),
+			shares: []Share{{UserID: 1, Rate: Percent(70)}},
+			want: map[string]int64{
+				"assets:gateway:fake": 8000,
+				Discounts:             2000,
+				InstructorAccount(1):  -5600,
+				PlatformFees:          -4400,
+			},
+		},
+		{
+			name:   "rounding goes to the platform",
+			order:  order(999, 0),
+			shares: []Share{{UserID: 1, Rate: Percent(33.33)}, {UserID: 2, Rate: Percent(33.33)}},
+			want: map[string]int64{
+				"assets:gateway:fake": 999,
+				InstructorAccount(1):  -332,
+				InstructorAccount(2):  -332,
+				PlatformFees:          -335,
+			},
+		},
+		{
+			name:   "whole sale to instructors",
+			order:  order(10000, 0),
+			shares: []Share{{UserID: 1, Rate: Percent(60)}, {UserID: 2, Rate: Percent(40)}},
+			want: map[string]int64{
+				"assets:gateway:fake": 10000,
+				InstructorAccount(1):  -6000,
+				InstructorAccount(2):  -4000,
+			},
+		},
+		{
+			name:    "shares over 100%",
+			order:   order(10000, 0),
+			shares:  []Share{{UserID: 1, Rate: Percent(60)}, {UserID: 2, Rate: Percent(50)}},
+			wantErr: ErrInvalidEntry,
+		},
+		{
+			name:    "negative share",
+			order:   order(10000, 0),
+			shares:  []Share{{UserID: 1, Rate: -1}},
+			wantErr: ErrInvalidEntry,
+		},
+		{
+			name:    "negative discount",
+			order:   order(10000, -1),
+			wantErr: ErrInvalidEntry,
+		},
+		{
+			name:    "taxes over the sale",
+			order:   order(100, 0),
+			taxes:   []Leg{Credit(TaxAccount("igst"), New(101, "INR"))},
+			wantErr: ErrInvalidEntry,
+		},
+		{
+			name:    "tax as a debit",
+			order:   order(100, 0),
+			taxes:   []Leg{Debit(TaxAccount("igst"), New(18, "INR"))},
+			wantErr: ErrInvalidEntry,
+		},
+		{
+			name:    "tax in another currency",
+			order:   order(100, 0),
+			taxes:   []Leg{Credit(TaxAccount("igst"), New(18, "USD"))},
+			wantErr: ErrInvalidEntry,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := Payment(tt.order, tt.shares, tt.taxes, at)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Payment() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := balances(entry); !maps.Equal(got, tt.want) {
+				t.Errorf("Payment() lines = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefundsReverseThePaymentExactly(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   models.Order
+		shares  []Share
+		refunds []int64
+	}{
+		{"in one go", order(10000, 0), []Share{{UserID: 1, Rate: Percent(70)}}, []int64{10000}},
+		{"in uneven parts", order(10000, 0), []Share{{UserID: 1, Rate: Percent(70)}}, []int64{3333, 3333, 3334}},
+		{"with a discount", order(8000, 2000), []Share{{UserID: 1, Rate: Percent(70)}}, []int64{1, 2999, 5000}},
+		{"with rounding in every part", order(999, 0),
+			[]Share{{UserID: 1, Rate: Percent(33.33)}, {UserID: 2, Rate: Percent(33.33)}}, []int64{333, 333, 333}},
+		{"a minor unit at a time", order(7, 0), []Share{{UserID: 1, Rate: Percent(50)}}, []int64{1, 1, 1, 1, 1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment, err := Payment(tt.order, tt.shares, nil, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries := []models.JournalEntry{payment}
+			o := tt.order
+			for _, amount := range tt.refunds {
+				refund, err := Refund(payment, o, models.Refund{ID: "refund", AmountMinor: amount, Currency: "INR"}, at)
+				if err != nil {
+					t.Fatalf("Refund(%d) after %d: %v", amount, o.RefundedMinor, err)
+				}
+				if got := balances(refund)["assets:gateway:fake"]; got != -amount {
+					t.Errorf("Refund(%d) took %d from the gateway", amount, -got)
+				}
+				entries = append(entries, refund)
+				o.RefundedMinor += amount
+			}
+
+			if left := balances(entries...); len(left) != 0 {
+				t.Errorf("full refund left %v", left)
+			}
+		})
+	}
+}
+
+func TestRefundPartIsProportional(t *testing.T) {
+	payment, err := Payment(order(8000, 2000), []Share{{UserID: 1, Rate: Percent(70)}}, nil, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refund, err := Refund(payment, order(8000, 2000), models.Refund{ID: "refund", AmountMinor: 2000, Currency: "INR"}, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{
+		"assets:gateway:fake": -2000,
+		Discounts:             -500,
+		InstructorAccount(1):  1400,
+		PlatformFees:          1100,
+	}
+	if got := balances(refund); !maps.Equal(got, want) {
+		t.Errorf("Refund() lines = %v, want %v", got, want)
+	}
+}
+
+func TestRefundRejects(t *testing.T) {
+	payment, err := Payment(order(10000, 0), []Share{{UserID: 1, Rate: Percent(70)}}, nil, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refunded := order(10000, 0)
+	refunded.RefundedMinor = 9000
+
+	tests := []struct {
+		name    string
+		order   models.Order
+		refund  models.Refund
+		wantErr error
+	}{
+		{"more than was paid", order(10000, 0), models.Refund{ID: "r", AmountMinor: 10001, Currency: "INR"}, ErrInvalidEntry},
+		{"more than is left", refunded, models.Refund{ID: "r", AmountMinor: 1001, Currency: "INR"}, ErrInvalidEntry},
+		{"nothing", order(10000, 0), models.Refund{ID: "r", Currency: "INR"}, ErrInvalidEntry},
+		{"another currency", order(10000, 0), models.Refund{ID: "r", AmountMinor: 100, Currency: "USD"}, ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Refund(payment, tt.order, tt.refund, at); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Refund() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package messaging
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// NewOTPSenderFromEnv builds the sender configured through environment variables.
+//
+// OTP_PROVIDERS is a comma separated, ordered list of providers to fall back
+// through: whatsapp, sms, email, file or memory. It defaults to "file", which
+// prints messages to stdout (or OTP_FILE_PATH) for local development.
+func NewOTPSenderFromEnv() (*FallbackSender, error) {
+	templates, err := NewTemplates(map[Channel]string{
+		ChannelWhatsApp: os.Getenv("OTP_TEMPLATE_WHATSAPP"),
+		ChannelSMS:      os.Getenv("OTP_TEMPLATE_SMS"),
+		ChannelEmail:    os.Getenv("OTP_TEMPLATE_EMAIL"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := os.Getenv("OTP_PROVIDERS")
+	if names == "" {
+		names = "file"
+	}
+
+	var providers []Provider
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "whatsapp":
+			// Status callbacks are signed with the app secret; without it
+			// anyone could post them
+			if os.Getenv("WHATSAPP_APP_SECRET") == "" {
+				return nil, fmt.Errorf("WHATSAPP_APP_SECRET is required for the whatsapp provider")
+			}
+			providers = append(providers, &WhatsAppSender{
+				BaseURL:       envOr("WHATSAPP_API_URL", "https://graph.facebook.com/v19.0"),
+				PhoneNumberID: os.Getenv("WHATSAPP_PHONE_NUMBER_ID"),
+				AccessToken:   os.Getenv("WHATSAPP_ACCESS_TOKEN"),
+				Template:      os.Getenv("WHATSAPP_OTP_TEMPLATE"),
+				Language:      envOr("WHATSAPP_OTP_TEMPLATE_LANGUAGE", "en"),
+				AppSecret:     os.Getenv("WHATSAPP_APP_SECRET"),
+				VerifyToken:   os.Getenv("WHATSAPP_VERIFY_TOKEN"),
+			})
+		case "sms":
+			providers = append(providers, &SMSSender{
+				BaseURL:           envOr("SMS_API_URL", "https://api.twilio.com"),
+				AccountSID:        os.Getenv("SMS_ACCOUNT_SID"),
+				AuthToken:         os.Getenv("SMS_AUTH_TOKEN"),
+				From:              os.Getenv("SMS_FROM"),
+				StatusCallbackURL: os.Getenv("SMS_STATUS_CALLBACK_URL"),
+			})
+		case "email":
+			providers = append(providers, &EmailSender{
+				Host:     os.Getenv("SMTP_HOST"),
+				Port:     envOr("SMTP_PORT", "587"),
+				Username: os.Getenv("SMTP_USERNAME"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+				From:     os.Getenv("SMTP_FROM"),
+				Subject:  os.Getenv("OTP_EMAIL_SUBJECT"),
+			})
+		case "file":
+			providers = append(providers, &FileSender{Path: os.Getenv("OTP_FILE_PATH")})
+		case "memory":
+			providers = append(providers, &MemorySender{})
+		default:
+			return nil, fmt.Errorf("unknown OTP provider %q", name)
+		}
+	}
+
+	return NewFallbackSender(templates, providers...), nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,59 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// EmailSender delivers OTPs over SMTP
+type EmailSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	Subject  string
+}
+
+func (e *EmailSender) Name() string     { return "smtp" }
+func (e *EmailSender) Channel() Channel { return ChannelEmail }
+
+// Send writes the message to the SMTP server and returns the generated Message-ID
+func (e *EmailSender) Send(ctx context.Context, msg OTPMessage, body string) (string, error) {
+	if msg.Recipient.Email == "" {
+		return "", ErrNoRecipient
+	}
+
+	messageID := fmt.Sprintf("<%s@%s>", uuid.NewString(), e.Host)
+	subject := e.Subject
+	if subject == "" {
+		subject = "Your verification code"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.Recipient.Email)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Message-ID: %s\r\n", messageID)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(body)
+	b.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+
+	err := smtp.SendMail(net.JoinHostPort(e.Host, e.Port), auth, e.From, []string{msg.Recipient.Email}, []byte(b.String()))
+	if err != nil {
+		return "", fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return messageID, nil
+}
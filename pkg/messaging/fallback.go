@@ -0,0 +1,97 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Provider delivers an already rendered message over a single channel
+type Provider interface {
+	Name() string
+	Channel() Channel
+	Send(ctx context.Context, msg OTPMessage, body string) (string, error)
+}
+
+// StatusCallbackParser is implemented by providers that report delivery
+// status asynchronously through webhooks
+type StatusCallbackParser interface {
+	ParseStatusCallback(r *http.Request) ([]StatusUpdate, error)
+}
+
+// SubscriptionVerifier is implemented by providers that confirm ownership of
+// the callback URL with a GET handshake before sending status callbacks
+type SubscriptionVerifier interface {
+	VerifySubscription(query url.Values) (string, bool)
+}
+
+// StatusSource exposes the callback parser for a named provider
+type StatusSource interface {
+	StatusParser(provider string) (StatusCallbackParser, bool)
+}
+
+// FallbackSender tries each provider in order until one accepts the message
+type FallbackSender struct {
+	Providers []Provider
+	Templates *Templates
+}
+
+// NewFallbackSender creates a sender that falls back through providers in order
+func NewFallbackSender(templates *Templates, providers ...Provider) *FallbackSender {
+	return &FallbackSender{Providers: providers, Templates: templates}
+}
+
+// SendOTP delivers msg over the first provider that succeeds, recording every attempt
+func (f *FallbackSender) SendOTP(ctx context.Context, msg OTPMessage) (Result, error) {
+	var result Result
+	var errs []string
+
+	for _, p := range f.Providers {
+		body, err := f.Templates.Render(p.Channel(), msg)
+		if err != nil {
+			return result, err
+		}
+
+		id, err := p.Send(ctx, msg, body)
+		if errors.Is(err, ErrNoRecipient) {
+			continue
+		}
+
+		attempt := Delivery{
+			Channel:           p.Channel(),
+			Provider:          p.Name(),
+			ProviderMessageID: id,
+			Status:            StatusSent,
+		}
+		if err != nil {
+			attempt.Status = StatusFailed
+			attempt.Error = err.Error()
+			errs = append(errs, fmt.Sprintf("%s: %v", p.Name(), err))
+		}
+		result.Attempts = append(result.Attempts, attempt)
+
+		if err == nil {
+			return result, nil
+		}
+	}
+
+	if len(errs) == 0 {
+		return result, ErrNoRecipient
+	}
+	return result, fmt.Errorf("all OTP providers failed: %s", strings.Join(errs, "; "))
+}
+
+// StatusParser returns the callback parser of the named provider
+func (f *FallbackSender) StatusParser(provider string) (StatusCallbackParser, bool) {
+	for _, p := range f.Providers {
+		if p.Name() != provider {
+			continue
+		}
+		parser, ok := p.(StatusCallbackParser)
+		return parser, ok
+	}
+	return nil, false
+}
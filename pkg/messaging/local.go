@@ -0,0 +1,131 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SentMessage is a message captured by one of the local senders
+type SentMessage struct {
+	ID          string    `json:"id"`
+	Channel     Channel   `json:"channel"`
+	PhoneNumber string    `json:"phone_number,omitempty"`
+	Email       string    `json:"email,omitempty"`
+	Code        string    `json:"code"`
+	Body        string    `json:"body"`
+	SentAt      time.Time `json:"sent_at"`
+}
+
+func newSentMessage(channel Channel, msg OTPMessage, body string) SentMessage {
+	return SentMessage{
+		ID:          uuid.NewString(),
+		Channel:     channel,
+		PhoneNumber: msg.Recipient.PhoneNumber,
+		Email:       msg.Recipient.Email,
+		Code:        msg.Code,
+		Body:        body,
+		SentAt:      time.Now(),
+	}
+}
+
+// FileSender appends every message as a JSON line to a file, or to stdout when
+// Path is empty. It is meant for local development.
+type FileSender struct {
+	Path        string
+	ChannelName Channel
+	mutex       sync.Mutex
+}
+
+func (f *FileSender) Name() string { return "file" }
+
+func (f *FileSender) Channel() Channel {
+	if f.ChannelName == "" {
+		return ChannelWhatsApp
+	}
+	return f.ChannelName
+}
+
+func (f *FileSender) Send(ctx context.Context, msg OTPMessage, body string) (string, error) {
+	sent := newSentMessage(f.Channel(), msg, body)
+	line, err := json.Marshal(sent)
+	if err != nil {
+		return "", err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.Path == "" {
+		fmt.Println(string(line))
+		return sent.ID, nil
+	}
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to open OTP log file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return "", fmt.Errorf("failed to write OTP log file: %v", err)
+	}
+
+	return sent.ID, nil
+}
+
+// MemorySender keeps every message in memory so tests can read the OTP back
+type MemorySender struct {
+	ChannelName Channel
+	// Fail makes every send return this error, to exercise fallback paths
+	Fail     error
+	mutex    sync.Mutex
+	messages []SentMessage
+}
+
+func (m *MemorySender) Name() string { return "memory" }
+
+func (m *MemorySender) Channel() Channel {
+	if m.ChannelName == "" {
+		return ChannelWhatsApp
+	}
+	return m.ChannelName
+}
+
+func (m *MemorySender) Send(ctx context.Context, msg OTPMessage, body string) (string, error) {
+	if m.Fail != nil {
+		return "", m.Fail
+	}
+
+	sent := newSentMessage(m.Channel(), msg, body)
+
+	m.mutex.Lock()
+	m.messages = append(m.messages, sent)
+	m.mutex.Unlock()
+
+	return sent.ID, nil
+}
+
+// Messages returns a copy of everything sent so far
+func (m *MemorySender) Messages() []SentMessage {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]SentMessage(nil), m.messages...)
+}
+
+// Last returns the most recent message sent to the given phone number or email
+func (m *MemorySender) Last(address string) (SentMessage, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].PhoneNumber == address || m.messages[i].Email == address {
+			return m.messages[i], true
+		}
+	}
+	return SentMessage{}, false
+}
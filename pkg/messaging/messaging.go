@@ -0,0 +1,149 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// Channel identifies the medium an OTP is delivered over
+type Channel string
+
+const (
+	ChannelWhatsApp Channel = "whatsapp"
+	ChannelSMS      Channel = "sms"
+	ChannelEmail    Channel = "email"
+)
+
+// DeliveryStatus tracks where a message is in the provider's pipeline
+type DeliveryStatus string
+
+const (
+	StatusQueued    DeliveryStatus = "queued"
+	StatusSent      DeliveryStatus = "sent"
+	StatusDelivered DeliveryStatus = "delivered"
+	StatusRead      DeliveryStatus = "read"
+	StatusFailed    DeliveryStatus = "failed"
+)
+
+// ErrNoRecipient is returned when a sender has no address it can deliver to
+var ErrNoRecipient = errors.New("recipient has no address for this channel")
+
+// Recipient holds every address we know for the person receiving the OTP
+type Recipient struct {
+	PhoneNumber string
+	Email       string
+}
+
+// OTPMessage is a single one-time password to be delivered
+type OTPMessage struct {
+	Recipient Recipient
+	Code      string
+	ExpiresAt time.Time
+}
+
+// Delivery is the outcome of one attempt to deliver an OTPMessage
+type Delivery struct {
+	Channel           Channel
+	Provider          string
+	ProviderMessageID string
+	Status            DeliveryStatus
+	Error             string
+}
+
+// Result describes every attempt made while sending an OTP, in order
+type Result struct {
+	Attempts []Delivery
+}
+
+// Delivered returns the successful attempt, if any
+func (r Result) Delivered() (Delivery, bool) {
+	for _, a := range r.Attempts {
+		if a.Status != StatusFailed {
+			return a, true
+		}
+	}
+	return Delivery{}, false
+}
+
+// OTPSender delivers one-time passwords to users
+type OTPSender interface {
+	SendOTP(ctx context.Context, msg OTPMessage) (Result, error)
+}
+
+// StatusUpdate is a provider callback reporting a change in delivery status
+type StatusUpdate struct {
+	ProviderMessageID string
+	Status            DeliveryStatus
+	Error             string
+}
+
+// templateData is what message templates are rendered with
+type templateData struct {
+	Code     string
+	Minutes  int
+	Phone    string
+	Email    string
+	ValidFor string
+}
+
+// DefaultTemplate is used for every channel without a template of its own
+const DefaultTemplate = "Your verification code is {{.Code}}. It expires in {{.ValidFor}}. Do not share it with anyone."
+
+// Templates renders the message body for each channel
+type Templates struct {
+	byChannel map[Channel]*template.Template
+	fallback  *template.Template
+}
+
+// NewTemplates parses a template per channel, falling back to DefaultTemplate
+func NewTemplates(byChannel map[Channel]string) (*Templates, error) {
+	fallback, err := template.New("default").Parse(DefaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{byChannel: map[Channel]*template.Template{}, fallback: fallback}
+	for channel, text := range byChannel {
+		if text == "" {
+			continue
+		}
+		parsed, err := template.New(string(channel)).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s template: %v", channel, err)
+		}
+		t.byChannel[channel] = parsed
+	}
+
+	return t, nil
+}
+
+// Render produces the message body for msg on the given channel
+func (t *Templates) Render(channel Channel, msg OTPMessage) (string, error) {
+	tmpl := t.fallback
+	if custom, ok := t.byChannel[channel]; ok {
+		tmpl = custom
+	}
+
+	validFor := time.Until(msg.ExpiresAt).Round(time.Minute)
+	if validFor < time.Minute {
+		validFor = time.Minute
+	}
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, templateData{
+		Code:     msg.Code,
+		Minutes:  int(validFor.Minutes()),
+		Phone:    msg.Recipient.PhoneNumber,
+		Email:    msg.Recipient.Email,
+		ValidFor: fmt.Sprintf("%d minutes", int(validFor.Minutes())),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s template: %v", channel, err)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,123 @@
+package messaging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SMSSender delivers OTPs as text messages through a Twilio compatible API
+type SMSSender struct {
+	BaseURL    string
+	AccountSID string
+	AuthToken  string
+	From       string
+	// StatusCallbackURL is passed to the provider so it can report delivery status
+	StatusCallbackURL string
+	HTTPClient        *http.Client
+}
+
+func (s *SMSSender) Name() string     { return "twilio" }
+func (s *SMSSender) Channel() Channel { return ChannelSMS }
+
+// Send submits the message and returns the provider's message SID
+func (s *SMSSender) Send(ctx context.Context, msg OTPMessage, body string) (string, error) {
+	if msg.Recipient.PhoneNumber == "" {
+		return "", ErrNoRecipient
+	}
+
+	form := url.Values{}
+	form.Set("To", msg.Recipient.PhoneNumber)
+	form.Set("From", s.From)
+	form.Set("Body", body)
+	if s.StatusCallbackURL != "" {
+		form.Set("StatusCallback", s.StatusCallbackURL)
+	}
+
+	reqURL := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", strings.TrimSuffix(s.BaseURL, "/"), s.AccountSID)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.SetBasicAuth(s.AccountSID, s.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient(s.HTTPClient).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to make API request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("unexpected status code from SMS provider: %v, response: %s", resp.Status, string(respBody))
+	}
+
+	var response struct {
+		SID string `json:"sid"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return "", fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return response.SID, nil
+}
+
+// ParseStatusCallback reads the form encoded status callback the provider
+// posts, checking it was signed with the auth token for StatusCallbackURL
+func (s *SMSSender) ParseStatusCallback(r *http.Request) ([]StatusUpdate, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("failed to parse callback: %v", err)
+	}
+	if s.StatusCallbackURL == "" || !hmac.Equal([]byte(s.signature(s.StatusCallbackURL, r.PostForm)), []byte(r.Header.Get("X-Twilio-Signature"))) {
+		return nil, fmt.Errorf("invalid callback signature")
+	}
+	if r.PostForm.Get("AccountSid") != s.AccountSID {
+		return nil, fmt.Errorf("callback is for a different account")
+	}
+
+	status := DeliveryStatus(r.PostForm.Get("MessageStatus"))
+	switch status {
+	case "undelivered":
+		status = StatusFailed
+	case "accepted", "sending":
+		status = StatusQueued
+	}
+
+	return []StatusUpdate{{
+		ProviderMessageID: r.PostForm.Get("MessageSid"),
+		Status:            status,
+		Error:             r.PostForm.Get("ErrorCode"),
+	}}, nil
+}
+
+// signature signs a callback the way Twilio does: the URL followed by each
+// POST parameter's name and value, sorted by name, HMAC-SHA1'd with the auth
+// token
+func (s *SMSSender) signature(callbackURL string, form url.Values) string {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	mac := hmac.New(sha1.New, []byte(s.AuthToken))
+	mac.Write([]byte(callbackURL))
+	for _, k := range keys {
+		values := append([]string(nil), form[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			mac.Write([]byte(k + v))
+		}
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
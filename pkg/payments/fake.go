@@ -0,0 +1,121 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Fake is a gateway that never moves money. Payments verify when signed with
+// its secret the way Razorpay signs them, so tests and local clients can pay
+// with Sign. It is meant for local development and tests.
+type Fake struct {
+	Secret string
+
+	mu      sync.Mutex
+	orders  map[string]Order
+	refunds map[string]string
+}
+
+func NewFake(secret string) *Fake {
+	return &Fake{Secret: secret, orders: map[string]Order{}, refunds: map[string]string{}}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) CreateOrder(ctx context.Context, order Order) (Checkout, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := "order_" + uuid.NewString()
+	f.orders[id] = order
+	return Checkout{OrderID: id, KeyID: "fake"}, nil
+}
+
+func (f *Fake) VerifyPayment(ctx context.Context, payment Payment) (string, error) {
+	f.mu.Lock()
+	_, ok := f.orders[payment.OrderID]
+	f.mu.Unlock()
+
+	if !ok || payment.PaymentID == "" || !hmac.Equal([]byte(f.Sign(payment.OrderID, payment.PaymentID)), []byte(payment.Signature)) {
+		return "", ErrNotPaid
+	}
+	return payment.PaymentID, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, refund RefundRequest) (string, error) {
+	if refund.PaymentID == "" || refund.Amount <= 0 {
+		return "", fmt.Errorf("invalid refund")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id, ok := f.refunds[refund.Receipt]
+	if !ok {
+		id = "rfnd_" + uuid.NewString()
+		f.refunds[refund.Receipt] = id
+	}
+	return id, nil
+}
+
+// Sign returns the signature that makes a payment of the order verify
+func (f *Fake) Sign(orderID, paymentID string) string {
+	return signature(f.Secret, orderID, paymentID)
+}
+
+// VerifyWebhook checks X-Fake-Signature, the HMAC of the body with the
+// secret. Bodies are JSON shaped like fakeWebhook.
+func (f *Fake) VerifyWebhook(header http.Header, body []byte) (string, string, error) {
+	if !validHMAC(f.Secret, body, header.Get("X-Fake-Signature")) {
+		return "", "", ErrInvalidSignature
+	}
+
+	var event fakeWebhook
+	if err := json.Unmarshal(body, &event); err != nil {
+		return "", "", fmt.Errorf("failed to decode webhook: %v", err)
+	}
+	if event.ID == "" {
+		event.ID = bodyID(body)
+	}
+	return event.ID, event.Type, nil
+}
+
+func (f *Fake) ParseWebhook(body []byte) (WebhookEvent, error) {
+	var event fakeWebhook
+	if err := json.Unmarshal(body, &event); err != nil {
+		return WebhookEvent{}, fmt.Errorf("failed to decode webhook: %v", err)
+	}
+
+	parsed := WebhookEvent{
+		OrderID:   event.OrderID,
+		PaymentID: event.PaymentID,
+		Amount:    event.Amount,
+		Currency:  event.Currency,
+	}
+	switch event.Type {
+	case "payment.captured":
+		parsed.Kind = WebhookPaymentCaptured
+	case "payment.failed":
+		parsed.Kind = WebhookPaymentFailed
+	}
+	return parsed, nil
+}
+
+// SignWebhook returns the X-Fake-Signature for a webhook body
+func (f *Fake) SignWebhook(body []byte) string {
+	return hmacHex(f.Secret, body)
+}
+
+type fakeWebhook struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	OrderID   string `json:"order_id"`
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+}
@@ -0,0 +1,32 @@
+package payments
+
+import "testing"
+
+func TestNewFromEnvFake(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		secret  string
+		wantErr bool
+	}{
+		{"development", "debug", "secret", false},
+		{"without a secret", "debug", "", true},
+		{"release", "release", "secret", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PAYMENT_GATEWAY", "fake")
+			t.Setenv("GIN_MODE", tt.mode)
+			t.Setenv("FAKE_GATEWAY_SECRET", tt.secret)
+
+			gateway, err := NewFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFromEnv() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && gateway.(*Fake).Secret != tt.secret {
+				t.Errorf("fake gateway has secret %q, want %q", gateway.(*Fake).Secret, tt.secret)
+			}
+		})
+	}
+}
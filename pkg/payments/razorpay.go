@@ -0,0 +1,190 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Razorpay takes payments through Razorpay Checkout
+type Razorpay struct {
+	BaseURL   string
+	KeyID     string
+	KeySecret string
+	// WebhookSecret is set when creating the webhook in the dashboard
+	WebhookSecret string
+	HTTPClient    *http.Client
+}
+
+func (r *Razorpay) Name() string { return "razorpay" }
+
+// CreateOrder creates a Razorpay order for the checkout widget to pay
+func (r *Razorpay) CreateOrder(ctx context.Context, order Order) (Checkout, error) {
+	var response struct {
+		ID string `json:"id"`
+	}
+	err := r.do(ctx, "POST", "/v1/orders", map[string]interface{}{
+		"amount":   order.Amount,
+		"currency": order.Currency,
+		"receipt":  order.Receipt,
+	}, &response)
+	if err != nil {
+		return Checkout{}, err
+	}
+
+	return Checkout{OrderID: response.ID, KeyID: r.KeyID}, nil
+}
+
+// VerifyPayment checks the signature Checkout hands the client on success,
+// which only someone holding the key secret can produce
+func (r *Razorpay) VerifyPayment(ctx context.Context, payment Payment) (string, error) {
+	expected := signature(r.KeySecret, payment.OrderID, payment.PaymentID)
+	if payment.PaymentID == "" || !hmac.Equal([]byte(expected), []byte(payment.Signature)) {
+		return "", ErrNotPaid
+	}
+	return payment.PaymentID, nil
+}
+
+// Refund refunds the payment through the payments API. Razorpay has no
+// idempotency keys, so a refund already made with the same receipt is looked
+// up first and returned instead of refunding again.
+func (r *Razorpay) Refund(ctx context.Context, refund RefundRequest) (string, error) {
+	existing, err := r.findRefund(ctx, refund.PaymentID, refund.Receipt)
+	if err != nil || existing != "" {
+		return existing, err
+	}
+
+	var response struct {
+		ID string `json:"id"`
+	}
+	err = r.do(ctx, "POST", "/v1/payments/"+url.PathEscape(refund.PaymentID)+"/refund", map[string]interface{}{
+		"amount":  refund.Amount,
+		"receipt": refund.Receipt,
+	}, &response)
+	if err != nil {
+		return "", err
+	}
+
+	return response.ID, nil
+}
+
+// findRefund returns the ID of the payment's refund with the receipt, or ""
+// when there is none
+func (r *Razorpay) findRefund(ctx context.Context, paymentID, receipt string) (string, error) {
+	const page = 100
+	for skip := 0; ; skip += page {
+		var response struct {
+			Items []struct {
+				ID      string `json:"id"`
+				Receipt string `json:"receipt"`
+			} `json:"items"`
+		}
+		path := fmt.Sprintf("/v1/payments/%s/refunds?count=%d&skip=%d", url.PathEscape(paymentID), page, skip)
+		if err := r.do(ctx, "GET", path, nil, &response); err != nil {
+			return "", fmt.Errorf("failed to list refunds: %v", err)
+		}
+
+		for _, item := range response.Items {
+			if item.Receipt == receipt {
+				return item.ID, nil
+			}
+		}
+		if len(response.Items) < page {
+			return "", nil
+		}
+	}
+}
+
+func (r *Razorpay) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(r.BaseURL, "/")+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.SetBasicAuth(r.KeyID, r.KeySecret)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient(r.HTTPClient).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make API request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from Razorpay: %v, response: %s", resp.Status, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// VerifyWebhook checks X-Razorpay-Signature, the HMAC of the body with the
+// webhook secret
+func (r *Razorpay) VerifyWebhook(header http.Header, body []byte) (string, string, error) {
+	if !validHMAC(r.WebhookSecret, body, header.Get("X-Razorpay-Signature")) {
+		return "", "", ErrInvalidSignature
+	}
+
+	var event struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return "", "", fmt.Errorf("failed to decode webhook: %v", err)
+	}
+
+	id := header.Get("X-Razorpay-Event-Id")
+	if id == "" {
+		id = bodyID(body)
+	}
+	return id, event.Event, nil
+}
+
+func (r *Razorpay) ParseWebhook(body []byte) (WebhookEvent, error) {
+	var event struct {
+		Event   string `json:"event"`
+		Payload struct {
+			Payment struct {
+				Entity struct {
+					ID       string `json:"id"`
+					OrderID  string `json:"order_id"`
+					Amount   int64  `json:"amount"`
+					Currency string `json:"currency"`
+				} `json:"entity"`
+			} `json:"payment"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return WebhookEvent{}, fmt.Errorf("failed to decode webhook: %v", err)
+	}
+
+	payment := event.Payload.Payment.Entity
+	parsed := WebhookEvent{
+		OrderID:   payment.OrderID,
+		PaymentID: payment.ID,
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+	}
+	switch event.Event {
+	case "payment.captured", "order.paid":
+		parsed.Kind = WebhookPaymentCaptured
+	case "payment.failed":
+		parsed.Kind = WebhookPaymentFailed
+	}
+	return parsed, nil
+}
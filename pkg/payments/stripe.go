@@ -0,0 +1,234 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stripe takes payments through Stripe PaymentIntents
+type Stripe struct {
+	BaseURL        string
+	SecretKey      string
+	PublishableKey string
+	// WebhookSecret is the endpoint's signing secret, "whsec_..."
+	WebhookSecret string
+	HTTPClient    *http.Client
+}
+
+// stripeWebhookTolerance is how old a signed webhook may be, to keep
+// captured requests from being replayed later
+const stripeWebhookTolerance = 5 * time.Minute
+
+func (s *Stripe) Name() string { return "stripe" }
+
+// stripeIntent is the part of a PaymentIntent we look at
+type stripeIntent struct {
+	ID             string            `json:"id"`
+	ClientSecret   string            `json:"client_secret"`
+	Status         string            `json:"status"`
+	Amount         int64             `json:"amount"`
+	AmountReceived int64             `json:"amount_received"`
+	Currency       string            `json:"currency"`
+	Metadata       map[string]string `json:"metadata"`
+}
+
+// CreateOrder creates a PaymentIntent for the client to confirm
+func (s *Stripe) CreateOrder(ctx context.Context, order Order) (Checkout, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(order.Amount, 10))
+	form.Set("currency", strings.ToLower(order.Currency))
+	form.Set("metadata[order_id]", order.Receipt)
+
+	var intent stripeIntent
+	if err := s.do(ctx, "POST", "/v1/payment_intents", form, order.Receipt, &intent); err != nil {
+		return Checkout{}, err
+	}
+
+	return Checkout{OrderID: intent.ID, KeyID: s.PublishableKey, ClientSecret: intent.ClientSecret}, nil
+}
+
+// VerifyPayment asks Stripe whether the PaymentIntent succeeded in full.
+// Stripe doesn't sign client results, so the signature and payment ID the
+// client reports are ignored and the intent is the payment.
+func (s *Stripe) VerifyPayment(ctx context.Context, payment Payment) (string, error) {
+	var intent stripeIntent
+	if err := s.do(ctx, "GET", "/v1/payment_intents/"+url.PathEscape(payment.OrderID), nil, "", &intent); err != nil {
+		return "", err
+	}
+
+	if intent.ID != payment.OrderID || intent.Status != "succeeded" || intent.AmountReceived < intent.Amount {
+		return "", ErrNotPaid
+	}
+	return intent.ID, nil
+}
+
+// Refund refunds the PaymentIntent, which is also the payment ID on Stripe.
+// Idempotency keys only last a day, so a refund already made for the receipt
+// is looked up first.
+func (s *Stripe) Refund(ctx context.Context, refund RefundRequest) (string, error) {
+	existing, err := s.findRefund(ctx, refund.PaymentID, refund.Receipt)
+	if err != nil || existing != "" {
+		return existing, err
+	}
+
+	form := url.Values{}
+	form.Set("payment_intent", refund.PaymentID)
+	form.Set("amount", strconv.FormatInt(refund.Amount, 10))
+	form.Set("metadata[refund_id]", refund.Receipt)
+
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := s.do(ctx, "POST", "/v1/refunds", form, "refund-"+refund.Receipt, &response); err != nil {
+		return "", err
+	}
+
+	return response.ID, nil
+}
+
+// findRefund returns the ID of the PaymentIntent's refund made for the
+// receipt, or "" when there is none
+func (s *Stripe) findRefund(ctx context.Context, paymentID, receipt string) (string, error) {
+	query := url.Values{}
+	query.Set("payment_intent", paymentID)
+	query.Set("limit", "100")
+	for {
+		var response struct {
+			Data []struct {
+				ID       string            `json:"id"`
+				Metadata map[string]string `json:"metadata"`
+			} `json:"data"`
+			HasMore bool `json:"has_more"`
+		}
+		if err := s.do(ctx, "GET", "/v1/refunds?"+query.Encode(), nil, "", &response); err != nil {
+			return "", fmt.Errorf("failed to list refunds: %v", err)
+		}
+
+		for _, r := range response.Data {
+			if r.Metadata["refund_id"] == receipt {
+				return r.ID, nil
+			}
+		}
+		if !response.HasMore || len(response.Data) == 0 {
+			return "", nil
+		}
+		query.Set("starting_after", response.Data[len(response.Data)-1].ID)
+	}
+}
+
+// do calls the API. Requests with an idempotency key are only carried out
+// once however often they're retried.
+func (s *Stripe) do(ctx context.Context, method, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.BaseURL, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.SecretKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := httpClient(s.HTTPClient).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make API request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from Stripe: %v, response: %s", resp.Status, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// VerifyWebhook checks Stripe-Signature, which carries a timestamp and one or
+// more HMACs of "timestamp.body"
+func (s *Stripe) VerifyWebhook(header http.Header, body []byte) (string, string, error) {
+	var timestamp string
+	var sigs []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", "", ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(t, 0)); age > stripeWebhookTolerance || age < -stripeWebhookTolerance {
+		return "", "", ErrInvalidSignature
+	}
+
+	message := append([]byte(timestamp+"."), body...)
+	valid := false
+	for _, sig := range sigs {
+		if validHMAC(s.WebhookSecret, message, sig) {
+			valid = true
+		}
+	}
+	if !valid {
+		return "", "", ErrInvalidSignature
+	}
+
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return "", "", fmt.Errorf("failed to decode webhook: %v", err)
+	}
+	if event.ID == "" {
+		event.ID = bodyID(body)
+	}
+	return event.ID, event.Type, nil
+}
+
+func (s *Stripe) ParseWebhook(body []byte) (WebhookEvent, error) {
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Object stripeIntent `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return WebhookEvent{}, fmt.Errorf("failed to decode webhook: %v", err)
+	}
+
+	intent := event.Data.Object
+	parsed := WebhookEvent{
+		OrderID:   intent.ID,
+		PaymentID: intent.ID,
+		Amount:    intent.AmountReceived,
+		Currency:  strings.ToUpper(intent.Currency),
+	}
+	switch event.Type {
+	case "payment_intent.succeeded":
+		parsed.Kind = WebhookPaymentCaptured
+	case "payment_intent.payment_failed":
+		parsed.Kind = WebhookPaymentFailed
+	}
+	return parsed, nil
+}
@@ -0,0 +1,47 @@
+package payments
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+)
+
+// ErrInvalidSignature is returned for webhooks that weren't signed by the gateway
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Kinds of webhook events we act on
+const (
+	WebhookPaymentCaptured = "payment_captured"
+	WebhookPaymentFailed   = "payment_failed"
+)
+
+// WebhookReceiver is implemented by gateways that report payments through
+// signed webhooks
+type WebhookReceiver interface {
+	// VerifyWebhook checks the request's signature and returns the event's
+	// ID and type
+	VerifyWebhook(header http.Header, body []byte) (id, eventType string, err error)
+	// ParseWebhook reads an event VerifyWebhook accepted
+	ParseWebhook(body []byte) (WebhookEvent, error)
+}
+
+// WebhookEvent is a gateway event in terms of orders
+type WebhookEvent struct {
+	// Kind is one of the Webhook constants, or empty for events that don't
+	// concern orders
+	Kind string
+	// OrderID is the gateway's ID for the order
+	OrderID   string
+	PaymentID string
+	// Amount is what was captured, in the currency's minor unit
+	Amount   int64
+	Currency string
+}
+
+// bodyID identifies events whose gateway doesn't send an ID by their
+// contents, so redeliveries of the same body are still recognized
+func bodyID(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,69 @@
+package payouts
+
+import (
+	"encoding/csv"
+	"fintech/store/models"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// bankFile describes the bulk transfer CSV banks accept for a payout method
+type bankFile struct {
+	header []string
+	row    func(p models.Payout, valueDate time.Time) []string
+}
+
+var bankFiles = map[string]bankFile{
+	models.PayoutNEFT: {
+		header: []string{"Payment Type", "Beneficiary Name", "Beneficiary Account Number", "IFSC", "Amount", "Value Date", "Reference"},
+		row: func(p models.Payout, valueDate time.Time) []string {
+			return []string{"NEFT", cell(p.AccountHolder), cell(p.AccountNumber), cell(p.BankCode),
+				decimal(p.AmountMinor), valueDate.Format("02/01/2006"), p.ID}
+		},
+	},
+	models.PayoutACH: {
+		header: []string{"Receiver Name", "Routing Number", "Account Number", "Transaction Code", "Amount", "Effective Date", "Identification Number"},
+		row: func(p models.Payout, valueDate time.Time) []string {
+			// 22 credits a checking account
+			return []string{cell(p.AccountHolder), cell(p.BankCode), cell(p.AccountNumber), "22",
+				decimal(p.AmountMinor), valueDate.Format("2006-01-02"), p.ID}
+		},
+	},
+}
+
+// WriteBankFile writes the payouts made with method as a bulk transfer CSV,
+// returning how many it wrote
+func WriteBankFile(w io.Writer, method string, payouts []models.Payout, valueDate time.Time) (int, error) {
+	file, ok := bankFiles[method]
+	if !ok {
+		return 0, fmt.Errorf("unknown payout method %q", method)
+	}
+
+	out := csv.NewWriter(w)
+	out.Write(file.header)
+	count := 0
+	for _, p := range payouts {
+		if p.Method != method {
+			continue
+		}
+		out.Write(file.row(p, valueDate))
+		count++
+	}
+	out.Flush()
+	return count, out.Error()
+}
+
+// decimal prints an amount in minor units with two decimal places
+func decimal(amount int64) string {
+	return fmt.Sprintf("%d.%02d", amount/100, amount%100)
+}
+
+// cell keeps spreadsheet programs from running user supplied values as formulas
+func cell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
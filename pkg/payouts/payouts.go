@@ -0,0 +1,101 @@
+// Package payouts works out what instructors are paid in each payout run and
+// writes the bank transfer files for it
+package payouts
+
+import (
+	"fintech/pkg/ledger"
+	"fintech/store/models"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Config controls which earnings a payout run pays out
+type Config struct {
+	// Hold is how old earnings have to be before they're paid out, so most
+	// refunds come in before the money has left
+	Hold time.Duration
+	// Minimum is the smallest payout in a currency's minor unit; smaller
+	// balances carry over to the next run
+	Minimum int64
+}
+
+// ConfigFromEnv reads PAYOUT_HOLD_DAYS (14) and PAYOUT_MINIMUM_MINOR (10000)
+func ConfigFromEnv() Config {
+	config := Config{Hold: 14 * 24 * time.Hour, Minimum: 10000}
+	if v, err := strconv.Atoi(os.Getenv("PAYOUT_HOLD_DAYS")); err == nil && v >= 0 {
+		config.Hold = time.Duration(v) * 24 * time.Hour
+	}
+	if v, err := strconv.ParseInt(os.Getenv("PAYOUT_MINIMUM_MINOR"), 10, 64); err == nil && v > 0 {
+		config.Minimum = v
+	}
+	return config
+}
+
+// methodCurrency is the currency each payout method transfers
+var methodCurrency = map[string]string{
+	models.PayoutNEFT: "INR",
+	models.PayoutACH:  "USD",
+}
+
+// Skipped is a balance left out of a run, and why
+type Skipped struct {
+	UserID      int    `json:"user_id"`
+	AmountMinor int64  `json:"amount_minor"`
+	Currency    string `json:"currency"`
+	Reason      string `json:"reason"`
+}
+
+// Plan turns instructors' balances into payouts to their bank accounts.
+// Balances are as the ledger stores them, so what an instructor is owed is
+// negative. Balances without a bank account able to take them are skipped.
+func Plan(balances []models.AccountBalance, accounts map[int]models.PayoutAccount, minimum int64) ([]models.Payout, []Skipped) {
+	var planned []models.Payout
+	var skipped []Skipped
+
+	for _, b := range balances {
+		userID, ok := ledger.InstructorOf(b.Account)
+		if !ok {
+			continue
+		}
+		owed := ledger.Natural(b.Account, b.AmountMinor)
+		if owed <= 0 {
+			continue
+		}
+
+		skip := Skipped{UserID: userID, AmountMinor: owed, Currency: b.Currency}
+		account, ok := accounts[userID]
+		switch {
+		case owed < minimum:
+			skip.Reason = "below the minimum payout"
+		case !ok:
+			skip.Reason = "no payout account"
+		case methodCurrency[account.Method] != b.Currency:
+			skip.Reason = "payout account can't receive " + b.Currency
+		}
+		if skip.Reason != "" {
+			skipped = append(skipped, skip)
+			continue
+		}
+
+		planned = append(planned, models.Payout{
+			UserID:        userID,
+			AmountMinor:   owed,
+			Currency:      b.Currency,
+			Method:        account.Method,
+			AccountHolder: account.AccountHolder,
+			AccountNumber: account.AccountNumber,
+			BankCode:      account.BankCode,
+		})
+	}
+
+	sort.Slice(planned, func(i, j int) bool { return planned[i].UserID < planned[j].UserID })
+	return planned, skipped
+}
+
+// Currency returns the currency a payout method transfers
+func Currency(method string) (string, bool) {
+	c, ok := methodCurrency[method]
+	return c, ok
+}
@@ -0,0 +1,70 @@
+package phone
+
+// Country describes how phone numbers are written in one region
+type Country struct {
+	// Code is the ISO 3166-1 alpha-2 region code
+	Code string
+	Name string
+	// CallingCode is the international dialing prefix without the "+"
+	CallingCode string
+	// TrunkPrefix is dialed before national numbers inside the country
+	TrunkPrefix string
+	// Lengths lists the valid lengths of the national significant number
+	Lengths []int
+	// LeadingDigits, when set, restricts the first digit of mobile numbers
+	LeadingDigits string
+}
+
+// countries lists the regions numbers can be registered from. Regions sharing
+// a calling code are listed with the most common one first, since that is the
+// one international numbers resolve to.
+var countries = []Country{
+	{Code: "IN", Name: "India", CallingCode: "91", TrunkPrefix: "0", Lengths: []int{10}, LeadingDigits: "6789"},
+	{Code: "US", Name: "United States", CallingCode: "1", TrunkPrefix: "1", Lengths: []int{10}, LeadingDigits: "23456789"},
+	{Code: "CA", Name: "Canada", CallingCode: "1", TrunkPrefix: "1", Lengths: []int{10}, LeadingDigits: "23456789"},
+	{Code: "GB", Name: "United Kingdom", CallingCode: "44", TrunkPrefix: "0", Lengths: []int{10}, LeadingDigits: "7"},
+	{Code: "AE", Name: "United Arab Emirates", CallingCode: "971", TrunkPrefix: "0", Lengths: []int{9}, LeadingDigits: "5"},
+	{Code: "SA", Name: "Saudi Arabia", CallingCode: "966", TrunkPrefix: "0", Lengths: []int{9}, LeadingDigits: "5"},
+	{Code: "QA", Name: "Qatar", CallingCode: "974", Lengths: []int{8}},
+	{Code: "KW", Name: "Kuwait", CallingCode: "965", Lengths: []int{8}},
+	{Code: "OM", Name: "Oman", CallingCode: "968", Lengths: []int{8}},
+	{Code: "BH", Name: "Bahrain", CallingCode: "973", Lengths: []int{8}},
+	{Code: "SG", Name: "Singapore", CallingCode: "65", Lengths: []int{8}, LeadingDigits: "89"},
+	{Code: "MY", Name: "Malaysia", CallingCode: "60", TrunkPrefix: "0", Lengths: []int{9, 10}, LeadingDigits: "1"},
+	{Code: "AU", Name: "Australia", CallingCode: "61", TrunkPrefix: "0", Lengths: []int{9}, LeadingDigits: "4"},
+	{Code: "NZ", Name: "New Zealand", CallingCode: "64", TrunkPrefix: "0", Lengths: []int{8, 9, 10}, LeadingDigits: "2"},
+	{Code: "DE", Name: "Germany", CallingCode: "49", TrunkPrefix: "0", Lengths: []int{10, 11}, LeadingDigits: "1"},
+	{Code: "FR", Name: "France", CallingCode: "33", TrunkPrefix: "0", Lengths: []int{9}, LeadingDigits: "67"},
+	{Code: "NL", Name: "Netherlands", CallingCode: "31", TrunkPrefix: "0", Lengths: []int{9}, LeadingDigits: "6"},
+	{Code: "IE", Name: "Ireland", CallingCode: "353", TrunkPrefix: "0", Lengths: []int{9}, LeadingDigits: "8"},
+	{Code: "BD", Name: "Bangladesh", CallingCode: "880", TrunkPrefix: "0", Lengths: []int{10}, LeadingDigits: "1"},
+	{Code: "LK", Name: "Sri Lanka", CallingCode: "94", TrunkPrefix: "0", Lengths: []int{9}, LeadingDigits: "7"},
+	{Code: "NP", Name: "Nepal", CallingCode: "977", Lengths: []int{10}, LeadingDigits: "9"},
+	{Code: "PK", Name: "Pakistan", CallingCode: "92", TrunkPrefix: "0", Lengths: []int{10}, LeadingDigits: "3"},
+	{Code: "ZA", Name: "South Africa", CallingCode: "27", TrunkPrefix: "0", Lengths: []int{9}, LeadingDigits: "678"},
+	{Code: "KE", Name: "Kenya", CallingCode: "254", TrunkPrefix: "0", Lengths: []int{9}, LeadingDigits: "17"},
+	{Code: "NG", Name: "Nigeria", CallingCode: "234", TrunkPrefix: "0", Lengths: []int{10}, LeadingDigits: "789"},
+}
+
+// LookupCountry returns the country with the given ISO region code
+func LookupCountry(code string) (Country, bool) {
+	for _, c := range countries {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return Country{}, false
+}
+
+// countryForCallingCode finds the country whose calling code prefixes digits
+func countryForCallingCode(digits string) (Country, bool) {
+	// Calling codes are prefix free and at most three digits long
+	for n := 1; n <= 3 && n <= len(digits); n++ {
+		for _, c := range countries {
+			if c.CallingCode == digits[:n] {
+				return c, true
+			}
+		}
+	}
+	return Country{}, false
+}
@@ -0,0 +1,169 @@
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultRegion is used for numbers written without a country calling code
+// when PHONE_DEFAULT_REGION isn't set
+const DefaultRegion = "IN"
+
+var (
+	ErrEmpty              = errors.New("phone number is required")
+	ErrInvalidCharacters  = errors.New("phone number may only contain digits, spaces, dashes, dots, brackets and a leading +")
+	ErrUnsupportedCountry = errors.New("phone numbers from this country calling code are not supported")
+)
+
+// ValidationError reports a number that doesn't match its country's format
+type ValidationError struct {
+	Country Country
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Number is a parsed phone number
+type Number struct {
+	// E164 is the canonical form stored and sent to providers, e.g. +919840091130
+	E164    string
+	Country Country
+	// National is the national significant number without any trunk prefix
+	National string
+}
+
+// Parser normalizes user input to E.164
+type Parser struct {
+	// DefaultRegion is the country assumed for numbers without a calling code
+	DefaultRegion string
+}
+
+// ParserFromEnv reads the default region from PHONE_DEFAULT_REGION
+func ParserFromEnv() Parser {
+	region := strings.ToUpper(strings.TrimSpace(os.Getenv("PHONE_DEFAULT_REGION")))
+	if _, ok := LookupCountry(region); !ok {
+		region = DefaultRegion
+	}
+	return Parser{DefaultRegion: region}
+}
+
+// Parse parses a number written in international format or in the national
+// format of the parser's default region
+func (p Parser) Parse(input string) (Number, error) {
+	return Parse(input, p.DefaultRegion)
+}
+
+// Normalize returns the E.164 form of input
+func (p Parser) Normalize(input string) (string, error) {
+	n, err := p.Parse(input)
+	return n.E164, err
+}
+
+// Parse parses a number written in international format, with a leading "+"
+// or "00", or in the national format of region
+func Parse(input, region string) (Number, error) {
+	s := strings.TrimSpace(input)
+	if s == "" {
+		return Number{}, ErrEmpty
+	}
+
+	international := false
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			international = true
+		case strings.ContainsRune(" -.()/", r):
+		default:
+			return Number{}, ErrInvalidCharacters
+		}
+	}
+	digits := b.String()
+
+	if !international && strings.HasPrefix(digits, "00") {
+		international = true
+		digits = digits[2:]
+	}
+
+	if international {
+		country, ok := countryForCallingCode(digits)
+		if !ok {
+			return Number{}, ErrUnsupportedCountry
+		}
+		return country.number(digits[len(country.CallingCode):])
+	}
+
+	country, ok := LookupCountry(region)
+	if !ok {
+		return Number{}, fmt.Errorf("unknown phone region %q", region)
+	}
+
+	national := digits
+	if !country.validLength(len(national)) {
+		switch {
+		// Dialed with the trunk prefix, e.g. 098400 91130
+		case country.TrunkPrefix != "" && strings.HasPrefix(national, country.TrunkPrefix) &&
+			country.validLength(len(national)-len(country.TrunkPrefix)):
+			national = national[len(country.TrunkPrefix):]
+		// Written with the calling code but no "+", e.g. 91 98400 91130
+		case strings.HasPrefix(national, country.CallingCode) &&
+			country.validLength(len(national)-len(country.CallingCode)):
+			national = national[len(country.CallingCode):]
+		}
+	}
+
+	return country.number(national)
+}
+
+func (c Country) number(national string) (Number, error) {
+	if !c.validLength(len(national)) {
+		return Number{}, &ValidationError{
+			Country: c,
+			Message: fmt.Sprintf("phone numbers in %s (+%s) must have %s digits", c.Name, c.CallingCode, c.lengthsText()),
+		}
+	}
+
+	if c.LeadingDigits != "" && !strings.ContainsRune(c.LeadingDigits, rune(national[0])) {
+		return Number{}, &ValidationError{
+			Country: c,
+			Message: fmt.Sprintf("phone numbers in %s (+%s) must be mobile numbers starting with %s", c.Name, c.CallingCode, c.leadingDigitsText()),
+		}
+	}
+
+	return Number{E164: "+" + c.CallingCode + national, Country: c, National: national}, nil
+}
+
+func (c Country) validLength(n int) bool {
+	for _, l := range c.Lengths {
+		if l == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Country) lengthsText() string {
+	var parts []string
+	for _, l := range c.Lengths {
+		parts = append(parts, fmt.Sprint(l))
+	}
+	return joinOr(parts)
+}
+
+func (c Country) leadingDigitsText() string {
+	return joinOr(strings.Split(c.LeadingDigits, ""))
+}
+
+// joinOr joins items as "a", "a or b" or "a, b or c"
+func joinOr(items []string) string {
+	if len(items) <= 1 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+}
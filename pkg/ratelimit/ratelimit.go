@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy allows Limit requests per Period. Tokens refill continuously, so a
+// client that used up its burst gets one request back every Period/Limit.
+type Policy struct {
+	// Name separates the buckets of different policies sharing a backend
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// Disabled reports whether the policy lets everything through
+func (p Policy) Disabled() bool {
+	return p.Limit <= 0 || p.Period <= 0
+}
+
+// String formats the policy for the RateLimit-Policy header, e.g. "5;w=3600"
+func (p Policy) String() string {
+	return fmt.Sprintf("%d;w=%d", p.Limit, int(p.Period.Seconds()))
+}
+
+// PolicyFromEnv reads RATE_LIMIT_<NAME> as "<limit>/<period>", e.g. "5/1h",
+// falling back to the given policy. "off" disables the policy.
+func PolicyFromEnv(fallback Policy) Policy {
+	v := strings.TrimSpace(os.Getenv("RATE_LIMIT_" + strings.ToUpper(fallback.Name)))
+	if v == "" {
+		return fallback
+	}
+	if v == "off" {
+		fallback.Limit = 0
+		return fallback
+	}
+
+	limit, period, ok := strings.Cut(v, "/")
+	l, err := strconv.Atoi(limit)
+	if !ok || err != nil || l <= 0 {
+		return fallback
+	}
+	p, err := time.ParseDuration(period)
+	if err != nil || p <= 0 {
+		return fallback
+	}
+
+	fallback.Limit = l
+	fallback.Period = p
+	return fallback
+}
+
+// Result is the state of a bucket after taking a token from it
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, zero when
+	// this one was
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from buckets. The in-memory limiter only counts
+// requests reaching one process; replicas behind a load balancer need an
+// implementation backed by shared storage.
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// NewFromEnv returns the limiter configured through RATE_LIMIT_BACKEND. Only
+// "memory" is supported for now.
+func NewFromEnv() (Limiter, error) {
+	switch backend := os.Getenv("RATE_LIMIT_BACKEND"); backend {
+	case "", "memory":
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unsupported rate limit backend %q", backend)
+	}
+}
+
+// bucket is a token bucket as of updated
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills the bucket up to now and takes a token if there is one
+func (b *bucket) take(policy Policy, now time.Time) Result {
+	rate := float64(policy.Limit) / float64(policy.Period)
+	limit := float64(policy.Limit)
+
+	b.tokens += float64(now.Sub(b.updated)) * rate
+	if b.tokens > limit {
+		b.tokens = limit
+	}
+	b.updated = now
+
+	var result Result
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((limit - b.tokens) / rate)
+	return result
+}
@@ -0,0 +1,96 @@
+package rbac
+
+import (
+	"fintech/store/models"
+	"slices"
+	"strings"
+)
+
+// Permission is an action a user may be allowed to perform. Grants may carry
+// an ":any" or ":own" suffix; ":own" only applies to courses the user is an
+// active instructor of, and only for actions their instructor level allows.
+type Permission string
+
+const (
+	CourseView        Permission = "course:view"
+	CourseCreate      Permission = "course:create"
+	CourseEdit        Permission = "course:edit"
+	CourseDelete      Permission = "course:delete"
+	CourseInstructors Permission = "course:instructors"
+
+	EnrollmentManage Permission = "enrollment:manage"
+
+	FolderEdit   Permission = "folder:edit"
+	FolderUpload Permission = "folder:upload"
+
+	ChatParticipate Permission = "chat:participate"
+	ChatSupport     Permission = "chat:support"
+
+	UserManage      Permission = "user:manage"
+	UserImpersonate Permission = "user:impersonate"
+
+	AuditView Permission = "audit:view"
+
+	PaymentManage Permission = "payment:manage"
+	FinanceView   Permission = "finance:view"
+	PayoutManage  Permission = "payout:manage"
+	CouponManage  Permission = "coupon:manage"
+)
+
+const (
+	suffixAny = ":any"
+	suffixOwn = ":own"
+)
+
+// levelActions lists what each instructor level may do on its course
+var levelActions = map[string][]Permission{
+	models.InstructorOwner:        {CourseEdit, CourseDelete, CourseInstructors, FolderEdit, FolderUpload},
+	models.InstructorCoInstructor: {CourseEdit, FolderEdit, FolderUpload},
+	models.InstructorTA:           {FolderUpload},
+}
+
+// Target is the resource an action is performed on
+type Target struct {
+	// Course is nil for platform-wide actions
+	Course *models.Course
+	// Level is the caller's active instructor level on Course, if any
+	Level string
+}
+
+// LevelAllows reports whether an instructor level permits the action
+func LevelAllows(level string, action Permission) bool {
+	return slices.Contains(levelActions[level], action)
+}
+
+// Allows reports whether any of the grants lets the user perform action on target
+func Allows(grants []models.PermissionGrant, action Permission, target Target) bool {
+	for _, g := range grants {
+		// Grants scoped to a course only count for that course
+		if g.CourseID != "" && (target.Course == nil || g.CourseID != target.Course.ID.String()) {
+			continue
+		}
+
+		granted := Permission(g.Permission)
+		switch {
+		case granted == action, granted == action+suffixAny:
+			return true
+		case granted == action+suffixOwn && target.Course != nil && LevelAllows(target.Level, action):
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scope keeps only the grants covered by scopes, as for API keys. A scope
+// without a suffix covers the permission with any suffix.
+func Scope(grants []models.PermissionGrant, scopes []string) []models.PermissionGrant {
+	scoped := []models.PermissionGrant{}
+	for _, g := range grants {
+		base := strings.TrimSuffix(strings.TrimSuffix(g.Permission, suffixAny), suffixOwn)
+		if slices.Contains(scopes, g.Permission) || slices.Contains(scopes, base) {
+			scoped = append(scoped, g)
+		}
+	}
+	return scoped
+}
@@ -0,0 +1,84 @@
+// Package refunds decides which refunds buyers may have without an admin
+// approving them
+package refunds
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Policy is the set of rules a refund has to meet to go through without
+// approval. Rules set to zero don't apply.
+type Policy struct {
+	// Window is how long after paying a buyer may ask for a refund
+	Window time.Duration
+	// MaxWatchedPercent is the share of the course's videos the buyer may
+	// have watched
+	MaxWatchedPercent float64
+	// PartialAccess is how long buyers keep access to the course after a
+	// partial refund
+	PartialAccess time.Duration
+}
+
+// Usage is what the buyer did with the course before asking for a refund
+type Usage struct {
+	PaidAt time.Time
+	// WatchedPercent is only meaningful when WatchedKnown is set
+	WatchedPercent float64
+	WatchedKnown   bool
+}
+
+// PolicyFromEnv reads REFUND_WINDOW_DAYS (7), REFUND_MAX_WATCHED_PERCENT (20)
+// and REFUND_PARTIAL_ACCESS_DAYS (30). Zero turns a rule off.
+func PolicyFromEnv() Policy {
+	return Policy{
+		Window:            envDays("REFUND_WINDOW_DAYS", 7),
+		MaxWatchedPercent: envFloat("REFUND_MAX_WATCHED_PERCENT", 20),
+		PartialAccess:     envDays("REFUND_PARTIAL_ACCESS_DAYS", 30),
+	}
+}
+
+// Check returns the rules the refund breaks, or nothing when it's within
+// the policy
+func (p Policy) Check(usage Usage, now time.Time) []string {
+	var broken []string
+	if p.Window > 0 && now.Sub(usage.PaidAt) > p.Window {
+		broken = append(broken, fmt.Sprintf("paid more than %d days ago", int(p.Window.Hours()/24)))
+	}
+	if p.MaxWatchedPercent > 0 {
+		switch {
+		case !usage.WatchedKnown:
+			broken = append(broken, "watch history unavailable")
+		case usage.WatchedPercent >= p.MaxWatchedPercent:
+			broken = append(broken, fmt.Sprintf("watched %.0f%% of the videos, the limit is %.0f%%", usage.WatchedPercent, p.MaxWatchedPercent))
+		}
+	}
+	return broken
+}
+
+// AccessUntil returns when access should end after a partial refund, or nil
+// to leave it as it is
+func (p Policy) AccessUntil(now time.Time) *time.Time {
+	if p.PartialAccess <= 0 {
+		return nil
+	}
+	t := now.Add(p.PartialAccess)
+	return &t
+}
+
+func envDays(key string, fallback int) time.Duration {
+	days := fallback
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v >= 0 {
+		days = v
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func envFloat(key string, fallback float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil && v >= 0 {
+		return v
+	}
+	return fallback
+}
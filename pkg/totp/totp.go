@@ -0,0 +1,178 @@
+// Package totp implements RFC 6238 time-based one-time passwords as used by
+// authenticator apps, along with recovery codes for when the app is lost.
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the length of generated codes
+	Digits = 6
+	// Period is how long each code is valid for
+	Period = 30 * time.Second
+	// secretSize is the recommended 160 bits for HMAC-SHA1
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ErrInvalidSecret is returned for secrets that aren't valid base32
+var ErrInvalidSecret = errors.New("invalid TOTP secret")
+
+// Config controls how codes are checked and how secrets are stored
+type Config struct {
+	// Issuer is shown next to the account in authenticator apps
+	Issuer string
+	// Skew is how many periods either side of now a code is still accepted,
+	// to allow for clock drift between the server and the phone
+	Skew int
+	// EncryptionKey seals secrets at rest, since unlike OTPs they have to be
+	// read back to check codes
+	EncryptionKey []byte
+}
+
+// ConfigFromEnv reads TOTP_ISSUER and TOTP_ENCRYPTION_KEY, which is required
+// since secrets sealed with a guessable key are as good as plain text
+func ConfigFromEnv() (Config, error) {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Fintech"
+	}
+
+	secret := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if secret == "" {
+		return Config{}, errors.New("TOTP_ENCRYPTION_KEY is not set")
+	}
+	key := sha256.Sum256([]byte(secret))
+	return Config{Issuer: issuer, Skew: 1, EncryptionKey: key[:]}, nil
+}
+
+// GenerateSecret returns a new random base32 encoded secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate TOTP secret: %v", err)
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Code returns the code for the given time step
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation from RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod), nil
+}
+
+// Step returns the time step t falls in
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Validate checks code against the steps around now and returns the step it
+// matched, so callers can refuse to accept the same step twice
+func (c Config) Validate(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(now)
+	for i := -c.Skew; i <= c.Skew; i++ {
+		expected, err := Code(secret, current+int64(i))
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return current + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// URI returns the otpauth:// provisioning URI authenticator apps read from
+// a QR code
+func (c Config) URI(account, secret string) string {
+	label := url.PathEscape(c.Issuer) + ":" + url.PathEscape(account)
+
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", c.Issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(Digits))
+	q.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// Seal encrypts a secret for storage
+func (c Config) Seal(secret string) (string, error) {
+	gcm, err := c.aead()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a secret sealed with Seal
+func (c Config) Open(sealed string) (string, error) {
+	gcm, err := c.aead()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(b) < gcm.NonceSize() {
+		return "", ErrInvalidSecret
+	}
+	secret, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+	return string(secret), nil
+}
+
+func (c Config) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(c.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,160 @@
+package totp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890", in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil || got != tt.want {
+			t.Errorf("Code at %d = %q, %v, want %q", tt.unix, got, err, tt.want)
+		}
+	}
+
+	if _, err := Code(strings.ToLower(rfcSecret), 1); err != nil {
+		t.Errorf("lowercase secret: %v", err)
+	}
+	if _, err := Code("not base32!", 1); !errors.Is(err, ErrInvalidSecret) {
+		t.Errorf("invalid secret returned %v, want ErrInvalidSecret", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		skew     int
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", 1, code(current), current, true},
+		{"with spaces around", 1, " " + code(current) + " ", current, true},
+		{"previous step within skew", 1, code(current - 1), current - 1, true},
+		{"next step within skew", 1, code(current + 1), current + 1, true},
+		{"two steps back", 1, code(current - 2), 0, false},
+		{"two steps ahead", 1, code(current + 2), 0, false},
+		{"previous step without skew", 0, code(current - 1), 0, false},
+		{"two steps back with skew of two", 2, code(current - 2), current - 2, true},
+		{"wrong code", 1, "000000", 0, false},
+		{"too short", 1, code(current)[:5], 0, false},
+		{"too long", 1, code(current) + "0", 0, false},
+		{"empty", 1, "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Config{Skew: tt.skew}.Validate(rfcSecret, tt.code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate(%q) = %d, %v, want %d, %v", tt.code, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateReportsStepForReuse(t *testing.T) {
+	c := Config{Skew: 1}
+	now := time.Unix(1111111111, 0)
+	code, err := Code(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the window the same code matches the same step, which is what
+	// callers record to refuse it a second time
+	first, ok := c.Validate(rfcSecret, code, now)
+	if !ok {
+		t.Fatal("code didn't validate")
+	}
+	again, ok := c.Validate(rfcSecret, code, now.Add(Period))
+	if !ok || again != first {
+		t.Errorf("code a period later matched step %d, %v, want %d", again, ok, first)
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"abcde-fghij", "abcdefghij"},
+		{"ABCDE-FGHIJ", "abcdefghij"},
+		{"abcde fghij", "abcdefghij"},
+		{" abcde - fghij ", "abcdefghij"},
+		{"abcdefghij", "abcdefghij"},
+		{"ab-cd-ef", "abcdef"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.code); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || code != strings.ToLower(code) {
+			t.Errorf("code %q isn't formatted as xxxxx-xxxxx", code)
+		}
+		normalized := NormalizeRecoveryCode(code)
+		if seen[normalized] {
+			t.Errorf("code %q was issued twice", code)
+		}
+		seen[normalized] = true
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	c := Config{EncryptionKey: make([]byte, 32)}
+	sealed, err := c.Seal(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened, err := c.Open(sealed); err != nil || opened != rfcSecret {
+		t.Errorf("Open() = %q, %v, want %q", opened, err, rfcSecret)
+	}
+
+	other := Config{EncryptionKey: []byte(strings.Repeat("k", 32))}
+	if _, err := other.Open(sealed); !errors.Is(err, ErrInvalidSecret) {
+		t.Errorf("Open() with another key returned %v, want ErrInvalidSecret", err)
+	}
+}
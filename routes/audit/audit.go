@@ -0,0 +1,20 @@
+package audit
+
+import (
+	auditController "fintech/controllers/audit"
+	"fintech/middlewares"
+	"fintech/pkg/rbac"
+	"fintech/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AuditRoutes(r *gin.Engine, db store.Store) {
+	controller := auditController.Controller{Store: db}
+
+	admin := middlewares.RequirePermission(db, rbac.AuditView)
+
+	r.GET("/admin/audit", admin, controller.List)
+	r.GET("/admin/audit/export", admin, controller.Export)
+	r.GET("/admin/audit/verify", admin, controller.Verify)
+}
@@ -2,14 +2,63 @@ package auth
 
 import (
 	authController "fintech/controllers/auth"
+	"fintech/middlewares"
+	"fintech/pkg/messaging"
+	"fintech/pkg/oidc"
+	"fintech/pkg/otp"
+	"fintech/pkg/phone"
+	"fintech/pkg/ratelimit"
+	"fintech/pkg/rbac"
+	"fintech/pkg/totp"
 	"fintech/store"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthRoutes(r *gin.Engine, db store.Store) {
-	controller := authController.Controller{Store: db}
+func AuthRoutes(r *gin.Engine, db store.Store, sender messaging.OTPSender, otpConfig otp.Config, totpConfig totp.Config, providers map[string]*oidc.Provider, limiter ratelimit.Limiter) {
+	controller := authController.Controller{
+		Store:  db,
+		Sender: sender,
+		OTP:    otpConfig,
+		Phone:  phone.ParserFromEnv(),
+		TOTP:   totpConfig,
+		OIDC:   providers,
+	}
 
-	r.POST("/register", controller.Register)
-	r.POST("/verify", controller.Verify)
+	// Every registration sends an OTP, so it's limited per number as well as
+	// per address to stop anyone flooding a phone with messages
+	registerByIP := middlewares.RateLimit(limiter, ratelimit.PolicyFromEnv(ratelimit.Policy{Name: "register_ip", Limit: 20, Period: time.Hour}), middlewares.RateByIP)
+	registerByPhone := middlewares.RateLimit(limiter, ratelimit.PolicyFromEnv(ratelimit.Policy{Name: "register_phone", Limit: 5, Period: time.Hour}), middlewares.RateByPhone(controller.Phone))
+	verify := middlewares.RateLimit(limiter, ratelimit.PolicyFromEnv(ratelimit.Policy{Name: "verify", Limit: 30, Period: 10 * time.Minute}), middlewares.RateByIP)
+
+	r.POST("/register", registerByIP, registerByPhone, controller.Register)
+	r.POST("/verify", verify, controller.Verify)
+	r.POST("/verify/mfa", verify, controller.VerifyMFA)
+	r.POST("/verify/mfa/enroll", verify, controller.EnrollMFAChallenge)
+	r.POST("/token/refresh", controller.Refresh)
+	r.GET("/.well-known/jwks.json", controller.JWKS)
+	r.POST("/logout", middlewares.RequirePermission(db), controller.Logout)
+	r.POST("/logout-all", middlewares.RequirePermission(db), controller.LogoutAll)
+	r.GET("/me/sessions", middlewares.RequirePermission(db), controller.ListSessions)
+	r.DELETE("/me/sessions/:session_id", middlewares.RequirePermission(db), controller.RevokeSession)
+	r.POST("/users/:id/logout-all", middlewares.RequirePermission(db, rbac.UserManage), controller.RevokeUserSessions)
+	r.POST("/admin/users/:id/impersonate", middlewares.RequirePermission(db, rbac.UserImpersonate), controller.Impersonate)
+	r.DELETE("/admin/impersonations/:session_id", middlewares.RequirePermission(db, rbac.UserImpersonate), controller.EndImpersonation)
+
+	r.GET("/me/mfa", middlewares.RequirePermission(db), controller.MFAStatus)
+	r.POST("/me/mfa/totp", middlewares.RequirePermission(db), controller.EnrollMFA)
+	r.POST("/me/mfa/totp/confirm", middlewares.RequirePermission(db), controller.ConfirmMFA)
+	r.DELETE("/me/mfa/totp", middlewares.RequirePermission(db), controller.DisableMFA)
+	r.POST("/me/mfa/recovery-codes", middlewares.RequirePermission(db), controller.RegenerateRecoveryCodes)
+
+	r.GET("/auth/oidc/providers", controller.OIDCProviders)
+	r.GET("/auth/oidc/:provider/login", controller.OIDCLogin)
+	r.POST("/auth/oidc/:provider/callback", controller.OIDCCallback)
+	r.GET("/me/identities", middlewares.RequirePermission(db), controller.ListIdentities)
+	r.POST("/me/identities/:provider", middlewares.RequirePermission(db), controller.LinkIdentity)
+	r.DELETE("/me/identities/:provider", middlewares.RequirePermission(db), controller.UnlinkIdentity)
+
+	r.GET("/otp/deliveries/:provider/status", controller.DeliveryStatus)
+	r.POST("/otp/deliveries/:provider/status", controller.DeliveryStatus)
 }
@@ -1,67 +1,82 @@
 package chat
 
 import (
+	"database/sql"
+	"errors"
 	chatController "fintech/controllers/chat"
 	"fintech/middlewares"
-	"fintech/utils"
+	"fintech/pkg/ratelimit"
+	"fintech/pkg/rbac"
 	"net/http"
+	"strconv"
+	"time"
 
 	"fintech/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func ChatRoutes(r *gin.Engine, db store.Store) {
-	controller := chatController.ChatController{Store: db}
-
-	r.GET("/chat/ws", ChatAuthMiddleware, controller.Chat)
-	r.GET("/chat/ws/admin", ChatAdminMiddleware, controller.ChatAdmin)
-	r.GET("/chat/sessions", middlewares.AuthMiddleware, controller.GetChatSessions)
-	r.GET("/chat/sessions/:session_id/messages", middlewares.AuthMiddleware, controller.GetChatSessionsMessages)
-	r.GET("/chat/sessions/:session_id/messages/read", middlewares.AuthMiddleware, controller.MarkChatSessionsAsRead)
-}
-
-func ChatAuthMiddleware(c *gin.Context) {
-	token := c.Query("authorization")
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-		c.Abort()
-		return
+func ChatRoutes(r *gin.Engine, db store.Store, limiter ratelimit.Limiter) {
+	controller := chatController.ChatController{
+		Store:         db,
+		Limiter:       limiter,
+		MessagePolicy: ratelimit.PolicyFromEnv(ratelimit.Policy{Name: "chat_message", Limit: 60, Period: time.Minute}),
 	}
 
-	claims, err := utils.VerifyJWT(token) // We only care about phone number here
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-		c.Abort()
-		return
-	}
+	connect := middlewares.RateLimit(limiter, ratelimit.PolicyFromEnv(ratelimit.Policy{Name: "chat_connect", Limit: 30, Period: time.Minute}), middlewares.RateByUser)
+
+	chat := middlewares.RequirePermission(db, rbac.ChatParticipate, rbac.ChatSupport)
 
-	c.Set("user_id", claims.UserID)           // Store phone number in context
-	c.Set("phone_number", claims.PhoneNumber) // Store phone number in context
-	c.Next()
+	r.GET("/chat/ws", middlewares.RequirePermission(db, rbac.ChatParticipate), middlewares.RequireEnrollment(db), connect, controller.Chat)
+	r.GET("/chat/ws/admin", middlewares.RequirePermission(db, rbac.ChatSupport), connect, controller.ChatAdmin)
+	r.GET("/chat/sessions", middlewares.RequirePermission(db), controller.GetChatSessions)
+	r.GET("/chat/sessions/:session_id/messages", chat, sessionMiddleware(db), controller.GetChatSessionsMessages)
+	r.GET("/chat/sessions/:session_id/messages/read", chat, sessionMiddleware(db), controller.MarkChatSessionsAsRead)
 }
 
-// AdminMiddleware checks if the user is an admin
-func ChatAdminMiddleware(c *gin.Context) {
-	token := c.Query("authorization")
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-		c.Abort()
-		return
-	}
+// sessionMiddleware loads the chat session, which only its participants can
+// see. Support staff see all of theirs; everyone else only while the
+// enrollment the chat is about lets them.
+func sessionMiddleware(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("session_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+			c.Abort()
+			return
+		}
 
-	claims, err := utils.VerifyJWT(token) // We only care about phone number here
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-		c.Abort()
-		return
-	}
-	if claims.Role != "admin" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid access"})
-		c.Abort()
-		return
+		userID := c.MustGet("user_id").(int)
+		session, err := db.GetChatSession(c, id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chat session"})
+			c.Abort()
+			return
+		}
+		if err != nil || (session.SenderID != userID && session.ReceiverID != userID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+			c.Abort()
+			return
+		}
+
+		if !middlewares.Can(c, rbac.ChatSupport) {
+			other := session.SenderID
+			if other == userID {
+				other = session.ReceiverID
+			}
+			allowed, err := db.CanChat(c, userID, other, time.Now())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check enrollment"})
+				c.Abort()
+				return
+			}
+			if !allowed {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("chat_session", session)
 	}
-	c.Set("user_id", claims.UserID)           // Store phone number in context
-	c.Set("phone_number", claims.PhoneNumber) // Store phone number in context
-	c.Next()
 }
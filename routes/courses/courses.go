@@ -3,9 +3,9 @@ package courses
 import (
 	courseController "fintech/controllers/courses"
 	"fintech/middlewares"
+	"fintech/pkg/rbac"
 	"fintech/pkg/vdo"
 	"fintech/store"
-	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,23 +13,27 @@ import (
 func CourseRoutes(r *gin.Engine, db store.Store, VDO *vdo.VideoCipherClient) {
 	controller := courseController.Controller{Store: db, VDO: VDO}
 
-	r.POST("/courses", middlewares.AdminMiddleware, controller.Create)
-	r.GET("/courses", middlewares.AuthMiddleware, controller.List)
-	r.GET("/courses/:id", middlewares.AuthMiddleware, courseMiddleware(db), controller.Get)
-	r.PATCH("/courses/:id", middlewares.AdminMiddleware, courseMiddleware(db), controller.Update)
-	r.DELETE("/courses/:id", middlewares.AdminMiddleware, courseMiddleware(db), controller.Delete)
-}
+	r.POST("/courses", middlewares.RequirePermission(db, rbac.CourseCreate), controller.Create)
+	r.GET("/courses", middlewares.RequirePermission(db, rbac.CourseView), controller.List)
+	r.GET("/courses/:course_id", middlewares.RequirePermission(db, rbac.CourseView), middlewares.RequireEnrollment(db), controller.Get)
+	r.PATCH("/courses/:course_id", middlewares.RequirePermission(db, rbac.CourseEdit), controller.Update)
+	r.DELETE("/courses/:course_id", middlewares.RequirePermission(db, rbac.CourseDelete), controller.Delete)
+
+	r.GET("/courses/:course_id/instructors", middlewares.RequirePermission(db, rbac.CourseView), controller.ListInstructors)
+	r.POST("/courses/:course_id/instructors", middlewares.RequirePermission(db, rbac.CourseInstructors), controller.InviteInstructor)
+	r.POST("/courses/:course_id/instructors/accept", middlewares.RequirePermission(db), controller.AcceptInvitation)
+	r.DELETE("/courses/:course_id/instructors/:user_id", middlewares.RequirePermission(db, rbac.CourseInstructors), controller.RemoveInstructor)
+
+	r.GET("/me/courses", middlewares.RequirePermission(db), controller.MyCourses)
+	r.POST("/courses/:course_id/enrollment", middlewares.RequirePermission(db, rbac.CourseView), controller.Enroll)
+	r.DELETE("/courses/:course_id/enrollment", middlewares.RequirePermission(db), controller.Unenroll)
 
-func courseMiddleware(db store.Store) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		courseID := c.Param("id")
-		course, err := db.GetCourse(c, courseID)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err})
-			return
-		}
+	r.GET("/courses/:course_id/progress", middlewares.RequirePermission(db, rbac.CourseView), middlewares.RequireEnrollment(db), controller.ListProgress)
+	r.PUT("/courses/:course_id/videos/:video_id/progress", middlewares.RequirePermission(db, rbac.CourseView), middlewares.RequireEnrollment(db), controller.SaveProgress)
 
-		c.Set("course", course)
-	}
+	admin := middlewares.RequirePermission(db, rbac.EnrollmentManage)
 
+	r.GET("/admin/courses/:course_id/enrollments", admin, controller.ListEnrollments)
+	r.POST("/admin/courses/:course_id/enrollments", admin, controller.BulkEnroll)
+	r.POST("/admin/courses/:course_id/enrollments/cancel", admin, controller.BulkUnenroll)
 }
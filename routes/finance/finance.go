@@ -0,0 +1,61 @@
+package finance
+
+import (
+	financeController "fintech/controllers/finance"
+	"fintech/middlewares"
+	"fintech/pkg/ledger"
+	"fintech/pkg/payouts"
+	"fintech/pkg/rbac"
+	"fintech/store"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func FinanceRoutes(r *gin.Engine, db store.Store) {
+	controller := financeController.Controller{
+		Store:        db,
+		PlatformFee:  ledger.PlatformFeeFromEnv(),
+		PayoutConfig: payouts.ConfigFromEnv(),
+	}
+
+	admin := middlewares.RequirePermission(db, rbac.FinanceView)
+
+	r.GET("/admin/finance/balances", admin, controller.Balances)
+	r.GET("/admin/finance/activity", admin, controller.Activity)
+	r.GET("/admin/finance/accounts/:account", admin, controller.Statement)
+	r.GET("/admin/finance/entries", admin, controller.FindEntry)
+	r.GET("/admin/finance/entries/:id", admin, controller.GetEntry)
+
+	payoutAdmin := middlewares.RequirePermission(db, rbac.PayoutManage)
+
+	r.GET("/admin/courses/:course_id/revenue-shares", payoutAdmin, controller.GetRevenueShares)
+	r.PUT("/admin/courses/:course_id/revenue-shares", payoutAdmin, controller.SetRevenueShares)
+
+	r.POST("/admin/payouts/batches", payoutAdmin, controller.RunPayouts)
+	r.GET("/admin/payouts/batches", payoutAdmin, controller.ListPayoutBatches)
+	r.GET("/admin/payouts/batches/:batch_id", payoutAdmin, batchMiddleware(db), controller.GetPayoutBatch)
+	r.POST("/admin/payouts/batches/:batch_id/approve", payoutAdmin, batchMiddleware(db), controller.ApprovePayoutBatch)
+	r.GET("/admin/payouts/batches/:batch_id/export", payoutAdmin, batchMiddleware(db), controller.ExportPayoutBatch)
+	r.POST("/admin/payouts/batches/:batch_id/settle", payoutAdmin, batchMiddleware(db), controller.SettlePayoutBatch)
+	r.POST("/admin/payouts/batches/:batch_id/cancel", payoutAdmin, batchMiddleware(db), controller.CancelPayoutBatch)
+
+	r.GET("/me/earnings", middlewares.RequirePermission(db), controller.MyEarnings)
+	r.GET("/me/payouts", middlewares.RequirePermission(db), controller.MyPayouts)
+	r.GET("/me/payout-account", middlewares.RequirePermission(db), controller.GetPayoutAccount)
+	r.PUT("/me/payout-account", middlewares.RequirePermission(db), controller.SavePayoutAccount)
+}
+
+// batchMiddleware loads the payout batch with its payouts
+func batchMiddleware(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		batch, err := db.GetPayoutBatch(c, c.Param("batch_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payout batch not found"})
+			c.Abort()
+			return
+		}
+
+		c.Set("batch", batch)
+	}
+}
@@ -3,46 +3,41 @@ package folders
 import (
 	folderController "fintech/controllers/folders"
 	"fintech/middlewares"
+	"fintech/pkg/ratelimit"
+	"fintech/pkg/rbac"
 	"fintech/pkg/vdo"
 	"fintech/store"
+	"fintech/store/models"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func FolderRoutes(r *gin.Engine, db store.Store, VDO *vdo.VideoCipherClient) {
+func FolderRoutes(r *gin.Engine, db store.Store, VDO *vdo.VideoCipherClient, limiter ratelimit.Limiter) {
 	controller := folderController.Controller{Store: db, VDO: VDO}
 
-	r.POST("/courses/:id/folders", middlewares.AdminMiddleware, courseMiddleware(db), controller.Create)
-	r.GET("/courses/:id/folders", middlewares.AuthMiddleware, courseMiddleware(db), controller.List)
-	r.GET("/courses/:id/folders/:folder_id", middlewares.AuthMiddleware, courseMiddleware(db), folderMiddleware(db), controller.Get)
-	r.PATCH("/courses/:id/folders/:folder_id", middlewares.AdminMiddleware, courseMiddleware(db), folderMiddleware(db), controller.Update)
-	r.DELETE("/courses/:id/folders/:folder_id", middlewares.AdminMiddleware, courseMiddleware(db), folderMiddleware(db), controller.Delete)
+	upload := middlewares.RateLimit(limiter, ratelimit.PolicyFromEnv(ratelimit.Policy{Name: "upload", Limit: 30, Period: time.Hour}), middlewares.RateByUser)
 
-	r.POST("/courses/:id/folders/:folder_id/upload", middlewares.AdminMiddleware, courseMiddleware(db), folderMiddleware(db), controller.Upload)
-
-}
-
-func courseMiddleware(db store.Store) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		courseID := c.Param("id")
-		course, err := db.GetCourse(c, courseID)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err})
-			return
-		}
-
-		c.Set("course", course)
-	}
+	r.POST("/courses/:course_id/folders", middlewares.RequirePermission(db, rbac.FolderEdit), controller.Create)
+	r.GET("/courses/:course_id/folders", middlewares.RequirePermission(db, rbac.CourseView), middlewares.RequireEnrollment(db), controller.List)
+	r.GET("/courses/:course_id/folders/:folder_id", middlewares.RequirePermission(db, rbac.CourseView), middlewares.RequireEnrollment(db), folderMiddleware(db), controller.Get)
+	r.PATCH("/courses/:course_id/folders/:folder_id", middlewares.RequirePermission(db, rbac.FolderEdit), folderMiddleware(db), controller.Update)
+	r.DELETE("/courses/:course_id/folders/:folder_id", middlewares.RequirePermission(db, rbac.FolderEdit), folderMiddleware(db), controller.Delete)
 
+	r.POST("/courses/:course_id/folders/:folder_id/upload", middlewares.RequirePermission(db, rbac.FolderUpload), folderMiddleware(db), upload, controller.Upload)
 }
 
 func folderMiddleware(db store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		course := c.MustGet("course").(models.Course)
 		folder_id := c.Param("folder_id")
 		folder, err := db.GetFolder(c, folder_id)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err})
+		// A folder is only reachable through the course it belongs to, so rights
+		// on one course can't be used on another course's folders
+		if err != nil || folder.CourseID != course.ID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+			c.Abort()
 			return
 		}
 
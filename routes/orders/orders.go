@@ -0,0 +1,129 @@
+package orders
+
+import (
+	orderController "fintech/controllers/orders"
+	"fintech/middlewares"
+	"fintech/pkg/gst"
+	"fintech/pkg/ledger"
+	"fintech/pkg/payments"
+	"fintech/pkg/rbac"
+	"fintech/pkg/refunds"
+	"fintech/pkg/storage"
+	"fintech/pkg/vdo"
+	"fintech/store"
+	"fintech/store/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func OrderRoutes(r *gin.Engine, db store.Store, gateway payments.PaymentGateway, worker *orderController.WebhookWorker, tax gst.Config, blobs storage.Storage, VDO *vdo.VideoCipherClient) {
+	controller := orderController.Controller{
+		Store:        db,
+		Gateway:      gateway,
+		Worker:       worker,
+		PlatformFee:  ledger.PlatformFeeFromEnv(),
+		GST:          tax,
+		RefundPolicy: refunds.PolicyFromEnv(),
+		Storage:      blobs,
+		VDO:          VDO,
+	}
+
+	r.POST("/courses/:course_id/checkout", middlewares.RequirePermission(db, rbac.CourseView), controller.Checkout)
+	r.POST("/checkout/quote", middlewares.RequirePermission(db), controller.Quote)
+	r.GET("/me/orders", middlewares.RequirePermission(db), controller.ListMine)
+	r.GET("/orders/:order_id", middlewares.RequirePermission(db), orderMiddleware(db), controller.Get)
+	r.POST("/orders/:order_id/confirm", middlewares.RequirePermission(db), orderMiddleware(db), controller.Confirm)
+	r.GET("/orders/:order_id/invoice", middlewares.RequirePermission(db), orderMiddleware(db), controller.Invoice)
+	r.GET("/orders/:order_id/refunds", middlewares.RequirePermission(db), orderMiddleware(db), controller.ListRefunds)
+	r.POST("/orders/:order_id/refunds", middlewares.RequirePermission(db), orderMiddleware(db), controller.RequestRefund)
+	r.GET("/orders/:order_id/refunds/:refund_id/credit-note", middlewares.RequirePermission(db), orderMiddleware(db), refundMiddleware(db), controller.CreditNote)
+
+	// Gateways authenticate webhooks by signing them
+	r.POST("/webhooks/payments/:gateway", controller.Webhook)
+
+	admin := middlewares.RequirePermission(db, rbac.PaymentManage)
+
+	r.GET("/admin/webhooks", admin, controller.ListWebhooks)
+	r.GET("/admin/webhooks/:id", admin, controller.GetWebhook)
+	r.POST("/admin/webhooks/:id/replay", admin, controller.ReplayWebhook)
+
+	r.GET("/admin/orders/:order_id/invoice", admin, adminOrderMiddleware(db), controller.Invoice)
+	r.POST("/admin/orders/:order_id/refunds", admin, adminOrderMiddleware(db), controller.CreateRefund)
+	r.GET("/admin/refunds", admin, controller.ListAllRefunds)
+	r.POST("/admin/refunds/:refund_id/approve", admin, refundMiddleware(db), controller.ApproveRefund)
+	r.POST("/admin/refunds/:refund_id/reject", admin, refundMiddleware(db), controller.RejectRefund)
+	r.POST("/admin/refunds/:refund_id/retry", admin, refundMiddleware(db), controller.RetryRefund)
+	r.GET("/admin/refunds/:refund_id/credit-note", admin, refundMiddleware(db), controller.CreditNote)
+
+	coupons := middlewares.RequirePermission(db, rbac.CouponManage)
+
+	r.POST("/admin/coupons", coupons, controller.CreateCoupon)
+	r.GET("/admin/coupons", coupons, controller.ListCoupons)
+	r.GET("/admin/coupons/:coupon_id", coupons, couponMiddleware(db), controller.GetCoupon)
+	r.PATCH("/admin/coupons/:coupon_id", coupons, couponMiddleware(db), controller.UpdateCoupon)
+	r.GET("/admin/coupons/:coupon_id/redemptions", coupons, couponMiddleware(db), controller.ListCouponRedemptions)
+}
+
+// orderMiddleware loads the order, which only its buyer can see
+func orderMiddleware(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		order, err := db.GetOrder(c, c.Param("order_id"))
+		if err != nil || order.UserID != c.MustGet("user_id").(int) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			c.Abort()
+			return
+		}
+
+		c.Set("order", order)
+	}
+}
+
+// adminOrderMiddleware loads any order
+func adminOrderMiddleware(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		order, err := db.GetOrder(c, c.Param("order_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			c.Abort()
+			return
+		}
+
+		c.Set("order", order)
+	}
+}
+
+// refundMiddleware loads the refund, which has to belong to the order when
+// the route is under one
+func refundMiddleware(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		refund, err := db.GetRefund(c, c.Param("refund_id"))
+		order, underOrder := c.Get("order")
+		if err != nil || (underOrder && refund.OrderID != order.(models.Order).ID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Refund not found"})
+			c.Abort()
+			return
+		}
+
+		c.Set("refund", refund)
+	}
+}
+
+// couponMiddleware loads the coupon
+func couponMiddleware(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("coupon_id"), 10, 64)
+		var coupon models.Coupon
+		if err == nil {
+			coupon, err = db.GetCoupon(c, id)
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+			c.Abort()
+			return
+		}
+
+		c.Set("coupon", coupon)
+	}
+}
@@ -0,0 +1,114 @@
+package users
+
+import (
+	userController "fintech/controllers/users"
+	"fintech/middlewares"
+	"fintech/pkg/messaging"
+	"fintech/pkg/otp"
+	"fintech/pkg/phone"
+	"fintech/pkg/ratelimit"
+	"fintech/pkg/rbac"
+	"fintech/pkg/storage"
+	"fintech/store"
+	"fintech/store/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func UserRoutes(r *gin.Engine, db store.Store, sender messaging.OTPSender, otpConfig otp.Config, blobs storage.Storage, limiter ratelimit.Limiter) {
+	controller := userController.Controller{Store: db, Sender: sender, Storage: blobs, OTP: otpConfig, Phone: phone.ParserFromEnv()}
+
+	// Changing the email sends a verification code to it
+	profile := middlewares.RateLimit(limiter, ratelimit.PolicyFromEnv(ratelimit.Policy{Name: "profile", Limit: 20, Period: time.Hour}), middlewares.RateByUser)
+	// Email verification codes are short, so guessing is slowed down on top
+	// of the lockout
+	verifyEmail := middlewares.RateLimit(limiter, ratelimit.PolicyFromEnv(ratelimit.Policy{Name: "verify_email", Limit: 10, Period: 10 * time.Minute}), middlewares.RateByUser)
+	upload := middlewares.RateLimit(limiter, ratelimit.PolicyFromEnv(ratelimit.Policy{Name: "upload", Limit: 30, Period: time.Hour}), middlewares.RateByUser)
+
+	r.GET("/me", middlewares.RequirePermission(db), controller.Me)
+	r.PATCH("/me", middlewares.RequirePermission(db), profile, controller.UpdateMe)
+	r.POST("/me/email/verify", middlewares.RequirePermission(db), verifyEmail, controller.VerifyEmail)
+	r.POST("/me/avatar", middlewares.RequirePermission(db), upload, controller.UploadAvatar)
+	r.GET("/me/billing", middlewares.RequirePermission(db), controller.GetBilling)
+	r.PUT("/me/billing", middlewares.RequirePermission(db), profile, controller.SaveBilling)
+	r.DELETE("/me", middlewares.RequirePermission(db), controller.DeleteMe)
+	r.POST("/me/deletion/cancel", middlewares.RequirePermission(db), controller.CancelDeletion)
+	r.POST("/me/export", middlewares.RequirePermission(db), controller.RequestExport)
+	r.GET("/me/export", middlewares.RequirePermission(db), controller.ListExports)
+	r.GET("/me/export/:export_id", middlewares.RequirePermission(db), controller.GetExport)
+	r.GET("/me/export/:export_id/download", middlewares.RequirePermission(db), controller.DownloadExport)
+	r.GET("/users/:id", middlewares.RequirePermission(db), profileIDMiddleware, controller.Profile)
+	// Avatars are loaded by <img> tags, which can't send an Authorization header
+	r.GET("/users/:id/avatar", profileIDMiddleware, controller.Avatar)
+
+	admin := middlewares.RequirePermission(db, rbac.UserManage)
+
+	r.GET("/admin/users", admin, controller.List)
+	r.POST("/admin/users/:id/roles", admin, userMiddleware(db), controller.GrantRole)
+	r.DELETE("/admin/users/:id/roles/:role", admin, userMiddleware(db), controller.RevokeRole)
+	r.DELETE("/admin/users/:id/mfa", admin, userMiddleware(db), controller.ResetMFA)
+	r.PUT("/admin/users/:id/max-devices", admin, userMiddleware(db), controller.SetMaxDevices)
+
+	r.GET("/admin/service-accounts", admin, controller.ListServiceAccounts)
+	r.POST("/admin/service-accounts", admin, controller.CreateServiceAccount)
+	r.GET("/admin/service-accounts/:id/keys", admin, serviceAccountMiddleware(db), controller.ListAPIKeys)
+	r.POST("/admin/service-accounts/:id/keys", admin, serviceAccountMiddleware(db), controller.CreateAPIKey)
+	r.DELETE("/admin/service-accounts/:id/keys/:key_id", admin, serviceAccountMiddleware(db), controller.RevokeAPIKey)
+
+	r.GET("/admin/roles", admin, controller.ListRoles)
+	r.POST("/admin/roles", admin, controller.CreateRole)
+	r.PUT("/admin/roles/:role/permissions", admin, controller.SetRolePermissions)
+	r.PUT("/admin/roles/:role/mfa", admin, controller.SetRoleMFA)
+	r.GET("/admin/permissions", admin, controller.ListPermissions)
+}
+
+func profileIDMiddleware(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Abort()
+		return
+	}
+
+	c.Set("profile_id", userID)
+}
+
+func userMiddleware(db store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+
+		user, err := db.GetUser(c, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user", user)
+	}
+}
+
+// serviceAccountMiddleware loads the user like userMiddleware, but only
+// accepts service accounts
+func serviceAccountMiddleware(db store.Store) gin.HandlerFunc {
+	load := userMiddleware(db)
+	return func(c *gin.Context) {
+		load(c)
+		if c.IsAborted() {
+			return
+		}
+
+		if c.MustGet("user").(models.User).Kind != models.UserKindService {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+			c.Abort()
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// APIKey lets a service account authenticate without a phone number
+type APIKey struct {
+	ID         int        `db:"id" json:"id"`                     // Unique identifier for the key
+	UserID     int        `db:"user_id" json:"user_id"`           // Service account the key acts as
+	Name       string     `db:"name" json:"name"`                 // What the key is used for
+	Prefix     string     `db:"prefix" json:"prefix"`             // Public part of the key used to look it up
+	KeyHash    string     `db:"key_hash" json:"-"`                // SHA-256 of the whole key
+	Scopes     []string   `db:"-" json:"scopes"`                  // Permissions the key is limited to
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at"`     // Key can't be used after this, nil for never
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at"` // Roughly when the key was last used
+	LastUsedIP string     `db:"last_used_ip" json:"last_used_ip"` // Address the key was last used from
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at"`     // Set once the key was revoked
+	CreatedBy  *int       `db:"created_by" json:"created_by"`     // Admin who created the key
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`     // Timestamp of key creation
+}
+
+// Active reports whether the key can still be used
+func (k APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
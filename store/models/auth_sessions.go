@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// AuthSession is a login on one device, kept alive by rotating refresh tokens
+type AuthSession struct {
+	ID             string     `db:"id"`              // CHAR(36) UUID, carried as the "sid" claim
+	UserID         int        `db:"user_id"`         // User the session belongs to
+	ImpersonatorID *int       `db:"impersonator_id"` // Admin acting as the user, for impersonation sessions
+	UserAgent      string     `db:"user_agent"`      // User agent of the device that logged in
+	IP             string     `db:"ip"`              // IP address the session was last used from
+	LastSeenAt     *time.Time `db:"last_seen_at"`    // When the session was last used, to the minute
+	ExpiresAt      time.Time  `db:"expires_at"`      // Session ends unless refreshed before this
+	RevokedAt      *time.Time `db:"revoked_at"`      // Set once the session is logged out or revoked
+	RevokedReason  string     `db:"revoked_reason"`  // Why the session was revoked
+	CreatedAt      time.Time  `db:"created_at"`      // Timestamp of the login
+	UpdatedAt      time.Time  `db:"updated_at"`      // Timestamp of the last refresh
+}
+
+// Active reports whether the session can still be used
+func (s AuthSession) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RefreshToken is one link in a session's chain of rotating refresh tokens
+type RefreshToken struct {
+	ID        int        `db:"id"`         // Unique identifier for the token
+	SessionID string     `db:"session_id"` // Session the token belongs to
+	TokenHash string     `db:"token_hash"` // SHA-256 of the token handed to the client
+	ExpiresAt time.Time  `db:"expires_at"` // Token can't be used after this
+	UsedAt    *time.Time `db:"used_at"`    // Set when the token was exchanged for a new one
+	CreatedAt time.Time  `db:"created_at"` // Timestamp the token was issued
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// CouponPercent takes a share of the course's price off
+	CouponPercent = "percent"
+	// CouponFixed takes a fixed amount off
+	CouponFixed = "fixed"
+)
+
+// ErrCouponLimitReached is returned when a coupon ran out of redemptions,
+// overall or for the buyer, while an order using it was being placed
+var ErrCouponLimitReached = errors.New("coupon redemption limit reached")
+
+// Coupon is a discount code buyers enter at checkout
+type Coupon struct {
+	ID             int64      `db:"id" json:"id"`                           // Unique identifier
+	Code           string     `db:"code" json:"code"`                       // Upper case code buyers enter
+	Description    string     `db:"description" json:"description"`         // Shown to buyers
+	Kind           string     `db:"kind" json:"kind"`                       // CouponPercent or CouponFixed
+	PercentBps     int        `db:"percent_bps" json:"percent_bps"`         // Discount in basis points, for percent coupons
+	AmountMinor    int64      `db:"amount_minor" json:"amount_minor"`       // Discount in the currency's minor unit, for fixed coupons
+	Currency       string     `db:"currency" json:"currency"`               // Currency of the amounts, empty if the coupon has none
+	MinOrderMinor  int64      `db:"min_order_minor" json:"min_order_minor"` // Smallest course price it applies to, 0 for any
+	CourseID       *string    `db:"course_id" json:"course_id"`             // Only course it applies to, nil for any
+	Category       string     `db:"category" json:"category"`               // Only category it applies to, empty for any
+	MaxRedemptions *int       `db:"max_redemptions" json:"max_redemptions"` // Redemptions across all buyers, nil for unlimited
+	PerUserLimit   *int       `db:"per_user_limit" json:"per_user_limit"`   // Redemptions per buyer, nil for unlimited
+	Stackable      bool       `db:"stackable" json:"stackable"`             // Whether it combines with other stackable coupons
+	StartsAt       time.Time  `db:"starts_at" json:"starts_at"`             // Start of the validity window
+	EndsAt         *time.Time `db:"ends_at" json:"ends_at"`                 // End of the validity window, nil for open ended
+	DisabledAt     *time.Time `db:"disabled_at" json:"disabled_at"`         // Set when an admin switched it off
+	CreatedBy      int        `db:"created_by" json:"created_by"`           // Admin who created it
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`           // Timestamp of creation
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`           // Timestamp of the last change
+}
+
+// CouponRedemption is a coupon used on an order
+type CouponRedemption struct {
+	ID            int64     `db:"id" json:"id"`                         // Unique identifier
+	CouponID      int64     `db:"coupon_id" json:"coupon_id"`           // Coupon used
+	OrderID       string    `db:"order_id" json:"order_id"`             // Order it was used on
+	UserID        int       `db:"user_id" json:"user_id"`               // Buyer
+	DiscountMinor int64     `db:"discount_minor" json:"discount_minor"` // What it took off the order
+	Currency      string    `db:"currency" json:"currency"`             // ISO 4217 code of the order
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`         // Timestamp the order was placed
+}
+
+// CouponUsage is how many redemptions hold a coupon
+type CouponUsage struct {
+	Total  int `db:"total" json:"total"`     // Across all buyers
+	ByUser int `db:"by_user" json:"by_user"` // By one buyer
+}
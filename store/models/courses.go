@@ -12,6 +12,9 @@ type Course struct {
 	Description string    `db:"description"` // VARCHAR(300), nullable, use sql.NullString
 	AuthorID    int       `db:"author_id"`   // INT, non-nullable
 	FolderID    string    `db:"folder_id"`
-	CreatedAt   time.Time `db:"created_at"` // DATETIME(6), default CURRENT_TIMESTAMP(6)
-	UpdatedAt   time.Time `db:"updated_at"` // DATETIME(6), auto-updated with CURRENT_TIMESTAMP(6)
+	PriceMinor  int64     `db:"price_minor"` // BIGINT, price in the currency's minor unit, 0 for free courses
+	Currency    string    `db:"currency"`    // CHAR(3), ISO 4217 code
+	Category    string    `db:"category"`    // VARCHAR(50), empty for uncategorized courses
+	CreatedAt   time.Time `db:"created_at"`  // DATETIME(6), default CURRENT_TIMESTAMP(6)
+	UpdatedAt   time.Time `db:"updated_at"`  // DATETIME(6), auto-updated with CURRENT_TIMESTAMP(6)
 }
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	EnrollmentActive    = "active"
+	EnrollmentCancelled = "cancelled"
+
+	EnrollmentSourceSelf     = "self"
+	EnrollmentSourceAdmin    = "admin"
+	EnrollmentSourcePurchase = "purchase"
+)
+
+// Enrollment gives a learner access to a course's content and chat
+type Enrollment struct {
+	UserID     int        `db:"user_id" json:"user_id"`         // Enrolled learner
+	CourseID   string     `db:"course_id" json:"course_id"`     // CHAR(36) UUID of the course
+	Status     string     `db:"status" json:"status"`           // 'active' or 'cancelled'
+	Source     string     `db:"source" json:"source"`           // 'self', 'admin' or 'purchase'
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at"`   // Access ends at this time, if set
+	EnrolledBy *int       `db:"enrolled_by" json:"enrolled_by"` // Admin who enrolled the learner, if any
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`   // Timestamp of the first enrollment
+	UpdatedAt  time.Time  `db:"updated_at" json:"updated_at"`   // Timestamp of the last change
+}
+
+// Active reports whether the enrollment currently gives access
+func (e Enrollment) Active() bool {
+	return e.Status == EnrollmentActive && (e.ExpiresAt == nil || time.Now().Before(*e.ExpiresAt))
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport is an archive of everything stored about a user, built in the
+// background on request
+type DataExport struct {
+	ID          string     `db:"id" json:"id"`                     // CHAR(36) UUID
+	UserID      int        `db:"user_id" json:"-"`                 // User the data belongs to
+	Status      string     `db:"status" json:"status"`             // ExportPending, ExportReady or ExportFailed
+	StorageKey  string     `db:"storage_key" json:"-"`             // Storage key of the archive once ready
+	Error       string     `db:"error" json:"error,omitempty"`     // Why the export failed
+	ExpiresAt   *time.Time `db:"expires_at" json:"expires_at"`     // Archive is deleted after this
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`     // Timestamp of the request
+	CompletedAt *time.Time `db:"completed_at" json:"completed_at"` // When the archive was built or failed
+}
+
+// Downloadable reports whether the archive can still be downloaded
+func (e DataExport) Downloadable() bool {
+	return e.Status == ExportReady && e.ExpiresAt != nil && time.Now().Before(*e.ExpiresAt)
+}
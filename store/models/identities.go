@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to their account at an external identity provider
+type UserIdentity struct {
+	ID          int        `db:"id" json:"id"`                       // Unique identifier for the link
+	UserID      int        `db:"user_id" json:"-"`                   // User the identity logs in as
+	Provider    string     `db:"provider" json:"provider"`           // Name of the configured provider
+	Subject     string     `db:"subject" json:"subject"`             // The provider's stable user ID ("sub")
+	Email       string     `db:"email" json:"email"`                 // Email the provider reported, for display
+	LastLoginAt *time.Time `db:"last_login_at" json:"last_login_at"` // Last login through this identity
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`       // Timestamp the identity was linked
+}
+
+// OIDCState tracks a login started with an identity provider until it
+// redirects back
+type OIDCState struct {
+	StateHash    string    `db:"state_hash"`    // SHA-256 of the state parameter
+	Provider     string    `db:"provider"`      // Provider the login was started with
+	CodeVerifier string    `db:"code_verifier"` // PKCE verifier for the code exchange
+	Nonce        string    `db:"nonce"`         // Nonce the ID token must carry
+	LinkUserID   *int      `db:"link_user_id"`  // Set when linking an identity to a logged in user
+	ExpiresAt    time.Time `db:"expires_at"`    // Login must complete before this
+	CreatedAt    time.Time `db:"created_at"`    // Timestamp the login was started
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	InstructorOwner        = "owner"
+	InstructorCoInstructor = "co_instructor"
+	InstructorTA           = "teaching_assistant"
+
+	InstructorInvited = "invited"
+	InstructorActive  = "active"
+)
+
+// CourseInstructor links a user to a course they help teach
+type CourseInstructor struct {
+	CourseID  string    `db:"course_id" json:"course_id"`   // CHAR(36) UUID of the course
+	UserID    int       `db:"user_id" json:"user_id"`       // Instructor's user ID
+	Level     string    `db:"level" json:"level"`           // 'owner', 'co_instructor' or 'teaching_assistant'
+	Status    string    `db:"status" json:"status"`         // 'invited' until the user accepts, then 'active'
+	InvitedBy *int      `db:"invited_by" json:"invited_by"` // User who sent the invitation
+	CreatedAt time.Time `db:"created_at" json:"created_at"` // Timestamp of the invitation
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"` // Timestamp of the last change
+}
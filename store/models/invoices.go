@@ -0,0 +1,69 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// IST is Indian Standard Time, which GST documents are dated in
+var IST = time.FixedZone("IST", 5*60*60+30*60)
+
+// FinancialYear returns the Indian financial year, April to March, that t
+// falls in, e.g. "26-27"
+func FinancialYear(t time.Time) string {
+	t = t.In(IST)
+	year := t.Year()
+	if t.Month() < time.April {
+		year--
+	}
+	return fmt.Sprintf("%02d-%02d", year%100, (year+1)%100)
+}
+
+// GSTAmounts splits an amount that includes GST into its taxable value and
+// the tax on it. Supplies within the supplier's state pay CGST and SGST,
+// those to other states and countries IGST.
+type GSTAmounts struct {
+	TaxableMinor int64 `db:"taxable_minor" json:"taxable_minor"` // Value before tax
+	CGSTMinor    int64 `db:"cgst_minor" json:"cgst_minor"`       // Central tax
+	SGSTMinor    int64 `db:"sgst_minor" json:"sgst_minor"`       // State tax
+	IGSTMinor    int64 `db:"igst_minor" json:"igst_minor"`       // Integrated tax
+}
+
+// Tax returns the total tax
+func (a GSTAmounts) Tax() int64 {
+	return a.CGSTMinor + a.SGSTMinor + a.IGSTMinor
+}
+
+// BillingProfile is what a buyer wants printed on their invoices. Buyers
+// registered for GST give their GSTIN to claim input tax credit.
+type BillingProfile struct {
+	UserID    int       `db:"user_id" json:"user_id"`       // Buyer
+	LegalName string    `db:"legal_name" json:"legal_name"` // Name to bill, the account name if empty
+	GSTIN     string    `db:"gstin" json:"gstin"`           // GST identification number, empty for consumers
+	Address   string    `db:"address" json:"address"`       // Billing address
+	StateCode string    `db:"state_code" json:"state_code"` // Two digit GST state code of the address
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"` // Timestamp of the last change
+}
+
+// Invoice is the tax invoice issued for a paid order. The buyer's details
+// are copied from their billing profile when it's issued.
+type Invoice struct {
+	ID             int64     `db:"id" json:"id"`                             // Unique identifier
+	Number         string    `db:"number" json:"number"`                     // Sequential within the financial year, e.g. INV/26-27/000001
+	FinancialYear  string    `db:"financial_year" json:"financial_year"`     // April to March, e.g. 26-27
+	OrderID        string    `db:"order_id" json:"order_id"`                 // Order invoiced
+	UserID         int       `db:"user_id" json:"user_id"`                   // Buyer
+	TotalMinor     int64     `db:"total_minor" json:"total_minor"`           // Amount paid, including tax
+	Currency       string    `db:"currency" json:"currency"`                 // ISO 4217 code of the order
+	RateBps        int       `db:"rate_bps" json:"rate_bps"`                 // GST rate in basis points, 0 when no GST is charged
+	SAC            string    `db:"sac" json:"sac"`                           // Services accounting code of the course
+	PlaceOfSupply  string    `db:"place_of_supply" json:"place_of_supply"`   // GST state code, 96 for supplies abroad
+	SupplierGSTIN  string    `db:"supplier_gstin" json:"supplier_gstin"`     // Platform's GSTIN when it was issued
+	BuyerName      string    `db:"buyer_name" json:"buyer_name"`             // Name billed
+	BuyerGSTIN     string    `db:"buyer_gstin" json:"buyer_gstin"`           // Buyer's GSTIN, empty for consumers
+	BuyerAddress   string    `db:"buyer_address" json:"buyer_address"`       // Billing address
+	BuyerStateCode string    `db:"buyer_state_code" json:"buyer_state_code"` // GST state code of the address
+	StorageKey     string    `db:"storage_key" json:"-"`                     // PDF in storage, empty until it's rendered
+	IssuedAt       time.Time `db:"issued_at" json:"issued_at"`               // Timestamp of issue
+	GSTAmounts
+}
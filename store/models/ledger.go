@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+const (
+	JournalPayment            = "payment"
+	JournalRefund             = "refund"
+	JournalPayout             = "payout"
+	JournalPayoutSettlement   = "payout_settlement"
+	JournalPayoutCancellation = "payout_cancellation"
+)
+
+// JournalEntry is one balanced movement of money between ledger accounts.
+// Entries are never changed; mistakes are corrected by posting another entry.
+type JournalEntry struct {
+	ID          int64         `db:"id" json:"id"`                     // Unique identifier
+	Kind        string        `db:"kind" json:"kind"`                 // What moved the money, e.g. JournalPayment
+	Reference   string        `db:"reference" json:"reference"`       // ID of the order, refund or other record behind it
+	Memo        string        `db:"memo" json:"memo"`                 // Human readable description
+	EffectiveAt time.Time     `db:"effective_at" json:"effective_at"` // When the money moved, which balances are taken as of
+	CreatedAt   time.Time     `db:"created_at" json:"created_at"`     // Timestamp the entry was posted
+	Lines       []JournalLine `db:"-" json:"lines"`                   // Legs of the entry, summing to zero per currency
+}
+
+// JournalLine is one leg of a journal entry. Debits are positive and credits
+// negative.
+type JournalLine struct {
+	ID          int64  `db:"id" json:"id"`                     // Unique identifier
+	EntryID     int64  `db:"entry_id" json:"entry_id"`         // Entry the leg belongs to
+	Account     string `db:"account" json:"account"`           // Ledger account code
+	AmountMinor int64  `db:"amount_minor" json:"amount_minor"` // Signed amount in the currency's minor unit
+	Currency    string `db:"currency" json:"currency"`         // ISO 4217 code
+}
+
+// StatementLine is a journal line along with the entry it belongs to
+type StatementLine struct {
+	JournalLine
+	Kind        string    `db:"kind" json:"kind"`
+	Reference   string    `db:"reference" json:"reference"`
+	Memo        string    `db:"memo" json:"memo"`
+	EffectiveAt time.Time `db:"effective_at" json:"effective_at"`
+}
+
+// AccountBalance is the sum of an account's lines in one currency, debits
+// minus credits
+type AccountBalance struct {
+	Account     string `db:"account" json:"account"`
+	Currency    string `db:"currency" json:"currency"`
+	AmountMinor int64  `db:"amount_minor" json:"amount_minor"`
+}
+
+// LedgerFilter narrows down journal lines. Both ends of the time range are
+// inclusive and optional.
+type LedgerFilter struct {
+	Account string
+	// AccountPrefix matches accounts starting with it, such as "liabilities:"
+	AccountPrefix string
+	From          *time.Time
+	To            *time.Time
+	Limit         int
+	Offset        int
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// UserMFA is a user's authenticator app enrollment
+type UserMFA struct {
+	UserID       int        `db:"user_id"`        // User the authenticator belongs to
+	TOTPSecret   string     `db:"totp_secret"`    // Encrypted base32 TOTP secret
+	ConfirmedAt  *time.Time `db:"confirmed_at"`   // Set once a code from the app was accepted
+	LastUsedStep int64      `db:"last_used_step"` // Last accepted time step, so codes can't be replayed
+	CreatedAt    time.Time  `db:"created_at"`     // Timestamp enrollment started
+	UpdatedAt    time.Time  `db:"updated_at"`     // Timestamp of the last change
+}
+
+// Enrolled reports whether the authenticator has been confirmed
+func (m UserMFA) Enrolled() bool {
+	return m.ConfirmedAt != nil
+}
+
+// MFAChallenge is handed out by /verify when a second factor is still needed
+type MFAChallenge struct {
+	TokenHash string     `db:"token_hash"` // SHA-256 of the challenge token
+	UserID    int        `db:"user_id"`    // User that passed the first factor
+	ExpiresAt time.Time  `db:"expires_at"` // Challenge can't be used after this
+	UsedAt    *time.Time `db:"used_at"`    // Set once the challenge was completed
+	CreatedAt time.Time  `db:"created_at"` // Timestamp the challenge was issued
+}
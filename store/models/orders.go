@@ -0,0 +1,62 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderFulfilled = "fulfilled"
+	OrderRefunded  = "refunded"
+	OrderFailed    = "failed"
+)
+
+// orderTransitions lists the states an order may move to from each state. A
+// failed payment can still be followed by a successful one on the same
+// gateway order. Payments that can't be accepted, because a coupon ran out
+// meanwhile, are refunded without the order ever being paid.
+var orderTransitions = map[string][]string{
+	OrderPending:   {OrderPaid, OrderFailed, OrderRefunded},
+	OrderFailed:    {OrderPaid, OrderRefunded},
+	OrderPaid:      {OrderFulfilled, OrderRefunded},
+	OrderFulfilled: {OrderRefunded},
+}
+
+// Order is a purchase of a course through a payment gateway
+type Order struct {
+	ID               string     `db:"id" json:"id"`                                 // CHAR(36) UUID, also the receipt sent to the gateway
+	UserID           int        `db:"user_id" json:"user_id"`                       // Buyer
+	CourseID         string     `db:"course_id" json:"course_id"`                   // Course bought
+	AmountMinor      int64      `db:"amount_minor" json:"amount_minor"`             // Amount charged in the currency's minor unit
+	DiscountMinor    int64      `db:"discount_minor" json:"discount_minor"`         // Taken off the course's price by coupons
+	RefundedMinor    int64      `db:"refunded_minor" json:"refunded_minor"`         // Amount refunded so far
+	Currency         string     `db:"currency" json:"currency"`                     // ISO 4217 code
+	Status           string     `db:"status" json:"status"`                         // See orderTransitions
+	Gateway          string     `db:"gateway" json:"gateway"`                       // Gateway the order was placed on
+	GatewayOrderID   string     `db:"gateway_order_id" json:"gateway_order_id"`     // Gateway's ID for the order
+	GatewayPaymentID string     `db:"gateway_payment_id" json:"gateway_payment_id"` // Gateway's ID for the captured payment
+	PaidAt           *time.Time `db:"paid_at" json:"paid_at"`                       // Timestamp the payment was verified
+	FulfilledAt      *time.Time `db:"fulfilled_at" json:"fulfilled_at"`             // Timestamp the enrollment was created
+	RefundedAt       *time.Time `db:"refunded_at" json:"refunded_at"`               // Timestamp the payment was fully refunded
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"`                 // Timestamp of the order
+	UpdatedAt        time.Time  `db:"updated_at" json:"updated_at"`                 // Timestamp of the last change
+}
+
+// CanTransition reports whether the order may move to the given state
+func (o Order) CanTransition(to string) bool {
+	return slices.Contains(orderTransitions[o.Status], to)
+}
+
+// OrderStatesBefore returns the states an order may move to the given state from
+func OrderStatesBefore(to string) []string {
+	var from []string
+	for state, next := range orderTransitions {
+		if slices.Contains(next, to) {
+			from = append(from, state)
+		}
+	}
+	slices.Sort(from)
+	return from
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// OTPDelivery records one attempt to deliver an OTP through a provider
+type OTPDelivery struct {
+	ID                int       `db:"id"`                  // Unique identifier for the attempt
+	PhoneNumber       string    `db:"phone_number"`        // Phone number the OTP was requested for
+	Channel           string    `db:"channel"`             // Channel used ('whatsapp', 'sms', 'email')
+	Provider          string    `db:"provider"`            // Provider that handled the attempt
+	ProviderMessageID string    `db:"provider_message_id"` // Message ID assigned by the provider
+	Status            string    `db:"status"`              // Latest delivery status reported
+	Error             string    `db:"error"`               // Provider error, if the attempt failed
+	CreatedAt         time.Time `db:"created_at"`          // Timestamp of the attempt
+	UpdatedAt         time.Time `db:"updated_at"`          // Timestamp of the last status change
+}
+
+// OTPAttempt counts consecutive failed verifications for a phone number or IP
+type OTPAttempt struct {
+	Scope       string     `db:"scope"`        // What the subject is ('phone', 'ip', 'mfa' or 'email')
+	Subject     string     `db:"subject"`      // Phone number, IP address or user ID
+	Failures    int        `db:"failures"`     // Consecutive failed attempts
+	LockedUntil *time.Time `db:"locked_until"` // End of the current lockout, if any
+	UpdatedAt   time.Time  `db:"updated_at"`   // Timestamp of the last failure
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	PayoutPendingApproval = "pending_approval"
+	PayoutApproved        = "approved"
+	PayoutSettled         = "settled"
+	PayoutCancelled       = "cancelled"
+)
+
+const (
+	// PayoutNEFT pays INR to Indian bank accounts
+	PayoutNEFT = "neft"
+	// PayoutACH pays USD to US bank accounts
+	PayoutACH = "ach"
+)
+
+// ErrPayoutExceedsBalance is returned when an instructor's balance dropped
+// below a payout while it was being calculated
+var ErrPayoutExceedsBalance = errors.New("payout exceeds the instructor's balance")
+
+// RevenueShare is one instructor's share of a course's sales for a period
+type RevenueShare struct {
+	ID        int64      `db:"id" json:"id"`                 // Unique identifier
+	CourseID  string     `db:"course_id" json:"course_id"`   // CHAR(36) UUID of the course
+	UserID    int        `db:"user_id" json:"user_id"`       // Instructor paid the share
+	ShareBps  int        `db:"share_bps" json:"share_bps"`   // Share of each sale in basis points
+	StartsAt  time.Time  `db:"starts_at" json:"starts_at"`   // Sales from this time on are shared
+	EndsAt    *time.Time `db:"ends_at" json:"ends_at"`       // Set once a newer agreement replaces it
+	CreatedBy int        `db:"created_by" json:"created_by"` // Admin who set it
+	CreatedAt time.Time  `db:"created_at" json:"created_at"` // Timestamp of creation
+}
+
+// PayoutAccount is the bank account an instructor is paid out to
+type PayoutAccount struct {
+	UserID        int       `db:"user_id" json:"user_id"`               // Instructor
+	Method        string    `db:"method" json:"method"`                 // PayoutNEFT or PayoutACH
+	AccountHolder string    `db:"account_holder" json:"account_holder"` // Name on the account
+	AccountNumber string    `db:"account_number" json:"account_number"` // Account number
+	BankCode      string    `db:"bank_code" json:"bank_code"`           // IFSC for NEFT, routing number for ACH
+	BankName      string    `db:"bank_name" json:"bank_name"`           // Name of the bank
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`         // Timestamp of the last change
+}
+
+// Masked returns the account with all but the last four digits of its number
+// hidden
+func (a PayoutAccount) Masked() PayoutAccount {
+	if n := len(a.AccountNumber); n > 4 {
+		masked := make([]byte, n)
+		for i := range masked {
+			masked[i] = 'X'
+		}
+		copy(masked[n-4:], a.AccountNumber[n-4:])
+		a.AccountNumber = string(masked)
+	}
+	return a
+}
+
+// PayoutBatch is one payout run, paid out with a single bank transfer file
+// per payout method
+type PayoutBatch struct {
+	ID            string     `db:"id" json:"id"`                         // CHAR(36) UUID
+	Status        string     `db:"status" json:"status"`                 // 'pending_approval', 'approved', 'settled' or 'cancelled'
+	CutoffAt      time.Time  `db:"cutoff_at" json:"cutoff_at"`           // Earnings up to this time were paid out
+	CreatedBy     *int       `db:"created_by" json:"created_by"`         // Admin who ran it, nil for scheduled runs
+	ApprovedBy    *int       `db:"approved_by" json:"approved_by"`       // Admin who approved it
+	ApprovedAt    *time.Time `db:"approved_at" json:"approved_at"`       // Timestamp of approval
+	SettledBy     *int       `db:"settled_by" json:"settled_by"`         // Admin who marked it paid
+	SettledAt     *time.Time `db:"settled_at" json:"settled_at"`         // Timestamp the transfers went out
+	BankReference string     `db:"bank_reference" json:"bank_reference"` // Bank's reference for the transfers
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`         // Timestamp of the run
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`         // Timestamp of the last change
+	Payouts       []Payout   `db:"-" json:"payouts,omitempty"`           // Loaded for single batches
+}
+
+// Payout is the transfer to one instructor in a batch
+type Payout struct {
+	ID            string    `db:"id" json:"id"`                         // CHAR(36) UUID, also the transfer's reference
+	BatchID       string    `db:"batch_id" json:"batch_id"`             // Batch it's paid with
+	UserID        int       `db:"user_id" json:"user_id"`               // Instructor paid
+	AmountMinor   int64     `db:"amount_minor" json:"amount_minor"`     // Amount in the currency's minor unit
+	Currency      string    `db:"currency" json:"currency"`             // ISO 4217 code
+	Method        string    `db:"method" json:"method"`                 // PayoutNEFT or PayoutACH
+	AccountHolder string    `db:"account_holder" json:"account_holder"` // Copied from the payout account
+	AccountNumber string    `db:"account_number" json:"account_number"` // Copied from the payout account
+	BankCode      string    `db:"bank_code" json:"bank_code"`           // Copied from the payout account
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`         // Timestamp of calculation
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// VideoProgress is how far a learner got through one video of a course
+type VideoProgress struct {
+	UserID          int        `db:"user_id" json:"user_id"`                   // Learner
+	CourseID        string     `db:"course_id" json:"course_id"`               // CHAR(36) UUID of the course
+	VideoID         string     `db:"video_id" json:"video_id"`                 // VdoCipher video ID
+	FurthestSeconds int        `db:"furthest_seconds" json:"furthest_seconds"` // Furthest position reached
+	DurationSeconds int        `db:"duration_seconds" json:"duration_seconds"` // Length of the video
+	WatchedAt       *time.Time `db:"watched_at" json:"watched_at"`             // When the learner got through half of it
+	UpdatedAt       time.Time  `db:"updated_at" json:"updated_at"`             // Timestamp of the last report
+}
+
+// Watched reports whether the learner got far enough for the video to count
+// as watched
+func (p VideoProgress) Watched() bool {
+	return p.DurationSeconds > 0 && p.FurthestSeconds*2 >= p.DurationSeconds
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	RefundPendingApproval = "pending_approval"
+	RefundProcessing      = "processing"
+	RefundRefunded        = "refunded"
+	RefundRejected        = "rejected"
+	RefundFailed          = "failed"
+)
+
+// ErrRefundExceedsPayment is returned for refunds larger than what's left of
+// the payment after earlier and outstanding refunds
+var ErrRefundExceedsPayment = errors.New("refund exceeds the refundable amount")
+
+// Refund returns all or part of an order's payment
+type Refund struct {
+	ID              string     `db:"id" json:"id"`                               // CHAR(36) UUID
+	OrderID         string     `db:"order_id" json:"order_id"`                   // Order refunded
+	UserID          int        `db:"user_id" json:"user_id"`                     // Buyer
+	AmountMinor     int64      `db:"amount_minor" json:"amount_minor"`           // Amount in the currency's minor unit
+	Currency        string     `db:"currency" json:"currency"`                   // ISO 4217 code of the order
+	Reason          string     `db:"reason" json:"reason"`                       // Why the refund was asked for
+	Status          string     `db:"status" json:"status"`                       // 'pending_approval', 'processing', 'refunded', 'rejected' or 'failed'
+	WithinPolicy    bool       `db:"within_policy" json:"within_policy"`         // Whether the refund policy allowed it without approval
+	PolicyNotes     string     `db:"policy_notes" json:"policy_notes"`           // Which policy rules it broke
+	GatewayRefundID string     `db:"gateway_refund_id" json:"gateway_refund_id"` // Gateway's ID for the refund
+	Error           string     `db:"error" json:"error"`                         // Why the gateway refused it
+	RequestedBy     int        `db:"requested_by" json:"requested_by"`           // Buyer or admin who asked for it
+	ReviewedBy      *int       `db:"reviewed_by" json:"reviewed_by"`             // Admin who approved or rejected it
+	ReviewNote      string     `db:"review_note" json:"review_note"`             // Admin's reason for the decision
+	ReviewedAt      *time.Time `db:"reviewed_at" json:"reviewed_at"`             // Timestamp of the decision
+	CompletedAt     *time.Time `db:"completed_at" json:"completed_at"`           // Timestamp the gateway refunded it
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`               // Timestamp of the request
+	UpdatedAt       time.Time  `db:"updated_at" json:"updated_at"`               // Timestamp of the last change
+}
+
+// CreditNote documents a completed refund
+type CreditNote struct {
+	ID          int64     `db:"id" json:"id"`                     // Unique identifier
+	Number      string    `db:"number" json:"number"`             // Sequential within the financial year, e.g. CN/26-27/000001; CN-000001 before invoicing
+	InvoiceID   *int64    `db:"invoice_id" json:"invoice_id"`     // Invoice it amends, nil for orders paid before invoicing
+	RefundID    string    `db:"refund_id" json:"refund_id"`       // Refund documented
+	OrderID     string    `db:"order_id" json:"order_id"`         // Order the refund belongs to
+	UserID      int       `db:"user_id" json:"user_id"`           // Buyer
+	AmountMinor int64     `db:"amount_minor" json:"amount_minor"` // Amount credited in the currency's minor unit
+	Currency    string    `db:"currency" json:"currency"`         // ISO 4217 code
+	StorageKey  string    `db:"storage_key" json:"-"`             // Document in storage, empty until it's rendered
+	IssuedAt    time.Time `db:"issued_at" json:"issued_at"`       // Timestamp of issue
+	GSTAmounts
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	RoleStudent           = "student"
+	RoleTeachingAssistant = "teaching_assistant"
+	RoleInstructor        = "instructor"
+	RoleAdmin             = "admin"
+)
+
+// ErrLastAdmin is returned when revoking the role would leave no one able to
+// manage the platform
+var ErrLastAdmin = errors.New("cannot revoke the last admin")
+
+// ErrNoUserManager is returned when changing a role's permissions would leave
+// no one holding a role able to manage users
+var ErrNoUserManager = errors.New("no one would be able to manage users")
+
+// Role is a named set of permissions that can be granted to users
+type Role struct {
+	Name        string    `db:"name" json:"name"`                 // Unique role name, e.g. "admin"
+	Description string    `db:"description" json:"description"`   // Human readable description
+	Permissions []string  `db:"-" json:"permissions"`             // Permissions the role grants
+	MFARequired bool      `db:"mfa_required" json:"mfa_required"` // Holders must use a second factor to log in
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`     // Timestamp of role creation
+}
+
+// Permission is an action that can be attached to roles, e.g. "course:edit:own"
+type Permission struct {
+	Name        string `db:"name" json:"name"`               // Action name
+	Description string `db:"description" json:"description"` // Human readable description
+}
+
+// UserRole is a role held by a user, either platform-wide or for one course
+type UserRole struct {
+	UserID    int       `db:"user_id" json:"-"`             // User holding the role
+	Role      string    `db:"role" json:"role"`             // Name of the role
+	CourseID  string    `db:"course_id" json:"course_id"`   // Course the role is limited to, empty for platform-wide
+	GrantedBy *int      `db:"granted_by" json:"granted_by"` // Admin who granted the role
+	CreatedAt time.Time `db:"created_at" json:"created_at"` // Timestamp of the grant
+}
+
+// PermissionGrant is a permission a user holds through one of their roles
+type PermissionGrant struct {
+	Permission string `db:"permission"` // Permission name, possibly ending in ":own" or ":any"
+	CourseID   string `db:"course_id"`  // Course the grant is limited to, empty for platform-wide
+}
+
+// UserWithRoles is a user as listed in the admin API
+type UserWithRoles struct {
+	ID          int        `json:"id"`
+	Kind        string     `json:"kind"`
+	Name        string     `json:"name"`
+	PhoneNumber *string    `json:"phone_number"`
+	Roles       []UserRole `json:"roles"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// UserFilter narrows down the users returned by ListUsers
+type UserFilter struct {
+	Kind        string
+	Role        string
+	PhoneNumber string
+	Limit       int
+	Offset      int
+}
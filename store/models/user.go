@@ -1,14 +1,71 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+const (
+	// UserKindHuman users log in with their phone number
+	UserKindHuman = "human"
+	// UserKindService users are service accounts that only authenticate
+	// with API keys
+	UserKindService = "service"
+)
+
+// ErrDeletionNotDue is returned when purging an account whose deletion was
+// cancelled, or isn't due yet
+var ErrDeletionNotDue = errors.New("account deletion isn't due")
+
+// ErrUserHasPayments is returned when merging users whose orders, refunds or
+// payouts would have to move, which changes invoices and the ledger
+var ErrUserHasPayments = errors.New("user has payments")
 
 // User represents the user model in the application
 type User struct {
-	ID          int       `db:"id"`           // Unique identifier for the user
-	PhoneNumber string    `db:"phone_number"` // User's phone number
-	OTP         string    `db:"otp_code"`     // One-time password for verification
-	OTPExpiry   time.Time `db:"otp_expiry"`   // Expiration time for the OTP
-	Role        string    `db:"role"`         // Role of the user (e.g., "user", "admin")
-	CreatedAt   time.Time `db:"created_at"`   // Timestamp of user creation
-	UpdatedAt   time.Time `db:"updated_at"`   // Timestamp of the last update
+	ID                  int        `db:"id"`                    // Unique identifier for the user
+	Kind                string     `db:"kind"`                  // UserKindHuman or UserKindService
+	PhoneNumber         *string    `db:"phone_number"`          // User's phone number, nil for service accounts
+	OTPHash             string     `db:"otp_hash"`              // Hash of the pending one-time password, empty once used
+	OTPExpiry           time.Time  `db:"otp_expiry"`            // Expiration time for the OTP
+	Name                string     `db:"name"`                  // Display name
+	Email               *string    `db:"email"`                 // Verified email address
+	EmailVerifiedAt     *time.Time `db:"email_verified_at"`     // When the email address was verified
+	PendingEmail        string     `db:"pending_email"`         // Email address awaiting verification
+	EmailCodeHash       string     `db:"email_code_hash"`       // Hash of the code sent to the pending email
+	EmailCodeExpiry     *time.Time `db:"email_code_expiry"`     // Expiration time for the email code
+	AvatarKey           string     `db:"avatar_key"`            // Storage key of the avatar image
+	Locale              string     `db:"locale"`                // Preferred locale, e.g. "en-IN"
+	MaxDevices          *int       `db:"max_devices"`           // Concurrent session limit, nil for the MAX_DEVICES default
+	DeletionScheduledAt *time.Time `db:"deletion_scheduled_at"` // When the account is deleted, if the user asked for it
+	DeletedAt           *time.Time `db:"deleted_at"`            // When the account's personal data was erased
+	CreatedAt           time.Time  `db:"created_at"`            // Timestamp of user creation
+	UpdatedAt           time.Time  `db:"updated_at"`            // Timestamp of the last update
+}
+
+// Phone returns the user's phone number, or empty for service accounts
+func (u User) Phone() string {
+	if u.PhoneNumber == nil {
+		return ""
+	}
+	return *u.PhoneNumber
+}
+
+// UserSummary is the compact, public view of a user embedded in other resources
+type UserSummary struct {
+	ID        int    `db:"id" json:"id"`
+	Name      string `db:"name" json:"name"`
+	AvatarURL string `db:"-" json:"avatar_url"`
+	AvatarKey string `db:"avatar_key" json:"-"`
+}
+
+// AvatarURL is where the avatar stored under key is served, or empty without one
+func AvatarURL(userID int, key string) string {
+	if key == "" {
+		return ""
+	}
+	// The key changes on every upload, so it doubles as a cache buster
+	return fmt.Sprintf("/users/%d/avatar?v=%s", userID, path.Base(key))
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	WebhookPending   = "pending"
+	WebhookProcessed = "processed"
+	WebhookIgnored   = "ignored"
+	WebhookFailed    = "failed"
+)
+
+// WebhookEvent is a payment gateway callback as it was received
+type WebhookEvent struct {
+	ID            int64      `db:"id" json:"id"`                           // Unique identifier for the event
+	Gateway       string     `db:"gateway" json:"gateway"`                 // Gateway that sent the event
+	EventID       string     `db:"event_id" json:"event_id"`               // Gateway's ID for the event, unique per gateway
+	EventType     string     `db:"event_type" json:"event_type"`           // Gateway's event type, e.g. "payment.captured"
+	Payload       string     `db:"payload" json:"payload,omitempty"`       // Raw request body
+	Status        string     `db:"status" json:"status"`                   // 'pending' until applied, or 'failed' after the last retry
+	Attempts      int        `db:"attempts" json:"attempts"`               // Number of failed attempts to apply it
+	LastError     string     `db:"last_error" json:"last_error"`           // Why the last attempt failed
+	NextAttemptAt *time.Time `db:"next_attempt_at" json:"next_attempt_at"` // When a pending event is due to be applied
+	ReceivedAt    time.Time  `db:"received_at" json:"received_at"`         // Timestamp of the first delivery
+	ProcessedAt   *time.Time `db:"processed_at" json:"processed_at"`       // Timestamp it was applied or ignored
+}
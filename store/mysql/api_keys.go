@@ -0,0 +1,168 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/store/models"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateServiceAccount inserts a service account holding the given roles.
+// The event's TargetID is set to the new account's ID.
+func (m *MySQLStore) CreateServiceAccount(context context.Context, name string, roles []string, grantedBy int, event models.AuditEvent) (int, error) {
+	var userID int64
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(context, "INSERT INTO users (kind, name) VALUES (?, ?)",
+			models.UserKindService, name)
+		if err != nil {
+			return err
+		}
+
+		userID, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		event.TargetID = strconv.FormatInt(userID, 10)
+
+		for _, role := range roles {
+			_, err = tx.ExecContext(context, "INSERT INTO user_roles (user_id, role, granted_by) VALUES (?, ?, ?)",
+				userID, role, grantedBy)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return int(userID), err
+}
+
+// CreateAPIKey inserts the key with its scopes. The event's TargetID is set
+// to the new key's ID.
+func (m *MySQLStore) CreateAPIKey(context context.Context, key models.APIKey, event models.AuditEvent) (int, error) {
+	var keyID int64
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		result, err := tx.NamedExecContext(context, `
+            INSERT INTO api_keys (user_id, name, prefix, key_hash, expires_at, created_by)
+            VALUES (:user_id, :name, :prefix, :key_hash, :expires_at, :created_by)`,
+			key)
+		if err != nil {
+			return err
+		}
+
+		keyID, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		event.TargetID = strconv.FormatInt(keyID, 10)
+
+		for _, scope := range key.Scopes {
+			_, err = tx.ExecContext(context, "INSERT INTO api_key_scopes (api_key_id, permission) VALUES (?, ?)",
+				keyID, scope)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return int(keyID), err
+}
+
+func (m *MySQLStore) GetAPIKeyByPrefix(context context.Context, prefix string) (models.APIKey, error) {
+	var k models.APIKey
+	err := m.DB.GetContext(context, &k, "SELECT * FROM api_keys WHERE prefix = ?", prefix)
+	if err != nil {
+		return k, err
+	}
+
+	keys := []models.APIKey{k}
+	err = m.loadAPIKeyScopes(context, keys)
+	return keys[0], err
+}
+
+func (m *MySQLStore) ListAPIKeys(context context.Context, userID int) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	err := m.DB.SelectContext(context, &keys, "SELECT * FROM api_keys WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return keys, err
+	}
+
+	err = m.loadAPIKeyScopes(context, keys)
+	return keys, err
+}
+
+// RevokeAPIKey revokes one of the user's keys, reporting whether it existed
+// RevokeAPIKey revokes an active key. The event is only recorded when there
+// was one.
+func (m *MySQLStore) RevokeAPIKey(context context.Context, userID, keyID int, event models.AuditEvent) (bool, error) {
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(context, "UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+			time.Now(), keyID, userID)
+		if err != nil {
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// TouchAPIKey records that a key was used. Writes are skipped while the last
+// recorded use is under a minute old, so busy keys don't write on every request.
+func (m *MySQLStore) TouchAPIKey(context context.Context, keyID int, ip string) error {
+	now := time.Now()
+	_, err := m.DB.ExecContext(context, `
+        UPDATE api_keys SET last_used_at = ?, last_used_ip = ?
+        WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)`,
+		now, ip, keyID, now.Add(-time.Minute))
+	return err
+}
+
+func (m *MySQLStore) loadAPIKeyScopes(context context.Context, keys []models.APIKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	byID := map[int]int{}
+	var ids []int
+	for i := range keys {
+		keys[i].Scopes = []string{}
+		byID[keys[i].ID] = i
+		ids = append(ids, keys[i].ID)
+	}
+
+	query, args, err := sqlx.In("SELECT api_key_id, permission FROM api_key_scopes WHERE api_key_id IN (?) ORDER BY permission", ids)
+	if err != nil {
+		return err
+	}
+
+	var scopes []struct {
+		APIKeyID   int    `db:"api_key_id"`
+		Permission string `db:"permission"`
+	}
+	err = m.DB.SelectContext(context, &scopes, m.DB.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range scopes {
+		i := byID[s.APIKeyID]
+		keys[i].Scopes = append(keys[i].Scopes, s.Permission)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateAuditEvent appends an event that isn't tied to another change
+func (m *MySQLStore) CreateAuditEvent(context context.Context, event models.AuditEvent) error {
+	return m.audited(context, &event, nil)
+}
+
+func (m *MySQLStore) ListAuditEvents(context context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	query := "SELECT * FROM audit_events WHERE 1 = 1"
+	var args []interface{}
+
+	if filter.ActorID != 0 {
+		query += " AND actor_id = ?"
+		args = append(args, filter.ActorID)
+	}
+	if filter.UserID != 0 {
+		query += " AND user_id = ?"
+		args = append(args, filter.UserID)
+	}
+	if filter.Action != "" {
+		query += " AND action = ?"
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		query += " AND target_type = ?"
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query += " AND target_id = ?"
+		args = append(args, filter.TargetID)
+	}
+	if filter.RequestID != "" {
+		query += " AND request_id = ?"
+		args = append(args, filter.RequestID)
+	}
+	if filter.From != nil {
+		query += " AND created_at >= ?"
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		query += " AND created_at < ?"
+		args = append(args, *filter.To)
+	}
+	if filter.BeforeID != 0 {
+		query += " AND id < ?"
+		args = append(args, filter.BeforeID)
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	events := []models.AuditEvent{}
+	err := m.DB.SelectContext(context, &events, query, args...)
+	if err != nil {
+		return events, err
+	}
+
+	return events, nil
+}
+
+// ListAuditChain returns events in chain order, starting after afterID
+func (m *MySQLStore) ListAuditChain(context context.Context, afterID int64, limit int) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	err := m.DB.SelectContext(context, &events, "SELECT * FROM audit_events WHERE id > ? ORDER BY id LIMIT ?", afterID, limit)
+	if err != nil {
+		return events, err
+	}
+
+	return events, nil
+}
+
+// audited runs fn and appends event to the audit log in one transaction, so
+// a change is never made without its audit event or the other way round.
+// fn may be nil to only append the event, and may fill in the event's
+// TargetID once the insert it makes assigns one.
+func (m *MySQLStore) audited(context context.Context, event *models.AuditEvent, fn func(tx *sqlx.Tx) error) error {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if fn != nil {
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := appendAuditEvent(context, tx, *event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// appendAuditEvent links the event to the head of the chain and inserts it.
+// Locking the head serializes writers, so the chain never forks.
+func appendAuditEvent(context context.Context, tx *sqlx.Tx, event models.AuditEvent) error {
+	err := tx.GetContext(context, &event.PrevHash, "SELECT hash FROM audit_chain WHERE id = 1 FOR UPDATE")
+	if err != nil {
+		return err
+	}
+
+	if event.Changes == "" {
+		event.Changes = "{}"
+	}
+	if event.Details == "" {
+		event.Details = "{}"
+	}
+	event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	event.Hash = event.ChainHash()
+
+	_, err = tx.NamedExecContext(context, `
+        INSERT INTO audit_events (actor_id, user_id, action, target_type, target_id, method, path, status, ip, request_id, changes, details, prev_hash, hash, created_at)
+        VALUES (:actor_id, :user_id, :action, :target_type, :target_id, :method, :path, :status, :ip, :request_id, :changes, :details, :prev_hash, :hash, :created_at)`,
+		event)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context, "UPDATE audit_chain SET hash = ? WHERE id = 1", event.Hash)
+	return err
+}
+
+// GetAuditChainHead returns the hash of the last event appended
+func (m *MySQLStore) GetAuditChainHead(context context.Context) (string, error) {
+	var hash string
+	err := m.DB.GetContext(context, &hash, "SELECT hash FROM audit_chain WHERE id = 1")
+	return hash, err
+}
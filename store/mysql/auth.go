@@ -28,15 +28,63 @@ func (m *MySQLStore) GetUserByPhoneNumber(context context.Context, phoneNumber s
 	return u, nil
 }
 
-func (m *MySQLStore) CreateUser(context context.Context, phoneNumber, otp string, otpExpiry time.Time, role string) error {
-	_, err := m.DB.ExecContext(context, "INSERT INTO users (phone_number, otp_code, otp_expiry, role) VALUES (?, ?, ?, ?)",
-		phoneNumber, otp, otpExpiry, role)
+// CreateUser inserts a user with the default "student" role
+func (m *MySQLStore) CreateUser(context context.Context, phoneNumber, otpHash string, otpExpiry time.Time) error {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	return err
+	result, err := tx.ExecContext(context, "INSERT INTO users (phone_number, otp_hash, otp_expiry) VALUES (?, ?, ?)",
+		phoneNumber, otpHash, otpExpiry)
+	if err != nil {
+		return err
+	}
+
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context, "INSERT INTO user_roles (user_id, role) VALUES (?, ?)",
+		userID, models.RoleStudent)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m *MySQLStore) UpdateOTP(context context.Context, phoneNumber, otp string, otpExpiry time.Time) error {
-	_, err := m.DB.ExecContext(context, "UPDATE users SET otp_code = ?, otp_expiry = ? WHERE phone_number = ?",
-		otp, otpExpiry, phoneNumber)
+func (m *MySQLStore) UpdateOTP(context context.Context, phoneNumber, otpHash string, otpExpiry time.Time) error {
+	_, err := m.DB.ExecContext(context, "UPDATE users SET otp_hash = ?, otp_expiry = ? WHERE phone_number = ?",
+		otpHash, otpExpiry, phoneNumber)
 	return err
 }
+
+// ConsumeOTP clears the pending OTP if it still matches, so a code can only be
+// used once even when two verifications race
+func (m *MySQLStore) ConsumeOTP(context context.Context, userID int, otpHash string) (bool, error) {
+	result, err := m.DB.ExecContext(context, "UPDATE users SET otp_hash = '' WHERE id = ? AND otp_hash = ? AND otp_expiry > ?",
+		userID, otpHash, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+func (m *MySQLStore) GetUser(context context.Context, id int) (models.User, error) {
+	var u models.User
+	err := m.DB.GetContext(context, &u, "SELECT * FROM users WHERE id = ?", id)
+	if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
@@ -0,0 +1,193 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateAuthSession creates a session with its first refresh token. When
+// maxDevices is positive, the user's oldest sessions beyond that many are
+// revoked so the new one fits.
+func (m *MySQLStore) CreateAuthSession(context context.Context, session models.AuthSession, token models.RefreshToken, maxDevices int) error {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so concurrent logins can't both squeeze under the limit
+	_, err = tx.ExecContext(context, "SELECT id FROM users WHERE id = ? FOR UPDATE", session.UserID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NamedExecContext(context, `
+        INSERT INTO auth_sessions (id, user_id, user_agent, ip, last_seen_at, expires_at)
+        VALUES (:id, :user_id, :user_agent, :ip, :last_seen_at, :expires_at)`,
+		session)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NamedExecContext(context, "INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES (:session_id, :token_hash, :expires_at)",
+		token)
+	if err != nil {
+		return err
+	}
+
+	if maxDevices > 0 {
+		var active []string
+		err = tx.SelectContext(context, &active, `
+            SELECT id FROM auth_sessions
+            WHERE user_id = ? AND impersonator_id IS NULL AND revoked_at IS NULL AND expires_at > ?
+            ORDER BY created_at DESC`,
+			session.UserID, time.Now())
+		if err != nil {
+			return err
+		}
+		if len(active) > maxDevices {
+			query, args, err := sqlx.In("UPDATE auth_sessions SET revoked_at = ?, revoked_reason = 'device_limit' WHERE id IN (?)",
+				time.Now(), active[maxDevices:])
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(context, tx.Rebind(query), args...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CreateImpersonationSession creates a session without a refresh token, so
+// it ends when its expiry passes
+func (m *MySQLStore) CreateImpersonationSession(context context.Context, session models.AuthSession) error {
+	_, err := m.DB.NamedExecContext(context, "INSERT INTO auth_sessions (id, user_id, impersonator_id, expires_at) VALUES (:id, :user_id, :impersonator_id, :expires_at)",
+		session)
+	return err
+}
+
+func (m *MySQLStore) GetAuthSession(context context.Context, id string) (models.AuthSession, error) {
+	var s models.AuthSession
+	err := m.DB.GetContext(context, &s, "SELECT * FROM auth_sessions WHERE id = ?", id)
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// ListUserAuthSessions returns the user's active sessions, most recently used
+// first. Impersonation sessions aren't included.
+func (m *MySQLStore) ListUserAuthSessions(context context.Context, userID int) ([]models.AuthSession, error) {
+	s := []models.AuthSession{}
+	err := m.DB.SelectContext(context, &s, `
+        SELECT * FROM auth_sessions
+        WHERE user_id = ? AND impersonator_id IS NULL AND revoked_at IS NULL AND expires_at > ?
+        ORDER BY COALESCE(last_seen_at, created_at) DESC`,
+		userID, time.Now())
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// TouchAuthSession records that a session was used. Like TouchAPIKey, writes
+// are skipped while the last recorded use is under a minute old.
+func (m *MySQLStore) TouchAuthSession(context context.Context, id, ip string) error {
+	now := time.Now()
+	_, err := m.DB.ExecContext(context, `
+        UPDATE auth_sessions SET last_seen_at = ?, ip = ?
+        WHERE id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)`,
+		now, ip, id, now.Add(-time.Minute))
+	return err
+}
+
+func (m *MySQLStore) GetRefreshToken(context context.Context, tokenHash string) (models.RefreshToken, error) {
+	var t models.RefreshToken
+	err := m.DB.GetContext(context, &t, "SELECT * FROM refresh_tokens WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+// RotateRefreshToken marks the presented token as used and issues its
+// successor. It returns false when the token had already been used, which
+// callers must treat as reuse.
+func (m *MySQLStore) RotateRefreshToken(context context.Context, usedID int, next models.RefreshToken) (bool, error) {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(context, "UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL",
+		time.Now(), usedID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows != 1 {
+		return false, nil
+	}
+
+	_, err = tx.NamedExecContext(context, "INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES (:session_id, :token_hash, :expires_at)",
+		next)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(context, "UPDATE auth_sessions SET expires_at = ? WHERE id = ?",
+		next.ExpiresAt, next.SessionID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (m *MySQLStore) RevokeAuthSession(context context.Context, id, reason string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE auth_sessions SET revoked_at = ?, revoked_reason = ? WHERE id = ? AND revoked_at IS NULL",
+		time.Now(), reason, id)
+	return err
+}
+
+// RevokeUserAuthSession revokes one of the user's sessions, returning false
+// when the user has no such active session
+func (m *MySQLStore) RevokeUserAuthSession(context context.Context, userID int, id, reason string) (bool, error) {
+	result, err := m.DB.ExecContext(context, `
+        UPDATE auth_sessions SET revoked_at = ?, revoked_reason = ?
+        WHERE id = ? AND user_id = ? AND impersonator_id IS NULL AND revoked_at IS NULL`,
+		time.Now(), reason, id, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (m *MySQLStore) RevokeUserAuthSessions(context context.Context, userID int, reason string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE auth_sessions SET revoked_at = ?, revoked_reason = ? WHERE user_id = ? AND revoked_at IS NULL",
+		time.Now(), reason, userID)
+	return err
+}
+
+// SetUserMaxDevices sets how many sessions the user may have at once, nil
+// falling back to the default
+func (m *MySQLStore) SetUserMaxDevices(context context.Context, userID int, maxDevices *int, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(context, "UPDATE users SET max_devices = ? WHERE id = ?", maxDevices, userID)
+		return err
+	})
+}
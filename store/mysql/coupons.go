@@ -0,0 +1,195 @@
+package mysql
+
+import (
+	"cmp"
+	"context"
+	"fintech/store/models"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// couponHold is how long a redemption on an order that hasn't been paid
+// holds its coupon. Abandoned checkouts give the coupon back after it, paid
+// orders keep it for good. Orders paid after it only keep their coupons if
+// they still have room.
+const couponHold = 30 * time.Minute
+
+// CreateCoupon inserts the coupon. The event's TargetID is set to the new
+// coupon's ID.
+func (m *MySQLStore) CreateCoupon(context context.Context, c models.Coupon, event models.AuditEvent) (int64, error) {
+	var id int64
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		result, err := tx.NamedExecContext(context, `
+            INSERT INTO coupons (code, description, kind, percent_bps, amount_minor, currency, min_order_minor, course_id,
+                category, max_redemptions, per_user_limit, stackable, starts_at, ends_at, created_by)
+            VALUES (:code, :description, :kind, :percent_bps, :amount_minor, :currency, :min_order_minor, :course_id,
+                :category, :max_redemptions, :per_user_limit, :stackable, :starts_at, :ends_at, :created_by)`,
+			c)
+		if err != nil {
+			return err
+		}
+
+		id, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		event.TargetID = strconv.FormatInt(id, 10)
+		return nil
+	})
+
+	return id, err
+}
+
+// UpdateCoupon changes what can change once a coupon may have been redeemed:
+// its description, limits, stacking, end and whether it's disabled
+func (m *MySQLStore) UpdateCoupon(context context.Context, c models.Coupon, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(context, `
+            UPDATE coupons SET description = :description, max_redemptions = :max_redemptions, per_user_limit = :per_user_limit,
+                stackable = :stackable, ends_at = :ends_at, disabled_at = :disabled_at
+            WHERE id = :id`,
+			c)
+		return err
+	})
+}
+
+func (m *MySQLStore) GetCoupon(context context.Context, id int64) (models.Coupon, error) {
+	var c models.Coupon
+	err := m.DB.GetContext(context, &c, "SELECT * FROM coupons WHERE id = ?", id)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// GetCouponsByCode returns the coupons with the given codes, leaving out
+// codes that don't exist
+func (m *MySQLStore) GetCouponsByCode(context context.Context, codes []string) ([]models.Coupon, error) {
+	c := []models.Coupon{}
+	if len(codes) == 0 {
+		return c, nil
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM coupons WHERE code IN (?)", codes)
+	if err != nil {
+		return c, err
+	}
+	err = m.DB.SelectContext(context, &c, m.DB.Rebind(query), args...)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// ListCoupons lists coupons newest first
+func (m *MySQLStore) ListCoupons(context context.Context, limit, offset int) ([]models.Coupon, error) {
+	c := []models.Coupon{}
+	err := m.DB.SelectContext(context, &c, "SELECT * FROM coupons ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// GetCouponUsage counts the redemptions holding the coupon, overall and by
+// the user
+func (m *MySQLStore) GetCouponUsage(context context.Context, couponID int64, userID int) (models.CouponUsage, error) {
+	return couponUsage(context, m.DB, couponID, userID, "")
+}
+
+// ListCouponRedemptions lists the coupon's redemptions newest first
+func (m *MySQLStore) ListCouponRedemptions(context context.Context, couponID int64, limit, offset int) ([]models.CouponRedemption, error) {
+	r := []models.CouponRedemption{}
+	err := m.DB.SelectContext(context, &r, `
+        SELECT * FROM coupon_redemptions WHERE coupon_id = ?
+        ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		couponID, limit, offset)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+// redeemCoupons records the order's redemptions. Each coupon is locked while
+// its limits are checked, so concurrent orders can't take it past them.
+func redeemCoupons(context context.Context, tx *sqlx.Tx, redemptions []models.CouponRedemption) error {
+	// Lock in a fixed order so orders using the same coupons don't deadlock
+	slices.SortFunc(redemptions, func(a, b models.CouponRedemption) int { return cmp.Compare(a.CouponID, b.CouponID) })
+
+	for _, r := range redemptions {
+		var c models.Coupon
+		err := tx.GetContext(context, &c, "SELECT * FROM coupons WHERE id = ? FOR UPDATE", r.CouponID)
+		if err != nil {
+			return err
+		}
+		if err := checkCouponLimits(context, tx, c, r.UserID, ""); err != nil {
+			return err
+		}
+
+		_, err = tx.NamedExecContext(context, `
+            INSERT INTO coupon_redemptions (coupon_id, order_id, user_id, discount_minor, currency)
+            VALUES (:coupon_id, :order_id, :user_id, :discount_minor, :currency)`,
+			r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recheckCoupons makes sure the coupons the order redeems still have room
+// for it as it's paid. Its redemptions stopped holding their coupons once
+// couponHold passed, so others may have taken their place meanwhile.
+func recheckCoupons(context context.Context, tx *sqlx.Tx, orderID string) error {
+	var redemptions []models.CouponRedemption
+	err := tx.SelectContext(context, &redemptions, "SELECT * FROM coupon_redemptions WHERE order_id = ? ORDER BY coupon_id", orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range redemptions {
+		var c models.Coupon
+		err := tx.GetContext(context, &c, "SELECT * FROM coupons WHERE id = ? FOR UPDATE", r.CouponID)
+		if err != nil {
+			return err
+		}
+		if err := checkCouponLimits(context, tx, c, r.UserID, orderID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCouponLimits returns models.ErrCouponLimitReached if the coupon has no
+// redemptions left for the user, not counting the given order's
+func checkCouponLimits(context context.Context, tx *sqlx.Tx, c models.Coupon, userID int, exceptOrderID string) error {
+	usage, err := couponUsage(context, tx, c.ID, userID, exceptOrderID)
+	if err != nil {
+		return err
+	}
+	if (c.MaxRedemptions != nil && usage.Total >= *c.MaxRedemptions) ||
+		(c.PerUserLimit != nil && usage.ByUser >= *c.PerUserLimit) {
+		return models.ErrCouponLimitReached
+	}
+	return nil
+}
+
+// couponUsage counts redemptions on orders that were paid, or that were
+// placed within couponHold and may still be, other than the given order's
+func couponUsage(context context.Context, q sqlx.QueryerContext, couponID int64, userID int, exceptOrderID string) (models.CouponUsage, error) {
+	var u models.CouponUsage
+	err := sqlx.GetContext(context, q, &u, `
+        SELECT COUNT(*) AS total, COALESCE(SUM(r.user_id = ?), 0) AS by_user
+        FROM coupon_redemptions r
+        JOIN orders o ON o.id = r.order_id
+        WHERE r.coupon_id = ? AND r.order_id <> ? AND (o.status NOT IN (?, ?) OR r.created_at > ?)`,
+		userID, couponID, exceptOrderID, models.OrderPending, models.OrderFailed, time.Now().Add(-couponHold))
+	return u, err
+}
@@ -3,6 +3,8 @@ package mysql
 import (
 	"context"
 	"fintech/store/models"
+
+	"github.com/jmoiron/sqlx"
 )
 
 func (m *MySQLStore) GetCourse(context context.Context, courseID string) (models.Course, error) {
@@ -25,21 +27,52 @@ func (m *MySQLStore) ListCourse(context context.Context) ([]models.Course, error
 	return c, nil
 }
 
-func (m *MySQLStore) CreateCourse(context context.Context, c models.Course) error {
-	_, err := m.DB.NamedExecContext(context, "INSERT INTO courses (id, name, description, author_id, folder_id, created_at, updated_at) VALUES (:id, :name, :description, :author_id, :folder_id, :created_at, :updated_at)",
-		c)
+// ListCoursesByID returns the courses with the given IDs, skipping unknown ones
+func (m *MySQLStore) ListCoursesByID(context context.Context, ids []string) ([]models.Course, error) {
+	c := []models.Course{}
+	if len(ids) == 0 {
+		return c, nil
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM courses WHERE id IN (?) ORDER BY name", ids)
+	if err != nil {
+		return c, err
+	}
+	err = m.DB.SelectContext(context, &c, m.DB.Rebind(query), args...)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// CreateCourse inserts the course and makes its author the owning instructor
+func (m *MySQLStore) CreateCourse(context context.Context, c models.Course, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(context, "INSERT INTO courses (id, name, description, author_id, folder_id, price_minor, currency, category, created_at, updated_at) VALUES (:id, :name, :description, :author_id, :folder_id, :price_minor, :currency, :category, :created_at, :updated_at)",
+			c)
+		if err != nil {
+			return err
+		}
 
-	return err
+		_, err = tx.ExecContext(context, "INSERT INTO course_instructors (course_id, user_id, level, status) VALUES (?, ?, ?, ?)",
+			c.ID, c.AuthorID, models.InstructorOwner, models.InstructorActive)
+		return err
+	})
 }
 
-func (m *MySQLStore) UpdateCourse(context context.Context, c models.Course) error {
-	_, err := m.DB.NamedExecContext(context, "UPDATE courses SET name = :name, description = :description, author_id = :author_id, updated_at = :updated_at WHERE id = :id",
-		c)
-	return err
+func (m *MySQLStore) UpdateCourse(context context.Context, c models.Course, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(context, "UPDATE courses SET name = :name, description = :description, author_id = :author_id, price_minor = :price_minor, currency = :currency, category = :category, updated_at = :updated_at WHERE id = :id",
+			c)
+		return err
+	})
 }
 
-func (m *MySQLStore) DeleteCourse(context context.Context, id string) error {
-	_, err := m.DB.ExecContext(context, "DELETE from courses WHERE id = ?",
-		id)
-	return err
+func (m *MySQLStore) DeleteCourse(context context.Context, id string, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(context, "DELETE from courses WHERE id = ?",
+			id)
+		return err
+	})
 }
@@ -0,0 +1,135 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// deletedMessage replaces the content of messages sent by deleted users
+const deletedMessage = "This message was deleted"
+
+// ScheduleUserDeletion sets when the user's account is deleted, nil cancelling
+// a scheduled deletion. The platform admins are locked and counted first,
+// returning models.ErrLastAdmin rather than scheduling the deletion of the
+// only admin not already on their way out.
+func (m *MySQLStore) ScheduleUserDeletion(context context.Context, userID int, at *time.Time) error {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if at != nil {
+		var admins []int
+		err = tx.SelectContext(context, &admins, `
+            SELECT ur.user_id FROM user_roles ur
+            JOIN users u ON u.id = ur.user_id
+            WHERE ur.role = ? AND ur.course_id = '' AND u.kind = 'human'
+                AND u.deleted_at IS NULL AND u.deletion_scheduled_at IS NULL
+            FOR UPDATE`, models.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if len(admins) <= 1 && slices.Contains(admins, userID) {
+			return models.ErrLastAdmin
+		}
+	}
+
+	_, err = tx.ExecContext(context, "UPDATE users SET deletion_scheduled_at = ? WHERE id = ? AND deleted_at IS NULL",
+		at, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListUsersDueForDeletion returns users whose grace period ended before now
+func (m *MySQLStore) ListUsersDueForDeletion(context context.Context, now time.Time) ([]models.User, error) {
+	var u []models.User
+	err := m.DB.SelectContext(context, &u, "SELECT * FROM users WHERE deletion_scheduled_at <= ? AND deleted_at IS NULL ORDER BY id",
+		now)
+	if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
+
+// PurgeUser erases the personal data of a user whose deletion is due at now,
+// returning the storage keys of the files nothing points at any more. The
+// users row itself is kept, anonymized, so orders, courses and audit events
+// referencing it stay intact; messages the user sent are kept for the other
+// participant with their content replaced. API keys the user made are
+// revoked. A deletion cancelled since the user was listed returns
+// models.ErrDeletionNotDue.
+func (m *MySQLStore) PurgeUser(context context.Context, userID int, now time.Time, event models.AuditEvent) ([]string, error) {
+	var keys []string
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		var err error
+		keys, err = purgeUser(context, tx, userID, now)
+		return err
+	})
+	return keys, err
+}
+
+func purgeUser(context context.Context, tx *sqlx.Tx, userID int, due time.Time) ([]string, error) {
+	var u models.User
+	err := tx.GetContext(context, &u, "SELECT * FROM users WHERE id = ? FOR UPDATE", userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.DeletedAt != nil || u.DeletionScheduledAt == nil || u.DeletionScheduledAt.After(due) {
+		return nil, models.ErrDeletionNotDue
+	}
+
+	var keys []string
+	err = tx.SelectContext(context, &keys, "SELECT storage_key FROM data_exports WHERE user_id = ? AND storage_key <> ''", userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.AvatarKey != "" {
+		keys = append(keys, u.AvatarKey)
+	}
+
+	now := time.Now()
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE messages SET content = ? WHERE sender_id = ?", []interface{}{deletedMessage, userID}},
+		{`UPDATE chat_sessions cs SET last_message = COALESCE(
+            (SELECT m.content FROM messages m WHERE m.session_id = cs.id ORDER BY m.created_at DESC, m.id DESC LIMIT 1), '')
+          WHERE cs.sender_id = ? OR cs.receiver_id = ?`, []interface{}{userID, userID}},
+		{"DELETE FROM otp_deliveries WHERE phone_number = ?", []interface{}{u.Phone()}},
+		{"DELETE FROM otp_attempts WHERE scope = 'phone' AND subject = ?", []interface{}{u.Phone()}},
+		{"DELETE FROM auth_sessions WHERE user_id = ?", []interface{}{userID}},
+		{"UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", []interface{}{now, userID}},
+		{"DELETE FROM user_roles WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM course_instructors WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM enrollments WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM video_progress WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM payout_accounts WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM billing_profiles WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM user_mfa WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM mfa_recovery_codes WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM mfa_challenges WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM user_identities WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM oidc_states WHERE link_user_id = ?", []interface{}{userID}},
+		{"DELETE FROM data_exports WHERE user_id = ?", []interface{}{userID}},
+		{`UPDATE users SET phone_number = NULL, otp_hash = '', name = '', email = NULL, email_verified_at = NULL,
+            pending_email = '', email_code_hash = '', email_code_expiry = NULL, avatar_key = '',
+            deletion_scheduled_at = NULL, deleted_at = ?
+          WHERE id = ?`, []interface{}{now, userID}},
+	}
+	for _, q := range queries {
+		if _, err := tx.ExecContext(context, q.query, q.args...); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
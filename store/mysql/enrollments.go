@@ -0,0 +1,115 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/store/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// enrollQuery enrolls a learner, reactivating a cancelled or expired
+// enrollment in place
+const enrollQuery = `
+    INSERT INTO enrollments (user_id, course_id, status, source, expires_at, enrolled_by)
+    VALUES (:user_id, :course_id, :status, :source, :expires_at, :enrolled_by)
+    ON DUPLICATE KEY UPDATE
+        status = VALUES(status),
+        source = VALUES(source),
+        expires_at = VALUES(expires_at),
+        enrolled_by = VALUES(enrolled_by)`
+
+func (m *MySQLStore) GetEnrollment(context context.Context, userID int, courseID string) (models.Enrollment, error) {
+	var e models.Enrollment
+	err := m.DB.GetContext(context, &e, "SELECT * FROM enrollments WHERE user_id = ? AND course_id = ?", userID, courseID)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// ListUserEnrollments returns all of the user's enrollments, including
+// cancelled and expired ones
+func (m *MySQLStore) ListUserEnrollments(context context.Context, userID int) ([]models.Enrollment, error) {
+	e := []models.Enrollment{}
+	err := m.DB.SelectContext(context, &e, "SELECT * FROM enrollments WHERE user_id = ? ORDER BY created_at DESC", userID)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+func (m *MySQLStore) ListCourseEnrollments(context context.Context, courseID string, limit, offset int) ([]models.Enrollment, error) {
+	e := []models.Enrollment{}
+	err := m.DB.SelectContext(context, &e, "SELECT * FROM enrollments WHERE course_id = ? ORDER BY created_at, user_id LIMIT ? OFFSET ?",
+		courseID, limit, offset)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// Enroll is for learners enrolling themselves, which isn't audited
+func (m *MySQLStore) Enroll(context context.Context, e models.Enrollment) error {
+	_, err := m.DB.NamedExecContext(context, enrollQuery, e)
+	return err
+}
+
+// CancelEnrollment ends the learner's own active enrollment, reporting
+// whether there was one
+func (m *MySQLStore) CancelEnrollment(context context.Context, userID int, courseID string) (bool, error) {
+	result, err := m.DB.ExecContext(context, "UPDATE enrollments SET status = ? WHERE user_id = ? AND course_id = ? AND status = ?",
+		models.EnrollmentCancelled, userID, courseID, models.EnrollmentActive)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+// EnrollUsers enrolls every learner in one transaction, under a single event
+func (m *MySQLStore) EnrollUsers(context context.Context, enrollments []models.Enrollment, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		for _, e := range enrollments {
+			if _, err := tx.NamedExecContext(context, enrollQuery, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CancelEnrollments ends the active enrollments of the given learners and
+// returns how many there were. No event is recorded when there were none.
+func (m *MySQLStore) CancelEnrollments(context context.Context, courseID string, userIDs []int, event models.AuditEvent) (int64, error) {
+	var cancelled int64
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		query, args, err := sqlx.In("UPDATE enrollments SET status = ? WHERE course_id = ? AND status = ? AND user_id IN (?)",
+			models.EnrollmentCancelled, courseID, models.EnrollmentActive, userIDs)
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(context, tx.Rebind(query), args...)
+		if err != nil {
+			return err
+		}
+
+		cancelled, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if cancelled == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return cancelled, err
+}
@@ -0,0 +1,74 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"time"
+)
+
+func (m *MySQLStore) CreateDataExport(context context.Context, export models.DataExport) error {
+	_, err := m.DB.NamedExecContext(context, "INSERT INTO data_exports (id, user_id, status) VALUES (:id, :user_id, :status)",
+		export)
+	return err
+}
+
+func (m *MySQLStore) GetDataExport(context context.Context, userID int, id string) (models.DataExport, error) {
+	var e models.DataExport
+	err := m.DB.GetContext(context, &e, "SELECT * FROM data_exports WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// ListDataExports returns the user's exports, newest first
+func (m *MySQLStore) ListDataExports(context context.Context, userID int) ([]models.DataExport, error) {
+	e := []models.DataExport{}
+	err := m.DB.SelectContext(context, &e, "SELECT * FROM data_exports WHERE user_id = ? ORDER BY created_at DESC", userID)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+func (m *MySQLStore) CompleteDataExport(context context.Context, id, storageKey string, expiresAt time.Time) error {
+	_, err := m.DB.ExecContext(context, "UPDATE data_exports SET status = ?, storage_key = ?, expires_at = ?, completed_at = ? WHERE id = ?",
+		models.ExportReady, storageKey, expiresAt, time.Now(), id)
+	return err
+}
+
+func (m *MySQLStore) FailDataExport(context context.Context, id, reason string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE data_exports SET status = ?, error = ?, completed_at = ? WHERE id = ?",
+		models.ExportFailed, reason, time.Now(), id)
+	return err
+}
+
+// ListExpiredDataExports returns exports whose archive should be deleted
+func (m *MySQLStore) ListExpiredDataExports(context context.Context, now time.Time) ([]models.DataExport, error) {
+	var e []models.DataExport
+	err := m.DB.SelectContext(context, &e, "SELECT * FROM data_exports WHERE expires_at <= ?", now)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+func (m *MySQLStore) DeleteDataExport(context context.Context, id string) error {
+	_, err := m.DB.ExecContext(context, "DELETE FROM data_exports WHERE id = ?", id)
+	return err
+}
+
+// ListUserMessages returns every message the user sent or received, oldest first
+func (m *MySQLStore) ListUserMessages(context context.Context, userID int) ([]models.Message, error) {
+	msgs := []models.Message{}
+	err := m.DB.SelectContext(context, &msgs, "SELECT * FROM messages WHERE sender_id = ? OR receiver_id = ? ORDER BY created_at, id",
+		userID, userID)
+	if err != nil {
+		return msgs, err
+	}
+
+	return msgs, nil
+}
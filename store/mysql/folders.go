@@ -3,6 +3,8 @@ package mysql
 import (
 	"context"
 	"fintech/store/models"
+
+	"github.com/jmoiron/sqlx"
 )
 
 func (m *MySQLStore) GetFolder(context context.Context, folderID string) (models.Folder, error) {
@@ -25,21 +27,26 @@ func (m *MySQLStore) ListFolder(context context.Context) ([]models.Folder, error
 	return c, nil
 }
 
-func (m *MySQLStore) CreateFolder(context context.Context, c models.Folder) error {
-	_, err := m.DB.NamedExecContext(context, "INSERT INTO folders (id, name, description, course_id, folder_id, created_at, updated_at) VALUES (:id, :name, :description, :course_id, :folder_id, :created_at, :updated_at)",
-		c)
-
-	return err
+func (m *MySQLStore) CreateFolder(context context.Context, c models.Folder, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(context, "INSERT INTO folders (id, name, description, course_id, folder_id, created_at, updated_at) VALUES (:id, :name, :description, :course_id, :folder_id, :created_at, :updated_at)",
+			c)
+		return err
+	})
 }
 
-func (m *MySQLStore) UpdateFolder(context context.Context, c models.Folder) error {
-	_, err := m.DB.NamedExecContext(context, "UPDATE folders SET name = :name, description = :description, course_id = :course_id, updated_at = :updated_at WHERE id = :id",
-		c)
-	return err
+func (m *MySQLStore) UpdateFolder(context context.Context, c models.Folder, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(context, "UPDATE folders SET name = :name, description = :description, course_id = :course_id, updated_at = :updated_at WHERE id = :id",
+			c)
+		return err
+	})
 }
 
-func (m *MySQLStore) DeleteFolder(context context.Context, id string) error {
-	_, err := m.DB.ExecContext(context, "DELETE from folders WHERE id = ?",
-		id)
-	return err
+func (m *MySQLStore) DeleteFolder(context context.Context, id string, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(context, "DELETE from folders WHERE id = ?",
+			id)
+		return err
+	})
 }
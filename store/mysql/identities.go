@@ -0,0 +1,131 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"time"
+)
+
+func (m *MySQLStore) CreateOIDCState(context context.Context, state models.OIDCState) error {
+	_, err := m.DB.NamedExecContext(context, `
+        INSERT INTO oidc_states (state_hash, provider, code_verifier, nonce, link_user_id, expires_at)
+        VALUES (:state_hash, :provider, :code_verifier, :nonce, :link_user_id, :expires_at)`,
+		state)
+	return err
+}
+
+// ConsumeOIDCState returns and deletes a state, so each can only be used once
+func (m *MySQLStore) ConsumeOIDCState(context context.Context, stateHash string) (models.OIDCState, error) {
+	var s models.OIDCState
+
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return s, err
+	}
+	defer tx.Rollback()
+
+	err = tx.GetContext(context, &s, "SELECT * FROM oidc_states WHERE state_hash = ? FOR UPDATE", stateHash)
+	if err != nil {
+		return s, err
+	}
+
+	_, err = tx.ExecContext(context, "DELETE FROM oidc_states WHERE state_hash = ?", stateHash)
+	if err != nil {
+		return s, err
+	}
+
+	return s, tx.Commit()
+}
+
+func (m *MySQLStore) GetUserIdentity(context context.Context, provider, subject string) (models.UserIdentity, error) {
+	var i models.UserIdentity
+	err := m.DB.GetContext(context, &i, "SELECT * FROM user_identities WHERE provider = ? AND subject = ?", provider, subject)
+	if err != nil {
+		return i, err
+	}
+
+	return i, nil
+}
+
+func (m *MySQLStore) ListUserIdentities(context context.Context, userID int) ([]models.UserIdentity, error) {
+	identities := []models.UserIdentity{}
+	err := m.DB.SelectContext(context, &identities, "SELECT * FROM user_identities WHERE user_id = ? ORDER BY provider", userID)
+	if err != nil {
+		return identities, err
+	}
+
+	return identities, nil
+}
+
+func (m *MySQLStore) CreateUserIdentity(context context.Context, identity models.UserIdentity) error {
+	_, err := m.DB.NamedExecContext(context, `
+        INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+        VALUES (:user_id, :provider, :subject, :email, :last_login_at)`,
+		identity)
+	return err
+}
+
+// TouchUserIdentity records a login through the identity
+func (m *MySQLStore) TouchUserIdentity(context context.Context, id int, email string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE user_identities SET last_login_at = ?, email = ? WHERE id = ?",
+		time.Now(), email, id)
+	return err
+}
+
+func (m *MySQLStore) DeleteUserIdentity(context context.Context, userID int, provider string) (bool, error) {
+	result, err := m.DB.ExecContext(context, "DELETE FROM user_identities WHERE user_id = ? AND provider = ?", userID, provider)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (m *MySQLStore) GetUserByEmail(context context.Context, email string) (models.User, error) {
+	var u models.User
+	err := m.DB.GetContext(context, &u, "SELECT * FROM users WHERE email = ?", email)
+	if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
+
+// CreateIdentityUser inserts a user first seen through an identity provider,
+// with the default "student" role and the identity already linked
+func (m *MySQLStore) CreateIdentityUser(context context.Context, user models.User, identity models.UserIdentity) (int, error) {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(context, "INSERT INTO users (phone_number, name, email, email_verified_at) VALUES (?, ?, ?, ?)",
+		user.PhoneNumber, user.Name, user.Email, user.EmailVerifiedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(context, "INSERT INTO user_roles (user_id, role) VALUES (?, ?)",
+		userID, models.RoleStudent)
+	if err != nil {
+		return 0, err
+	}
+
+	identity.UserID = int(userID)
+	_, err = tx.NamedExecContext(context, `
+        INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+        VALUES (:user_id, :provider, :subject, :email, :last_login_at)`,
+		identity)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(userID), tx.Commit()
+}
@@ -0,0 +1,71 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/store/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (m *MySQLStore) ListCourseInstructors(context context.Context, courseID string) ([]models.CourseInstructor, error) {
+	var i []models.CourseInstructor
+	err := m.DB.SelectContext(context, &i, "SELECT * FROM course_instructors WHERE course_id = ? ORDER BY created_at", courseID)
+	if err != nil {
+		return i, err
+	}
+
+	return i, nil
+}
+
+func (m *MySQLStore) GetCourseInstructor(context context.Context, courseID string, userID int) (models.CourseInstructor, error) {
+	var i models.CourseInstructor
+	err := m.DB.GetContext(context, &i, "SELECT * FROM course_instructors WHERE course_id = ? AND user_id = ?", courseID, userID)
+	if err != nil {
+		return i, err
+	}
+
+	return i, nil
+}
+
+func (m *MySQLStore) AddCourseInstructor(context context.Context, i models.CourseInstructor, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(context, "INSERT INTO course_instructors (course_id, user_id, level, status, invited_by) VALUES (:course_id, :user_id, :level, :status, :invited_by)",
+			i)
+		return err
+	})
+}
+
+// ActivateCourseInstructor accepts a pending invitation. The event is only
+// recorded when there was one.
+func (m *MySQLStore) ActivateCourseInstructor(context context.Context, courseID string, userID int, event models.AuditEvent) (bool, error) {
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(context, "UPDATE course_instructors SET status = ? WHERE course_id = ? AND user_id = ? AND status = ?",
+			models.InstructorActive, courseID, userID, models.InstructorInvited)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m *MySQLStore) RemoveCourseInstructor(context context.Context, courseID string, userID int, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(context, "DELETE FROM course_instructors WHERE course_id = ? AND user_id = ?",
+			courseID, userID)
+		return err
+	})
+}
@@ -0,0 +1,99 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Document series, which start the numbers of their documents
+const (
+	seriesInvoice    = "INV"
+	seriesCreditNote = "CN"
+)
+
+// nextDocumentNumber allocates the next number of the series in the financial
+// year, e.g. INV/26-27/000001. The sequence stays locked until tx ends, so
+// numbers are only used up by documents that are stored.
+func nextDocumentNumber(context context.Context, tx *sqlx.Tx, series, financialYear string) (string, error) {
+	result, err := tx.ExecContext(context, `
+        INSERT INTO document_sequences (series, financial_year, last_number) VALUES (?, ?, LAST_INSERT_ID(1))
+        ON DUPLICATE KEY UPDATE last_number = LAST_INSERT_ID(last_number + 1)`,
+		series, financialYear)
+	if err != nil {
+		return "", err
+	}
+	n, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%s/%06d", series, financialYear, n), nil
+}
+
+// insertInvoice numbers the invoice and stores it
+func insertInvoice(context context.Context, tx *sqlx.Tx, invoice models.Invoice) error {
+	var err error
+	invoice.Number, err = nextDocumentNumber(context, tx, seriesInvoice, invoice.FinancialYear)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NamedExecContext(context, `
+        INSERT INTO invoices (number, financial_year, order_id, user_id, total_minor, currency, taxable_minor,
+            cgst_minor, sgst_minor, igst_minor, rate_bps, sac, place_of_supply, supplier_gstin,
+            buyer_name, buyer_gstin, buyer_address, buyer_state_code, issued_at)
+        VALUES (:number, :financial_year, :order_id, :user_id, :total_minor, :currency, :taxable_minor,
+            :cgst_minor, :sgst_minor, :igst_minor, :rate_bps, :sac, :place_of_supply, :supplier_gstin,
+            :buyer_name, :buyer_gstin, :buyer_address, :buyer_state_code, :issued_at)`,
+		invoice)
+	return err
+}
+
+func (m *MySQLStore) GetInvoiceByOrder(context context.Context, orderID string) (models.Invoice, error) {
+	var i models.Invoice
+	err := m.DB.GetContext(context, &i, "SELECT * FROM invoices WHERE order_id = ?", orderID)
+	if err != nil {
+		return i, err
+	}
+
+	return i, nil
+}
+
+// ListUserInvoices lists the invoices issued to the user, newest first
+func (m *MySQLStore) ListUserInvoices(context context.Context, userID int) ([]models.Invoice, error) {
+	i := []models.Invoice{}
+	err := m.DB.SelectContext(context, &i, "SELECT * FROM invoices WHERE user_id = ? ORDER BY issued_at DESC", userID)
+	if err != nil {
+		return i, err
+	}
+
+	return i, nil
+}
+
+func (m *MySQLStore) SetInvoiceKey(context context.Context, id int64, storageKey string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE invoices SET storage_key = ? WHERE id = ?", storageKey, id)
+	return err
+}
+
+func (m *MySQLStore) GetBillingProfile(context context.Context, userID int) (models.BillingProfile, error) {
+	var p models.BillingProfile
+	err := m.DB.GetContext(context, &p, "SELECT * FROM billing_profiles WHERE user_id = ?", userID)
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+func (m *MySQLStore) SaveBillingProfile(context context.Context, p models.BillingProfile) error {
+	_, err := m.DB.NamedExecContext(context, `
+        INSERT INTO billing_profiles (user_id, legal_name, gstin, address, state_code)
+        VALUES (:user_id, :legal_name, :gstin, :address, :state_code)
+        ON DUPLICATE KEY UPDATE
+            legal_name = VALUES(legal_name), gstin = VALUES(gstin), address = VALUES(address), state_code = VALUES(state_code)`,
+		p)
+	return err
+}
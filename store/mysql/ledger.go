@@ -0,0 +1,161 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostJournalEntry stores an entry on its own. Entries that go with another
+// change are posted in the same transaction as it instead.
+func (m *MySQLStore) PostJournalEntry(context context.Context, entry models.JournalEntry) (int64, error) {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := postJournalEntry(context, tx, entry)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// postJournalEntry inserts the entry and its lines. Each kind of entry is
+// posted once per reference, so a change applied twice can't move the money
+// twice.
+func postJournalEntry(context context.Context, tx *sqlx.Tx, entry models.JournalEntry) (int64, error) {
+	result, err := tx.NamedExecContext(context, `
+        INSERT INTO journal_entries (kind, reference, memo, effective_at)
+        VALUES (:kind, :reference, :memo, :effective_at)`,
+		entry)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, l := range entry.Lines {
+		_, err = tx.ExecContext(context, "INSERT INTO journal_lines (entry_id, account, amount_minor, currency) VALUES (?, ?, ?, ?)",
+			id, l.Account, l.AmountMinor, l.Currency)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+func (m *MySQLStore) GetJournalEntry(context context.Context, id int64) (models.JournalEntry, error) {
+	var e models.JournalEntry
+	err := m.DB.GetContext(context, &e, "SELECT * FROM journal_entries WHERE id = ?", id)
+	if err != nil {
+		return e, err
+	}
+
+	return e, m.loadJournalLines(context, &e)
+}
+
+func (m *MySQLStore) GetJournalEntryByReference(context context.Context, kind, reference string) (models.JournalEntry, error) {
+	var e models.JournalEntry
+	err := m.DB.GetContext(context, &e, "SELECT * FROM journal_entries WHERE kind = ? AND reference = ?", kind, reference)
+	if err != nil {
+		return e, err
+	}
+
+	return e, m.loadJournalLines(context, &e)
+}
+
+func (m *MySQLStore) loadJournalLines(context context.Context, e *models.JournalEntry) error {
+	e.Lines = []models.JournalLine{}
+	return m.DB.SelectContext(context, &e.Lines, "SELECT * FROM journal_lines WHERE entry_id = ? ORDER BY id", e.ID)
+}
+
+// SumLedger totals the lines of each account and currency the filter
+// matches. With only To set, that's every balance as of that time.
+func (m *MySQLStore) SumLedger(context context.Context, filter models.LedgerFilter) ([]models.AccountBalance, error) {
+	query := `
+        SELECT l.account, l.currency, SUM(l.amount_minor) AS amount_minor
+        FROM journal_lines l
+        JOIN journal_entries e ON e.id = l.entry_id
+        WHERE 1 = 1`
+	query, args := ledgerConditions(query, filter)
+	query += " GROUP BY l.account, l.currency ORDER BY l.account, l.currency"
+
+	b := []models.AccountBalance{}
+	err := m.DB.SelectContext(context, &b, query, args...)
+	if err != nil {
+		return b, err
+	}
+
+	return b, nil
+}
+
+// ListStatementLines lists the lines the filter matches in the order the
+// money moved
+func (m *MySQLStore) ListStatementLines(context context.Context, filter models.LedgerFilter) ([]models.StatementLine, error) {
+	query := `
+        SELECT l.*, e.kind, e.reference, e.memo, e.effective_at
+        FROM journal_lines l
+        JOIN journal_entries e ON e.id = l.entry_id
+        WHERE 1 = 1`
+	query, args := ledgerConditions(query, filter)
+	query += " ORDER BY e.effective_at, e.id LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	lines := []models.StatementLine{}
+	err := m.DB.SelectContext(context, &lines, query, args...)
+	if err != nil {
+		return lines, err
+	}
+
+	return lines, nil
+}
+
+func ledgerConditions(query string, filter models.LedgerFilter) (string, []interface{}) {
+	var args []interface{}
+	if filter.Account != "" {
+		query += " AND l.account = ?"
+		args = append(args, filter.Account)
+	}
+	if filter.AccountPrefix != "" {
+		query += " AND LEFT(l.account, CHAR_LENGTH(?)) = ?"
+		args = append(args, filter.AccountPrefix, filter.AccountPrefix)
+	}
+	if filter.From != nil {
+		query += " AND e.effective_at >= ?"
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		query += " AND e.effective_at <= ?"
+		args = append(args, *filter.To)
+	}
+	return query, args
+}
+
+// SumMaturedLedger totals the accounts starting with prefix, counting credits
+// only once they're older than cutoff but debits whenever they were posted.
+// For liabilities that's what has been owed since cutoff, less anything paid
+// or taken back since. Cancelled payouts matured before they were made, so
+// they count straight away.
+func (m *MySQLStore) SumMaturedLedger(context context.Context, prefix string, cutoff time.Time) ([]models.AccountBalance, error) {
+	b := []models.AccountBalance{}
+	err := m.DB.SelectContext(context, &b, `
+        SELECT l.account, l.currency,
+            SUM(CASE WHEN l.amount_minor < 0 AND e.effective_at > ? AND e.kind <> ? THEN 0 ELSE l.amount_minor END) AS amount_minor
+        FROM journal_lines l
+        JOIN journal_entries e ON e.id = l.entry_id
+        WHERE LEFT(l.account, CHAR_LENGTH(?)) = ?
+        GROUP BY l.account, l.currency
+        ORDER BY l.account, l.currency`,
+		cutoff, models.JournalPayoutCancellation, prefix, prefix)
+	if err != nil {
+		return b, err
+	}
+
+	return b, nil
+}
@@ -3,6 +3,7 @@ package mysql
 import (
 	"context"
 	"fintech/store/models"
+	"time"
 )
 
 func (m *MySQLStore) AddMessage(context context.Context, c models.Message) error {
@@ -47,6 +48,32 @@ func (m *MySQLStore) GetChatSessions(context context.Context, userID int) ([]mod
 	return c, nil
 }
 
+func (m *MySQLStore) GetChatSession(context context.Context, id int) (models.ChatSession, error) {
+	var c models.ChatSession
+	err := m.DB.GetContext(context, &c, "SELECT * FROM chat_sessions WHERE id = ?", id)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// CanChat reports whether userID may chat with otherID: as a learner with an
+// active enrollment in one of otherID's courses, or as the author of a course
+// otherID enrolled in
+func (m *MySQLStore) CanChat(context context.Context, userID, otherID int, now time.Time) (bool, error) {
+	var allowed bool
+	err := m.DB.GetContext(context, &allowed, `
+        SELECT EXISTS (
+                SELECT 1 FROM enrollments e JOIN courses c ON c.id = e.course_id
+                WHERE e.user_id = ? AND c.author_id = ? AND e.status = ? AND (e.expires_at IS NULL OR e.expires_at > ?))
+            OR EXISTS (
+                SELECT 1 FROM enrollments e JOIN courses c ON c.id = e.course_id
+                WHERE e.user_id = ? AND c.author_id = ?)`,
+		userID, otherID, models.EnrollmentActive, now, otherID, userID)
+	return allowed, err
+}
+
 func (m *MySQLStore) MarkChatSessionsAsRead(context context.Context, ChatSessionID int) error {
 	_, err := m.DB.ExecContext(context, "UPDATE messages SET is_read = 1 WHERE session_id = ?",
 		ChatSessionID)
@@ -0,0 +1,173 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (m *MySQLStore) GetUserMFA(context context.Context, userID int) (models.UserMFA, error) {
+	var u models.UserMFA
+	err := m.DB.GetContext(context, &u, "SELECT * FROM user_mfa WHERE user_id = ?", userID)
+	if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
+
+// StartMFAEnrollment stores a new, unconfirmed secret for the user,
+// replacing any enrollment that was never confirmed
+func (m *MySQLStore) StartMFAEnrollment(context context.Context, userID int, secret string) error {
+	_, err := m.DB.ExecContext(context, `
+        INSERT INTO user_mfa (user_id, totp_secret) VALUES (?, ?)
+        ON DUPLICATE KEY UPDATE
+            totp_secret = IF(confirmed_at IS NULL, VALUES(totp_secret), totp_secret)`,
+		userID, secret)
+	return err
+}
+
+// ConfirmMFAEnrollment marks the secret as confirmed with the step that was
+// used and issues a fresh set of recovery codes
+func (m *MySQLStore) ConfirmMFAEnrollment(context context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(context, "UPDATE user_mfa SET confirmed_at = ?, last_used_step = ? WHERE user_id = ?",
+		time.Now(), step, userID)
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodes(context, tx, userID, recoveryCodeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records step as used, failing if it or a later step already was
+func (m *MySQLStore) UseTOTPStep(context context.Context, userID int, step int64) (bool, error) {
+	result, err := m.DB.ExecContext(context, "UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?",
+		step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (m *MySQLStore) DeleteUserMFA(context context.Context, userID int, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(context, "DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(context, "DELETE FROM user_mfa WHERE user_id = ?", userID)
+		return err
+	})
+}
+
+func (m *MySQLStore) ReplaceRecoveryCodes(context context.Context, userID int, codeHashes []string) error {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(context, tx, userID, codeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code as used
+func (m *MySQLStore) UseRecoveryCode(context context.Context, userID int, codeHash string) (bool, error) {
+	result, err := m.DB.ExecContext(context, "UPDATE mfa_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (m *MySQLStore) CountRecoveryCodes(context context.Context, userID int) (int, error) {
+	var count int
+	err := m.DB.GetContext(context, &count, "SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID)
+	return count, err
+}
+
+// MFARequired reports whether any role the user holds requires a second factor
+func (m *MySQLStore) MFARequired(context context.Context, userID int) (bool, error) {
+	var required bool
+	err := m.DB.GetContext(context, &required, `
+        SELECT EXISTS (
+            SELECT 1 FROM user_roles ur
+            JOIN roles r ON r.name = ur.role
+            WHERE ur.user_id = ? AND r.mfa_required
+        )`, userID)
+	return required, err
+}
+
+func (m *MySQLStore) SetRoleMFARequired(context context.Context, role string, required bool, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(context, "UPDATE roles SET mfa_required = ? WHERE name = ?", required, role)
+		return err
+	})
+}
+
+func (m *MySQLStore) CreateMFAChallenge(context context.Context, challenge models.MFAChallenge) error {
+	_, err := m.DB.NamedExecContext(context, "INSERT INTO mfa_challenges (token_hash, user_id, expires_at) VALUES (:token_hash, :user_id, :expires_at)",
+		challenge)
+	return err
+}
+
+func (m *MySQLStore) GetMFAChallenge(context context.Context, tokenHash string) (models.MFAChallenge, error) {
+	var c models.MFAChallenge
+	err := m.DB.GetContext(context, &c, "SELECT * FROM mfa_challenges WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// ConsumeMFAChallenge marks the challenge as used, failing if it already was
+func (m *MySQLStore) ConsumeMFAChallenge(context context.Context, tokenHash string) (bool, error) {
+	result, err := m.DB.ExecContext(context, "UPDATE mfa_challenges SET used_at = ? WHERE token_hash = ? AND used_at IS NULL",
+		time.Now(), tokenHash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func replaceRecoveryCodes(context context.Context, tx *sqlx.Tx, userID int, codeHashes []string) error {
+	_, err := tx.ExecContext(context, "DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range codeHashes {
+		_, err = tx.ExecContext(context, "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, h)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
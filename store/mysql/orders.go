@@ -0,0 +1,166 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateOrder inserts the order along with the coupons it redeems. It
+// returns models.ErrCouponLimitReached, placing nothing, if a coupon ran out.
+func (m *MySQLStore) CreateOrder(context context.Context, o models.Order, redemptions []models.CouponRedemption) error {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedExecContext(context, `
+        INSERT INTO orders (id, user_id, course_id, amount_minor, discount_minor, currency, status, gateway, gateway_order_id)
+        VALUES (:id, :user_id, :course_id, :amount_minor, :discount_minor, :currency, :status, :gateway, :gateway_order_id)`,
+		o)
+	if err != nil {
+		return err
+	}
+	if err := redeemCoupons(context, tx, redemptions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *MySQLStore) GetOrder(context context.Context, id string) (models.Order, error) {
+	var o models.Order
+	err := m.DB.GetContext(context, &o, "SELECT * FROM orders WHERE id = ?", id)
+	if err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
+
+func (m *MySQLStore) GetOrderByGatewayID(context context.Context, gateway, gatewayOrderID string) (models.Order, error) {
+	var o models.Order
+	err := m.DB.GetContext(context, &o, "SELECT * FROM orders WHERE gateway = ? AND gateway_order_id = ?", gateway, gatewayOrderID)
+	if err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
+
+func (m *MySQLStore) ListUserOrders(context context.Context, userID int) ([]models.Order, error) {
+	o := []models.Order{}
+	err := m.DB.SelectContext(context, &o, "SELECT * FROM orders WHERE user_id = ? ORDER BY created_at DESC", userID)
+	if err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
+
+// MarkOrderPaid records the captured payment along with its journal entry
+// and issues the order's invoice, reporting whether the order was still
+// waiting for one. The order is paid as of the entry's effective time. It
+// returns models.ErrCouponLimitReached, recording nothing, if a coupon the
+// order redeems ran out while it was being paid.
+func (m *MySQLStore) MarkOrderPaid(context context.Context, id, paymentID string, entry models.JournalEntry, invoice models.Invoice) (bool, error) {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := recheckCoupons(context, tx, id); err != nil {
+		return false, err
+	}
+	ok, err := transitionOrder(context, tx, id, models.OrderPaid, "gateway_payment_id = ?, paid_at = ?", paymentID, entry.EffectiveAt)
+	if err != nil || !ok {
+		return false, err
+	}
+	if _, err := postJournalEntry(context, tx, entry); err != nil {
+		return false, err
+	}
+	if err := insertInvoice(context, tx, invoice); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// VoidOrder records that a payment for the order was refunded in full
+// without it ever counting as paid, giving its coupons back
+func (m *MySQLStore) VoidOrder(context context.Context, id, paymentID string) (bool, error) {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	ok, err := transitionOrder(context, tx, id, models.OrderRefunded, "gateway_payment_id = ?, refunded_minor = amount_minor, refunded_at = ?",
+		paymentID, time.Now())
+	if err != nil || !ok {
+		return false, err
+	}
+	if _, err := tx.ExecContext(context, "DELETE FROM coupon_redemptions WHERE order_id = ?", id); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// FailOrder records a failed payment attempt
+func (m *MySQLStore) FailOrder(context context.Context, id string) (bool, error) {
+	return transitionOrder(context, m.DB, id, models.OrderFailed, "")
+}
+
+// FulfillOrder enrolls the buyer in the course they paid for, reporting
+// whether the order was paid and not yet fulfilled
+func (m *MySQLStore) FulfillOrder(context context.Context, o models.Order) (bool, error) {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	ok, err := transitionOrder(context, tx, o.ID, models.OrderFulfilled, "fulfilled_at = ?", time.Now())
+	if err != nil || !ok {
+		return false, err
+	}
+
+	_, err = tx.NamedExecContext(context, enrollQuery, models.Enrollment{
+		UserID:   o.UserID,
+		CourseID: o.CourseID,
+		Status:   models.EnrollmentActive,
+		Source:   models.EnrollmentSourcePurchase,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// transitionOrder moves the order to the given state if its current state
+// allows it, setting any extra columns along the way
+func transitionOrder(context context.Context, db sqlx.ExtContext, id, to, set string, args ...interface{}) (bool, error) {
+	if set != "" {
+		set = ", " + set
+	}
+	args = append([]interface{}{to}, args...)
+	args = append(args, id, models.OrderStatesBefore(to))
+
+	query, args, err := sqlx.In("UPDATE orders SET status = ?"+set+" WHERE id = ? AND status IN (?)", args...)
+	if err != nil {
+		return false, err
+	}
+	result, err := db.ExecContext(context, db.Rebind(query), args...)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
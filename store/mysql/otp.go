@@ -0,0 +1,67 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"fmt"
+	"time"
+)
+
+func (m *MySQLStore) CreateOTPDelivery(context context.Context, d models.OTPDelivery) error {
+	_, err := m.DB.NamedExecContext(context, "INSERT INTO otp_deliveries (phone_number, channel, provider, provider_message_id, status, error) VALUES (:phone_number, :channel, :provider, :provider_message_id, :status, :error)",
+		d)
+
+	return err
+}
+
+func (m *MySQLStore) UpdateOTPDeliveryStatus(context context.Context, provider, providerMessageID, status, deliveryError string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE otp_deliveries SET status = ?, error = ? WHERE provider = ? AND provider_message_id = ?",
+		status, deliveryError, provider, providerMessageID)
+	return err
+}
+
+func (m *MySQLStore) GetOTPAttempt(context context.Context, scope, subject string) (models.OTPAttempt, error) {
+	var a models.OTPAttempt
+	err := m.DB.GetContext(context, &a, "SELECT * FROM otp_attempts WHERE scope = ? AND subject = ?", scope, subject)
+	if err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+// RecordOTPFailure counts a failed verification against the subject in one
+// statement, so concurrent guesses can't overwrite each other's count.
+// Failures are forgotten once the subject has been quiet for window. From
+// maxAttempts failures on, the subject is locked out for baseLockout, doubled
+// on every further failure up to maxLockout.
+func (m *MySQLStore) RecordOTPFailure(context context.Context, scope, subject string, window time.Duration, maxAttempts int, baseLockout, maxLockout time.Duration) error {
+	now := time.Now()
+	// MySQL assigns in order, so failures is already incremented when
+	// locked_until is worked out from it
+	lockedUntil := func(failures string) (string, []interface{}) {
+		return fmt.Sprintf(`IF(%[1]s >= ?, DATE_ADD(?, INTERVAL CAST(LEAST(? * POW(2, LEAST(%[1]s - ?, 40)), ?) AS SIGNED) MICROSECOND), NULL)`, failures),
+			[]interface{}{maxAttempts, now, baseLockout.Microseconds(), maxAttempts, maxLockout.Microseconds()}
+	}
+	insertLock, insertArgs := lockedUntil("1")
+	updateLock, updateArgs := lockedUntil("failures")
+
+	args := append([]interface{}{scope, subject}, insertArgs...)
+	args = append(args, now, now.Add(-window))
+	args = append(args, updateArgs...)
+	_, err := m.DB.ExecContext(context, `
+        INSERT INTO otp_attempts (scope, subject, failures, locked_until, updated_at)
+        VALUES (?, ?, 1, `+insertLock+`, ?)
+        ON DUPLICATE KEY UPDATE
+            failures = IF(updated_at < ?, 1, failures + 1),
+            locked_until = `+updateLock+`,
+            updated_at = VALUES(updated_at)`,
+		args...)
+	return err
+}
+
+func (m *MySQLStore) ResetOTPAttempts(context context.Context, scope, subject string) error {
+	_, err := m.DB.ExecContext(context, "DELETE FROM otp_attempts WHERE scope = ? AND subject = ?",
+		scope, subject)
+	return err
+}
@@ -0,0 +1,263 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/store/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SetRevenueShares replaces the course's agreement from startsAt on. The
+// current agreement ends then, and agreements scheduled to start later are
+// dropped.
+func (m *MySQLStore) SetRevenueShares(context context.Context, courseID string, shares []models.RevenueShare, startsAt time.Time, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(context, "DELETE FROM revenue_shares WHERE course_id = ? AND starts_at >= ?", courseID, startsAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(context, "UPDATE revenue_shares SET ends_at = ? WHERE course_id = ? AND (ends_at IS NULL OR ends_at > ?)",
+			startsAt, courseID, startsAt)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range shares {
+			s.CourseID = courseID
+			s.StartsAt = startsAt
+			_, err = tx.NamedExecContext(context, `
+                INSERT INTO revenue_shares (course_id, user_id, share_bps, starts_at, created_by)
+                VALUES (:course_id, :user_id, :share_bps, :starts_at, :created_by)`,
+				s)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRevenueShares returns the shares of the course's agreement in effect at
+// the given time, none if it has no agreement
+func (m *MySQLStore) GetRevenueShares(context context.Context, courseID string, at time.Time) ([]models.RevenueShare, error) {
+	s := []models.RevenueShare{}
+	err := m.DB.SelectContext(context, &s, `
+        SELECT * FROM revenue_shares
+        WHERE course_id = ? AND starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)
+        ORDER BY user_id`,
+		courseID, at, at)
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// ListRevenueShares lists every agreement the course has had, newest first
+func (m *MySQLStore) ListRevenueShares(context context.Context, courseID string) ([]models.RevenueShare, error) {
+	s := []models.RevenueShare{}
+	err := m.DB.SelectContext(context, &s, "SELECT * FROM revenue_shares WHERE course_id = ? ORDER BY starts_at DESC, user_id", courseID)
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+func (m *MySQLStore) GetPayoutAccount(context context.Context, userID int) (models.PayoutAccount, error) {
+	var a models.PayoutAccount
+	err := m.DB.GetContext(context, &a, "SELECT * FROM payout_accounts WHERE user_id = ?", userID)
+	if err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+func (m *MySQLStore) SavePayoutAccount(context context.Context, a models.PayoutAccount, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(context, `
+            INSERT INTO payout_accounts (user_id, method, account_holder, account_number, bank_code, bank_name)
+            VALUES (:user_id, :method, :account_holder, :account_number, :bank_code, :bank_name)
+            ON DUPLICATE KEY UPDATE
+                method = VALUES(method), account_holder = VALUES(account_holder), account_number = VALUES(account_number),
+                bank_code = VALUES(bank_code), bank_name = VALUES(bank_name)`,
+			a)
+		return err
+	})
+}
+
+// ListPayoutAccounts returns the payout accounts of the users that have one
+func (m *MySQLStore) ListPayoutAccounts(context context.Context, userIDs []int) (map[int]models.PayoutAccount, error) {
+	byUser := map[int]models.PayoutAccount{}
+	if len(userIDs) == 0 {
+		return byUser, nil
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM payout_accounts WHERE user_id IN (?)", userIDs)
+	if err != nil {
+		return byUser, err
+	}
+	var accounts []models.PayoutAccount
+	if err := m.DB.SelectContext(context, &accounts, m.DB.Rebind(query), args...); err != nil {
+		return byUser, err
+	}
+	for _, a := range accounts {
+		byUser[a.UserID] = a
+	}
+
+	return byUser, nil
+}
+
+// CreatePayoutBatch stores the batch with its payouts and the journal entry
+// moving them out of the instructors' accounts. Each account the entry debits
+// is locked and checked to still cover it, so concurrent runs can't pay the
+// same earnings twice.
+func (m *MySQLStore) CreatePayoutBatch(context context.Context, batch models.PayoutBatch, payouts []models.Payout, entry models.JournalEntry, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(context, `
+            INSERT INTO payout_batches (id, status, cutoff_at, created_by)
+            VALUES (:id, :status, :cutoff_at, :created_by)`,
+			batch)
+		if err != nil {
+			return err
+		}
+
+		// Instructors' accounts are liabilities, so what they're owed is
+		// negative, and the entry debits what's paid out of them
+		for _, l := range entry.Lines {
+			if l.AmountMinor <= 0 {
+				continue
+			}
+			var balance int64
+			err := tx.GetContext(context, &balance, `
+                SELECT COALESCE(SUM(amount_minor), 0) FROM journal_lines
+                WHERE account = ? AND currency = ? FOR UPDATE`,
+				l.Account, l.Currency)
+			if err != nil {
+				return err
+			}
+			if l.AmountMinor > -balance {
+				return models.ErrPayoutExceedsBalance
+			}
+		}
+
+		for _, p := range payouts {
+			p.BatchID = batch.ID
+			_, err = tx.NamedExecContext(context, `
+                INSERT INTO payouts (id, batch_id, user_id, amount_minor, currency, method, account_holder, account_number, bank_code)
+                VALUES (:id, :batch_id, :user_id, :amount_minor, :currency, :method, :account_holder, :account_number, :bank_code)`,
+				p)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = postJournalEntry(context, tx, entry)
+		return err
+	})
+}
+
+// GetPayoutBatch returns the batch with its payouts
+func (m *MySQLStore) GetPayoutBatch(context context.Context, id string) (models.PayoutBatch, error) {
+	var b models.PayoutBatch
+	err := m.DB.GetContext(context, &b, "SELECT * FROM payout_batches WHERE id = ?", id)
+	if err != nil {
+		return b, err
+	}
+
+	b.Payouts = []models.Payout{}
+	err = m.DB.SelectContext(context, &b.Payouts, "SELECT * FROM payouts WHERE batch_id = ? ORDER BY user_id, currency", id)
+	return b, err
+}
+
+// ListPayoutBatches lists batches newest first, without their payouts
+func (m *MySQLStore) ListPayoutBatches(context context.Context, status string, limit, offset int) ([]models.PayoutBatch, error) {
+	query := "SELECT * FROM payout_batches WHERE 1 = 1"
+	var args []interface{}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	b := []models.PayoutBatch{}
+	err := m.DB.SelectContext(context, &b, query, args...)
+	if err != nil {
+		return b, err
+	}
+
+	return b, nil
+}
+
+// ListUserPayouts lists the payouts of the user's batches that weren't
+// cancelled, newest first
+func (m *MySQLStore) ListUserPayouts(context context.Context, userID int) ([]models.Payout, error) {
+	p := []models.Payout{}
+	err := m.DB.SelectContext(context, &p, `
+        SELECT p.* FROM payouts p
+        JOIN payout_batches b ON b.id = p.batch_id
+        WHERE p.user_id = ? AND b.status <> ?
+        ORDER BY p.created_at DESC`,
+		userID, models.PayoutCancelled)
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+// ApprovePayoutBatch approves a batch waiting for approval
+func (m *MySQLStore) ApprovePayoutBatch(context context.Context, id string, approverID int, event models.AuditEvent) (bool, error) {
+	return m.transitionPayoutBatch(context, id, []string{models.PayoutPendingApproval}, nil, event,
+		"status = ?, approved_by = ?, approved_at = ?", models.PayoutApproved, approverID, time.Now())
+}
+
+// SettlePayoutBatch records that an approved batch's transfers went out
+func (m *MySQLStore) SettlePayoutBatch(context context.Context, id string, settlerID int, reference string, entry models.JournalEntry, event models.AuditEvent) (bool, error) {
+	return m.transitionPayoutBatch(context, id, []string{models.PayoutApproved}, &entry, event,
+		"status = ?, settled_by = ?, settled_at = ?, bank_reference = ?", models.PayoutSettled, settlerID, entry.EffectiveAt, reference)
+}
+
+// CancelPayoutBatch cancels a batch that hasn't been settled, giving the
+// payouts back to the instructors through the entry
+func (m *MySQLStore) CancelPayoutBatch(context context.Context, id string, entry models.JournalEntry, event models.AuditEvent) (bool, error) {
+	return m.transitionPayoutBatch(context, id, []string{models.PayoutPendingApproval, models.PayoutApproved}, &entry, event,
+		"status = ?", models.PayoutCancelled)
+}
+
+// transitionPayoutBatch updates the batch if it is in one of the from states,
+// posting the entry if there is one. It reports false when the batch wasn't.
+func (m *MySQLStore) transitionPayoutBatch(context context.Context, id string, from []string, entry *models.JournalEntry, event models.AuditEvent, set string, args ...interface{}) (bool, error) {
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		query, queryArgs, err := sqlx.In("UPDATE payout_batches SET "+set+" WHERE id = ? AND status IN (?)",
+			append(args, id, from)...)
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(context, tx.Rebind(query), queryArgs...)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return sql.ErrNoRows
+		}
+
+		if entry != nil {
+			_, err = postJournalEntry(context, tx, *entry)
+		}
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,115 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ListPhoneNumbers returns the ID and phone number of every user
+func (m *MySQLStore) ListPhoneNumbers(context context.Context) ([]models.User, error) {
+	var u []models.User
+	err := m.DB.SelectContext(context, &u, "SELECT id, phone_number FROM users WHERE phone_number IS NOT NULL ORDER BY id")
+	if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
+
+// MergeUsers moves everything owned by mergeIDs over to keepID, deletes the
+// merged users and sets keepID's phone number. Roles, instructor seats,
+// enrollments, progress, identities and profiles the kept user already has
+// win over the merged ones, as does its authenticator; sessions of the merged
+// users are dropped. Merged users with orders, refunds, invoices, revenue
+// shares, payouts or coupon redemptions aren't merged, since those are in the
+// ledger under their ID: models.ErrUserHasPayments is returned instead.
+func (m *MySQLStore) MergeUsers(context context.Context, keepID int, mergeIDs []int, phoneNumber string) error {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(mergeIDs) > 0 {
+		query, args, err := sqlx.In(`
+            SELECT EXISTS (SELECT 1 FROM orders WHERE user_id IN (?))
+                OR EXISTS (SELECT 1 FROM refunds WHERE user_id IN (?))
+                OR EXISTS (SELECT 1 FROM credit_notes WHERE user_id IN (?))
+                OR EXISTS (SELECT 1 FROM invoices WHERE user_id IN (?))
+                OR EXISTS (SELECT 1 FROM revenue_shares WHERE user_id IN (?))
+                OR EXISTS (SELECT 1 FROM payouts WHERE user_id IN (?))
+                OR EXISTS (SELECT 1 FROM coupon_redemptions WHERE user_id IN (?))`,
+			mergeIDs, mergeIDs, mergeIDs, mergeIDs, mergeIDs, mergeIDs, mergeIDs)
+		if err != nil {
+			return err
+		}
+		var hasPayments bool
+		if err := tx.GetContext(context, &hasPayments, tx.Rebind(query), args...); err != nil {
+			return err
+		}
+		if hasPayments {
+			return models.ErrUserHasPayments
+		}
+
+		// UPDATE IGNORE skips rows the kept user already has; those are
+		// removed with the merged users below. Recovery codes only move
+		// with the authenticator they belong to.
+		queries := []string{
+			"UPDATE IGNORE user_roles SET user_id = ? WHERE user_id IN (?)",
+			"UPDATE IGNORE course_instructors SET user_id = ? WHERE user_id IN (?)",
+			"UPDATE courses SET author_id = ? WHERE author_id IN (?)",
+			"UPDATE chat_sessions SET sender_id = ? WHERE sender_id IN (?)",
+			"UPDATE chat_sessions SET receiver_id = ? WHERE receiver_id IN (?)",
+			"UPDATE messages SET sender_id = ? WHERE sender_id IN (?)",
+			"UPDATE messages SET receiver_id = ? WHERE receiver_id IN (?)",
+			"UPDATE IGNORE enrollments SET user_id = ? WHERE user_id IN (?)",
+			"UPDATE IGNORE video_progress SET user_id = ? WHERE user_id IN (?)",
+			"UPDATE IGNORE user_identities SET user_id = ? WHERE user_id IN (?)",
+			"UPDATE IGNORE billing_profiles SET user_id = ? WHERE user_id IN (?)",
+			"UPDATE IGNORE payout_accounts SET user_id = ? WHERE user_id IN (?)",
+			"UPDATE IGNORE user_mfa SET user_id = ? WHERE user_id IN (?)",
+			"UPDATE IGNORE mfa_recovery_codes SET user_id = ? WHERE user_id IN (?) AND user_id NOT IN (SELECT user_id FROM user_mfa)",
+			"UPDATE api_keys SET user_id = ? WHERE user_id IN (?)",
+			"UPDATE data_exports SET user_id = ? WHERE user_id IN (?)",
+			"UPDATE user_roles SET granted_by = ? WHERE granted_by IN (?)",
+			"UPDATE course_instructors SET invited_by = ? WHERE invited_by IN (?)",
+			"UPDATE enrollments SET enrolled_by = ? WHERE enrolled_by IN (?)",
+			"UPDATE api_keys SET created_by = ? WHERE created_by IN (?)",
+			"UPDATE refunds SET requested_by = ? WHERE requested_by IN (?)",
+			"UPDATE refunds SET reviewed_by = ? WHERE reviewed_by IN (?)",
+			"UPDATE revenue_shares SET created_by = ? WHERE created_by IN (?)",
+			"UPDATE payout_batches SET created_by = ? WHERE created_by IN (?)",
+			"UPDATE payout_batches SET approved_by = ? WHERE approved_by IN (?)",
+			"UPDATE payout_batches SET settled_by = ? WHERE settled_by IN (?)",
+			"UPDATE coupons SET created_by = ? WHERE created_by IN (?)",
+		}
+		for _, q := range queries {
+			query, args, err := sqlx.In(q, keepID, mergeIDs)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(context, tx.Rebind(query), args...)
+			if err != nil {
+				return err
+			}
+		}
+
+		query, args, err = sqlx.In("DELETE FROM users WHERE id IN (?)", mergeIDs)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(context, tx.Rebind(query), args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(context, "UPDATE users SET phone_number = ? WHERE id = ?", phoneNumber, keepID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (m *MySQLStore) UpdateProfile(context context.Context, userID int, name, locale string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE users SET name = ?, locale = ? WHERE id = ?",
+		name, locale, userID)
+	return err
+}
+
+func (m *MySQLStore) SetPendingEmail(context context.Context, userID int, email, codeHash string, expiry time.Time) error {
+	_, err := m.DB.ExecContext(context, "UPDATE users SET pending_email = ?, email_code_hash = ?, email_code_expiry = ? WHERE id = ?",
+		email, codeHash, expiry, userID)
+	return err
+}
+
+// VerifyEmail promotes the pending email to the verified one if the code
+// matches and hasn't expired
+func (m *MySQLStore) VerifyEmail(context context.Context, userID int, codeHash string) (bool, error) {
+	now := time.Now()
+	result, err := m.DB.ExecContext(context, `
+        UPDATE users
+        SET email = pending_email, email_verified_at = ?, pending_email = '', email_code_hash = '', email_code_expiry = NULL
+        WHERE id = ? AND pending_email <> '' AND email_code_hash = ? AND email_code_expiry > ?`,
+		now, userID, codeHash, now)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+// ClearPendingEmail forgets the pending email and its code, so a new code
+// has to be sent before it can be verified
+func (m *MySQLStore) ClearPendingEmail(context context.Context, userID int) error {
+	_, err := m.DB.ExecContext(context, "UPDATE users SET pending_email = '', email_code_hash = '', email_code_expiry = NULL WHERE id = ?",
+		userID)
+	return err
+}
+
+func (m *MySQLStore) SetAvatar(context context.Context, userID int, key string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE users SET avatar_key = ? WHERE id = ?",
+		key, userID)
+	return err
+}
+
+// GetUserSummaries returns the compact profile of each user, keyed by ID
+func (m *MySQLStore) GetUserSummaries(context context.Context, ids []int) (map[int]models.UserSummary, error) {
+	summaries := map[int]models.UserSummary{}
+	if len(ids) == 0 {
+		return summaries, nil
+	}
+
+	query, args, err := sqlx.In("SELECT id, name, avatar_key FROM users WHERE id IN (?)", ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var s []models.UserSummary
+	err = m.DB.SelectContext(context, &s, m.DB.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range s {
+		u.AvatarURL = models.AvatarURL(u.ID, u.AvatarKey)
+		summaries[u.ID] = u
+	}
+
+	return summaries, nil
+}
@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"time"
+)
+
+// SaveVideoProgress records a position reached in a video. Positions never
+// move back, so rewinding doesn't undo progress.
+func (m *MySQLStore) SaveVideoProgress(context context.Context, p models.VideoProgress) error {
+	if p.Watched() {
+		now := time.Now()
+		p.WatchedAt = &now
+	}
+
+	_, err := m.DB.NamedExecContext(context, `
+        INSERT INTO video_progress (user_id, course_id, video_id, furthest_seconds, duration_seconds, watched_at)
+        VALUES (:user_id, :course_id, :video_id, :furthest_seconds, :duration_seconds, :watched_at)
+        ON DUPLICATE KEY UPDATE
+            watched_at = COALESCE(watched_at, VALUES(watched_at)),
+            furthest_seconds = GREATEST(furthest_seconds, VALUES(furthest_seconds)),
+            duration_seconds = VALUES(duration_seconds)`,
+		p)
+	return err
+}
+
+func (m *MySQLStore) ListCourseProgress(context context.Context, userID int, courseID string) ([]models.VideoProgress, error) {
+	p := []models.VideoProgress{}
+	err := m.DB.SelectContext(context, &p, "SELECT * FROM video_progress WHERE user_id = ? AND course_id = ? ORDER BY updated_at DESC",
+		userID, courseID)
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+func (m *MySQLStore) ListUserProgress(context context.Context, userID int) ([]models.VideoProgress, error) {
+	p := []models.VideoProgress{}
+	err := m.DB.SelectContext(context, &p, "SELECT * FROM video_progress WHERE user_id = ? ORDER BY course_id, updated_at DESC", userID)
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+// CountWatchedVideos counts the videos of the course the user got through
+// half of
+func (m *MySQLStore) CountWatchedVideos(context context.Context, userID int, courseID string) (int, error) {
+	var count int
+	err := m.DB.GetContext(context, &count, "SELECT COUNT(*) FROM video_progress WHERE user_id = ? AND course_id = ? AND watched_at IS NOT NULL",
+		userID, courseID)
+	return count, err
+}
@@ -0,0 +1,306 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/store/models"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// reservingRefunds are the refund states that hold on to part of the payment
+var reservingRefunds = []string{models.RefundPendingApproval, models.RefundProcessing, models.RefundRefunded}
+
+// CreateRefund stores the refund if the order still has that much left to
+// refund, counting refunds that are waiting for approval or in progress
+func (m *MySQLStore) CreateRefund(context context.Context, r models.Refund, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		if err := checkRefundable(context, tx, r); err != nil {
+			return err
+		}
+
+		_, err := tx.NamedExecContext(context, `
+            INSERT INTO refunds (id, order_id, user_id, amount_minor, currency, reason, status, within_policy, policy_notes, requested_by)
+            VALUES (:id, :order_id, :user_id, :amount_minor, :currency, :reason, :status, :within_policy, :policy_notes, :requested_by)`,
+			r)
+		return err
+	})
+}
+
+// checkRefundable locks the order and checks the refund fits in what's left
+// of it, not counting the refund itself
+func checkRefundable(context context.Context, tx *sqlx.Tx, r models.Refund) error {
+	var order models.Order
+	err := tx.GetContext(context, &order, "SELECT * FROM orders WHERE id = ? FOR UPDATE", r.OrderID)
+	if err != nil {
+		return err
+	}
+	if order.Status != models.OrderPaid && order.Status != models.OrderFulfilled {
+		return models.ErrRefundExceedsPayment
+	}
+
+	query, args, err := sqlx.In("SELECT COALESCE(SUM(amount_minor), 0) FROM refunds WHERE order_id = ? AND id <> ? AND status IN (?)",
+		r.OrderID, r.ID, reservingRefunds)
+	if err != nil {
+		return err
+	}
+	var reserved int64
+	if err := tx.GetContext(context, &reserved, tx.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	if r.AmountMinor <= 0 || r.AmountMinor > order.AmountMinor-reserved {
+		return models.ErrRefundExceedsPayment
+	}
+	return nil
+}
+
+func (m *MySQLStore) GetRefund(context context.Context, id string) (models.Refund, error) {
+	var r models.Refund
+	err := m.DB.GetContext(context, &r, "SELECT * FROM refunds WHERE id = ?", id)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+func (m *MySQLStore) ListOrderRefunds(context context.Context, orderID string) ([]models.Refund, error) {
+	r := []models.Refund{}
+	err := m.DB.SelectContext(context, &r, "SELECT * FROM refunds WHERE order_id = ? ORDER BY created_at", orderID)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+func (m *MySQLStore) ListUserRefunds(context context.Context, userID int) ([]models.Refund, error) {
+	r := []models.Refund{}
+	err := m.DB.SelectContext(context, &r, "SELECT * FROM refunds WHERE user_id = ? ORDER BY created_at", userID)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+// ListRefunds lists refunds oldest first, so the approval queue is worked
+// through in order
+func (m *MySQLStore) ListRefunds(context context.Context, status string, limit, offset int) ([]models.Refund, error) {
+	query := "SELECT * FROM refunds WHERE 1 = 1"
+	var args []interface{}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	r := []models.Refund{}
+	err := m.DB.SelectContext(context, &r, query, args...)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+// ApproveRefund sends a refund waiting for approval, or one the gateway
+// refused, back to processing. It reports false when the refund was in
+// neither state.
+func (m *MySQLStore) ApproveRefund(context context.Context, id string, reviewerID int, note string, event models.AuditEvent) (bool, error) {
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		var r models.Refund
+		err := tx.GetContext(context, &r, "SELECT * FROM refunds WHERE id = ? FOR UPDATE", id)
+		if err != nil {
+			return err
+		}
+		if r.Status != models.RefundPendingApproval && r.Status != models.RefundFailed {
+			return sql.ErrNoRows
+		}
+		// Failed refunds stopped reserving their amount
+		if err := checkRefundable(context, tx, r); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(context, `
+            UPDATE refunds SET status = ?, error = '', reviewed_by = ?, review_note = ?, reviewed_at = ?
+            WHERE id = ?`,
+			models.RefundProcessing, reviewerID, note, time.Now(), id)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RejectRefund turns down a refund waiting for approval
+func (m *MySQLStore) RejectRefund(context context.Context, id string, reviewerID int, note string, event models.AuditEvent) (bool, error) {
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(context, `
+            UPDATE refunds SET status = ?, reviewed_by = ?, review_note = ?, reviewed_at = ?
+            WHERE id = ? AND status = ?`,
+			models.RefundRejected, reviewerID, note, time.Now(), id, models.RefundPendingApproval)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ReclaimRefund claims a refund left processing since before stale, so it
+// can be sent to the gateway again. Claiming touches updated_at, so only one
+// admin at a time gets it.
+func (m *MySQLStore) ReclaimRefund(context context.Context, id string, stale time.Time, event models.AuditEvent) (bool, error) {
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(context, "UPDATE refunds SET updated_at = ? WHERE id = ? AND status = ? AND updated_at < ?",
+			time.Now(), id, models.RefundProcessing, stale)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// FailRefund records that the gateway refused the refund
+func (m *MySQLStore) FailRefund(context context.Context, id, reason string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE refunds SET status = ?, error = ? WHERE id = ? AND status = ?",
+		models.RefundFailed, reason, id, models.RefundProcessing)
+	return err
+}
+
+// CompleteRefund records the gateway's refund with its journal entry, takes
+// it off the order and issues its credit note. A full refund revokes the
+// buyer's enrollment; a partial one ends it at accessUntil, if that's earlier
+// and set. The credit note amends the order's invoice, if it has one, by the
+// given taxes.
+func (m *MySQLStore) CompleteRefund(context context.Context, r models.Refund, gatewayRefundID string, accessUntil *time.Time, entry models.JournalEntry, taxes models.GSTAmounts) (models.CreditNote, error) {
+	note := models.CreditNote{
+		RefundID:    r.ID,
+		OrderID:     r.OrderID,
+		UserID:      r.UserID,
+		AmountMinor: r.AmountMinor,
+		Currency:    r.Currency,
+		IssuedAt:    entry.EffectiveAt,
+		GSTAmounts:  taxes,
+	}
+
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return note, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(context, "UPDATE refunds SET status = ?, gateway_refund_id = ?, completed_at = ? WHERE id = ? AND status = ?",
+		models.RefundRefunded, gatewayRefundID, note.IssuedAt, r.ID, models.RefundProcessing)
+	if err != nil {
+		return note, err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows != 1 {
+		return note, fmt.Errorf("refund %s isn't processing", r.ID)
+	}
+
+	var order models.Order
+	err = tx.GetContext(context, &order, "SELECT * FROM orders WHERE id = ? FOR UPDATE", r.OrderID)
+	if err != nil {
+		return note, err
+	}
+	order.RefundedMinor += r.AmountMinor
+	_, err = tx.ExecContext(context, "UPDATE orders SET refunded_minor = ? WHERE id = ?", order.RefundedMinor, order.ID)
+	if err != nil {
+		return note, err
+	}
+
+	if order.RefundedMinor >= order.AmountMinor {
+		if _, err := transitionOrder(context, tx, order.ID, models.OrderRefunded, "refunded_at = ?", note.IssuedAt); err != nil {
+			return note, err
+		}
+		_, err = tx.ExecContext(context, "UPDATE enrollments SET status = ? WHERE user_id = ? AND course_id = ?",
+			models.EnrollmentCancelled, order.UserID, order.CourseID)
+	} else if accessUntil != nil {
+		_, err = tx.ExecContext(context, `
+            UPDATE enrollments SET expires_at = LEAST(COALESCE(expires_at, ?), ?)
+            WHERE user_id = ? AND course_id = ?`,
+			*accessUntil, *accessUntil, order.UserID, order.CourseID)
+	}
+	if err != nil {
+		return note, err
+	}
+
+	if _, err := postJournalEntry(context, tx, entry); err != nil {
+		return note, err
+	}
+
+	var invoiceID int64
+	err = tx.GetContext(context, &invoiceID, "SELECT id FROM invoices WHERE order_id = ?", order.ID)
+	switch {
+	case err == nil:
+		note.InvoiceID = &invoiceID
+	case !errors.Is(err, sql.ErrNoRows):
+		return note, err
+	}
+
+	note.Number, err = nextDocumentNumber(context, tx, seriesCreditNote, models.FinancialYear(note.IssuedAt))
+	if err != nil {
+		return note, err
+	}
+	result, err = tx.NamedExecContext(context, `
+        INSERT INTO credit_notes (number, invoice_id, refund_id, order_id, user_id, amount_minor, currency,
+            taxable_minor, cgst_minor, sgst_minor, igst_minor, issued_at)
+        VALUES (:number, :invoice_id, :refund_id, :order_id, :user_id, :amount_minor, :currency,
+            :taxable_minor, :cgst_minor, :sgst_minor, :igst_minor, :issued_at)`,
+		note)
+	if err != nil {
+		return note, err
+	}
+	note.ID, err = result.LastInsertId()
+	if err != nil {
+		return note, err
+	}
+
+	return note, tx.Commit()
+}
+
+func (m *MySQLStore) GetCreditNoteByRefund(context context.Context, refundID string) (models.CreditNote, error) {
+	var n models.CreditNote
+	err := m.DB.GetContext(context, &n, "SELECT * FROM credit_notes WHERE refund_id = ?", refundID)
+	if err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+func (m *MySQLStore) SetCreditNoteKey(context context.Context, id int64, storageKey string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE credit_notes SET storage_key = ? WHERE id = ?", storageKey, id)
+	return err
+}
@@ -0,0 +1,247 @@
+package mysql
+
+import (
+	"context"
+	"fintech/store/models"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (m *MySQLStore) ListUsers(context context.Context, filter models.UserFilter) ([]models.UserWithRoles, error) {
+	query := "SELECT u.id, u.kind, u.name, u.phone_number, u.created_at FROM users u WHERE 1 = 1"
+	var args []interface{}
+
+	if filter.Kind != "" {
+		query += " AND u.kind = ?"
+		args = append(args, filter.Kind)
+	}
+	if filter.PhoneNumber != "" {
+		query += " AND u.phone_number = ?"
+		args = append(args, filter.PhoneNumber)
+	}
+	if filter.Role != "" {
+		query += " AND EXISTS (SELECT 1 FROM user_roles f WHERE f.user_id = u.id AND f.role = ?)"
+		args = append(args, filter.Role)
+	}
+	query += " ORDER BY u.id LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	var users []models.UserWithRoles
+	rows, err := m.DB.QueryxContext(context, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int]int{}
+	var ids []int
+	for rows.Next() {
+		var u models.UserWithRoles
+		if err := rows.Scan(&u.ID, &u.Kind, &u.Name, &u.PhoneNumber, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		u.Roles = []models.UserRole{}
+		byID[u.ID] = len(users)
+		ids = append(ids, u.ID)
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []models.UserWithRoles{}, nil
+	}
+
+	query, args, err = sqlx.In("SELECT * FROM user_roles WHERE user_id IN (?) ORDER BY role, course_id", ids)
+	if err != nil {
+		return nil, err
+	}
+	var roles []models.UserRole
+	err = m.DB.SelectContext(context, &roles, m.DB.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		i := byID[r.UserID]
+		users[i].Roles = append(users[i].Roles, r)
+	}
+
+	return users, nil
+}
+
+func (m *MySQLStore) ListRoles(context context.Context) ([]models.Role, error) {
+	var r []models.Role
+	err := m.DB.SelectContext(context, &r, "SELECT * FROM roles ORDER BY name")
+	if err != nil {
+		return r, err
+	}
+
+	var perms []struct {
+		Role       string `db:"role"`
+		Permission string `db:"permission"`
+	}
+	err = m.DB.SelectContext(context, &perms, "SELECT role, permission FROM role_permissions ORDER BY permission")
+	if err != nil {
+		return r, err
+	}
+
+	for i := range r {
+		r[i].Permissions = []string{}
+		for _, p := range perms {
+			if p.Role == r[i].Name {
+				r[i].Permissions = append(r[i].Permissions, p.Permission)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// CreateRole inserts the role along with its permissions
+func (m *MySQLStore) CreateRole(context context.Context, role models.Role, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(context, "INSERT INTO roles (name, description, mfa_required) VALUES (:name, :description, :mfa_required)",
+			role)
+		if err != nil {
+			return err
+		}
+
+		return setRolePermissions(context, tx, role.Name, role.Permissions)
+	})
+}
+
+func (m *MySQLStore) ListPermissions(context context.Context) ([]models.Permission, error) {
+	var p []models.Permission
+	err := m.DB.SelectContext(context, &p, "SELECT name, description FROM permissions ORDER BY name")
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+// SetRolePermissions replaces every permission attached to the role. The
+// roles holding the guarded permission are locked first, and the change is
+// refused with models.ErrNoUserManager if afterwards none of them is held by
+// anyone who can log in.
+func (m *MySQLStore) SetRolePermissions(context context.Context, role string, permissions []string, guarded string, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		var holders []string
+		err := tx.SelectContext(context, &holders, "SELECT role FROM role_permissions WHERE permission = ? FOR UPDATE",
+			guarded)
+		if err != nil {
+			return err
+		}
+
+		err = setRolePermissions(context, tx, role, permissions)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(holders, role) || slices.Contains(permissions, guarded) {
+			return nil
+		}
+
+		var held bool
+		err = tx.GetContext(context, &held, `
+            SELECT EXISTS (
+                SELECT 1 FROM role_permissions rp
+                JOIN user_roles ur ON ur.role = rp.role
+                JOIN users u ON u.id = ur.user_id
+                WHERE rp.permission = ? AND ur.course_id = '' AND u.kind = 'human' AND u.deleted_at IS NULL)`,
+			guarded)
+		if err != nil {
+			return err
+		}
+		if !held {
+			return models.ErrNoUserManager
+		}
+		return nil
+	})
+}
+
+func setRolePermissions(context context.Context, tx *sqlx.Tx, role string, permissions []string) error {
+	_, err := tx.ExecContext(context, "DELETE FROM role_permissions WHERE role = ?", role)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range permissions {
+		_, err = tx.ExecContext(context, "INSERT INTO role_permissions (role, permission) VALUES (?, ?)", role, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *MySQLStore) GetUserRoles(context context.Context, userID int) ([]models.UserRole, error) {
+	var roles []models.UserRole
+	err := m.DB.SelectContext(context, &roles, "SELECT * FROM user_roles WHERE user_id = ? ORDER BY role, course_id", userID)
+	if err != nil {
+		return roles, err
+	}
+
+	return roles, nil
+}
+
+// GetUserGrants returns every permission the user holds through their roles
+func (m *MySQLStore) GetUserGrants(context context.Context, userID int) ([]models.PermissionGrant, error) {
+	var grants []models.PermissionGrant
+	err := m.DB.SelectContext(context, &grants, `
+        SELECT rp.permission, ur.course_id
+        FROM user_roles ur
+        JOIN role_permissions rp ON rp.role = ur.role
+        WHERE ur.user_id = ?`, userID)
+	if err != nil {
+		return grants, err
+	}
+
+	return grants, nil
+}
+
+func (m *MySQLStore) GrantRole(context context.Context, role models.UserRole, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(context, "INSERT IGNORE INTO user_roles (user_id, role, course_id, granted_by) VALUES (:user_id, :role, :course_id, :granted_by)",
+			role)
+		return err
+	})
+}
+
+// RevokeRole removes a role from a user. Platform-wide admins are locked and
+// counted first, returning models.ErrLastAdmin rather than demoting the last
+// one, so concurrent revokes can't leave none.
+func (m *MySQLStore) RevokeRole(context context.Context, userID int, role, courseID string, event models.AuditEvent) error {
+	return m.audited(context, &event, func(tx *sqlx.Tx) error {
+		if role == models.RoleAdmin && courseID == "" {
+			var admins []int
+			err := tx.SelectContext(context, &admins, `
+                SELECT ur.user_id FROM user_roles ur
+                JOIN users u ON u.id = ur.user_id
+                WHERE ur.role = ? AND ur.course_id = '' AND u.kind = 'human'
+                FOR UPDATE`, models.RoleAdmin)
+			if err != nil {
+				return err
+			}
+			if len(admins) <= 1 && slices.Contains(admins, userID) {
+				return models.ErrLastAdmin
+			}
+		}
+
+		_, err := tx.ExecContext(context, "DELETE FROM user_roles WHERE user_id = ? AND role = ? AND course_id = ?",
+			userID, role, courseID)
+		return err
+	})
+}
+
+// CountUsersWithRole counts the people holding a platform-wide role. Service
+// accounts aren't counted, since nobody can log in as them.
+func (m *MySQLStore) CountUsersWithRole(context context.Context, role string) (int, error) {
+	var count int
+	err := m.DB.GetContext(context, &count, `
+        SELECT COUNT(*) FROM user_roles ur
+        JOIN users u ON u.id = ur.user_id
+        WHERE ur.role = ? AND ur.course_id = '' AND u.kind = 'human'`, role)
+	return count, err
+}
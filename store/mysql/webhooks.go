@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fintech/store/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateWebhookEvent stores the event unless the gateway delivered it
+// before, reporting whether it was new
+func (m *MySQLStore) CreateWebhookEvent(context context.Context, e models.WebhookEvent) (bool, error) {
+	result, err := m.DB.NamedExecContext(context, `
+        INSERT IGNORE INTO webhook_events (gateway, event_id, event_type, payload)
+        VALUES (:gateway, :event_id, :event_type, :payload)`,
+		e)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (m *MySQLStore) GetWebhookEvent(context context.Context, id int64) (models.WebhookEvent, error) {
+	var e models.WebhookEvent
+	err := m.DB.GetContext(context, &e, "SELECT * FROM webhook_events WHERE id = ?", id)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// ListWebhookEvents lists events newest first, without their payloads
+func (m *MySQLStore) ListWebhookEvents(context context.Context, status string, limit, offset int) ([]models.WebhookEvent, error) {
+	query := `SELECT id, gateway, event_id, event_type, '' AS payload, status, attempts, last_error,
+            next_attempt_at, received_at, processed_at
+        FROM webhook_events WHERE 1 = 1`
+	var args []interface{}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	e := []models.WebhookEvent{}
+	err := m.DB.SelectContext(context, &e, query, args...)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// ClaimWebhookEvents returns pending events that are due, pushing their next
+// attempt back by lease so other workers leave them alone meanwhile. Events
+// whose worker died are picked up again once the lease runs out.
+func (m *MySQLStore) ClaimWebhookEvents(context context.Context, lease time.Duration, limit int) ([]models.WebhookEvent, error) {
+	tx, err := m.DB.BeginTxx(context, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var events []models.WebhookEvent
+	err = tx.SelectContext(context, &events, `
+        SELECT * FROM webhook_events
+        WHERE status = ? AND next_attempt_at <= ?
+        ORDER BY next_attempt_at, id LIMIT ?
+        FOR UPDATE SKIP LOCKED`,
+		models.WebhookPending, now, limit)
+	if err != nil || len(events) == 0 {
+		return events, err
+	}
+
+	ids := make([]int64, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	query, args, err := sqlx.In("UPDATE webhook_events SET next_attempt_at = ? WHERE id IN (?)", now.Add(lease), ids)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(context, tx.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	return events, tx.Commit()
+}
+
+// CompleteWebhookEvent marks the event processed or ignored
+func (m *MySQLStore) CompleteWebhookEvent(context context.Context, id int64, status string) error {
+	_, err := m.DB.ExecContext(context, "UPDATE webhook_events SET status = ?, last_error = '', processed_at = ? WHERE id = ?",
+		status, time.Now(), id)
+	return err
+}
+
+// FailWebhookEvent records a failed attempt. The event is retried at retryAt,
+// or marked failed when that is nil.
+func (m *MySQLStore) FailWebhookEvent(context context.Context, id int64, reason string, retryAt *time.Time) error {
+	status := models.WebhookPending
+	if retryAt == nil {
+		status = models.WebhookFailed
+	}
+	_, err := m.DB.ExecContext(context, `
+        UPDATE webhook_events
+        SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+        WHERE id = ?`,
+		status, reason, retryAt, id)
+	return err
+}
+
+// ReplayWebhookEvent queues a failed event to be applied again from scratch,
+// reporting whether it had failed
+func (m *MySQLStore) ReplayWebhookEvent(context context.Context, id int64, event models.AuditEvent) (bool, error) {
+	err := m.audited(context, &event, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(context, `
+            UPDATE webhook_events
+            SET status = ?, attempts = 0, next_attempt_at = ?
+            WHERE id = ? AND status = ?`,
+			models.WebhookPending, time.Now(), id, models.WebhookFailed)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -7,25 +7,201 @@ import (
 )
 
 type Store interface {
+	GetUser(context context.Context, id int) (models.User, error)
 	GetUserByPhoneNumber(context context.Context, phoneNumber string) (models.User, error)
-	CreateUser(context context.Context, phoneNumber, otp string, otpExpiry time.Time, role string) error
-	UpdateOTP(context context.Context, phoneNumber string, code string, expiry time.Time) error
+	CreateUser(context context.Context, phoneNumber, otpHash string, otpExpiry time.Time) error
+	UpdateOTP(context context.Context, phoneNumber string, otpHash string, expiry time.Time) error
+	ConsumeOTP(context context.Context, userID int, otpHash string) (bool, error)
 
-	CreateCourse(context context.Context, course models.Course) error
-	UpdateCourse(context context.Context, course models.Course) error
+	UpdateProfile(context context.Context, userID int, name, locale string) error
+	SetPendingEmail(context context.Context, userID int, email, codeHash string, expiry time.Time) error
+	VerifyEmail(context context.Context, userID int, codeHash string) (bool, error)
+	ClearPendingEmail(context context.Context, userID int) error
+	SetAvatar(context context.Context, userID int, key string) error
+	GetUserSummaries(context context.Context, ids []int) (map[int]models.UserSummary, error)
+	ListPhoneNumbers(context context.Context) ([]models.User, error)
+	ScheduleUserDeletion(context context.Context, userID int, at *time.Time) error
+	ListUsersDueForDeletion(context context.Context, now time.Time) ([]models.User, error)
+	PurgeUser(context context.Context, userID int, now time.Time, event models.AuditEvent) ([]string, error)
+	MergeUsers(context context.Context, keepID int, mergeIDs []int, phoneNumber string) error
+
+	GetUserMFA(context context.Context, userID int) (models.UserMFA, error)
+	StartMFAEnrollment(context context.Context, userID int, secret string) error
+	ConfirmMFAEnrollment(context context.Context, userID int, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(context context.Context, userID int, step int64) (bool, error)
+	DeleteUserMFA(context context.Context, userID int, event models.AuditEvent) error
+	ReplaceRecoveryCodes(context context.Context, userID int, codeHashes []string) error
+	UseRecoveryCode(context context.Context, userID int, codeHash string) (bool, error)
+	CountRecoveryCodes(context context.Context, userID int) (int, error)
+	MFARequired(context context.Context, userID int) (bool, error)
+	SetRoleMFARequired(context context.Context, role string, required bool, event models.AuditEvent) error
+	CreateMFAChallenge(context context.Context, challenge models.MFAChallenge) error
+	GetMFAChallenge(context context.Context, tokenHash string) (models.MFAChallenge, error)
+	ConsumeMFAChallenge(context context.Context, tokenHash string) (bool, error)
+
+	CreateServiceAccount(context context.Context, name string, roles []string, grantedBy int, event models.AuditEvent) (int, error)
+	CreateAPIKey(context context.Context, key models.APIKey, event models.AuditEvent) (int, error)
+	GetAPIKeyByPrefix(context context.Context, prefix string) (models.APIKey, error)
+	ListAPIKeys(context context.Context, userID int) ([]models.APIKey, error)
+	RevokeAPIKey(context context.Context, userID, keyID int, event models.AuditEvent) (bool, error)
+	TouchAPIKey(context context.Context, keyID int, ip string) error
+
+	CreateAuditEvent(context context.Context, event models.AuditEvent) error
+	ListAuditEvents(context context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+	ListAuditChain(context context.Context, afterID int64, limit int) ([]models.AuditEvent, error)
+	GetAuditChainHead(context context.Context) (string, error)
+
+	CreateDataExport(context context.Context, export models.DataExport) error
+	GetDataExport(context context.Context, userID int, id string) (models.DataExport, error)
+	ListDataExports(context context.Context, userID int) ([]models.DataExport, error)
+	CompleteDataExport(context context.Context, id, storageKey string, expiresAt time.Time) error
+	FailDataExport(context context.Context, id, reason string) error
+	ListExpiredDataExports(context context.Context, now time.Time) ([]models.DataExport, error)
+	DeleteDataExport(context context.Context, id string) error
+	ListUserMessages(context context.Context, userID int) ([]models.Message, error)
+
+	CreateOIDCState(context context.Context, state models.OIDCState) error
+	ConsumeOIDCState(context context.Context, stateHash string) (models.OIDCState, error)
+	GetUserIdentity(context context.Context, provider, subject string) (models.UserIdentity, error)
+	ListUserIdentities(context context.Context, userID int) ([]models.UserIdentity, error)
+	CreateUserIdentity(context context.Context, identity models.UserIdentity) error
+	TouchUserIdentity(context context.Context, id int, email string) error
+	DeleteUserIdentity(context context.Context, userID int, provider string) (bool, error)
+	GetUserByEmail(context context.Context, email string) (models.User, error)
+	CreateIdentityUser(context context.Context, user models.User, identity models.UserIdentity) (int, error)
+
+	GetOTPAttempt(context context.Context, scope, subject string) (models.OTPAttempt, error)
+	RecordOTPFailure(context context.Context, scope, subject string, window time.Duration, maxAttempts int, baseLockout, maxLockout time.Duration) error
+	ResetOTPAttempts(context context.Context, scope, subject string) error
+
+	ListUsers(context context.Context, filter models.UserFilter) ([]models.UserWithRoles, error)
+	ListRoles(context context.Context) ([]models.Role, error)
+	CreateRole(context context.Context, role models.Role, event models.AuditEvent) error
+	ListPermissions(context context.Context) ([]models.Permission, error)
+	SetRolePermissions(context context.Context, role string, permissions []string, guarded string, event models.AuditEvent) error
+	GetUserRoles(context context.Context, userID int) ([]models.UserRole, error)
+	GetUserGrants(context context.Context, userID int) ([]models.PermissionGrant, error)
+	GrantRole(context context.Context, role models.UserRole, event models.AuditEvent) error
+	RevokeRole(context context.Context, userID int, role, courseID string, event models.AuditEvent) error
+	CountUsersWithRole(context context.Context, role string) (int, error)
+
+	CreateAuthSession(context context.Context, session models.AuthSession, token models.RefreshToken, maxDevices int) error
+	CreateImpersonationSession(context context.Context, session models.AuthSession) error
+	GetAuthSession(context context.Context, id string) (models.AuthSession, error)
+	ListUserAuthSessions(context context.Context, userID int) ([]models.AuthSession, error)
+	TouchAuthSession(context context.Context, id, ip string) error
+	GetRefreshToken(context context.Context, tokenHash string) (models.RefreshToken, error)
+	RotateRefreshToken(context context.Context, usedID int, next models.RefreshToken) (bool, error)
+	RevokeAuthSession(context context.Context, id, reason string) error
+	RevokeUserAuthSession(context context.Context, userID int, id, reason string) (bool, error)
+	RevokeUserAuthSessions(context context.Context, userID int, reason string) error
+	SetUserMaxDevices(context context.Context, userID int, maxDevices *int, event models.AuditEvent) error
+
+	CreateOTPDelivery(context context.Context, delivery models.OTPDelivery) error
+	UpdateOTPDeliveryStatus(context context.Context, provider, providerMessageID, status, deliveryError string) error
+
+	CreateCourse(context context.Context, course models.Course, event models.AuditEvent) error
+	UpdateCourse(context context.Context, course models.Course, event models.AuditEvent) error
 	ListCourse(context context.Context) ([]models.Course, error)
+	ListCoursesByID(context context.Context, ids []string) ([]models.Course, error)
 	GetCourse(context context.Context, id string) (models.Course, error)
-	DeleteCourse(context context.Context, id string) error
+	DeleteCourse(context context.Context, id string, event models.AuditEvent) error
+
+	ListCourseInstructors(context context.Context, courseID string) ([]models.CourseInstructor, error)
+	GetCourseInstructor(context context.Context, courseID string, userID int) (models.CourseInstructor, error)
+	AddCourseInstructor(context context.Context, instructor models.CourseInstructor, event models.AuditEvent) error
+	ActivateCourseInstructor(context context.Context, courseID string, userID int, event models.AuditEvent) (bool, error)
+	RemoveCourseInstructor(context context.Context, courseID string, userID int, event models.AuditEvent) error
+
+	GetEnrollment(context context.Context, userID int, courseID string) (models.Enrollment, error)
+	ListUserEnrollments(context context.Context, userID int) ([]models.Enrollment, error)
+	ListCourseEnrollments(context context.Context, courseID string, limit, offset int) ([]models.Enrollment, error)
+	Enroll(context context.Context, enrollment models.Enrollment) error
+	CancelEnrollment(context context.Context, userID int, courseID string) (bool, error)
+	EnrollUsers(context context.Context, enrollments []models.Enrollment, event models.AuditEvent) error
+	CancelEnrollments(context context.Context, courseID string, userIDs []int, event models.AuditEvent) (int64, error)
+
+	CreateCoupon(context context.Context, coupon models.Coupon, event models.AuditEvent) (int64, error)
+	UpdateCoupon(context context.Context, coupon models.Coupon, event models.AuditEvent) error
+	GetCoupon(context context.Context, id int64) (models.Coupon, error)
+	GetCouponsByCode(context context.Context, codes []string) ([]models.Coupon, error)
+	ListCoupons(context context.Context, limit, offset int) ([]models.Coupon, error)
+	GetCouponUsage(context context.Context, couponID int64, userID int) (models.CouponUsage, error)
+	ListCouponRedemptions(context context.Context, couponID int64, limit, offset int) ([]models.CouponRedemption, error)
+
+	CreateOrder(context context.Context, order models.Order, redemptions []models.CouponRedemption) error
+	GetOrder(context context.Context, id string) (models.Order, error)
+	GetOrderByGatewayID(context context.Context, gateway, gatewayOrderID string) (models.Order, error)
+	ListUserOrders(context context.Context, userID int) ([]models.Order, error)
+	MarkOrderPaid(context context.Context, id, paymentID string, entry models.JournalEntry, invoice models.Invoice) (bool, error)
+	VoidOrder(context context.Context, id, paymentID string) (bool, error)
+	FailOrder(context context.Context, id string) (bool, error)
+	FulfillOrder(context context.Context, order models.Order) (bool, error)
+
+	SaveVideoProgress(context context.Context, progress models.VideoProgress) error
+	ListCourseProgress(context context.Context, userID int, courseID string) ([]models.VideoProgress, error)
+	ListUserProgress(context context.Context, userID int) ([]models.VideoProgress, error)
+	CountWatchedVideos(context context.Context, userID int, courseID string) (int, error)
+
+	CreateRefund(context context.Context, refund models.Refund, event models.AuditEvent) error
+	GetRefund(context context.Context, id string) (models.Refund, error)
+	ListOrderRefunds(context context.Context, orderID string) ([]models.Refund, error)
+	ListUserRefunds(context context.Context, userID int) ([]models.Refund, error)
+	ListRefunds(context context.Context, status string, limit, offset int) ([]models.Refund, error)
+	ApproveRefund(context context.Context, id string, reviewerID int, note string, event models.AuditEvent) (bool, error)
+	RejectRefund(context context.Context, id string, reviewerID int, note string, event models.AuditEvent) (bool, error)
+	ReclaimRefund(context context.Context, id string, stale time.Time, event models.AuditEvent) (bool, error)
+	FailRefund(context context.Context, id, reason string) error
+	CompleteRefund(context context.Context, refund models.Refund, gatewayRefundID string, accessUntil *time.Time, entry models.JournalEntry, taxes models.GSTAmounts) (models.CreditNote, error)
+	GetCreditNoteByRefund(context context.Context, refundID string) (models.CreditNote, error)
+	SetCreditNoteKey(context context.Context, id int64, storageKey string) error
+
+	GetInvoiceByOrder(context context.Context, orderID string) (models.Invoice, error)
+	ListUserInvoices(context context.Context, userID int) ([]models.Invoice, error)
+	SetInvoiceKey(context context.Context, id int64, storageKey string) error
+	GetBillingProfile(context context.Context, userID int) (models.BillingProfile, error)
+	SaveBillingProfile(context context.Context, profile models.BillingProfile) error
+
+	PostJournalEntry(context context.Context, entry models.JournalEntry) (int64, error)
+	GetJournalEntry(context context.Context, id int64) (models.JournalEntry, error)
+	GetJournalEntryByReference(context context.Context, kind, reference string) (models.JournalEntry, error)
+	SumLedger(context context.Context, filter models.LedgerFilter) ([]models.AccountBalance, error)
+	ListStatementLines(context context.Context, filter models.LedgerFilter) ([]models.StatementLine, error)
+	SumMaturedLedger(context context.Context, prefix string, cutoff time.Time) ([]models.AccountBalance, error)
+
+	SetRevenueShares(context context.Context, courseID string, shares []models.RevenueShare, startsAt time.Time, event models.AuditEvent) error
+	GetRevenueShares(context context.Context, courseID string, at time.Time) ([]models.RevenueShare, error)
+	ListRevenueShares(context context.Context, courseID string) ([]models.RevenueShare, error)
+	GetPayoutAccount(context context.Context, userID int) (models.PayoutAccount, error)
+	SavePayoutAccount(context context.Context, account models.PayoutAccount, event models.AuditEvent) error
+	ListPayoutAccounts(context context.Context, userIDs []int) (map[int]models.PayoutAccount, error)
+	CreatePayoutBatch(context context.Context, batch models.PayoutBatch, payouts []models.Payout, entry models.JournalEntry, event models.AuditEvent) error
+	GetPayoutBatch(context context.Context, id string) (models.PayoutBatch, error)
+	ListPayoutBatches(context context.Context, status string, limit, offset int) ([]models.PayoutBatch, error)
+	ListUserPayouts(context context.Context, userID int) ([]models.Payout, error)
+	ApprovePayoutBatch(context context.Context, id string, approverID int, event models.AuditEvent) (bool, error)
+	SettlePayoutBatch(context context.Context, id string, settlerID int, reference string, entry models.JournalEntry, event models.AuditEvent) (bool, error)
+	CancelPayoutBatch(context context.Context, id string, entry models.JournalEntry, event models.AuditEvent) (bool, error)
+
+	CreateWebhookEvent(context context.Context, event models.WebhookEvent) (bool, error)
+	GetWebhookEvent(context context.Context, id int64) (models.WebhookEvent, error)
+	ListWebhookEvents(context context.Context, status string, limit, offset int) ([]models.WebhookEvent, error)
+	ClaimWebhookEvents(context context.Context, lease time.Duration, limit int) ([]models.WebhookEvent, error)
+	CompleteWebhookEvent(context context.Context, id int64, status string) error
+	FailWebhookEvent(context context.Context, id int64, reason string, retryAt *time.Time) error
+	ReplayWebhookEvent(context context.Context, id int64, event models.AuditEvent) (bool, error)
 
-	CreateFolder(context context.Context, folder models.Folder) error
-	UpdateFolder(context context.Context, folder models.Folder) error
+	CreateFolder(context context.Context, folder models.Folder, event models.AuditEvent) error
+	UpdateFolder(context context.Context, folder models.Folder, event models.AuditEvent) error
 	ListFolder(context context.Context) ([]models.Folder, error)
 	GetFolder(context context.Context, id string) (models.Folder, error)
-	DeleteFolder(context context.Context, id string) error
+	DeleteFolder(context context.Context, id string, event models.AuditEvent) error
 
 	GetOrCreateSession(context context.Context, message models.Message) (int, error)
 	AddMessage(context context.Context, message models.Message) error
 	GetChatSessions(context context.Context, userID int) ([]models.ChatSession, error)
+	GetChatSession(context context.Context, id int) (models.ChatSession, error)
+	CanChat(context context.Context, userID, otherID int, now time.Time) (bool, error)
 	GetChatSessionsMessages(context context.Context, sessionID int) ([]models.Message, error)
 	MarkChatSessionsAsRead(context context.Context, ChatSessionID int) error
 }
@@ -1,40 +1,80 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-var jwtSecretKey = []byte(os.Getenv("JWT_SECRET"))
-
-// Claims defines the structure of the JWT claims, including phone number and role
+// Claims defines the structure of the JWT claims. Roles are deliberately not
+// carried in the token so role changes apply on the next request.
 type Claims struct {
 	UserID      int    `json:"user_id"`
 	PhoneNumber string `json:"phone_number"`
-	Role        string `json:"role"`
+	SessionID   string `json:"sid"`
+	// ActorID is the admin acting as UserID in impersonation tokens
+	ActorID int `json:"actor_id,omitempty"`
 	jwt.StandardClaims
 }
 
-// GenerateJWT generates a new JWT token with the phone number and role
-func GenerateJWT(userID int, phoneNumber, role string) (string, error) {
+// AccessTokenTTL is how long an access token is valid, from ACCESS_TOKEN_TTL
+func AccessTokenTTL() time.Duration {
+	return envDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL is how long a refresh token is valid, from REFRESH_TOKEN_TTL
+func RefreshTokenTTL() time.Duration {
+	return envDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// MaxDevices is how many sessions a user may have at once unless an admin
+// set a limit for them, from MAX_DEVICES. Zero means no limit.
+func MaxDevices() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_DEVICES")); err == nil && v >= 0 {
+		return v
+	}
+	return 0
+}
+
+// GenerateJWT generates a new short-lived JWT token bound to a session
+func GenerateJWT(userID int, phoneNumber, sessionID string) (string, error) {
+	claims := &Claims{
+		UserID:      userID,
+		PhoneNumber: phoneNumber,
+		SessionID:   sessionID,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(AccessTokenTTL()).Unix(),
+		},
+	}
+
+	return signToken(claims)
+}
+
+// GenerateImpersonationJWT generates a token that lets actorID act as userID
+// until the impersonation session expires
+func GenerateImpersonationJWT(userID, actorID int, phoneNumber, sessionID string, expiresAt time.Time) (string, error) {
 	claims := &Claims{
 		UserID:      userID,
 		PhoneNumber: phoneNumber,
-		Role:        role,
+		SessionID:   sessionID,
+		ActorID:     actorID,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(), // Token expires in 24 hours
+			ExpiresAt: expiresAt.Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecretKey)
+	return signToken(claims)
 }
 
-// VerifyJWT verifies the JWT token and extracts the phone number and role
+// VerifyJWT verifies the JWT token and extracts its claims
 func VerifyJWT(t string) (Claims, error) {
 	claims := &Claims{}
 
@@ -45,18 +85,35 @@ func VerifyJWT(t string) (Claims, error) {
 	tokenString := ts[1]
 
 	// Parse the token
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Check that the signing method is what we expect
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return jwtSecretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey)
 
 	if err != nil || !token.Valid {
 		return Claims{}, errors.New("invalid or expired token")
 	}
 
-	// Return both the phone number and role
 	return *claims, nil
 }
+
+// GenerateRefreshToken returns a random opaque refresh token and the hash to store
+func GenerateRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken hashes an opaque token for storage and lookup
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
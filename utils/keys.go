@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningKey is one key in the JWT key set. Keys without a private half are
+// only used to verify tokens signed before a rotation.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet holds the key new tokens are signed with and every key still
+// accepted for verification, indexed by kid
+type KeySet struct {
+	signing *SigningKey
+	byID    map[string]*SigningKey
+}
+
+var keys *KeySet
+
+// ErrNoSigningKey is returned when no JWT signing key has been configured
+var ErrNoSigningKey = errors.New("no JWT signing key configured")
+
+// LoadKeysFromEnv loads the JWT key set and must be called before any token
+// is issued or verified.
+//
+// JWT_KEYS is a comma separated list of kid=path entries pointing at PEM
+// encoded RSA or Ed25519 keys, private or public. JWT_SIGNING_KEY_ID picks
+// the key used to sign, defaulting to the first private key. Setting
+// JWT_EPHEMERAL_KEY=true generates a throwaway Ed25519 key for development.
+func LoadKeysFromEnv() error {
+	set := &KeySet{byID: map[string]*SigningKey{}}
+	var order []string
+
+	for _, entry := range strings.Split(os.Getenv("JWT_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok || kid == "" || path == "" {
+			return fmt.Errorf("invalid JWT_KEYS entry %q, expected kid=path", entry)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT key %s: %v", kid, err)
+		}
+		key, err := ParseSigningKey(kid, data)
+		if err != nil {
+			return err
+		}
+		set.byID[kid] = key
+		order = append(order, kid)
+	}
+
+	if os.Getenv("JWT_EPHEMERAL_KEY") == "true" {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		set.byID["ephemeral"] = &SigningKey{ID: "ephemeral", Method: SigningMethodEdDSA, Private: private, Public: private.Public()}
+		order = append(order, "ephemeral")
+	}
+
+	signingID := os.Getenv("JWT_SIGNING_KEY_ID")
+	if signingID == "" {
+		for _, kid := range order {
+			if set.byID[kid].Private != nil {
+				signingID = kid
+				break
+			}
+		}
+	}
+
+	signing, ok := set.byID[signingID]
+	if !ok || signing.Private == nil {
+		return ErrNoSigningKey
+	}
+	set.signing = signing
+
+	keys = set
+	return nil
+}
+
+// ParseSigningKey parses a PEM encoded RSA or Ed25519 key, private or public
+func ParseSigningKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("JWT key %s is not PEM encoded", kid)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("JWT key %s has unsupported PEM type %q", kid, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT key %s: %v", kid, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Private: k, Public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Public: k}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: kid, Method: SigningMethodEdDSA, Private: k, Public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{ID: kid, Method: SigningMethodEdDSA, Public: k}, nil
+	default:
+		return nil, fmt.Errorf("JWT key %s must be an RSA or Ed25519 key", kid)
+	}
+}
+
+// signToken signs the claims with the active key and tags them with its kid
+func signToken(claims jwt.Claims) (string, error) {
+	if keys == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(keys.signing.Method, claims)
+	token.Header["kid"] = keys.signing.ID
+	return token.SignedString(keys.signing.Private)
+}
+
+// verificationKey finds the public key a token claims to be signed with
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if keys == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := keys.byID[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	// Never let the token pick the algorithm a key is used with
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key.Public, nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every verification key so other services can check our tokens
+func JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if keys == nil {
+		return set
+	}
+
+	for _, key := range keys.byID {
+		jwk := JWK{KeyID: key.ID, Algorithm: key.Method.Alg(), Use: "sig"}
+		switch k := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}